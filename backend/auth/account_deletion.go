@@ -0,0 +1,107 @@
+// Package auth provides functions useful for using authentication in this API.
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/soumitradev/Dwitter/backend/common"
+	"github.com/soumitradev/Dwitter/backend/prisma/db"
+	"github.com/soumitradev/Dwitter/backend/subscriptions"
+	"github.com/soumitradev/Dwitter/backend/util"
+)
+
+// How long a deleted account can still be brought back by logging in
+var accountDeletionGracePeriod = time.Hour * 24 * 14
+
+// How often accounts whose grace period is over are looked for
+var AccountDeletionSweepInterval = time.Minute * 10
+
+// Read ACCOUNT_DELETION_GRACE_DAYS
+func initAccountDeletion() {
+	days, err := strconv.Atoi(os.Getenv("ACCOUNT_DELETION_GRACE_DAYS"))
+	if err == nil && days >= 0 {
+		accountDeletionGracePeriod = time.Hour * 24 * time.Duration(days)
+	}
+}
+
+// Schedule the deletion of an account after the grace period, and log it out everywhere.
+// The user has to send their password again, and a code if they use two-factor authentication.
+func ScheduleAccountDeletion(username string, password string, code string, ip string) (time.Time, error) {
+	user, err := common.Client.User.FindUnique(
+		db.User.Username.Equals(username),
+	).Exec(common.BaseCtx)
+	if err == db.ErrNotFound {
+		return time.Time{}, fmt.Errorf("user not found: %v", err)
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("internal server error: %v", err)
+	}
+
+	// Accounts made with OAuth have a random password nobody knows
+	if !user.PasswordSet {
+		return time.Time{}, errors.New("set a password with a password reset before deleting your account")
+	}
+	err = checkPassword(username, password, ip)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if user.TwoFactorEnabled {
+		err = checkSecondFactor(username, code, ip)
+		if err != nil {
+			return time.Time{}, err
+		}
+	}
+
+	deleteAt := time.Now().UTC().Add(accountDeletionGracePeriod)
+	_, err = common.Client.User.FindUnique(
+		db.User.Username.Equals(username),
+	).Update(
+		db.User.DeletionScheduledAt.Set(deleteAt),
+	).Exec(common.BaseCtx)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("internal server error: %v", err)
+	}
+
+	err = RevokeAllSessions(username)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	err = subscriptions.SendEmail("Your Dwitter account will be deleted", "Your Dwitter account "+username+" will be deleted on "+deleteAt.Format(util.TimeUTCFormat)+".\nLog in before then if you want to keep it.", user.Email)
+	if err != nil {
+		fmt.Printf("Error sending account deletion notice: %v\n", err)
+	}
+	return deleteAt, nil
+}
+
+// Cancel the scheduled deletion of an account, because its owner logged back in
+func cancelAccountDeletion(user *db.UserModel) error {
+	if _, scheduled := user.DeletionScheduledAt(); !scheduled {
+		return nil
+	}
+
+	_, err := common.Client.User.FindUnique(
+		db.User.Username.Equals(user.Username),
+	).Update(
+		db.User.DeletionScheduledAt.SetOptional(nil),
+	).Exec(common.BaseCtx)
+	return err
+}
+
+// Get the accounts whose grace period is over.
+// Only one server gets them at a time, the others get nothing until the next sweep.
+func DueAccountDeletions() ([]db.UserModel, error) {
+	locked, err := common.RedisDB.SetNX(common.BaseCtx, "deletion:sweep", "1", AccountDeletionSweepInterval).Result()
+	if err != nil || !locked {
+		return nil, err
+	}
+
+	return common.Client.User.FindMany(
+		db.User.DeletionScheduledAt.Before(time.Now().UTC()),
+	).Exec(common.BaseCtx)
+}
@@ -6,21 +6,16 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"net/http"
-	"os"
-	"strings"
+	"strconv"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/soumitradev/Dwitter/backend/common"
 	"github.com/soumitradev/Dwitter/backend/prisma/db"
 	"github.com/soumitradev/Dwitter/backend/util"
-
-	"github.com/golang/gddo/httputil/header"
 )
 
-var authDB *redis.Client
 var sessionTTL = time.Hour * 24
 
 // A SessionType stores info for a session
@@ -34,14 +29,12 @@ type SessionType struct {
 type loginType struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+	Device   string `json:"device"`
 }
 
 func InitAuth() {
-	authDB = redis.NewClient(&redis.Options{
-		Addr:     "localhost:6420",
-		Password: os.Getenv("REDIS_6420_PASS"),
-		DB:       0,
-	})
+	initAccountDeletion()
+	initTrustedProxies()
 }
 
 // Extract session from cookie
@@ -66,43 +59,71 @@ func ParseCookie(cookieString string) SessionType {
 	return session
 }
 
-func generateSession(username string, password string) (SessionType, error) {
-	authenticated, err := common.CheckCreds(username, password)
-	if authenticated {
-		sid := util.GenID(20)
-		_, err := authDB.Get(common.BaseCtx, sid).Result()
-		for err == nil {
-			sid = util.GenID(20)
-			_, err = authDB.Get(common.BaseCtx, sid).Result()
-		}
-		if err != redis.Nil {
-			return SessionType{}, err
-		}
-		session := SessionType{
-			Username: username,
-			Sid:      sid,
-			Expires:  time.Now().UTC().Add(sessionTTL),
-		}
+// Create a session for a user that has already been authenticated
+func createSession(username string, device string, r *http.Request) (SessionType, error) {
+	user, err := common.Client.User.FindUnique(
+		db.User.Username.Equals(username),
+	).Exec(common.BaseCtx)
+	if err != nil {
+		return SessionType{}, err
+	}
 
-		// Convert struct into a hashmap
-		sessionMap := make(map[string]string)
-		sessionMap["username"] = session.Username
-		sessionMap["sid"] = session.Sid
-		sessionMap["expires"] = session.Expires.UTC().Format(util.TimeUTCFormat)
+	// Logging back in keeps an account that was going to be deleted
+	err = cancelAccountDeletion(user)
+	if err != nil {
+		return SessionType{}, err
+	}
 
-		err = authDB.HSet(common.BaseCtx, sid, sessionMap).Err()
-		if err != nil {
-			return SessionType{}, err
-		}
-		err = authDB.PExpireAt(common.BaseCtx, sid, session.Expires).Err()
-		if err != nil {
-			return SessionType{}, err
-		}
+	sid := util.GenID(20)
+	_, err = common.RedisDB.Get(common.BaseCtx, sid).Result()
+	for err == nil {
+		sid = util.GenID(20)
+		_, err = common.RedisDB.Get(common.BaseCtx, sid).Result()
+	}
+	if err != redis.Nil {
+		return SessionType{}, err
+	}
+	now := time.Now().UTC()
+	session := SessionType{
+		Username: username,
+		Sid:      sid,
+		Expires:  now.Add(sessionTTL),
+	}
 
-		return session, nil
-	} else {
+	// Describe the device the session was created on
+	userAgent := r.UserAgent()
+	if device == "" {
+		device = deviceFromUserAgent(userAgent)
+	}
+
+	// Convert struct into a hashmap
+	sessionMap := make(map[string]string)
+	sessionMap["username"] = session.Username
+	sessionMap["sid"] = session.Sid
+	sessionMap["expires"] = session.Expires.UTC().Format(util.TimeUTCFormat)
+	sessionMap["id"] = util.GenID(10)
+	sessionMap["device"] = device
+	sessionMap["ip"] = ClientIP(r)
+	sessionMap["userAgent"] = userAgent
+	sessionMap["createdAt"] = now.Format(util.TimeUTCFormat)
+	sessionMap["tokenVersion"] = strconv.Itoa(user.TokenVersion)
+
+	err = common.RedisDB.HSet(common.BaseCtx, sid, sessionMap).Err()
+	if err != nil {
+		return SessionType{}, err
+	}
+	err = common.RedisDB.PExpireAt(common.BaseCtx, sid, session.Expires).Err()
+	if err != nil {
+		return SessionType{}, err
+	}
+
+	// Keep track of the sessions of every user so that they can be listed and revoked
+	err = common.RedisDB.SAdd(common.BaseCtx, userSessionsKey(username), sid).Err()
+	if err != nil {
 		return SessionType{}, err
 	}
+
+	return session, nil
 }
 
 func VerifySessionID(sessionID string) (SessionType, bool, error) {
@@ -112,8 +133,13 @@ func VerifySessionID(sessionID string) (SessionType, bool, error) {
 	}
 
 	// Validate session
-	res, err := authDB.HGetAll(common.BaseCtx, sessionID).Result()
+	res, err := common.RedisDB.HGetAll(common.BaseCtx, sessionID).Result()
 	if err == nil {
+		// A session that was revoked or has expired no longer has a hash
+		if len(res) == 0 {
+			return SessionType{}, false, errors.New("unauthorized")
+		}
+
 		var session SessionType
 		session.Username = res["username"]
 		session.Sid = res["sid"]
@@ -121,12 +147,26 @@ func VerifySessionID(sessionID string) (SessionType, bool, error) {
 		if err != nil {
 			return SessionType{}, false, err
 		}
-		_, err := common.Client.User.FindUnique(
+		user, err := common.Client.User.FindUnique(
 			db.User.Username.Equals(session.Username),
 		).Exec(common.BaseCtx)
 		if err == db.ErrNotFound {
 			return SessionType{}, false, errors.New("user doesn't exist")
 		}
+		if err != nil {
+			return SessionType{}, false, fmt.Errorf("internal server error: %v", err)
+		}
+
+		// Sessions created before the user's token version was bumped are no longer valid
+		if res["tokenVersion"] != strconv.Itoa(user.TokenVersion) {
+			RevokeSession(sessionID)
+			return SessionType{}, false, errors.New("unauthorized")
+		}
+
+		err = common.SuspensionError(user)
+		if err != nil {
+			return SessionType{}, false, err
+		}
 		return session, true, nil
 	} else {
 		return SessionType{}, false, errors.New("unauthorized")
@@ -135,109 +175,39 @@ func VerifySessionID(sessionID string) (SessionType, bool, error) {
 
 // Handles login requests
 func LoginHandler(w http.ResponseWriter, r *http.Request) {
-	// Check if content type is "application/json"
-	if r.Header.Get("Content-Type") != "" {
-		value, _ := header.ParseValueAndParams(r.Header, "Content-Type")
-		if value != "application/json" {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(common.HTTPError{
-				Error: "Content-Type header is not application/json",
-			})
-			return
-		}
-	}
-
-	// Read a maximum of 1MB from body
-	r.Body = http.MaxBytesReader(w, r.Body, 1048576)
-
-	// Create a JSON decoder and decode the request JSON
-	decoder := json.NewDecoder(r.Body)
-	decoder.DisallowUnknownFields()
 	var loginData loginType
-	err := decoder.Decode(&loginData)
+	if !decodeJSONBody(w, r, &loginData) {
+		return
+	}
 
-	// If any error occurred during the decoding, send an appropriate response
+	// Refuse to check the password at all while the username or IP is locked out
+	ip := ClientIP(r)
+	retryAfter, err := loginLockedFor(loginData.Username, ip)
 	if err != nil {
-		var syntaxError *json.SyntaxError
-		var unmarshalTypeError *json.UnmarshalTypeError
-
-		// Return errors based on what error JSON parser returned
-		switch {
-		case errors.As(err, &syntaxError):
-			msg := fmt.Sprintf("Request body contains badly-formed JSON (at position %d)", syntaxError.Offset)
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(common.HTTPError{
-				Error: msg,
-			})
-
-		case errors.Is(err, io.ErrUnexpectedEOF):
-			msg := "Request body contains badly-formed JSON"
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(common.HTTPError{
-				Error: msg,
-			})
-
-		case errors.As(err, &unmarshalTypeError):
-			msg := fmt.Sprintf("Request body contains an invalid value for the %q field (at position %d)", unmarshalTypeError.Field, unmarshalTypeError.Offset)
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(common.HTTPError{
-				Error: msg,
-			})
-
-		case strings.HasPrefix(err.Error(), "json: unknown field "):
-			fieldName := strings.TrimPrefix(err.Error(), "json: unknown field ")
-			msg := fmt.Sprintf("Request body contains unknown field %s", fieldName)
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(common.HTTPError{
-				Error: msg,
-			})
-
-		case errors.Is(err, io.EOF):
-			msg := "Request body must not be empty"
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(common.HTTPError{
-				Error: msg,
-			})
-
-		case err.Error() == "http: request body too large":
-			msg := "Request body must not be larger than 1MB"
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusRequestEntityTooLarge)
-			json.NewEncoder(w).Encode(common.HTTPError{
-				Error: msg,
-			})
-
-		default:
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(common.HTTPError{
-				Error: err.Error(),
-			})
-		}
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("internal server error: %v", err))
 		return
 	}
-
-	// Decode it and check for an external JSON error
-	err = decoder.Decode(&struct{}{})
-	if err != io.EOF {
-		msg := "Request body must only contain a single JSON object"
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(common.HTTPError{
-			Error: msg,
-		})
+	if retryAfter > 0 {
+		writeLockedOut(w, retryAfter)
 		return
 	}
 
-	// After checking for any errors, log the user in, and generate tokens
-	sessionData, err := generateSession(loginData.Username, loginData.Password)
-	if err != nil {
+	// After checking for any errors, check the password
+	authenticated, err := common.CheckCreds(loginData.Username, loginData.Password)
+	if !authenticated {
+		// Count wrong passwords towards a lockout
+		if errors.Is(err, common.ErrBadCredentials) {
+			lockout, lockErr := recordLoginFailure(loginData.Username, ip)
+			if lockErr != nil {
+				writeError(w, http.StatusInternalServerError, fmt.Sprintf("internal server error: %v", lockErr))
+				return
+			}
+			if lockout > 0 {
+				writeLockedOut(w, lockout)
+				return
+			}
+		}
+
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusUnauthorized)
 		json.NewEncoder(w).Encode(common.HTTPError{
@@ -246,9 +216,32 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Base 64 encode the session data because cookies are fuck
-	jsonSession, err := json.Marshal(&sessionData)
-	base64SessionString := base64.StdEncoding.EncodeToString(jsonSession)
+	// Users with two-factor authentication need to send a code before they get a session
+	user, err := common.Client.User.FindUnique(
+		db.User.Username.Equals(loginData.Username),
+	).Exec(common.BaseCtx)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("internal server error: %v", err))
+		return
+	}
+	if user.TwoFactorEnabled {
+		createTwoFactorChallenge(w, loginData.Username, loginData.Device)
+		return
+	}
+	clearLoginFailures(loginData.Username)
+
+	// Log the user in, and generate tokens
+	sessionData, err := createSession(loginData.Username, loginData.Device, r)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("internal server error: %v", err))
+		return
+	}
+	writeSession(w, sessionData)
+}
+
+// Send a new session back in a cookie and as JSON
+func writeSession(w http.ResponseWriter, sessionData SessionType) {
+	err := setSessionCookie(w, sessionData)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusInternalServerError)
@@ -258,7 +251,21 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Send the refresh token in a HTTPOnly cookie
+	// Set the response headers
+	w.Header().Set("Content-Type", "application/json")
+	// Send the access token in JSON
+	json.NewEncoder(w).Encode(sessionData)
+}
+
+// Send a new session back in a HTTPOnly cookie
+func setSessionCookie(w http.ResponseWriter, sessionData SessionType) error {
+	// Base 64 encode the session data because cookies are fuck
+	jsonSession, err := json.Marshal(&sessionData)
+	if err != nil {
+		return err
+	}
+	base64SessionString := base64.StdEncoding.EncodeToString(jsonSession)
+
 	c := http.Cookie{
 		Name:     "session",
 		Value:    base64SessionString,
@@ -266,13 +273,11 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		Secure:   true,
 		Path:     "/",
 		Expires:  sessionData.Expires,
+		SameSite: http.SameSiteLaxMode,
 	}
 	http.SetCookie(w, &c)
-
-	// Set the response headers
-	w.Header().Set("Content-Type", "application/json")
-	// Send the access token in JSON
-	json.NewEncoder(w).Encode(sessionData)
+	setCSRFCookie(w, sessionData)
+	return nil
 }
 
 // Check cookie of request and authenticate
@@ -286,3 +291,47 @@ func Authenticate(authCookie string) (string, error) {
 	username := data.Username
 	return username, nil
 }
+
+// Overwrite the session cookie with an expired one so that the browser drops it
+func ClearSessionCookie(w http.ResponseWriter) {
+	c := http.Cookie{
+		Name:     "session",
+		Value:    "",
+		HttpOnly: true,
+		Secure:   true,
+		Path:     "/",
+		Expires:  time.Unix(0, 0),
+		MaxAge:   -1,
+		SameSite: http.SameSiteLaxMode,
+	}
+	http.SetCookie(w, &c)
+	clearCSRFCookie(w)
+}
+
+// Handles logout requests
+func LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	// Revoke the session the cookie points to, if there is one
+	cookie, _ := r.Cookie("session")
+	if cookie != nil {
+		session := ParseCookie(cookie.Value)
+		err := RevokeSession(session.Sid)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(common.HTTPError{
+				Error: fmt.Sprintf("internal server error: %v", err),
+			})
+			return
+		}
+	}
+
+	// Clear the cookie even if the session was already gone
+	ClearSessionCookie(w)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SessionType{
+		Username: "",
+		Sid:      "",
+		Expires:  time.Unix(0, 0),
+	})
+}
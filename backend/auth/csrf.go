@@ -0,0 +1,133 @@
+// Package auth provides functions useful for using authentication in this API.
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Cookie the CSRF token is sent in, readable by the frontend so that it can send it back
+const CSRFCookieName = "csrf_token"
+
+// Header cookie-authenticated requests that change something need to send the CSRF token in
+const CSRFHeaderName = "X-CSRF-Token"
+
+// Key CSRF tokens are signed with
+var csrfSecret []byte
+
+// Origins allowed to make requests with the session cookie
+var allowedOrigins = map[string]bool{}
+
+var ErrCSRF = errors.New("Unauthorized: missing or invalid CSRF token")
+
+// Read CSRF_SECRET and ALLOWED_ORIGINS.
+// CSRF_SECRET has to be set, and be the same on every server, for a token to be accepted by the server that didn't issue it.
+func InitCSRF() {
+	csrfSecret = []byte(os.Getenv("CSRF_SECRET"))
+	if len(csrfSecret) == 0 {
+		panic(errors.New("CSRF_SECRET is not set"))
+	}
+
+	origins := os.Getenv("ALLOWED_ORIGINS")
+	if origins == "" {
+		origins = "http://localhost:5000,http://localhost:8080"
+	}
+	for _, origin := range strings.Split(origins, ",") {
+		origin = strings.TrimRight(strings.TrimSpace(origin), "/")
+		if origin != "" {
+			allowedOrigins[origin] = true
+		}
+	}
+}
+
+// Check if an origin is allowed to make requests with the session cookie
+func IsAllowedOrigin(origin string) bool {
+	return allowedOrigins[origin]
+}
+
+// The CSRF token of a session. It is tied to the session, so a token from another session doesn't work.
+func CSRFToken(sid string) string {
+	mac := hmac.New(sha256.New, csrfSecret)
+	mac.Write([]byte(sid))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Send the CSRF token of a session along with the session cookie
+func setCSRFCookie(w http.ResponseWriter, sessionData SessionType) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     CSRFCookieName,
+		Value:    CSRFToken(sessionData.Sid),
+		HttpOnly: false,
+		Secure:   true,
+		Path:     "/",
+		Expires:  sessionData.Expires,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// Overwrite the CSRF cookie with an expired one so that the browser drops it
+func clearCSRFCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     CSRFCookieName,
+		Value:    "",
+		HttpOnly: false,
+		Secure:   true,
+		Path:     "/",
+		Expires:  time.Unix(0, 0),
+		MaxAge:   -1,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// Get the origin a request came from, using the Referer when browsers leave out the Origin
+func requestOrigin(r *http.Request) string {
+	if origin := r.Header.Get("Origin"); origin != "" {
+		return origin
+	}
+
+	referer, err := url.Parse(r.Header.Get("Referer"))
+	if err != nil || referer.Host == "" {
+		return ""
+	}
+	return referer.Scheme + "://" + referer.Host
+}
+
+// Check if a request is authenticated by the session cookie, rather than an API token
+func UsesSessionCookie(r *http.Request) bool {
+	if BearerToken(r) != "" {
+		return false
+	}
+	cookie, err := r.Cookie("session")
+	return err == nil && cookie.Value != ""
+}
+
+// Check that a request authenticated by the session cookie was made by our own frontend.
+// Requests made with an API token can't be forged by another site, so they are always fine.
+func CheckCSRF(r *http.Request) error {
+	if !UsesSessionCookie(r) {
+		return nil
+	}
+
+	origin := requestOrigin(r)
+	if origin != "" && !IsAllowedOrigin(origin) {
+		return ErrCSRF
+	}
+
+	cookie, _ := r.Cookie("session")
+	session := ParseCookie(cookie.Value)
+	token := r.Header.Get(CSRFHeaderName)
+	if session.Sid == "" || token == "" {
+		return ErrCSRF
+	}
+	if !hmac.Equal([]byte(token), []byte(CSRFToken(session.Sid))) {
+		return ErrCSRF
+	}
+	return nil
+}
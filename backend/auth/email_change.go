@@ -0,0 +1,232 @@
+// Package auth provides functions useful for using authentication in this API.
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/mux"
+	"github.com/soumitradev/Dwitter/backend/cache"
+	"github.com/soumitradev/Dwitter/backend/common"
+	"github.com/soumitradev/Dwitter/backend/prisma/db"
+	"github.com/soumitradev/Dwitter/backend/subscriptions"
+	"github.com/soumitradev/Dwitter/backend/util"
+)
+
+// How long the link sent to a new email address works
+var emailChangeTTL = time.Hour * 24
+
+// How long the link sent to the old email address can undo the change
+var emailUndoTTL = time.Hour * 24 * 7
+
+// Key that stores the username and new email of a pending email change
+func emailChangeKey(token string) string {
+	return "emailchange:" + token
+}
+
+// Key that stores the pending email change token of a username, so that a newer change replaces it
+func userEmailChangeKey(username string) string {
+	return "emailchange:user:" + username
+}
+
+// Key that stores the username and old email of a change that can still be undone
+func emailUndoKey(token string) string {
+	return "emailundo:" + token
+}
+
+// Start changing the email of a user, by sending a confirmation link to the new address.
+// The email doesn't change until the link is clicked.
+func StartEmailChange(username string, newEmail string) error {
+	err := common.Validate.Var(newEmail, "required,email,lte=100")
+	if err != nil {
+		return err
+	}
+
+	_, err = common.Client.User.FindUnique(
+		db.User.Email.Equals(newEmail),
+	).Exec(common.BaseCtx)
+	if err == nil {
+		return errors.New("email already taken")
+	}
+	if err != db.ErrNotFound {
+		return fmt.Errorf("internal server error: %v", err)
+	}
+
+	// Only the newest change should go through
+	oldToken, err := common.RedisDB.Get(common.BaseCtx, userEmailChangeKey(username)).Result()
+	if err != nil && err != redis.Nil {
+		return fmt.Errorf("internal server error: %v", err)
+	}
+
+	token := util.GenSecureID(32)
+	_, err = common.RedisDB.TxPipelined(common.BaseCtx, func(pipe redis.Pipeliner) error {
+		if oldToken != "" {
+			pipe.Del(common.BaseCtx, emailChangeKey(oldToken))
+		}
+		pipe.HSet(common.BaseCtx, emailChangeKey(token), "username", username, "email", newEmail)
+		pipe.Expire(common.BaseCtx, emailChangeKey(token), emailChangeTTL)
+		pipe.Set(common.BaseCtx, userEmailChangeKey(username), token, emailChangeTTL)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("internal server error: %v", err)
+	}
+
+	link := subscriptions.AppURL() + "/api/email_change/" + token
+	err = subscriptions.SendEmail("Confirm your new Dwitter email", "Click this link to use this email for your Dwitter account "+username+": "+link+"\nThe link expires in 24 hours.\nIf you didn't ask for this, you can ignore this email.", newEmail)
+	if err != nil {
+		return errors.New("error sending email, please try again later")
+	}
+	return nil
+}
+
+// Set the email of a user
+func setEmail(username string, newEmail string) error {
+	_, err := common.Client.User.FindUnique(
+		db.User.Username.Equals(username),
+	).Update(
+		db.User.Email.Set(newEmail),
+	).Exec(common.BaseCtx)
+	if err != nil {
+		return err
+	}
+
+	return cache.EmailChangeCacheUpdate(username, newEmail)
+}
+
+// Handles the link sent to a new email address. Shows a page that asks to confirm on GET, and changes the email on POST.
+func EmailChangeHandler(w http.ResponseWriter, r *http.Request) {
+	token := mux.Vars(r)["token"]
+
+	change, err := common.RedisDB.HGetAll(common.BaseCtx, emailChangeKey(token)).Result()
+	if err != nil {
+		common.WriteLinkResponse(w, http.StatusInternalServerError, fmt.Sprintf("internal server error: %v", err))
+		return
+	}
+	if len(change) == 0 {
+		common.WriteLinkResponse(w, http.StatusNotFound, "Unrecognized or expired email change link")
+		return
+	}
+	if r.Method != http.MethodPost {
+		common.WriteConfirmPage(w, "Change the email of your Dwitter account to "+change["email"]+"?", "Change email")
+		return
+	}
+	// Links can only be used once
+	common.RedisDB.Del(common.BaseCtx, emailChangeKey(token), userEmailChangeKey(change["username"]))
+
+	user, err := common.Client.User.FindUnique(
+		db.User.Username.Equals(change["username"]),
+	).Exec(common.BaseCtx)
+	if err == db.ErrNotFound {
+		common.WriteLinkResponse(w, http.StatusNotFound, fmt.Sprintf("user not found: %v", err))
+		return
+	}
+	if err != nil {
+		common.WriteLinkResponse(w, http.StatusInternalServerError, fmt.Sprintf("internal server error: %v", err))
+		return
+	}
+
+	// Someone else could have taken the email since the link was sent
+	_, err = common.Client.User.FindUnique(
+		db.User.Email.Equals(change["email"]),
+	).Exec(common.BaseCtx)
+	if err == nil {
+		common.WriteLinkResponse(w, http.StatusConflict, "This email is already used by another account")
+		return
+	}
+	if err != db.ErrNotFound {
+		common.WriteLinkResponse(w, http.StatusInternalServerError, fmt.Sprintf("internal server error: %v", err))
+		return
+	}
+
+	oldEmail := user.Email
+	err = setEmail(user.Username, change["email"])
+	if err != nil {
+		common.WriteLinkResponse(w, http.StatusInternalServerError, fmt.Sprintf("internal server error: %v", err))
+		return
+	}
+
+	// Let the old address undo the change, in case the account was taken over
+	undoToken := util.GenSecureID(32)
+	undoKey := emailUndoKey(undoToken)
+	err = common.RedisDB.HSet(common.BaseCtx, undoKey, "username", user.Username, "email", oldEmail, "newEmail", change["email"]).Err()
+	if err == nil {
+		common.RedisDB.Expire(common.BaseCtx, undoKey, emailUndoTTL)
+
+		link := subscriptions.AppURL() + "/api/email_change/undo/" + undoToken
+		err = subscriptions.SendEmail("Your Dwitter email was changed", "The email of your Dwitter account "+user.Username+" was changed to "+change["email"]+".\nIf this wasn't you, click this link to change it back and log out everywhere: "+link+"\nThe link expires in 7 days.", oldEmail)
+	}
+	if err != nil {
+		fmt.Printf("Error sending email change notice: %v", err)
+	}
+
+	common.WriteLinkResponse(w, http.StatusOK, "Email changed!\nYou may close this tab now.")
+}
+
+// Handles the link sent to an old email address. Shows a page that asks to confirm on GET, and changes the email back on POST.
+func EmailChangeUndoHandler(w http.ResponseWriter, r *http.Request) {
+	token := mux.Vars(r)["token"]
+
+	undo, err := common.RedisDB.HGetAll(common.BaseCtx, emailUndoKey(token)).Result()
+	if err != nil {
+		common.WriteLinkResponse(w, http.StatusInternalServerError, fmt.Sprintf("internal server error: %v", err))
+		return
+	}
+	if len(undo) == 0 {
+		common.WriteLinkResponse(w, http.StatusNotFound, "Unrecognized or expired link")
+		return
+	}
+	if r.Method != http.MethodPost {
+		common.WriteConfirmPage(w, "Change the email of your Dwitter account back to "+undo["email"]+" and log out everywhere?", "Change email back")
+		return
+	}
+	common.RedisDB.Del(common.BaseCtx, emailUndoKey(token))
+
+	user, err := common.Client.User.FindUnique(
+		db.User.Username.Equals(undo["username"]),
+	).Exec(common.BaseCtx)
+	if err == db.ErrNotFound {
+		common.WriteLinkResponse(w, http.StatusNotFound, fmt.Sprintf("user not found: %v", err))
+		return
+	}
+	if err != nil {
+		common.WriteLinkResponse(w, http.StatusInternalServerError, fmt.Sprintf("internal server error: %v", err))
+		return
+	}
+
+	// Only undo the change this link was sent for, not a later one
+	if user.Email != undo["newEmail"] {
+		common.WriteLinkResponse(w, http.StatusConflict, "The email of this account has changed again since this link was sent")
+		return
+	}
+
+	_, err = common.Client.User.FindUnique(
+		db.User.Email.Equals(undo["email"]),
+	).Exec(common.BaseCtx)
+	if err == nil {
+		common.WriteLinkResponse(w, http.StatusConflict, "This email is already used by another account")
+		return
+	}
+	if err != db.ErrNotFound {
+		common.WriteLinkResponse(w, http.StatusInternalServerError, fmt.Sprintf("internal server error: %v", err))
+		return
+	}
+
+	err = setEmail(user.Username, undo["email"])
+	if err != nil {
+		common.WriteLinkResponse(w, http.StatusInternalServerError, fmt.Sprintf("internal server error: %v", err))
+		return
+	}
+
+	// Whoever changed the email may still be logged in
+	err = RevokeAllSessions(user.Username)
+	if err != nil {
+		common.WriteLinkResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	common.WriteLinkResponse(w, http.StatusOK, "Email changed back and logged out everywhere.\nConsider resetting your password too.")
+}
@@ -0,0 +1,140 @@
+// Package auth provides functions useful for using authentication in this API.
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/soumitradev/Dwitter/backend/common"
+	"github.com/soumitradev/Dwitter/backend/prisma/db"
+	"github.com/soumitradev/Dwitter/backend/schema"
+)
+
+// Find the identity a provider gave to an external account
+func findIdentity(provider string, subject string) (*db.IdentityModel, error) {
+	return common.Client.Identity.FindFirst(
+		db.Identity.Provider.Equals(provider),
+		db.Identity.Subject.Equals(subject),
+	).Exec(common.BaseCtx)
+}
+
+// Link an external identity to a user.
+// Returns an error and the status to send with it if it can't be linked.
+func linkIdentity(username string, identity ExternalIdentity) (int, error) {
+	linked, err := findIdentity(identity.Provider, identity.Subject)
+	if err == nil {
+		if linked.UserID == username {
+			return http.StatusOK, nil
+		}
+		return http.StatusConflict, fmt.Errorf("this %s account is already linked to another user", identity.Provider)
+	}
+	if err != db.ErrNotFound {
+		return http.StatusInternalServerError, fmt.Errorf("internal server error: %v", err)
+	}
+
+	// Unlinking works by provider, so only allow one account from each
+	existing, err := common.Client.Identity.FindMany(
+		db.Identity.UserID.Equals(username),
+		db.Identity.Provider.Equals(identity.Provider),
+	).Exec(common.BaseCtx)
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("internal server error: %v", err)
+	}
+	if len(existing) > 0 {
+		return http.StatusConflict, fmt.Errorf("a %s account is already linked, unlink it first", identity.Provider)
+	}
+
+	_, err = common.Client.Identity.CreateOne(
+		db.Identity.Provider.Set(identity.Provider),
+		db.Identity.Subject.Set(identity.Subject),
+		db.Identity.User.Link(
+			db.User.Username.Equals(username),
+		),
+		db.Identity.Email.Set(identity.Email),
+	).Exec(common.BaseCtx)
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("internal server error: %v", err)
+	}
+	return http.StatusOK, nil
+}
+
+// Start linking a provider to a logged in user, and return the URL to send them to
+func StartLinkIdentity(w http.ResponseWriter, username string, providerName string) (string, error) {
+	provider, ok := oauthProviders[providerName]
+	if !ok {
+		return "", errors.New("unknown OAuth provider")
+	}
+	if w == nil {
+		return "", errors.New("internal server error: no response to set the OAuth state cookie on")
+	}
+
+	return startOAuth(w, provider, "", username)
+}
+
+// List the external identities linked to a user
+func ListIdentities(username string) ([]schema.IdentityType, error) {
+	linked, err := common.Client.Identity.FindMany(
+		db.Identity.UserID.Equals(username),
+	).OrderBy(
+		db.Identity.CreatedAt.Order(db.ASC),
+	).Exec(common.BaseCtx)
+	if err != nil {
+		return nil, fmt.Errorf("internal server error: %v", err)
+	}
+
+	identities := []schema.IdentityType{}
+	for _, identity := range linked {
+		identities = append(identities, schema.IdentityType{
+			Provider:  identity.Provider,
+			Email:     identity.Email,
+			CreatedAt: identity.CreatedAt,
+		})
+	}
+	return identities, nil
+}
+
+// Unlink a provider from a user, as long as they can still log in some other way
+func UnlinkIdentity(username string, providerName string) error {
+	user, err := common.Client.User.FindUnique(
+		db.User.Username.Equals(username),
+	).Exec(common.BaseCtx)
+	if err == db.ErrNotFound {
+		return fmt.Errorf("user not found: %v", err)
+	}
+	if err != nil {
+		return fmt.Errorf("internal server error: %v", err)
+	}
+
+	linked, err := common.Client.Identity.FindMany(
+		db.Identity.UserID.Equals(username),
+	).Exec(common.BaseCtx)
+	if err != nil {
+		return fmt.Errorf("internal server error: %v", err)
+	}
+
+	remaining := 0
+	found := false
+	for _, identity := range linked {
+		if identity.Provider == providerName {
+			found = true
+		} else {
+			remaining++
+		}
+	}
+	if !found {
+		return fmt.Errorf("no %s account is linked", providerName)
+	}
+	if remaining == 0 && !user.PasswordSet {
+		return errors.New("this is the only way to log in to your account, set a password with a password reset before unlinking it")
+	}
+
+	_, err = common.Client.Identity.FindMany(
+		db.Identity.UserID.Equals(username),
+		db.Identity.Provider.Equals(providerName),
+	).Delete().Exec(common.BaseCtx)
+	if err != nil {
+		return fmt.Errorf("internal server error: %v", err)
+	}
+	return nil
+}
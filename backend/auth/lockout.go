@@ -0,0 +1,230 @@
+// Package auth provides functions useful for using authentication in this API.
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/soumitradev/Dwitter/backend/common"
+	"github.com/soumitradev/Dwitter/backend/prisma/db"
+	"github.com/soumitradev/Dwitter/backend/subscriptions"
+	"github.com/soumitradev/Dwitter/backend/util"
+)
+
+// Failed logins are counted over a sliding window
+var loginFailureWindow = time.Minute * 15
+
+// Number of failures in the window that cause a lockout
+const maxUserLoginFailures = 5
+const maxIPLoginFailures = 20
+
+// Lockouts start short and double every time they happen again, up to a limit
+var baseLockout = time.Minute
+var maxLockout = time.Hour
+
+// How long we remember past lockouts when working out the next one
+var lockoutMemory = time.Hour * 24
+
+// Key of the sorted set of failed login times for a username or IP
+func loginFailureKey(kind string, subject string) string {
+	return "loginfail:" + kind + ":" + subject
+}
+
+// Key that exists while a username or IP is locked out
+func loginLockKey(kind string, subject string) string {
+	return "loginlock:" + kind + ":" + subject
+}
+
+// Key that counts how many times a username or IP has been locked out recently
+func loginLockCountKey(kind string, subject string) string {
+	return "loginlocks:" + kind + ":" + subject
+}
+
+// Get how much longer a login for a username from an IP is locked out for
+func loginLockedFor(username string, ip string) (time.Duration, error) {
+	var longest time.Duration
+	for kind, subject := range map[string]string{"user": username, "ip": ip} {
+		remaining, err := common.RedisDB.PTTL(common.BaseCtx, loginLockKey(kind, subject)).Result()
+		if err != nil {
+			return 0, err
+		}
+		if remaining > longest {
+			longest = remaining
+		}
+	}
+	return longest, nil
+}
+
+// Record a failed attempt for a subject, and lock it out if it has failed too often.
+// Returns how long the subject got locked out for, or 0 if it wasn't.
+func recordFailure(kind string, subject string, limit int) (time.Duration, error) {
+	now := time.Now().UTC()
+	key := loginFailureKey(kind, subject)
+
+	// Add this failure and drop the ones that fell out of the window
+	_, err := common.RedisDB.TxPipelined(common.BaseCtx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(common.BaseCtx, key, &redis.Z{
+			Score:  float64(now.UnixNano()),
+			Member: strconv.FormatInt(now.UnixNano(), 10) + ":" + util.GenID(6),
+		})
+		pipe.ZRemRangeByScore(common.BaseCtx, key, "-inf", strconv.FormatInt(now.Add(-loginFailureWindow).UnixNano(), 10))
+		pipe.Expire(common.BaseCtx, key, loginFailureWindow)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	failures, err := common.RedisDB.ZCard(common.BaseCtx, key).Result()
+	if err != nil {
+		return 0, err
+	}
+	if failures < int64(limit) {
+		return 0, nil
+	}
+
+	// Every lockout in recent memory doubles the next one
+	lockCount, err := common.RedisDB.Incr(common.BaseCtx, loginLockCountKey(kind, subject)).Result()
+	if err != nil {
+		return 0, err
+	}
+	common.RedisDB.Expire(common.BaseCtx, loginLockCountKey(kind, subject), lockoutMemory)
+
+	lockout := time.Duration(float64(baseLockout) * math.Pow(2, float64(lockCount-1)))
+	if lockout > maxLockout {
+		lockout = maxLockout
+	}
+
+	err = common.RedisDB.Set(common.BaseCtx, loginLockKey(kind, subject), now.Add(lockout).Format(util.TimeUTCFormat), lockout).Err()
+	if err != nil {
+		return 0, err
+	}
+
+	// Start counting again once the lockout is over
+	common.RedisDB.Del(common.BaseCtx, key)
+	return lockout, nil
+}
+
+// Record a failed login for a username from an IP, and return how long the login is now locked out for
+func recordLoginFailure(username string, ip string) (time.Duration, error) {
+	userLockout, err := recordFailure("user", username, maxUserLoginFailures)
+	if err != nil {
+		return 0, err
+	}
+
+	ipLockout, err := recordFailure("ip", ip, maxIPLoginFailures)
+	if err != nil {
+		return 0, err
+	}
+
+	if userLockout > 0 {
+		notifyLockout(username, userLockout)
+	}
+
+	if ipLockout > userLockout {
+		return ipLockout, nil
+	}
+	return userLockout, nil
+}
+
+// Forget the failed logins of a username after it logs in successfully
+func clearLoginFailures(username string) {
+	common.RedisDB.Del(common.BaseCtx, loginFailureKey("user", username), loginLockCountKey("user", username))
+}
+
+// Let the owner of an account know that it was locked because of failed logins
+func notifyLockout(username string, lockout time.Duration) {
+	user, err := common.Client.User.FindUnique(
+		db.User.Username.Equals(username),
+	).Exec(common.BaseCtx)
+	if err != nil {
+		// Failed logins for usernames that don't exist are locked out too, but there's nobody to tell
+		return
+	}
+
+	body := fmt.Sprintf("There were too many failed attempts to log in to your Dwitter account %s, so logging in has been locked for %s.\nIf this wasn't you, consider changing your password.", username, lockout.String())
+	err = subscriptions.SendEmail("Your Dwitter account was temporarily locked", body, user.Email)
+	if err != nil {
+		fmt.Printf("Error sending lockout notice: %v", err)
+	}
+}
+
+// Tell the client it has to wait before trying to log in again
+func writeLockedOut(w http.ResponseWriter, retryAfter time.Duration) {
+	err := &LockedOutError{RetryAfter: retryAfter}
+	w.Header().Set("Retry-After", strconv.Itoa(err.seconds()))
+	writeError(w, http.StatusTooManyRequests, err.Error())
+}
+
+// Returned when a password or code isn't checked because of too many failed attempts
+type LockedOutError struct {
+	RetryAfter time.Duration
+}
+
+func (err *LockedOutError) seconds() int {
+	return int(math.Ceil(err.RetryAfter.Seconds()))
+}
+
+func (err *LockedOutError) Error() string {
+	return fmt.Sprintf("too many failed login attempts, try again in %d seconds", err.seconds())
+}
+
+// Answer a GraphQL request with 429 and Retry-After when a resolver was locked out, like logins are
+func SetLockedOutStatus(w http.ResponseWriter, err error) {
+	var lockedOut *LockedOutError
+	if w == nil || !errors.As(err, &lockedOut) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", strconv.Itoa(lockedOut.seconds()))
+	w.WriteHeader(http.StatusTooManyRequests)
+}
+
+// Run a password or code check for a user who is already logged in, like the checks done when logging in.
+// A stolen session could guess forever otherwise, so wrong guesses count towards the same lockout as failed logins.
+func limitAttempts(username string, ip string, check func() (bool, error)) error {
+	retryAfter, err := loginLockedFor(username, ip)
+	if err != nil {
+		return fmt.Errorf("internal server error: %v", err)
+	}
+	if retryAfter > 0 {
+		return &LockedOutError{RetryAfter: retryAfter}
+	}
+
+	valid, err := check()
+	if valid {
+		return nil
+	}
+	if err == nil || errors.Is(err, common.ErrBadCredentials) {
+		lockout, lockErr := recordLoginFailure(username, ip)
+		if lockErr != nil {
+			return fmt.Errorf("internal server error: %v", lockErr)
+		}
+		if lockout > 0 {
+			return &LockedOutError{RetryAfter: lockout}
+		}
+	}
+	if err == nil {
+		err = errors.New("invalid code")
+	}
+	return err
+}
+
+// Check the password of a user who is already logged in
+func checkPassword(username string, password string, ip string) error {
+	return limitAttempts(username, ip, func() (bool, error) {
+		return common.CheckCreds(username, password)
+	})
+}
+
+// Check the second factor of a user who is already logged in
+func checkSecondFactor(username string, code string, ip string) error {
+	return limitAttempts(username, ip, func() (bool, error) {
+		return verifySecondFactor(username, code)
+	})
+}
@@ -1,264 +1,323 @@
 package auth
 
 import (
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"math/rand"
 	"net/http"
-	"net/url"
-	"os"
 	"strings"
 	"time"
+	"unicode"
 
 	"github.com/soumitradev/Dwitter/backend/common"
 	"github.com/soumitradev/Dwitter/backend/prisma/db"
+	"github.com/soumitradev/Dwitter/backend/util"
 
-	"github.com/golang/gddo/httputil/header"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/gorilla/mux"
 )
 
-type DiscordTokenData struct {
-	AccessToken  string `json:"access_token"`
-	RefreshToken string `json:"refresh_token"`
-	TokenType    string `json:"token_type"`
-	ExpiresIn    int    `json:"expires_in"`
-	Scope        string `json:"scope"`
+// How long a user has to finish logging in with a provider
+var oauthStateTTL = time.Minute * 10
+
+// Key that stores the PKCE verifier and nonce of a login that was started with a provider
+func oauthStateKey(state string) string {
+	return "oauth:state:" + state
 }
 
-type DiscordUserData struct {
-	ID         string `json:"id"`
-	Username   string `json:"username"`
-	AvatarHash string `json:"avatar"`
-	Email      string `json:"email"`
+// Get a configured provider by the name in the URL
+func oauthProviderFromRequest(w http.ResponseWriter, r *http.Request) (OAuthProvider, bool) {
+	provider, ok := oauthProviders[mux.Vars(r)["provider"]]
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown OAuth provider")
+		return nil, false
+	}
+	return provider, true
 }
 
-// Handles login requests (only works with Discord for now)
-func OAuth2callbackHandler(w http.ResponseWriter, r *http.Request) {
+// PKCE S256 challenge for a verifier
+func pkceChallenge(verifier string) string {
+	digest := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(digest[:])
+}
 
-	fmt.Println(r)
+// Start logging in with a provider, and return the URL to send the user to.
+// If linkUsername is set, the identity gets linked to that user instead of logging in.
+func startOAuth(w http.ResponseWriter, provider OAuthProvider, device string, linkUsername string) (string, error) {
+	state := util.GenSecureID(32)
+	verifier := util.GenSecureID(64)
+	nonce := util.GenSecureID(32)
 
-	// Check if content type is "application/json"
-	if r.Header.Get("Content-Type") != "" {
-		value, _ := header.ParseValueAndParams(r.Header, "Content-Type")
-		if value != "application/json" {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(common.HTTPError{
-				Error: "Content-Type header is not application/json",
-			})
-			return
-		}
+	authURL, err := provider.AuthCodeURL(state, pkceChallenge(verifier), nonce)
+	if err != nil {
+		return "", err
 	}
 
-	data := url.Values{}
-	data.Set("client_id", os.Getenv("DISCORD_CLIENT_ID"))
-	data.Set("client_secret", os.Getenv("DISCORD_CLIENT_SECRET"))
-	data.Set("grant_type", "authorization_code")
-	data.Set("code", r.URL.Query().Get("code"))
-	data.Set("redirect_uri", "http://localhost:5000/callback")
+	key := oauthStateKey(state)
+	err = common.RedisDB.HSet(common.BaseCtx, key, map[string]interface{}{
+		"provider": provider.Name(),
+		"verifier": verifier,
+		"nonce":    nonce,
+		"device":   device,
+		"link":     linkUsername,
+	}).Err()
+	if err != nil {
+		return "", fmt.Errorf("internal server error: %v", err)
+	}
+	common.RedisDB.Expire(common.BaseCtx, key, oauthStateTTL)
+
+	// Tie the state to this browser so that nobody can make someone else finish their login
+	c := http.Cookie{
+		Name:     "oauth_state",
+		Value:    state,
+		HttpOnly: true,
+		Secure:   true,
+		Path:     "/api/oauth",
+		MaxAge:   int(oauthStateTTL.Seconds()),
+		SameSite: http.SameSiteLaxMode,
+	}
+	http.SetCookie(w, &c)
 
-	fmt.Println(data)
+	return authURL, nil
+}
+
+// Handles requests to start logging in with a provider, by redirecting to it
+func OAuth2LoginHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := oauthProviderFromRequest(w, r)
+	if !ok {
+		return
+	}
 
-	req, err := http.NewRequest("POST", "https://discord.com/api/v8/oauth2/token", strings.NewReader(data.Encode()))
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	authURL, err := startOAuth(w, provider, r.URL.Query().Get("device"), "")
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(common.HTTPError{
-			Error: err.Error(),
-		})
+		writeError(w, http.StatusBadGateway, err.Error())
 		return
 	}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// Handles the redirect back from a provider, and logs the user in
+func OAuth2CallbackHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := oauthProviderFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	if query.Get("error") != "" {
+		writeError(w, http.StatusUnauthorized, "login with "+provider.Name()+" failed: "+query.Get("error"))
+		return
+	}
+
+	// The state has to match the one we gave this browser, and can only be used once
+	state := query.Get("state")
+	cookie, err := r.Cookie("oauth_state")
+	if state == "" || err != nil || cookie.Value != state {
+		writeError(w, http.StatusBadRequest, "invalid OAuth state")
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     "oauth_state",
+		Value:    "",
+		HttpOnly: true,
+		Secure:   true,
+		Path:     "/api/oauth",
+		MaxAge:   -1,
+	})
+
+	key := oauthStateKey(state)
+	stateData, err := common.RedisDB.HGetAll(common.BaseCtx, key).Result()
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(common.HTTPError{
-			Error: err.Error(),
-		})
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("internal server error: %v", err))
+		return
+	}
+	common.RedisDB.Del(common.BaseCtx, key)
+	if len(stateData) == 0 || stateData["provider"] != provider.Name() {
+		writeError(w, http.StatusBadRequest, "invalid or expired OAuth state")
 		return
 	}
 
-	defer resp.Body.Close()
+	tokenData, err := provider.Exchange(query.Get("code"), stateData["verifier"])
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
 
-	if resp.StatusCode == 200 {
-		tokenData := DiscordTokenData{}
-		err = json.NewDecoder(resp.Body).Decode(&tokenData)
-		if err != nil {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(common.HTTPError{
-				Error: err.Error(),
-			})
-			return
-		}
+	identity, err := provider.Identity(tokenData, stateData["nonce"])
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
 
-		req, err := http.NewRequest("GET", "https://discord.com/api/v8/users/@me", nil)
-		req.Header.Set("Content-Type", "application/json")
-		req.Header.Set("Authorization", "Bearer "+tokenData.AccessToken)
+	// A logged in user asked to link this identity, so there's nobody to log in
+	if stateData["link"] != "" {
+		status, err := linkIdentity(stateData["link"], identity)
 		if err != nil {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(common.HTTPError{
-				Error: err.Error(),
-			})
+			writeError(w, status, err.Error())
 			return
 		}
 
-		client := &http.Client{}
-		resp, err := client.Do(req)
-		if err != nil {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(common.HTTPError{
-				Error: err.Error(),
-			})
-			return
-		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": "Linked " + identity.Provider + " to your account",
+		})
+		return
+	}
 
-		if resp.StatusCode == 200 {
-			userData := DiscordUserData{}
-			err = json.NewDecoder(resp.Body).Decode(&userData)
-			if err != nil {
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(http.StatusInternalServerError)
-				json.NewEncoder(w).Encode(common.HTTPError{
-					Error: err.Error(),
-				})
-				return
-			}
+	username, status, err := oauthUser(identity)
+	if err != nil {
+		writeError(w, status, err.Error())
+		return
+	}
 
-			fmt.Println(userData)
+	user, err := common.Client.User.FindUnique(
+		db.User.Username.Equals(username),
+	).Exec(common.BaseCtx)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("internal server error: %v", err))
+		return
+	}
+	err = common.SuspensionError(user)
+	if err != nil {
+		writeError(w, http.StatusForbidden, err.Error())
+		return
+	}
+	if user.TwoFactorEnabled {
+		createTwoFactorChallenge(w, username, stateData["device"])
+		return
+	}
 
-			passwordHash, err := bcrypt.GenerateFromPassword([]byte(tokenData.RefreshToken), bcrypt.DefaultCost)
-			if err != nil {
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(http.StatusInternalServerError)
-				json.NewEncoder(w).Encode(common.HTTPError{
-					Error: err.Error(),
-				})
-				return
-			}
+	sessionData, err := createSession(username, stateData["device"], r)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeSession(w, sessionData)
+}
 
-			// Check if user with username or email already exists
-
-			// TODO: Check if username is taken, and allow setting a new username
-			_, err1 := common.Client.User.FindUnique(
-				db.User.Username.Equals(userData.Username),
-			).Exec(common.BaseCtx)
-			_, err2 := common.Client.User.FindUnique(
-				db.User.Email.Equals(userData.Email),
-			).Exec(common.BaseCtx)
-			if (err1 == db.ErrNotFound) && (err2 == db.ErrNotFound) {
-				// Create user if no such user exists
-				_, err := common.Client.User.CreateOne(
-					db.User.Username.Set(userData.Username),
-					db.User.PasswordHash.Set(string(passwordHash)),
-					db.User.Name.Set(userData.Username),
-					db.User.Email.Set(userData.Email),
-					db.User.Bio.Set(""),
-					db.User.ProfilePicURL.Set("https://cdn.discordapp.com/avatars/"+userData.ID+"/"+userData.AvatarHash+".png"),
-					db.User.TokenVersion.Set(rand.Intn(10000)),
-					db.User.CreatedAt.Set(time.Now().UTC()),
-					db.User.OAuthProvider.Set("Discord"),
-				).With(
-					db.User.Dweets.Fetch().With(
-						db.Dweet.Author.Fetch(),
-					).OrderBy(
-						db.Dweet.PostedAt.Order(db.DESC),
-					),
-				).Exec(common.BaseCtx)
-
-				if err != nil {
-					w.Header().Set("Content-Type", "application/json")
-					w.WriteHeader(http.StatusInternalServerError)
-					json.NewEncoder(w).Encode(common.HTTPError{
-						Error: err.Error(),
-					})
-					return
-				}
-
-				// After checking for any errors, log the user in, and generate tokens
-				sessionData, err := generateSession(userData.Username, tokenData.RefreshToken)
-				if err != nil {
-					w.Header().Set("Content-Type", "application/json")
-					w.WriteHeader(http.StatusUnauthorized)
-					json.NewEncoder(w).Encode(common.HTTPError{
-						Error: err.Error(),
-					})
-					return
-				}
-
-				// Base 64 encode the session data because cookies are fuck
-				jsonSession, err := json.Marshal(&sessionData)
-				base64SessionString := base64.StdEncoding.EncodeToString(jsonSession)
-				if err != nil {
-					w.Header().Set("Content-Type", "application/json")
-					w.WriteHeader(http.StatusInternalServerError)
-					json.NewEncoder(w).Encode(common.HTTPError{
-						Error: fmt.Sprintf("internal server error: %v", err),
-					})
-					return
-				}
-
-				// Send the refresh token in a HTTPOnly cookie
-				c := http.Cookie{
-					Name:     "session",
-					Value:    base64SessionString,
-					HttpOnly: true,
-					Secure:   true,
-					Path:     "/",
-					Expires:  sessionData.Expires,
-				}
-				http.SetCookie(w, &c)
-
-				// Set the response headers
-				w.Header().Set("Content-Type", "application/json")
-				// Send the access token in JSON
-				json.NewEncoder(w).Encode(sessionData)
-			} else {
-				// TODO: Check if user already exists, and OAuth login them in.
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(http.StatusBadRequest)
-				json.NewEncoder(w).Encode(common.HTTPError{
-					Error: "Username/Email already taken",
-				})
-				return
-			}
-		} else {
-			// Send back any errors
-			body, err := ioutil.ReadAll(resp.Body)
+// Find the account an identity logs in to, or make one for it.
+// Returns the username, or an error and the status to send with it.
+func oauthUser(identity ExternalIdentity) (string, int, error) {
+	linked, err := findIdentity(identity.Provider, identity.Subject)
+	if err == nil {
+		return linked.UserID, http.StatusOK, nil
+	}
+	if err != db.ErrNotFound {
+		return "", http.StatusInternalServerError, fmt.Errorf("internal server error: %v", err)
+	}
+
+	// Anything past here trusts the provider about the email
+	if identity.Email == "" || !identity.EmailVerified {
+		return "", http.StatusForbidden, fmt.Errorf("your %s account needs a verified email address", identity.Provider)
+	}
+
+	user, err := common.Client.User.FindUnique(
+		db.User.Email.Equals(identity.Email),
+	).Exec(common.BaseCtx)
+	if err == nil {
+		// Accounts made with a provider before identities were stored get their identity now.
+		// Discord accounts from back then have it stored as "Discord".
+		if strings.EqualFold(user.OAuthProvider, identity.Provider) {
+			status, err := linkIdentity(user.Username, identity)
 			if err != nil {
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(http.StatusInternalServerError)
-				json.NewEncoder(w).Encode(common.HTTPError{
-					Error: err.Error(),
-				})
-				return
+				return "", status, err
 			}
+			return user.Username, http.StatusOK, nil
+		}
+		return "", http.StatusConflict, fmt.Errorf("an account with this email already exists, log in to it and link %s from there instead", identity.Provider)
+	}
+	if err != db.ErrNotFound {
+		return "", http.StatusInternalServerError, fmt.Errorf("internal server error: %v", err)
+	}
+
+	username, err := freeOAuthUsername(identity.Username)
+	if err != nil {
+		return "", http.StatusInternalServerError, fmt.Errorf("internal server error: %v", err)
+	}
+
+	// Nobody knows this password, so the account can only be logged in to with the provider
+	passwordHash, err := common.HashPassword(util.GenSecureID(32))
+	if err != nil {
+		return "", http.StatusInternalServerError, fmt.Errorf("internal server error: %v", err)
+	}
+
+	profilePicURL := identity.AvatarURL
+	if profilePicURL == "" {
+		profilePicURL = common.DefaultPFPURL
+	}
 
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(resp.StatusCode)
-			json.NewEncoder(w).Encode(string(body))
+	name := identity.Username
+	if len(name) > 40 {
+		name = name[:40]
+	}
+
+	_, err = common.Client.User.CreateOne(
+		db.User.Username.Set(username),
+		db.User.PasswordHash.Set(passwordHash),
+		db.User.Name.Set(name),
+		db.User.Email.Set(identity.Email),
+		db.User.Bio.Set(""),
+		db.User.ProfilePicURL.Set(profilePicURL),
+		db.User.TokenVersion.Set(rand.Intn(10000)),
+		db.User.CreatedAt.Set(time.Now().UTC()),
+		db.User.OAuthProvider.Set(identity.Provider),
+		db.User.Verified.Set(true),
+		db.User.PasswordSet.Set(false),
+	).Exec(common.BaseCtx)
+	if err != nil {
+		return "", http.StatusInternalServerError, fmt.Errorf("internal server error: %v", err)
+	}
+
+	status, err := linkIdentity(username, identity)
+	if err != nil {
+		return "", status, err
+	}
+	return username, http.StatusOK, nil
+}
+
+// Turn a provider's username into one that is valid here and not taken yet
+func freeOAuthUsername(providerUsername string) (string, error) {
+	base := strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return r
+		}
+		return -1
+	}, providerUsername)
+	if base == "" {
+		base = "user"
+	}
+	// Leave room for a suffix
+	if len(base) > 14 {
+		base = base[:14]
+	}
+
+	username := base
+	for i := 0; i < 10; i++ {
+		_, err := common.Client.User.FindUnique(
+			db.User.Username.Equals(username),
+		).Exec(common.BaseCtx)
+		if err == db.ErrNotFound {
+			return username, nil
 		}
-	} else {
-		// Send back any errors
-		body, err := ioutil.ReadAll(resp.Body)
 		if err != nil {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(common.HTTPError{
-				Error: err.Error(),
-			})
-			return
+			return "", err
 		}
+		username = base + util.GenID(6)
+	}
+	return "", fmt.Errorf("could not find a free username for %s", providerUsername)
+}
 
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(resp.StatusCode)
-		json.NewEncoder(w).Encode(string(body))
+// Send back the providers that can be logged in with
+func OAuth2ProvidersHandler(w http.ResponseWriter, r *http.Request) {
+	names := []string{}
+	for name := range oauthProviders {
+		names = append(names, name)
 	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]string{
+		"providers": names,
+	})
 }
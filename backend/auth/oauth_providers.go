@@ -0,0 +1,353 @@
+// Package auth provides functions useful for using authentication in this API.
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// An OAuthProvider is an external service users can log in with
+type OAuthProvider interface {
+	// Name used in URLs and stored on accounts, like "github"
+	Name() string
+	// URL to send the user to, to start logging in
+	AuthCodeURL(state string, codeChallenge string, nonce string) (string, error)
+	// Trade the code from the callback for tokens
+	Exchange(code string, codeVerifier string) (OAuthTokenData, error)
+	// Find out who the tokens belong to
+	Identity(token OAuthTokenData, nonce string) (ExternalIdentity, error)
+}
+
+// An OAuthTokenData stores the response of a token endpoint
+type OAuthTokenData struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	Scope        string `json:"scope"`
+	IDToken      string `json:"id_token"`
+}
+
+// An ExternalIdentity is a user as described by an OAuth provider
+type ExternalIdentity struct {
+	Provider      string
+	Subject       string
+	Username      string
+	Email         string
+	EmailVerified bool
+	AvatarURL     string
+}
+
+// Providers that are configured, by name
+var oauthProviders = map[string]OAuthProvider{}
+
+var oauthHTTPClient = &http.Client{Timeout: time.Second * 10}
+
+// An oauth2Provider is a plain OAuth2 provider with a provider specific user endpoint
+type oauth2Provider struct {
+	name         string
+	clientID     string
+	clientSecret string
+	redirectURI  string
+	authURL      string
+	tokenURL     string
+	userInfoURL  string
+	scopes       []string
+	// Turns the tokens into an identity, since every provider describes users differently
+	fetchIdentity func(p *oauth2Provider, token OAuthTokenData) (ExternalIdentity, error)
+}
+
+func (p *oauth2Provider) Name() string {
+	return p.name
+}
+
+func (p *oauth2Provider) AuthCodeURL(state string, codeChallenge string, nonce string) (string, error) {
+	values := url.Values{}
+	values.Set("response_type", "code")
+	values.Set("client_id", p.clientID)
+	values.Set("redirect_uri", p.redirectURI)
+	values.Set("scope", strings.Join(p.scopes, " "))
+	values.Set("state", state)
+	values.Set("code_challenge", codeChallenge)
+	values.Set("code_challenge_method", "S256")
+	if nonce != "" {
+		values.Set("nonce", nonce)
+	}
+
+	separator := "?"
+	if strings.Contains(p.authURL, "?") {
+		separator = "&"
+	}
+	return p.authURL + separator + values.Encode(), nil
+}
+
+func (p *oauth2Provider) Exchange(code string, codeVerifier string) (OAuthTokenData, error) {
+	data := url.Values{}
+	data.Set("client_id", p.clientID)
+	data.Set("client_secret", p.clientSecret)
+	data.Set("grant_type", "authorization_code")
+	data.Set("code", code)
+	data.Set("redirect_uri", p.redirectURI)
+	data.Set("code_verifier", codeVerifier)
+
+	req, err := http.NewRequest("POST", p.tokenURL, strings.NewReader(data.Encode()))
+	if err != nil {
+		return OAuthTokenData{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	// GitHub answers in form encoding unless asked for JSON
+	req.Header.Set("Accept", "application/json")
+
+	body, err := doOAuthRequest(req)
+	if err != nil {
+		return OAuthTokenData{}, err
+	}
+
+	tokenData := OAuthTokenData{}
+	err = json.Unmarshal(body, &tokenData)
+	if err != nil {
+		return OAuthTokenData{}, err
+	}
+	if tokenData.AccessToken == "" {
+		return OAuthTokenData{}, fmt.Errorf("no access token in response from %s", p.name)
+	}
+	return tokenData, nil
+}
+
+func (p *oauth2Provider) Identity(token OAuthTokenData, nonce string) (ExternalIdentity, error) {
+	identity, err := p.fetchIdentity(p, token)
+	if err != nil {
+		return ExternalIdentity{}, err
+	}
+	identity.Provider = p.name
+	return identity, nil
+}
+
+// Send a request to a provider and return the body, or an error if it didn't succeed
+func doOAuthRequest(req *http.Request) ([]byte, error) {
+	resp, err := oauthHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %d: %s", req.URL.Host, resp.StatusCode, string(body))
+	}
+	return body, nil
+}
+
+// GET a JSON document from a provider using an access token
+func getOAuthJSON(endpoint string, accessToken string, dst interface{}) error {
+	req, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+
+	body, err := doOAuthRequest(req)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, dst)
+}
+
+// Identity from Discord's /users/@me
+func discordIdentity(p *oauth2Provider, token OAuthTokenData) (ExternalIdentity, error) {
+	var user struct {
+		ID         string `json:"id"`
+		Username   string `json:"username"`
+		AvatarHash string `json:"avatar"`
+		Email      string `json:"email"`
+		Verified   bool   `json:"verified"`
+	}
+	err := getOAuthJSON(p.userInfoURL, token.AccessToken, &user)
+	if err != nil {
+		return ExternalIdentity{}, err
+	}
+
+	avatar := ""
+	if user.AvatarHash != "" {
+		avatar = "https://cdn.discordapp.com/avatars/" + user.ID + "/" + user.AvatarHash + ".png"
+	}
+	return ExternalIdentity{
+		Subject:       user.ID,
+		Username:      user.Username,
+		Email:         user.Email,
+		EmailVerified: user.Verified,
+		AvatarURL:     avatar,
+	}, nil
+}
+
+// Identity from GitHub's /user, and /user/emails since the public email can be empty
+func githubIdentity(p *oauth2Provider, token OAuthTokenData) (ExternalIdentity, error) {
+	var user struct {
+		ID        int    `json:"id"`
+		Login     string `json:"login"`
+		AvatarURL string `json:"avatar_url"`
+	}
+	err := getOAuthJSON(p.userInfoURL, token.AccessToken, &user)
+	if err != nil {
+		return ExternalIdentity{}, err
+	}
+
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	err = getOAuthJSON(p.userInfoURL+"/emails", token.AccessToken, &emails)
+	if err != nil {
+		return ExternalIdentity{}, err
+	}
+
+	identity := ExternalIdentity{
+		Subject:   strconv.Itoa(user.ID),
+		Username:  user.Login,
+		AvatarURL: user.AvatarURL,
+	}
+	for _, email := range emails {
+		if email.Primary {
+			identity.Email = email.Email
+			identity.EmailVerified = email.Verified
+		}
+	}
+	return identity, nil
+}
+
+// Identity from GitLab's /api/v4/user
+func gitlabIdentity(p *oauth2Provider, token OAuthTokenData) (ExternalIdentity, error) {
+	var user struct {
+		ID          int    `json:"id"`
+		Username    string `json:"username"`
+		Email       string `json:"email"`
+		AvatarURL   string `json:"avatar_url"`
+		ConfirmedAt string `json:"confirmed_at"`
+	}
+	err := getOAuthJSON(p.userInfoURL, token.AccessToken, &user)
+	if err != nil {
+		return ExternalIdentity{}, err
+	}
+
+	return ExternalIdentity{
+		Subject:       strconv.Itoa(user.ID),
+		Username:      user.Username,
+		Email:         user.Email,
+		EmailVerified: user.ConfirmedAt != "",
+		AvatarURL:     user.AvatarURL,
+	}, nil
+}
+
+// Read a provider setting from the environment, like OAUTH_GITHUB_CLIENT_ID
+func oauthSetting(name string, setting string) string {
+	return os.Getenv("OAUTH_" + strings.ToUpper(name) + "_" + setting)
+}
+
+// Register the providers listed in OAUTH_PROVIDERS.
+// Discord, GitHub and GitLab are plain OAuth2, Google and anything else are treated as OIDC issuers.
+func InitOAuth() {
+	redirectBase := os.Getenv("OAUTH_REDIRECT_BASE")
+	if redirectBase == "" {
+		redirectBase = "http://localhost:5000"
+	}
+
+	names := os.Getenv("OAUTH_PROVIDERS")
+	// Discord used to be the only provider, so keep it working with its old settings
+	if names == "" && os.Getenv("DISCORD_CLIENT_ID") != "" {
+		names = "discord"
+	}
+
+	for _, name := range strings.Split(names, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		provider, err := newOAuthProvider(name, redirectBase+"/api/oauth/"+name+"/callback")
+		if err != nil {
+			fmt.Printf("Error registering OAuth provider %s: %v\n", name, err)
+			continue
+		}
+		oauthProviders[name] = provider
+	}
+}
+
+// Make a provider from its settings
+func newOAuthProvider(name string, redirectURI string) (OAuthProvider, error) {
+	clientID := oauthSetting(name, "CLIENT_ID")
+	clientSecret := oauthSetting(name, "CLIENT_SECRET")
+	if name == "discord" && clientID == "" {
+		clientID = os.Getenv("DISCORD_CLIENT_ID")
+		clientSecret = os.Getenv("DISCORD_CLIENT_SECRET")
+	}
+	if clientID == "" {
+		return nil, errors.New("missing client ID")
+	}
+
+	switch name {
+	case "discord":
+		return &oauth2Provider{
+			name:          name,
+			clientID:      clientID,
+			clientSecret:  clientSecret,
+			redirectURI:   redirectURI,
+			authURL:       "https://discord.com/api/oauth2/authorize",
+			tokenURL:      "https://discord.com/api/oauth2/token",
+			userInfoURL:   "https://discord.com/api/users/@me",
+			scopes:        []string{"identify", "email"},
+			fetchIdentity: discordIdentity,
+		}, nil
+	case "github":
+		return &oauth2Provider{
+			name:          name,
+			clientID:      clientID,
+			clientSecret:  clientSecret,
+			redirectURI:   redirectURI,
+			authURL:       "https://github.com/login/oauth/authorize",
+			tokenURL:      "https://github.com/login/oauth/access_token",
+			userInfoURL:   "https://api.github.com/user",
+			scopes:        []string{"read:user", "user:email"},
+			fetchIdentity: githubIdentity,
+		}, nil
+	case "gitlab":
+		// Self-hosted GitLab instances can be used by setting OAUTH_GITLAB_URL
+		base := strings.TrimSuffix(oauthSetting(name, "URL"), "/")
+		if base == "" {
+			base = "https://gitlab.com"
+		}
+		return &oauth2Provider{
+			name:          name,
+			clientID:      clientID,
+			clientSecret:  clientSecret,
+			redirectURI:   redirectURI,
+			authURL:       base + "/oauth/authorize",
+			tokenURL:      base + "/oauth/token",
+			userInfoURL:   base + "/api/v4/user",
+			scopes:        []string{"read_user"},
+			fetchIdentity: gitlabIdentity,
+		}, nil
+	case "google":
+		return newOIDCProvider(name, "https://accounts.google.com", clientID, clientSecret, redirectURI), nil
+	default:
+		issuer := oauthSetting(name, "ISSUER")
+		if issuer == "" {
+			return nil, errors.New("missing issuer for OIDC provider")
+		}
+		return newOIDCProvider(name, issuer, clientID, clientSecret, redirectURI), nil
+	}
+}
@@ -0,0 +1,330 @@
+// Package auth provides functions useful for using authentication in this API.
+package auth
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Allowed difference between our clock and the issuer's when checking ID tokens
+var idTokenLeeway = time.Minute * 2
+
+// An oidcConfiguration stores the parts of an issuer's discovery document we use
+type oidcConfiguration struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserInfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// A jsonWebKey stores a single key from an issuer's JWKS
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// An idTokenClaims stores the claims of an ID token we check or use
+type idTokenClaims struct {
+	Issuer            string          `json:"iss"`
+	Subject           string          `json:"sub"`
+	Audience          json.RawMessage `json:"aud"`
+	Expires           int64           `json:"exp"`
+	IssuedAt          int64           `json:"iat"`
+	Nonce             string          `json:"nonce"`
+	Email             string          `json:"email"`
+	EmailVerified     interface{}     `json:"email_verified"`
+	PreferredUsername string          `json:"preferred_username"`
+	Name              string          `json:"name"`
+	Picture           string          `json:"picture"`
+}
+
+// An oidcProvider is an OpenID Connect issuer, set up from its discovery document
+type oidcProvider struct {
+	name         string
+	issuer       string
+	clientID     string
+	clientSecret string
+	redirectURI  string
+
+	// Discovery happens on first use so that an issuer being down doesn't stop the server from starting
+	mutex  sync.Mutex
+	config *oidcConfiguration
+	keys   map[string]*rsa.PublicKey
+}
+
+func newOIDCProvider(name string, issuer string, clientID string, clientSecret string, redirectURI string) *oidcProvider {
+	return &oidcProvider{
+		name:         name,
+		issuer:       strings.TrimSuffix(issuer, "/"),
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		redirectURI:  redirectURI,
+		keys:         map[string]*rsa.PublicKey{},
+	}
+}
+
+// Fetch the discovery document if we haven't yet
+func (p *oidcProvider) discover() (*oidcConfiguration, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.config != nil {
+		return p.config, nil
+	}
+
+	config := oidcConfiguration{}
+	err := getOAuthJSON(p.issuer+"/.well-known/openid-configuration", "", &config)
+	if err != nil {
+		return nil, fmt.Errorf("error discovering %s: %v", p.name, err)
+	}
+	if strings.TrimSuffix(config.Issuer, "/") != p.issuer {
+		return nil, fmt.Errorf("issuer of %s is %s, expected %s", p.name, config.Issuer, p.issuer)
+	}
+
+	p.config = &config
+	return p.config, nil
+}
+
+// The parts that work the same as any OAuth2 provider
+func (p *oidcProvider) oauth2() (*oauth2Provider, error) {
+	config, err := p.discover()
+	if err != nil {
+		return nil, err
+	}
+
+	return &oauth2Provider{
+		name:         p.name,
+		clientID:     p.clientID,
+		clientSecret: p.clientSecret,
+		redirectURI:  p.redirectURI,
+		authURL:      config.AuthorizationEndpoint,
+		tokenURL:     config.TokenEndpoint,
+		userInfoURL:  config.UserInfoEndpoint,
+		scopes:       []string{"openid", "profile", "email"},
+	}, nil
+}
+
+func (p *oidcProvider) Name() string {
+	return p.name
+}
+
+func (p *oidcProvider) AuthCodeURL(state string, codeChallenge string, nonce string) (string, error) {
+	base, err := p.oauth2()
+	if err != nil {
+		return "", err
+	}
+	return base.AuthCodeURL(state, codeChallenge, nonce)
+}
+
+func (p *oidcProvider) Exchange(code string, codeVerifier string) (OAuthTokenData, error) {
+	base, err := p.oauth2()
+	if err != nil {
+		return OAuthTokenData{}, err
+	}
+
+	tokenData, err := base.Exchange(code, codeVerifier)
+	if err != nil {
+		return OAuthTokenData{}, err
+	}
+	if tokenData.IDToken == "" {
+		return OAuthTokenData{}, fmt.Errorf("no ID token in response from %s", p.name)
+	}
+	return tokenData, nil
+}
+
+func (p *oidcProvider) Identity(token OAuthTokenData, nonce string) (ExternalIdentity, error) {
+	claims, err := p.verifyIDToken(token.IDToken, nonce)
+	if err != nil {
+		return ExternalIdentity{}, err
+	}
+
+	// Some issuers send email_verified as a string
+	verified := false
+	switch value := claims.EmailVerified.(type) {
+	case bool:
+		verified = value
+	case string:
+		verified = value == "true"
+	}
+
+	username := claims.PreferredUsername
+	if username == "" {
+		username = strings.Split(claims.Email, "@")[0]
+	}
+
+	return ExternalIdentity{
+		Provider:      p.name,
+		Subject:       claims.Subject,
+		Username:      username,
+		Email:         claims.Email,
+		EmailVerified: verified,
+		AvatarURL:     claims.Picture,
+	}, nil
+}
+
+// Find the key an ID token was signed with, refreshing the JWKS if we haven't seen it before
+func (p *oidcProvider) signingKey(kid string) (*rsa.PublicKey, error) {
+	config, err := p.discover()
+	if err != nil {
+		return nil, err
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	err = getOAuthJSON(config.JWKSURI, "", &jwks)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching keys of %s: %v", p.name, err)
+	}
+
+	// Keys get rotated, so replace the old ones instead of adding to them
+	keys := map[string]*rsa.PublicKey{}
+	for _, jwk := range jwks.Keys {
+		if jwk.Kty != "RSA" || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+		key, err := parseRSAKey(jwk)
+		if err != nil {
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	p.keys = keys
+
+	key, ok := p.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %s for %s", kid, p.name)
+	}
+	return key, nil
+}
+
+// Turn a JWK into an RSA public key
+func parseRSAKey(jwk jsonWebKey) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+	if err != nil {
+		return nil, err
+	}
+
+	exponent := new(big.Int).SetBytes(e)
+	if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+		return nil, errors.New("invalid RSA exponent")
+	}
+
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(exponent.Int64()),
+	}, nil
+}
+
+// Check the signature and claims of an ID token, and return its claims
+func (p *oidcProvider) verifyIDToken(idToken string, nonce string) (idTokenClaims, error) {
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return idTokenClaims{}, errors.New("malformed ID token")
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return idTokenClaims{}, errors.New("malformed ID token header")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	err = json.Unmarshal(headerJSON, &header)
+	if err != nil {
+		return idTokenClaims{}, errors.New("malformed ID token header")
+	}
+	// RS256 is the algorithm every issuer has to support, so it's the only one we accept
+	if header.Alg != "RS256" {
+		return idTokenClaims{}, fmt.Errorf("unsupported ID token algorithm %s", header.Alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return idTokenClaims{}, errors.New("malformed ID token signature")
+	}
+	key, err := p.signingKey(header.Kid)
+	if err != nil {
+		return idTokenClaims{}, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	err = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature)
+	if err != nil {
+		return idTokenClaims{}, errors.New("invalid ID token signature")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return idTokenClaims{}, errors.New("malformed ID token payload")
+	}
+	claims := idTokenClaims{}
+	err = json.Unmarshal(payload, &claims)
+	if err != nil {
+		return idTokenClaims{}, errors.New("malformed ID token payload")
+	}
+
+	if strings.TrimSuffix(claims.Issuer, "/") != p.issuer {
+		return idTokenClaims{}, errors.New("ID token has the wrong issuer")
+	}
+	if !audienceContains(claims.Audience, p.clientID) {
+		return idTokenClaims{}, errors.New("ID token has the wrong audience")
+	}
+	now := time.Now().UTC()
+	if now.After(time.Unix(claims.Expires, 0).Add(idTokenLeeway)) {
+		return idTokenClaims{}, errors.New("ID token has expired")
+	}
+	if time.Unix(claims.IssuedAt, 0).After(now.Add(idTokenLeeway)) {
+		return idTokenClaims{}, errors.New("ID token was issued in the future")
+	}
+	if claims.Nonce != nonce {
+		return idTokenClaims{}, errors.New("ID token has the wrong nonce")
+	}
+	if claims.Subject == "" {
+		return idTokenClaims{}, errors.New("ID token has no subject")
+	}
+	return claims, nil
+}
+
+// The aud claim can be a single string or a list of them
+func audienceContains(audience json.RawMessage, clientID string) bool {
+	var single string
+	if json.Unmarshal(audience, &single) == nil {
+		return single == clientID
+	}
+
+	var list []string
+	if json.Unmarshal(audience, &list) == nil {
+		for _, aud := range list {
+			if aud == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,335 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A mockIssuer is an OpenID Connect issuer that hands out codes and checks PKCE like a real one
+type mockIssuer struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	kid    string
+
+	mutex sync.Mutex
+	// Challenge and nonce of each code handed out, by code
+	codes map[string]mockAuthorization
+	// Issuer the discovery document claims, if it isn't the issuer's own URL
+	claimedIssuer string
+}
+
+type mockAuthorization struct {
+	challenge string
+	nonce     string
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issuer := &mockIssuer{
+		key:   key,
+		kid:   "test-key",
+		codes: map[string]mockAuthorization{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		claimed := issuer.claimedIssuer
+		if claimed == "" {
+			claimed = issuer.server.URL
+		}
+		json.NewEncoder(w).Encode(oidcConfiguration{
+			Issuer:                claimed,
+			AuthorizationEndpoint: issuer.server.URL + "/authorize",
+			TokenEndpoint:         issuer.server.URL + "/token",
+			UserInfoEndpoint:      issuer.server.URL + "/userinfo",
+			JWKSURI:               issuer.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string][]jsonWebKey{
+			"keys": {{
+				Kty: "RSA",
+				Kid: issuer.kid,
+				Use: "sig",
+				Alg: "RS256",
+				N:   base64.RawURLEncoding.EncodeToString(key.PublicKey.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.PublicKey.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", issuer.token)
+	issuer.server = httptest.NewServer(mux)
+	t.Cleanup(issuer.server.Close)
+
+	return issuer
+}
+
+// What the issuer does when the user agrees to log in: remember the challenge and nonce, and hand out a code
+func (issuer *mockIssuer) authorize(t *testing.T, authURL string) string {
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := parsed.Query()
+	if query.Get("code_challenge_method") != "S256" {
+		t.Fatalf("code_challenge_method = %q, want S256", query.Get("code_challenge_method"))
+	}
+
+	code := "code-" + query.Get("state")
+	issuer.mutex.Lock()
+	issuer.codes[code] = mockAuthorization{
+		challenge: query.Get("code_challenge"),
+		nonce:     query.Get("nonce"),
+	}
+	issuer.mutex.Unlock()
+	return code
+}
+
+func (issuer *mockIssuer) token(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil || r.PostForm.Get("grant_type") != "authorization_code" || r.PostForm.Get("client_id") != "client" || r.PostForm.Get("client_secret") != "secret" {
+		http.Error(w, `{"error":"invalid_request"}`, http.StatusBadRequest)
+		return
+	}
+
+	// Codes can only be used once
+	issuer.mutex.Lock()
+	authorization, ok := issuer.codes[r.PostForm.Get("code")]
+	delete(issuer.codes, r.PostForm.Get("code"))
+	issuer.mutex.Unlock()
+	if !ok || pkceChallenge(r.PostForm.Get("code_verifier")) != authorization.challenge {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+
+	claims := map[string]interface{}{
+		"iss":                issuer.server.URL,
+		"sub":                "1234",
+		"aud":                "client",
+		"exp":                time.Now().Add(time.Hour).Unix(),
+		"iat":                time.Now().Unix(),
+		"nonce":              authorization.nonce,
+		"email":              "someone@example.com",
+		"email_verified":     "true",
+		"preferred_username": "someone",
+		"picture":            "https://example.com/someone.png",
+	}
+
+	json.NewEncoder(w).Encode(OAuthTokenData{
+		AccessToken: "access",
+		TokenType:   "Bearer",
+		ExpiresIn:   3600,
+		IDToken:     issuer.sign(claims, "RS256", issuer.key),
+	})
+}
+
+func (issuer *mockIssuer) sign(claims map[string]interface{}, alg string, key *rsa.PrivateKey) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": issuer.kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		panic(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func (issuer *mockIssuer) provider() *oidcProvider {
+	return newOIDCProvider("mock", issuer.server.URL+"/", "client", "secret", "http://localhost:5000/api/oauth/mock/callback")
+}
+
+// Log in through the mock issuer the way OAuth2LoginHandler and OAuth2CallbackHandler do
+func loginWithIssuer(t *testing.T, issuer *mockIssuer, verifier string) (ExternalIdentity, error) {
+	provider := issuer.provider()
+	nonce := "nonce"
+
+	authURL, err := provider.AuthCodeURL("state", pkceChallenge("verifier"), nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(authURL, issuer.server.URL+"/authorize?") {
+		t.Fatalf("auth URL %s doesn't point at the authorization endpoint", authURL)
+	}
+	code := issuer.authorize(t, authURL)
+
+	tokenData, err := provider.Exchange(code, verifier)
+	if err != nil {
+		return ExternalIdentity{}, err
+	}
+	return provider.Identity(tokenData, nonce)
+}
+
+func TestOIDCLogin(t *testing.T) {
+	issuer := newMockIssuer(t)
+
+	identity, err := loginWithIssuer(t, issuer, "verifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := ExternalIdentity{
+		Provider:      "mock",
+		Subject:       "1234",
+		Username:      "someone",
+		Email:         "someone@example.com",
+		EmailVerified: true,
+		AvatarURL:     "https://example.com/someone.png",
+	}
+	if identity != want {
+		t.Errorf("identity = %+v, want %+v", identity, want)
+	}
+}
+
+func TestOIDCWrongVerifier(t *testing.T) {
+	issuer := newMockIssuer(t)
+
+	_, err := loginWithIssuer(t, issuer, "someone else's verifier")
+	if err == nil {
+		t.Fatal("exchange with the wrong PKCE verifier succeeded")
+	}
+}
+
+func TestOIDCAuthCodeURL(t *testing.T) {
+	issuer := newMockIssuer(t)
+
+	authURL, err := issuer.provider().AuthCodeURL("state", pkceChallenge("verifier"), "nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := parsed.Query()
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             "client",
+		"redirect_uri":          "http://localhost:5000/api/oauth/mock/callback",
+		"scope":                 "openid profile email",
+		"state":                 "state",
+		"code_challenge":        pkceChallenge("verifier"),
+		"code_challenge_method": "S256",
+		"nonce":                 "nonce",
+	}
+	for name, value := range want {
+		if query.Get(name) != value {
+			t.Errorf("%s = %q, want %q", name, query.Get(name), value)
+		}
+	}
+}
+
+func TestOIDCWrongIssuer(t *testing.T) {
+	issuer := newMockIssuer(t)
+	issuer.claimedIssuer = "https://evil.example.com"
+
+	_, err := issuer.provider().AuthCodeURL("state", pkceChallenge("verifier"), "nonce")
+	if err == nil {
+		t.Fatal("discovery accepted a document for another issuer")
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	issuer := newMockIssuer(t)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	validClaims := func() map[string]interface{} {
+		return map[string]interface{}{
+			"iss":   issuer.server.URL,
+			"sub":   "1234",
+			"aud":   "client",
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"iat":   time.Now().Unix(),
+			"nonce": "nonce",
+		}
+	}
+
+	tests := []struct {
+		name    string
+		edit    func(claims map[string]interface{})
+		alg     string
+		key     *rsa.PrivateKey
+		wantErr bool
+	}{
+		{name: "valid", wantErr: false},
+		{name: "audience list", edit: func(c map[string]interface{}) { c["aud"] = []string{"someone", "client"} }, wantErr: false},
+		{name: "expired within leeway", edit: func(c map[string]interface{}) { c["exp"] = time.Now().Add(-time.Minute).Unix() }, wantErr: false},
+		{name: "wrong nonce", edit: func(c map[string]interface{}) { c["nonce"] = "replayed" }, wantErr: true},
+		{name: "no nonce", edit: func(c map[string]interface{}) { delete(c, "nonce") }, wantErr: true},
+		{name: "wrong audience", edit: func(c map[string]interface{}) { c["aud"] = "someone" }, wantErr: true},
+		{name: "wrong audience list", edit: func(c map[string]interface{}) { c["aud"] = []string{"someone"} }, wantErr: true},
+		{name: "wrong issuer", edit: func(c map[string]interface{}) { c["iss"] = "https://evil.example.com" }, wantErr: true},
+		{name: "expired", edit: func(c map[string]interface{}) { c["exp"] = time.Now().Add(-time.Hour).Unix() }, wantErr: true},
+		{name: "issued in the future", edit: func(c map[string]interface{}) { c["iat"] = time.Now().Add(time.Hour).Unix() }, wantErr: true},
+		{name: "no subject", edit: func(c map[string]interface{}) { delete(c, "sub") }, wantErr: true},
+		{name: "signed with another key", key: otherKey, wantErr: true},
+		{name: "other algorithm", alg: "HS256", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			claims := validClaims()
+			if test.edit != nil {
+				test.edit(claims)
+			}
+			alg := test.alg
+			if alg == "" {
+				alg = "RS256"
+			}
+			key := test.key
+			if key == nil {
+				key = issuer.key
+			}
+
+			_, err := issuer.provider().verifyIDToken(issuer.sign(claims, alg, key), "nonce")
+			if (err != nil) != test.wantErr {
+				t.Errorf("verifyIDToken() error = %v, want error %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyIDTokenMalformed(t *testing.T) {
+	issuer := newMockIssuer(t)
+
+	for _, token := range []string{"", "a.b", "a.b.c.d", "!!!.e30.sig"} {
+		_, err := issuer.provider().verifyIDToken(token, "nonce")
+		if err == nil {
+			t.Errorf("verifyIDToken(%q) succeeded", token)
+		}
+	}
+}
+
+func TestPKCEChallenge(t *testing.T) {
+	verifier := "dBjftJeZ4CVP-mJ92ZXo2YgPOvi0bNBc3lJvmBDq9-Y"
+	digest := sha256.Sum256([]byte(verifier))
+
+	challenge := pkceChallenge(verifier)
+	if challenge != base64.RawURLEncoding.EncodeToString(digest[:]) {
+		t.Errorf("pkceChallenge() = %s, not the S256 challenge of the verifier", challenge)
+	}
+	if strings.ContainsAny(challenge, "+/=") {
+		t.Errorf("pkceChallenge() = %s, which isn't unpadded base64url", challenge)
+	}
+}
@@ -0,0 +1,161 @@
+// Package auth provides functions useful for using authentication in this API.
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/soumitradev/Dwitter/backend/common"
+	"github.com/soumitradev/Dwitter/backend/prisma/db"
+	"github.com/soumitradev/Dwitter/backend/subscriptions"
+	"github.com/soumitradev/Dwitter/backend/util"
+)
+
+var passwordResetTTL = time.Hour
+
+// A passwordResetRequestType stores the email a reset was requested for
+type passwordResetRequestType struct {
+	Email string `json:"email"`
+}
+
+// A passwordResetType stores the token from a reset email and the new password
+type passwordResetType struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// Key that stores the username a password reset token belongs to
+func passwordResetKey(token string) string {
+	return "reset:" + token
+}
+
+// Hash a new password and store it, then log the user out everywhere
+func setPassword(username string, password string) error {
+	err := common.ValidatePassword(password)
+	if err != nil {
+		return err
+	}
+
+	passwordHash, err := common.HashPassword(password)
+	if err != nil {
+		return fmt.Errorf("internal server error: %v", err)
+	}
+
+	user, err := common.Client.User.FindUnique(
+		db.User.Username.Equals(username),
+	).Update(
+		db.User.PasswordHash.Set(passwordHash),
+		db.User.PasswordSet.Set(true),
+	).Exec(common.BaseCtx)
+	if err == db.ErrNotFound {
+		return fmt.Errorf("user not found: %v", err)
+	}
+	if err != nil {
+		return fmt.Errorf("internal server error: %v", err)
+	}
+
+	// Anyone holding an old session should have to log in with the new password
+	err = RevokeAllSessions(username)
+	if err != nil {
+		return err
+	}
+
+	// Let the owner know, in case it wasn't them
+	err = subscriptions.SendEmail("Your Dwitter password was changed", "The password for your Dwitter account "+username+" was just changed.\nIf this wasn't you, reset your password right away.", user.Email)
+	if err != nil {
+		fmt.Printf("Error sending password change notice: %v", err)
+	}
+	return nil
+}
+
+// Change the password of a logged in user after checking their current password
+func ChangePassword(username string, oldPassword string, newPassword string, ip string) error {
+	err := checkPassword(username, oldPassword, ip)
+	if err != nil {
+		return err
+	}
+
+	return setPassword(username, newPassword)
+}
+
+// Handles requests to send a password reset email
+func PasswordResetRequestHandler(w http.ResponseWriter, r *http.Request) {
+	var resetRequest passwordResetRequestType
+	if !decodeJSONBody(w, r, &resetRequest) {
+		return
+	}
+
+	err := common.Validate.Var(resetRequest.Email, "required,email,lte=100")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Only send an email if the account exists, but always answer the same way
+	// so that this can't be used to find out which emails have accounts
+	user, err := common.Client.User.FindUnique(
+		db.User.Email.Equals(resetRequest.Email),
+	).Exec(common.BaseCtx)
+	if err != nil && err != db.ErrNotFound {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("internal server error: %v", err))
+		return
+	}
+
+	if err == nil {
+		token := util.GenSecureID(32)
+		err = common.RedisDB.Set(common.BaseCtx, passwordResetKey(token), user.Username, passwordResetTTL).Err()
+		if err == nil {
+			link := subscriptions.AppURL() + "/reset_password/" + token
+			err = subscriptions.SendEmail("Dwitter password reset", "Your password reset link for Dwitter is: "+link+"\nThe link can only be used once and expires in 1 hour.\nIf you didn't ask for this, you can ignore this email.", user.Email)
+		}
+		if err != nil {
+			// Failing here would tell that the account exists, so the answer stays the same
+			fmt.Printf("Error sending password reset email: %v\n", err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "If an account with that email exists, a password reset link has been sent to it",
+	})
+}
+
+// Handles requests to set a new password using a token from a reset email
+func PasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+	var resetData passwordResetType
+	if !decodeJSONBody(w, r, &resetData) {
+		return
+	}
+
+	// Check the password before using up the token
+	err := common.ValidatePassword(resetData.Password)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Tokens can only be used once, so remove it as we read it
+	username, err := common.RedisDB.GetDel(common.BaseCtx, passwordResetKey(resetData.Token)).Result()
+	if err == redis.Nil {
+		writeError(w, http.StatusBadRequest, "invalid or expired password reset token")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("internal server error: %v", err))
+		return
+	}
+
+	err = setPassword(username, resetData.Password)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Password changed, you may sign in now",
+	})
+}
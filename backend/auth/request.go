@@ -0,0 +1,89 @@
+// Package auth provides functions useful for using authentication in this API.
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/soumitradev/Dwitter/backend/common"
+
+	"github.com/golang/gddo/httputil/header"
+)
+
+// Send an error back as JSON
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(common.HTTPError{
+		Error: msg,
+	})
+}
+
+// Decode a JSON request body into dst, and send back an appropriate response if it fails.
+// Returns true if the body was decoded successfully.
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	// Check if content type is "application/json"
+	if r.Header.Get("Content-Type") != "" {
+		value, _ := header.ParseValueAndParams(r.Header, "Content-Type")
+		if value != "application/json" {
+			writeError(w, http.StatusBadRequest, "Content-Type header is not application/json")
+			return false
+		}
+	}
+
+	// Read a maximum of 1MB from body
+	r.Body = http.MaxBytesReader(w, r.Body, 1048576)
+
+	// Create a JSON decoder and decode the request JSON
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(dst)
+
+	// If any error occurred during the decoding, send an appropriate response
+	if err != nil {
+		var syntaxError *json.SyntaxError
+		var unmarshalTypeError *json.UnmarshalTypeError
+
+		// Return errors based on what error JSON parser returned
+		switch {
+		case errors.As(err, &syntaxError):
+			msg := fmt.Sprintf("Request body contains badly-formed JSON (at position %d)", syntaxError.Offset)
+			writeError(w, http.StatusBadRequest, msg)
+
+		case errors.Is(err, io.ErrUnexpectedEOF):
+			writeError(w, http.StatusBadRequest, "Request body contains badly-formed JSON")
+
+		case errors.As(err, &unmarshalTypeError):
+			msg := fmt.Sprintf("Request body contains an invalid value for the %q field (at position %d)", unmarshalTypeError.Field, unmarshalTypeError.Offset)
+			writeError(w, http.StatusBadRequest, msg)
+
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			fieldName := strings.TrimPrefix(err.Error(), "json: unknown field ")
+			msg := fmt.Sprintf("Request body contains unknown field %s", fieldName)
+			writeError(w, http.StatusBadRequest, msg)
+
+		case errors.Is(err, io.EOF):
+			writeError(w, http.StatusBadRequest, "Request body must not be empty")
+
+		case err.Error() == "http: request body too large":
+			writeError(w, http.StatusRequestEntityTooLarge, "Request body must not be larger than 1MB")
+
+		default:
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return false
+	}
+
+	// Decode it and check for an external JSON error
+	err = decoder.Decode(&struct{}{})
+	if err != io.EOF {
+		writeError(w, http.StatusBadRequest, "Request body must only contain a single JSON object")
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,236 @@
+// Package auth provides functions useful for using authentication in this API.
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/soumitradev/Dwitter/backend/common"
+	"github.com/soumitradev/Dwitter/backend/prisma/db"
+	"github.com/soumitradev/Dwitter/backend/schema"
+	"github.com/soumitradev/Dwitter/backend/util"
+)
+
+// Key of the set that stores all session IDs of a user
+func userSessionsKey(username string) string {
+	return "sessions:" + username
+}
+
+// Delete a session from the session store so that it can't be used anymore
+func RevokeSession(sessionID string) error {
+	if sessionID == "" {
+		return nil
+	}
+
+	username, err := common.RedisDB.HGet(common.BaseCtx, sessionID, "username").Result()
+	if err != nil && err != redis.Nil {
+		return err
+	}
+
+	err = common.RedisDB.Del(common.BaseCtx, sessionID).Err()
+	if err != nil {
+		return err
+	}
+
+	if username != "" {
+		return common.RedisDB.SRem(common.BaseCtx, userSessionsKey(username), sessionID).Err()
+	}
+	return nil
+}
+
+// List all active sessions of a user, newest first
+func ListSessions(username string, currentSessionID string) ([]schema.SessionInfoType, error) {
+	sids, err := common.RedisDB.SMembers(common.BaseCtx, userSessionsKey(username)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("internal server error: %v", err)
+	}
+
+	sessions := []schema.SessionInfoType{}
+	for _, sid := range sids {
+		res, err := common.RedisDB.HGetAll(common.BaseCtx, sid).Result()
+		if err != nil {
+			return nil, fmt.Errorf("internal server error: %v", err)
+		}
+
+		// Sessions that expired are still in the set, so clean them up
+		if len(res) == 0 {
+			common.RedisDB.SRem(common.BaseCtx, userSessionsKey(username), sid)
+			continue
+		}
+
+		createdAt, _ := time.Parse(util.TimeUTCFormat, res["createdAt"])
+		expires, _ := time.Parse(util.TimeUTCFormat, res["expires"])
+		sessions = append(sessions, schema.SessionInfoType{
+			ID:        res["id"],
+			Device:    res["device"],
+			IP:        res["ip"],
+			UserAgent: res["userAgent"],
+			CreatedAt: createdAt,
+			Expires:   expires,
+			Current:   sid == currentSessionID,
+		})
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.After(sessions[j].CreatedAt)
+	})
+	return sessions, nil
+}
+
+// Revoke a session of a user using the public ID shown in the session list
+func RevokeSessionByID(username string, id string) error {
+	sids, err := common.RedisDB.SMembers(common.BaseCtx, userSessionsKey(username)).Result()
+	if err != nil {
+		return fmt.Errorf("internal server error: %v", err)
+	}
+
+	for _, sid := range sids {
+		sessionID, err := common.RedisDB.HGet(common.BaseCtx, sid, "id").Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("internal server error: %v", err)
+		}
+		if sessionID == id {
+			return RevokeSession(sid)
+		}
+	}
+
+	return errors.New("session not found")
+}
+
+// Revoke every session of a user by bumping their token version
+func RevokeAllSessions(username string) error {
+	// Sessions store the token version they were created with, so this invalidates all of them
+	_, err := common.Client.User.FindUnique(
+		db.User.Username.Equals(username),
+	).Update(
+		db.User.TokenVersion.Increment(1),
+	).Exec(common.BaseCtx)
+	if err == db.ErrNotFound {
+		return fmt.Errorf("user not found: %v", err)
+	}
+	if err != nil {
+		return fmt.Errorf("internal server error: %v", err)
+	}
+
+	// Remove the session hashes right away instead of waiting for them to be checked
+	sids, err := common.RedisDB.SMembers(common.BaseCtx, userSessionsKey(username)).Result()
+	if err != nil {
+		return fmt.Errorf("internal server error: %v", err)
+	}
+	if len(sids) > 0 {
+		err = common.RedisDB.Del(common.BaseCtx, sids...).Err()
+		if err != nil {
+			return fmt.Errorf("internal server error: %v", err)
+		}
+	}
+	return common.RedisDB.Del(common.BaseCtx, userSessionsKey(username)).Err()
+}
+
+// Proxies whose X-Forwarded-For header is believed
+var trustedProxies = []*net.IPNet{}
+
+// Read TRUSTED_PROXIES, a comma separated list of IPs and CIDR ranges of the proxies in front of the API
+func initTrustedProxies() {
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+		if !strings.Contains(proxy, "/") {
+			if strings.Contains(proxy, ":") {
+				proxy += "/128"
+			} else {
+				proxy += "/32"
+			}
+		}
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			panic(fmt.Errorf("invalid TRUSTED_PROXIES entry %q: %v", proxy, err))
+		}
+		trustedProxies = append(trustedProxies, network)
+	}
+}
+
+func isTrustedProxy(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range trustedProxies {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// Get the IP of the client that sent a request
+func ClientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	// X-Forwarded-For can be set by anyone, so it is only read when a trusted proxy sent the request.
+	// Each proxy appends the address it saw, so the client is the last address that isn't a trusted proxy.
+	if !isTrustedProxy(ip) {
+		return ip
+	}
+	forwarded := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(forwarded[i])
+		if hop == "" {
+			continue
+		}
+		ip = hop
+		if !isTrustedProxy(hop) {
+			break
+		}
+	}
+	return ip
+}
+
+// Make a human readable device name like "Firefox on Linux" from a user agent
+func deviceFromUserAgent(userAgent string) string {
+	browser := "Unknown browser"
+	switch {
+	case strings.Contains(userAgent, "Firefox/"):
+		browser = "Firefox"
+	case strings.Contains(userAgent, "Edg/"):
+		browser = "Edge"
+	case strings.Contains(userAgent, "OPR/"):
+		browser = "Opera"
+	case strings.Contains(userAgent, "Chrome/"):
+		browser = "Chrome"
+	case strings.Contains(userAgent, "Safari/"):
+		browser = "Safari"
+	}
+
+	platform := "unknown device"
+	switch {
+	case strings.Contains(userAgent, "iPhone"):
+		platform = "iPhone"
+	case strings.Contains(userAgent, "iPad"):
+		platform = "iPad"
+	case strings.Contains(userAgent, "Android"):
+		platform = "Android"
+	case strings.Contains(userAgent, "Windows"):
+		platform = "Windows"
+	case strings.Contains(userAgent, "Macintosh"):
+		platform = "macOS"
+	case strings.Contains(userAgent, "Linux"):
+		platform = "Linux"
+	}
+
+	return browser + " on " + platform
+}
@@ -0,0 +1,280 @@
+// Package auth provides functions useful for using authentication in this API.
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/soumitradev/Dwitter/backend/common"
+	"github.com/soumitradev/Dwitter/backend/prisma/db"
+	"github.com/soumitradev/Dwitter/backend/schema"
+	"github.com/soumitradev/Dwitter/backend/util"
+)
+
+// Scopes an API token can be given
+const (
+	// Read dweets, users and feeds
+	ScopeRead = "read"
+	// Create, edit and delete dweets, likes and redweets
+	ScopeWriteDweets = "write:dweets"
+	// Edit the profile, follow or unfollow users, and change subscriptions and notification settings
+	ScopeWriteProfile = "write:profile"
+	// Upload media
+	ScopeMedia = "media"
+)
+
+var validScopes = map[string]bool{
+	ScopeRead:         true,
+	ScopeWriteDweets:  true,
+	ScopeWriteProfile: true,
+	ScopeMedia:        true,
+}
+
+// API tokens start with this so that they are easy to tell apart from other secrets
+const apiTokenPrefix = "dwt_"
+
+// A user can't have more tokens than this
+const maxAPITokens = 20
+
+// How often the last time a token was used is written down
+var apiTokenUsageInterval = time.Minute
+
+// Only the hash of a token is stored, so a leaked database doesn't leak working tokens.
+// Tokens are long and random, so a plain hash is enough.
+func hashAPIToken(token string) string {
+	digest := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(digest[:])
+}
+
+// Turn a stored token into what we send back, without the token itself
+func formatAPIToken(token *db.APITokenModel) schema.APITokenType {
+	formatted := schema.APITokenType{
+		ID:        token.ID,
+		Name:      token.Name,
+		Scopes:    token.Scopes,
+		CreatedAt: token.CreatedAt,
+	}
+	if lastUsedAt, ok := token.LastUsedAt(); ok {
+		formatted.LastUsedAt = &lastUsedAt
+	}
+	if expiresAt, ok := token.ExpiresAt(); ok {
+		formatted.ExpiresAt = &expiresAt
+	}
+	return formatted
+}
+
+// Create an API token for a user. The token is only ever sent back here.
+// Tokens don't expire if expiresInDays is 0.
+func CreateAPIToken(username string, name string, scopes []string, expiresInDays int) (schema.APITokenType, error) {
+	err := common.Validate.Var(name, "required,lte=40")
+	if err != nil {
+		return schema.APITokenType{}, err
+	}
+
+	err = common.Validate.Var(expiresInDays, "gte=0,lte=365")
+	if err != nil {
+		return schema.APITokenType{}, err
+	}
+
+	if len(scopes) == 0 {
+		return schema.APITokenType{}, errors.New("an API token needs at least one scope")
+	}
+	for _, scope := range scopes {
+		if !validScopes[scope] {
+			return schema.APITokenType{}, fmt.Errorf("unknown scope: %s", scope)
+		}
+	}
+
+	// Tokens are revoked along with sessions when the token version of their owner changes
+	owner, err := common.Client.User.FindUnique(
+		db.User.Username.Equals(username),
+	).Exec(common.BaseCtx)
+	if err == db.ErrNotFound {
+		return schema.APITokenType{}, fmt.Errorf("user not found: %v", err)
+	}
+	if err != nil {
+		return schema.APITokenType{}, fmt.Errorf("internal server error: %v", err)
+	}
+
+	existing, err := common.Client.APIToken.FindMany(
+		db.APIToken.OwnerID.Equals(username),
+	).Exec(common.BaseCtx)
+	if err != nil {
+		return schema.APITokenType{}, fmt.Errorf("internal server error: %v", err)
+	}
+	if len(existing) >= maxAPITokens {
+		return schema.APITokenType{}, fmt.Errorf("you can't have more than %d API tokens", maxAPITokens)
+	}
+
+	token := apiTokenPrefix + util.GenSecureID(40)
+
+	optional := []db.APITokenSetParam{
+		db.APIToken.CreatedAt.Set(time.Now().UTC()),
+		db.APIToken.TokenVersion.Set(owner.TokenVersion),
+	}
+	if expiresInDays > 0 {
+		optional = append(optional, db.APIToken.ExpiresAt.Set(time.Now().UTC().AddDate(0, 0, expiresInDays)))
+	}
+
+	createdToken, err := common.Client.APIToken.CreateOne(
+		db.APIToken.ID.Set(util.GenID(10)),
+		db.APIToken.Name.Set(name),
+		db.APIToken.TokenHash.Set(hashAPIToken(token)),
+		db.APIToken.Owner.Link(
+			db.User.Username.Equals(username),
+		),
+		append(optional, db.APIToken.Scopes.Set(scopes))...,
+	).Exec(common.BaseCtx)
+	if err != nil {
+		return schema.APITokenType{}, fmt.Errorf("internal server error: %v", err)
+	}
+
+	formatted := formatAPIToken(createdToken)
+	formatted.Token = token
+	return formatted, nil
+}
+
+// List the API tokens of a user
+func ListAPITokens(username string) ([]schema.APITokenType, error) {
+	tokens, err := common.Client.APIToken.FindMany(
+		db.APIToken.OwnerID.Equals(username),
+	).OrderBy(
+		db.APIToken.CreatedAt.Order(db.DESC),
+	).Exec(common.BaseCtx)
+	if err != nil {
+		return nil, fmt.Errorf("internal server error: %v", err)
+	}
+
+	formatted := []schema.APITokenType{}
+	for i := range tokens {
+		formatted = append(formatted, formatAPIToken(&tokens[i]))
+	}
+	return formatted, nil
+}
+
+// Revoke an API token of a user by its id
+func RevokeAPIToken(username string, id string) error {
+	result, err := common.Client.APIToken.FindMany(
+		db.APIToken.ID.Equals(id),
+		db.APIToken.OwnerID.Equals(username),
+	).Delete().Exec(common.BaseCtx)
+	if err != nil {
+		return fmt.Errorf("internal server error: %v", err)
+	}
+	if result.Count == 0 {
+		return errors.New("API token not found")
+	}
+	return nil
+}
+
+// Check an API token and that it has a scope, and return the username it belongs to
+func authenticateAPIToken(token string, scope string) (string, error) {
+	storedToken, err := common.Client.APIToken.FindUnique(
+		db.APIToken.TokenHash.Equals(hashAPIToken(token)),
+	).With(
+		db.APIToken.Owner.Fetch(),
+	).Exec(common.BaseCtx)
+	if err == db.ErrNotFound {
+		return "", errors.New("Unauthorized")
+	}
+	if err != nil {
+		return "", fmt.Errorf("internal server error: %v", err)
+	}
+
+	now := time.Now().UTC()
+	if expiresAt, ok := storedToken.ExpiresAt(); ok && now.After(expiresAt) {
+		return "", errors.New("Unauthorized: API token expired")
+	}
+
+	hasScope := false
+	for _, tokenScope := range storedToken.Scopes {
+		if tokenScope == scope {
+			hasScope = true
+		}
+	}
+	if !hasScope {
+		return "", fmt.Errorf("Unauthorized: API token is missing the %s scope", scope)
+	}
+
+	// Logging out everywhere and deleting the account revoke API tokens too, the same way they revoke sessions
+	owner := storedToken.Owner()
+	if storedToken.TokenVersion != owner.TokenVersion {
+		return "", errors.New("Unauthorized: API token was revoked")
+	}
+	if _, scheduled := owner.DeletionScheduledAt(); scheduled {
+		return "", errors.New("Unauthorized: account is scheduled for deletion")
+	}
+
+	err = common.SuspensionError(owner)
+	if err != nil {
+		return "", err
+	}
+
+	// Don't write to the database on every single request
+	lastUsedAt, used := storedToken.LastUsedAt()
+	if !used || now.Sub(lastUsedAt) > apiTokenUsageInterval {
+		common.Client.APIToken.FindUnique(
+			db.APIToken.ID.Equals(storedToken.ID),
+		).Update(
+			db.APIToken.LastUsedAt.Set(now),
+		).Exec(common.BaseCtx)
+	}
+
+	return storedToken.OwnerID, nil
+}
+
+// Get the API token sent in the Authorization header of a request, if there is one
+func BearerToken(r *http.Request) string {
+	authHeader := r.Header.Get("Authorization")
+	if strings.HasPrefix(authHeader, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(authHeader, "Bearer "))
+	}
+	return ""
+}
+
+// Find out who made a GraphQL request from its root object, using an API token or the session.
+// The API token has to have the scope, sessions can do everything.
+func ResolveViewer(rootValue interface{}, scope string) (SessionType, bool, error) {
+	root, _ := rootValue.(map[string]interface{})
+
+	if token, _ := root["apiToken"].(string); token != "" {
+		username, err := authenticateAPIToken(token, scope)
+		if err != nil {
+			return SessionType{}, false, err
+		}
+		return SessionType{Username: username}, true, nil
+	}
+
+	sid, _ := root["sid"].(string)
+	return VerifySessionID(sid)
+}
+
+// Find out who made a REST request, using an API token or the session.
+// The API token has to have the scope, sessions can do everything.
+func AuthenticateRequest(r *http.Request, scope string) (string, error) {
+	if token := BearerToken(r); token != "" {
+		return authenticateAPIToken(token, scope)
+	}
+
+	// The media upload used to take the session cookie in the Authorization header
+	if authHeader := r.Header.Get("Authorization"); authHeader != "" {
+		return Authenticate(authHeader)
+	}
+
+	cookie, err := r.Cookie("session")
+	if err != nil {
+		return "", errors.New("Unauthorized")
+	}
+
+	// Another site could make the browser send the cookie along with a form
+	err = CheckCSRF(r)
+	if err != nil {
+		return "", err
+	}
+	return Authenticate(cookie.Value)
+}
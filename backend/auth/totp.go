@@ -0,0 +1,382 @@
+// Package auth provides functions useful for using authentication in this API.
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/soumitradev/Dwitter/backend/common"
+	"github.com/soumitradev/Dwitter/backend/prisma/db"
+	"github.com/soumitradev/Dwitter/backend/schema"
+	"github.com/soumitradev/Dwitter/backend/util"
+)
+
+// TOTP parameters from RFC 6238, using the defaults that authenticator apps expect
+const totpPeriod = 30
+const totpDigits = 6
+const totpSkew = 1
+const totpIssuer = "Dwitter"
+
+const recoveryCodeCount = 10
+const maxChallengeAttempts = 5
+
+var twoFactorSetupTTL = time.Minute * 15
+var twoFactorChallengeTTL = time.Minute * 5
+
+// A twoFactorLoginType stores the second step of a login
+type twoFactorLoginType struct {
+	Challenge string `json:"challenge"`
+	Code      string `json:"code"`
+}
+
+// A twoFactorChallengeType is sent back when a password login needs a TOTP code
+type twoFactorChallengeType struct {
+	TwoFactorRequired bool   `json:"twoFactorRequired"`
+	Challenge         string `json:"challenge"`
+}
+
+// Key that stores a secret that is waiting for its first code
+func twoFactorSetupKey(username string) string {
+	return "2fa:setup:" + username
+}
+
+// Key that stores the user a login challenge belongs to
+func twoFactorChallengeKey(challenge string) string {
+	return "2fa:challenge:" + challenge
+}
+
+// Key that marks a code as used so that it can't be replayed
+func totpUsedKey(username string, counter uint64) string {
+	return "2fa:used:" + username + ":" + strconv.FormatUint(counter, 10)
+}
+
+// Make a new random base32 encoded TOTP secret
+func generateTOTPSecret() (string, error) {
+	secret := make([]byte, 20)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return "", err
+	}
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(secret), nil
+}
+
+// Make the otpauth:// URI that authenticator apps read from a QR code
+func totpProvisioningURI(username string, secret string) string {
+	values := url.Values{}
+	values.Set("secret", secret)
+	values.Set("issuer", totpIssuer)
+	values.Set("algorithm", "SHA1")
+	values.Set("digits", strconv.Itoa(totpDigits))
+	values.Set("period", strconv.Itoa(totpPeriod))
+	label := url.PathEscape(totpIssuer + ":" + username)
+	return "otpauth://totp/" + label + "?" + values.Encode()
+}
+
+// Calculate the code for a counter value, as described in RFC 4226
+func totpCode(secret []byte, counter uint64) string {
+	var message [8]byte
+	binary.BigEndian.PutUint64(message[:], counter)
+
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(message[:])
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	modulo := uint32(1)
+	for i := 0; i < totpDigits; i++ {
+		modulo *= 10
+	}
+	return fmt.Sprintf("%0*d", totpDigits, value%modulo)
+}
+
+// Check a TOTP code against a secret, allowing for a bit of clock drift.
+// Returns the counter that matched so that it can be marked as used.
+func checkTOTP(secret string, code string, now time.Time) (uint64, bool) {
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.ToUpper(secret))
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+
+	current := uint64(now.Unix()) / totpPeriod
+	for i := -totpSkew; i <= totpSkew; i++ {
+		counter := uint64(int64(current) + int64(i))
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, counter)), []byte(code)) == 1 {
+			return counter, true
+		}
+	}
+	return 0, false
+}
+
+// Hash a recovery code so that it isn't stored in plain text
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(code))))
+	return hex.EncodeToString(sum[:])
+}
+
+// Make a new set of recovery codes, and return them along with their hashes
+func generateRecoveryCodes() ([]string, []string) {
+	codes := []string{}
+	hashes := []string{}
+	for i := 0; i < recoveryCodeCount; i++ {
+		code := strings.ToLower(util.GenSecureID(10))
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, hashes
+}
+
+// Check a second factor for a user. The code can either be a TOTP code or an unused recovery code.
+func verifySecondFactor(username string, code string) (bool, error) {
+	user, err := common.Client.User.FindUnique(
+		db.User.Username.Equals(username),
+	).Exec(common.BaseCtx)
+	if err == db.ErrNotFound {
+		return false, fmt.Errorf("user not found: %v", err)
+	}
+	if err != nil {
+		return false, fmt.Errorf("internal server error: %v", err)
+	}
+
+	if !user.TwoFactorEnabled {
+		return false, errors.New("two-factor authentication is not enabled")
+	}
+
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+
+	// Try the code as a TOTP code first
+	counter, valid := checkTOTP(user.TwoFactorSecret, code, time.Now())
+	if valid {
+		// Each code can only be used once
+		fresh, err := common.RedisDB.SetNX(common.BaseCtx, totpUsedKey(username, counter), true, time.Second*totpPeriod*(2*totpSkew+2)).Result()
+		if err != nil {
+			return false, fmt.Errorf("internal server error: %v", err)
+		}
+		return fresh, nil
+	}
+
+	// Otherwise, check if it is one of the recovery codes, and use it up if it is
+	hashed := hashRecoveryCode(code)
+	found := false
+	for _, recoveryCode := range user.RecoveryCodes {
+		if subtle.ConstantTimeCompare([]byte(recoveryCode), []byte(hashed)) == 1 {
+			found = true
+		}
+	}
+	if !found {
+		return false, nil
+	}
+
+	// The code is removed in the same statement that checks it is still there, so two logins can't both use it
+	query := `UPDATE public."User" SET "recoveryCodes" = array_remove("recoveryCodes", $1) WHERE username = $2 AND $1 = ANY("recoveryCodes");`
+	result, err := common.Client.Prisma.ExecuteRaw(query, hashed, username).Exec(common.BaseCtx)
+	if err != nil {
+		return false, fmt.Errorf("internal server error: %v", err)
+	}
+	return result.Count > 0, nil
+}
+
+// Start two-factor enrollment for a user. The secret only takes effect once a code from it is confirmed.
+func SetupTwoFactor(username string, password string, ip string) (schema.TwoFactorSetupType, error) {
+	err := checkPassword(username, password, ip)
+	if err != nil {
+		return schema.TwoFactorSetupType{}, err
+	}
+
+	user, err := common.Client.User.FindUnique(
+		db.User.Username.Equals(username),
+	).Exec(common.BaseCtx)
+	if err != nil {
+		return schema.TwoFactorSetupType{}, fmt.Errorf("internal server error: %v", err)
+	}
+	if user.TwoFactorEnabled {
+		return schema.TwoFactorSetupType{}, errors.New("two-factor authentication is already enabled")
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		return schema.TwoFactorSetupType{}, fmt.Errorf("internal server error: %v", err)
+	}
+
+	err = common.RedisDB.Set(common.BaseCtx, twoFactorSetupKey(username), secret, twoFactorSetupTTL).Err()
+	if err != nil {
+		return schema.TwoFactorSetupType{}, fmt.Errorf("internal server error: %v", err)
+	}
+
+	return schema.TwoFactorSetupType{
+		Secret:          secret,
+		ProvisioningURI: totpProvisioningURI(username, secret),
+	}, nil
+}
+
+// Finish two-factor enrollment with a code from the new secret, and return the recovery codes
+func ConfirmTwoFactor(username string, code string) ([]string, error) {
+	secret, err := common.RedisDB.Get(common.BaseCtx, twoFactorSetupKey(username)).Result()
+	if err == redis.Nil {
+		return nil, errors.New("no two-factor setup in progress, or it has expired")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("internal server error: %v", err)
+	}
+
+	_, valid := checkTOTP(secret, strings.TrimSpace(code), time.Now())
+	if !valid {
+		return nil, errors.New("invalid code")
+	}
+
+	codes, hashes := generateRecoveryCodes()
+	_, err = common.Client.User.FindUnique(
+		db.User.Username.Equals(username),
+	).Update(
+		db.User.TwoFactorEnabled.Set(true),
+		db.User.TwoFactorSecret.Set(secret),
+		db.User.RecoveryCodes.Set(hashes),
+	).Exec(common.BaseCtx)
+	if err != nil {
+		return nil, fmt.Errorf("internal server error: %v", err)
+	}
+
+	common.RedisDB.Del(common.BaseCtx, twoFactorSetupKey(username))
+	return codes, nil
+}
+
+// Turn off two-factor authentication after checking both factors
+func DisableTwoFactor(username string, password string, code string, ip string) error {
+	err := checkPassword(username, password, ip)
+	if err != nil {
+		return err
+	}
+
+	err = checkSecondFactor(username, code, ip)
+	if err != nil {
+		return err
+	}
+
+	_, err = common.Client.User.FindUnique(
+		db.User.Username.Equals(username),
+	).Update(
+		db.User.TwoFactorEnabled.Set(false),
+		db.User.TwoFactorSecret.Set(""),
+		db.User.RecoveryCodes.Set([]string{}),
+	).Exec(common.BaseCtx)
+	if err != nil {
+		return fmt.Errorf("internal server error: %v", err)
+	}
+	return nil
+}
+
+// Start a two-factor challenge for a user that got their password right
+func createTwoFactorChallenge(w http.ResponseWriter, username string, device string) {
+	challenge := util.GenSecureID(32)
+	challengeMap := make(map[string]string)
+	challengeMap["username"] = username
+	challengeMap["device"] = device
+	challengeMap["attempts"] = "0"
+
+	err := common.RedisDB.HSet(common.BaseCtx, twoFactorChallengeKey(challenge), challengeMap).Err()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("internal server error: %v", err))
+		return
+	}
+	err = common.RedisDB.Expire(common.BaseCtx, twoFactorChallengeKey(challenge), twoFactorChallengeTTL).Err()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("internal server error: %v", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(twoFactorChallengeType{
+		TwoFactorRequired: true,
+		Challenge:         challenge,
+	})
+}
+
+// Handles the second step of logins for users with two-factor authentication
+func TwoFactorLoginHandler(w http.ResponseWriter, r *http.Request) {
+	var loginData twoFactorLoginType
+	if !decodeJSONBody(w, r, &loginData) {
+		return
+	}
+
+	key := twoFactorChallengeKey(loginData.Challenge)
+	challenge, err := common.RedisDB.HGetAll(common.BaseCtx, key).Result()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("internal server error: %v", err))
+		return
+	}
+	if len(challenge) == 0 {
+		writeError(w, http.StatusUnauthorized, "invalid or expired login challenge")
+		return
+	}
+
+	// Don't let a challenge be used to guess codes forever
+	attempts, err := common.RedisDB.HIncrBy(common.BaseCtx, key, "attempts", 1).Result()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("internal server error: %v", err))
+		return
+	}
+	if attempts > maxChallengeAttempts {
+		common.RedisDB.Del(common.BaseCtx, key)
+		writeError(w, http.StatusUnauthorized, "too many attempts, please log in again")
+		return
+	}
+
+	// Wrong codes count towards the same lockout as wrong passwords
+	ip := ClientIP(r)
+	retryAfter, err := loginLockedFor(challenge["username"], ip)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("internal server error: %v", err))
+		return
+	}
+	if retryAfter > 0 {
+		writeLockedOut(w, retryAfter)
+		return
+	}
+
+	valid, err := verifySecondFactor(challenge["username"], loginData.Code)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !valid {
+		lockout, err := recordLoginFailure(challenge["username"], ip)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Sprintf("internal server error: %v", err))
+			return
+		}
+		if lockout > 0 {
+			common.RedisDB.Del(common.BaseCtx, key)
+			writeLockedOut(w, lockout)
+			return
+		}
+		writeError(w, http.StatusUnauthorized, "invalid code")
+		return
+	}
+	clearLoginFailures(challenge["username"])
+
+	common.RedisDB.Del(common.BaseCtx, key)
+
+	sessionData, err := createSession(challenge["username"], challenge["device"], r)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("internal server error: %v", err))
+		return
+	}
+	writeSession(w, sessionData)
+}
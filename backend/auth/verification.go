@@ -2,47 +2,213 @@
 package auth
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
-	"os"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/go-redis/redis/v8"
 	"github.com/gorilla/mux"
-	"github.com/sendgrid/rest"
-	"github.com/sendgrid/sendgrid-go/helpers/mail"
 	"github.com/soumitradev/Dwitter/backend/common"
+	"github.com/soumitradev/Dwitter/backend/mailer"
 	"github.com/soumitradev/Dwitter/backend/prisma/db"
+	"github.com/soumitradev/Dwitter/backend/subscriptions"
+	"github.com/soumitradev/Dwitter/backend/util"
 )
 
-// TODO: Make the email look better
-func SendVerificationEmail(emailID string, link string) (*rest.Response, error) {
-	from := mail.NewEmail("Dwitter", os.Getenv("SENDGRID_SENDER_EMAIL_ADDR"))
-	subject := "Dwitter account verification"
-	to := mail.NewEmail("Recipient", emailID)
-	plainTextContent := "Your verification link for Dwitter is: " + link + ".\nClick the link to verify your account.\nUnverified accounts are deleted after 1 hour."
-	htmlContent := "Your verification link for Dwitter is: " + "<a href=\"" + link + "\">" + link + "</a>\r\n" + "Click the link to verify your account.\r\n" + "<strong>Unverified accounts are deleted after 1 hour.</strong>"
-	message := mail.NewSingleEmail(from, subject, to, plainTextContent, htmlContent)
-	response, err := common.SendgridClient.Send(message)
-	return response, err
+// Email a verification link, in the language of the account it is for
+func SendVerificationEmail(emailID string, link string) error {
+	language := mailer.DefaultLanguage
+	user, err := common.Client.User.FindUnique(
+		db.User.Email.Equals(emailID),
+	).Exec(common.BaseCtx)
+	if err == nil {
+		language = user.Language
+	}
+
+	message, err := mailer.Render("verification", language, mailer.TemplateData{Link: link})
+	if err != nil {
+		return err
+	}
+	message.To = emailID
+	return mailer.Send(message)
+}
+
+// Unverified accounts are deleted once their verification link expires
+var verificationTTL = time.Hour
+
+// How often to look for expired unverified accounts
+var verificationSweepInterval = time.Minute * 5
+
+// Verification emails can only be resent this often
+var resendCooldown = time.Minute
+
+// Number of verification emails that can be resent in a verification period
+const maxResends = 5
+
+// A resendVerificationType stores the email to resend a verification link to
+type resendVerificationType struct {
+	Email string `json:"email"`
+}
+
+// Key that stores the username a verification token belongs to
+func verificationKey(token string) string {
+	return "verify:" + token
+}
+
+// Key that stores the current verification token of a username, so that resending replaces it
+func userVerificationKey(username string) string {
+	return "verify:user:" + username
+}
+
+// Create a verification token for a new account and email the link to it
+func StartVerification(username string, email string) error {
+	token := util.GenSecureID(32)
+
+	// Only the newest link should work
+	oldToken, err := common.RedisDB.Get(common.BaseCtx, userVerificationKey(username)).Result()
+	if err != nil && err != redis.Nil {
+		return fmt.Errorf("internal server error: %v", err)
+	}
+
+	_, err = common.RedisDB.TxPipelined(common.BaseCtx, func(pipe redis.Pipeliner) error {
+		if oldToken != "" {
+			pipe.Del(common.BaseCtx, verificationKey(oldToken))
+		}
+		pipe.Set(common.BaseCtx, verificationKey(token), username, verificationTTL)
+		pipe.Set(common.BaseCtx, userVerificationKey(username), token, verificationTTL)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("internal server error: %v", err)
+	}
+
+	link := subscriptions.AppURL() + "/api/verify/" + token
+	err = SendVerificationEmail(email, link)
+	if err != nil {
+		return errors.New("error sending verification email, please try again later")
+	}
+	return nil
+}
+
+// Delete accounts that weren't verified in time, every few minutes.
+// This reads from the database so that accounts made before a restart are cleaned up too.
+func SweepUnverifiedAccounts() {
+	for {
+		sweepUnverifiedAccounts()
+		time.Sleep(verificationSweepInterval)
+	}
 }
 
-func DeleteUserAfterExpire(minutes int, token string) {
-	time.Sleep(time.Minute * time.Duration(minutes))
-	if username, found := common.AccountCreatedButNotVerified[token]; found {
-		_, err := common.InternalDeleteUser(username)
+func sweepUnverifiedAccounts() {
+	// Only one server has to do this at a time
+	locked, err := common.RedisDB.SetNX(common.BaseCtx, "verify:sweep", "1", verificationSweepInterval).Result()
+	if err != nil || !locked {
+		return
+	}
+
+	expired, err := common.Client.User.FindMany(
+		db.User.Verified.Equals(false),
+		db.User.CreatedAt.Before(time.Now().UTC().Add(-verificationTTL)),
+	).Exec(common.BaseCtx)
+	if err != nil {
+		fmt.Printf("Error finding unverified users: %v\n", err)
+		return
+	}
+
+	for _, user := range expired {
+		// A link that was resent recently is still allowed to be used
+		pending, err := common.RedisDB.Exists(common.BaseCtx, userVerificationKey(user.Username)).Result()
+		if err != nil || pending > 0 {
+			continue
+		}
+
+		_, err = common.InternalDeleteUser(user.Username)
 		if err != nil {
-			fmt.Printf("Error deleting user: %v", err)
+			fmt.Printf("Error deleting user: %v\n", err)
+			continue
 		}
+		common.RedisDB.Del(common.BaseCtx, userVerificationKey(user.Username))
 	}
 }
 
+// Handles requests to send a new verification link
+func ResendVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	var resendRequest resendVerificationType
+	if !decodeJSONBody(w, r, &resendRequest) {
+		return
+	}
+
+	err := common.Validate.Var(resendRequest.Email, "required,email,lte=100")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Limit resends per address so that this can't be used to flood someone's inbox
+	email := strings.ToLower(resendRequest.Email)
+	allowed, err := common.RedisDB.SetNX(common.BaseCtx, "verify:resend:"+email, "1", resendCooldown).Result()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("internal server error: %v", err))
+		return
+	}
+	resends, err := common.RedisDB.Incr(common.BaseCtx, "verify:resends:"+email).Result()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("internal server error: %v", err))
+		return
+	}
+	if resends == 1 {
+		common.RedisDB.Expire(common.BaseCtx, "verify:resends:"+email, verificationTTL)
+	}
+	if !allowed || resends > maxResends {
+		w.Header().Set("Retry-After", strconv.Itoa(int(resendCooldown.Seconds())))
+		writeError(w, http.StatusTooManyRequests, "too many verification emails requested, try again later")
+		return
+	}
+
+	// Answer the same way whether or not there's an unverified account with this email
+	user, err := common.Client.User.FindUnique(
+		db.User.Email.Equals(resendRequest.Email),
+	).Exec(common.BaseCtx)
+	if err != nil && err != db.ErrNotFound {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("internal server error: %v", err))
+		return
+	}
+
+	if err == nil && !user.Verified {
+		err = StartVerification(user.Username, user.Email)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "If an unverified account with that email exists, a new verification link has been sent to it",
+	})
+}
+
 // TODO: Make the thing actually send the emoji
 func VerifyHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	token := vars["token"]
 
-	if username, found := common.AccountCreatedButNotVerified[token]; found {
-		delete(common.AccountCreatedButNotVerified, token)
+	// Tokens can only be used once, so remove it as we read it
+	username, err := common.RedisDB.GetDel(common.BaseCtx, verificationKey(token)).Result()
+	if err != nil && err != redis.Nil {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusInternalServerError)
+		res := fmt.Sprintf("internal server error: %v", err)
+		w.Write([]byte(res))
+		return
+	}
+
+	if err == nil {
+		common.RedisDB.Del(common.BaseCtx, userVerificationKey(username))
 
 		_, err := common.Client.User.FindUnique(
 			db.User.Username.Equals(username),
@@ -54,12 +220,14 @@ func VerifyHandler(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusNotFound)
 			res := fmt.Sprintf("user not found: %v", err)
 			w.Write([]byte(res))
+			return
 		}
 		if err != nil {
 			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 			w.WriteHeader(http.StatusInternalServerError)
 			res := fmt.Sprintf("internal server error: %v", err)
 			w.Write([]byte(res))
+			return
 		}
 
 		verifiedHTML := "Account verified!\nYou may close this tab and sign in now."
@@ -1314,3 +1314,79 @@ func DeleteDweetCacheUpdate(dweetID string) error {
 
 	return nil
 }
+
+func EmailChangeCacheUpdate(username string, email string) error {
+	// Only overwrite the email if the user is cached, and keep it expiring with the rest of the user
+	for _, detailLevel := range []string{"basic", "full"} {
+		err := cacheDB.SetXX(common.BaseCtx, GenerateKey("user", detailLevel, username, "email"), email, redis.KeepTTL).Err()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete every key stored for a user
+func deleteUserKeys(username string) error {
+	iter := cacheDB.Scan(common.BaseCtx, 0, GenerateKey("user", "*", username, "*"), 100).Iterator()
+	for iter.Next(common.BaseCtx) {
+		err := cacheDB.Del(common.BaseCtx, iter.Val()).Err()
+		if err != nil {
+			return err
+		}
+	}
+	return iter.Err()
+}
+
+// Drop every cached version of some users, for changes the cached lists can't be updated with
+func DropUsers(usernames ...string) error {
+	for _, username := range usernames {
+		err := deleteUserKeys(username)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Removal of users destroys the user object, their dweets, redweets and likes
+// The users they followed and were followed by are destroyed too, since their follow lists and counts changed
+// The user needs to have been fetched with their dweets, redweets, liked dweets, followers and following
+func DeleteUserCacheUpdate(user db.UserModel) error {
+	for _, dweet := range user.Dweets() {
+		err := DeleteDweetCacheUpdate(dweet.ID)
+		if err != nil && err != redis.Nil {
+			return err
+		}
+	}
+
+	for _, redweet := range user.Redweets() {
+		err := unredweetCacheUpdateInternal(redweet.OriginalRedweetID, user.Username)
+		if err != nil && err != redis.Nil {
+			return err
+		}
+	}
+
+	for _, liked := range user.LikedDweets() {
+		err := unlikeCacheUpdateInternal(liked.ID, user.Username)
+		if err != nil && err != redis.Nil {
+			return err
+		}
+	}
+
+	for _, follower := range user.Followers() {
+		err := deleteUserKeys(follower.Username)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, followed := range user.Following() {
+		err := deleteUserKeys(followed.Username)
+		if err != nil {
+			return err
+		}
+	}
+
+	return deleteUserKeys(user.Username)
+}
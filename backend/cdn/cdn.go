@@ -125,8 +125,7 @@ func DeleteLocation(location string, deleteThumb bool) error {
 // Handle media upload requests
 func UploadMediaHandler(w http.ResponseWriter, r *http.Request) {
 	// Check authentication
-	authHeader := r.Header.Get("authorization")
-	_, err := auth.Authenticate(authHeader)
+	_, err := auth.AuthenticateRequest(r, auth.ScopeMedia)
 
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
@@ -370,9 +369,15 @@ func UploadMediaHandler(w http.ResponseWriter, r *http.Request) {
 			}
 
 			mediaLink := writer.Attrs().MediaLink
-			common.MediaCreatedButNotUsed[mediaLink] = true
-
-			go destroyObjectAfterExpire(10, mediaLink)
+			err = markMediaUnused(mediaLink)
+			if err != nil {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(common.HTTPError{
+					Error: err.Error(),
+				})
+				return
+			}
 
 			links = append(links, mediaLink)
 		}
@@ -386,25 +391,14 @@ func UploadMediaHandler(w http.ResponseWriter, r *http.Request) {
 // Handle pfp upload requests
 func UploadPFPHandler(w http.ResponseWriter, r *http.Request) {
 	// Check authentication
-	// authHeader := r.Header.Get("authorization")
-	cookie, _ := r.Cookie("session")
-	var username string
-	if cookie != nil {
-		cookieString := cookie.Value
-		_, err := auth.Authenticate(cookieString)
-		if err != nil {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusUnauthorized)
-			json.NewEncoder(w).Encode(common.HTTPError{
-				Error: err.Error(),
-			})
-		}
-	} else {
+	username, err := auth.AuthenticateRequest(r, auth.ScopeMedia)
+	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusUnauthorized)
 		json.NewEncoder(w).Encode(common.HTTPError{
-			Error: "No cookie",
+			Error: err.Error(),
 		})
+		return
 	}
 
 	supportedFormats := map[string]bool{
@@ -428,7 +422,7 @@ func UploadPFPHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Limit size to 8MB
-	err := r.ParseMultipartForm(8 << 20)
+	err = r.ParseMultipartForm(8 << 20)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusRequestEntityTooLarge)
@@ -583,18 +577,3 @@ func generateVideoThumbnail(videoBytes []byte) ([]byte, error) {
 
 	return imageBytes, nil
 }
-
-// Destroy an object when it expires
-func destroyObjectAfterExpire(minutes int, id string) {
-	time.Sleep(time.Minute * time.Duration(minutes))
-	if common.MediaCreatedButNotUsed[id] {
-		loc, err := LinkToLocation(id)
-		if err != nil {
-			fmt.Printf("Error finding media: %v", err)
-		}
-		err = DeleteLocation(loc, true)
-		if err != nil {
-			fmt.Printf("Error auto-deleting media: %v", err)
-		}
-	}
-}
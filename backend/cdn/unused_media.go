@@ -0,0 +1,72 @@
+package cdn
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/soumitradev/Dwitter/backend/common"
+)
+
+// Sorted set of uploaded media that no dweet uses yet, scored by when it gets deleted.
+// It is kept in Redis so that a dweet made on any server saves media uploaded to another one.
+const unusedMediaKey = "media:unused"
+
+// How long uploaded media waits to be used in a dweet before it is deleted
+var unusedMediaTTL = time.Minute * 10
+
+// How often to look for unused media to delete
+var unusedMediaSweepInterval = time.Minute
+
+// Delete uploaded media if no dweet uses it in time
+func markMediaUnused(link string) error {
+	return common.RedisDB.ZAdd(common.BaseCtx, unusedMediaKey, &redis.Z{
+		Score:  float64(time.Now().Add(unusedMediaTTL).Unix()),
+		Member: link,
+	}).Err()
+}
+
+// Keep uploaded media that a dweet uses
+func MarkMediaUsed(links []string) error {
+	if len(links) == 0 {
+		return nil
+	}
+	members := []interface{}{}
+	for _, link := range links {
+		members = append(members, link)
+	}
+	return common.RedisDB.ZRem(common.BaseCtx, unusedMediaKey, members...).Err()
+}
+
+// Delete uploaded media that wasn't used in time, every minute
+func SweepUnusedMedia() {
+	for {
+		expired, err := common.RedisDB.ZRangeByScore(common.BaseCtx, unusedMediaKey, &redis.ZRangeBy{
+			Min: "-inf",
+			Max: strconv.FormatInt(time.Now().Unix(), 10),
+		}).Result()
+		if err != nil {
+			fmt.Printf("Error reading unused media: %v\n", err)
+		}
+
+		for _, link := range expired {
+			// Only the server that manages to remove the media from the set deletes it
+			removed, err := common.RedisDB.ZRem(common.BaseCtx, unusedMediaKey, link).Result()
+			if err != nil || removed == 0 {
+				continue
+			}
+
+			loc, err := LinkToLocation(link)
+			if err != nil {
+				fmt.Printf("Error finding media: %v\n", err)
+				continue
+			}
+			err = DeleteLocation(loc, true)
+			if err != nil {
+				fmt.Printf("Error auto-deleting media: %v\n", err)
+			}
+		}
+		time.Sleep(unusedMediaSweepInterval)
+	}
+}
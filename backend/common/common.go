@@ -13,9 +13,7 @@ import (
 	"cloud.google.com/go/storage"
 	"github.com/functionalfoundry/graphqlws"
 	"github.com/go-playground/validator/v10"
-	"golang.org/x/crypto/bcrypt"
-
-	"github.com/sendgrid/sendgrid-go"
+	"github.com/go-redis/redis/v8"
 )
 
 const DefaultPFPURL = "https://storage.googleapis.com/download/storage/v1/b/dwitter-72e9d.appspot.com/o/pfp%2Fdefault.jpg?alt=media"
@@ -23,12 +21,16 @@ const DefaultPFPURL = "https://storage.googleapis.com/download/storage/v1/b/dwit
 var Client *db.PrismaClient
 var BaseCtx context.Context
 var Bucket *storage.BucketHandle
-var MediaCreatedButNotUsed map[string]bool
-var AccountCreatedButNotVerified map[string]string
 var SubscriptionManager graphqlws.SubscriptionManager
 var GraphqlwsHandler http.Handler
 var Validate *validator.Validate
-var SendgridClient *sendgrid.Client
+
+// Redis on port 6420, which keeps sessions, the job queue, events and everything else the cache could throw away
+var RedisDB *redis.Client
+
+// Errors returned by CheckCreds
+var ErrBadCredentials = errors.New("username/password error")
+var ErrNotVerified = errors.New("account not verified: please check your email for a verification link")
 
 type HTTPError struct {
 	Error string `json:"error"`
@@ -36,12 +38,33 @@ type HTTPError struct {
 
 func init() {
 	BaseCtx = context.Background()
-	MediaCreatedButNotUsed = make(map[string]bool)
-	AccountCreatedButNotVerified = make(map[string]string)
 }
 
-func InitSendgrid() {
-	SendgridClient = sendgrid.NewSendClient(os.Getenv("SENDGRID_API_KEY"))
+// Connect to the Redis on port 6420. Every package shares this one client.
+func InitRedis() {
+	RedisDB = redis.NewClient(&redis.Options{
+		Addr:     "localhost:6420",
+		Password: os.Getenv("REDIS_6420_PASS"),
+		DB:       0,
+	})
+}
+
+// Check that a new password is strong enough
+func ValidatePassword(password string) error {
+	// The longest password allowed is the longest one that gets hashed
+	if len(password) > MaxPasswordLength {
+		return ErrPasswordTooLong
+	}
+
+	err := Validate.Var(password, "required,gte=8,containsany=ABCDEFGHIJKLMNOPQRSTUVWXYZ,containsany=abcdefghijklmnopqrstuvwxyz,containsany=1234567890,containsany=!@#$%^&*`~-_=+/?.")
+	if err != nil {
+		return fmt.Errorf("password must be minimum eight characters, have at least one uppercase letter, one lowercase letter, one number and one special character : %v", err)
+	}
+
+	if IsBreachedPassword(password) {
+		return ErrBreachedPassword
+	}
+	return nil
 }
 
 // Check given credentials and return true if valid
@@ -50,16 +73,38 @@ func CheckCreds(username string, password string) (bool, error) {
 		db.User.Username.Equals(username),
 	).Exec(BaseCtx)
 	if err != nil {
-		return false, errors.New("username/password error")
+		return false, ErrBadCredentials
 	}
 
 	if !user.Verified {
-		return false, errors.New("account not verified: please check your email for a verification link")
+		return false, ErrNotVerified
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
+	valid, needsRehash, err := VerifyPassword(password, user.PasswordHash)
+	if err != nil || !valid {
+		return false, ErrBadCredentials
+	}
+
+	// Only tell people they are suspended once they've proven who they are
+	err = SuspensionError(user)
 	if err != nil {
-		return false, errors.New("username/password error")
+		return false, err
+	}
+
+	// Upgrade hashes made with an older algorithm or weaker parameters while we have the password
+	// Failing to do so doesn't stop the login, since the old hash still works
+	if needsRehash {
+		passwordHash, err := HashPassword(password)
+		if err == nil {
+			_, err = Client.User.FindUnique(
+				db.User.Username.Equals(username),
+			).Update(
+				db.User.PasswordHash.Set(passwordHash),
+			).Exec(BaseCtx)
+		}
+		if err != nil {
+			fmt.Printf("Error upgrading password hash of %s: %v\n", username, err)
+		}
 	}
 	return true, nil
 }
@@ -134,6 +179,13 @@ func InternalDeleteDweet(postID string) (*db.DweetModel, error) {
 		return nil, err
 	}
 
+	_, err = Client.Notification.FindMany(
+		db.Notification.DweetID.Equals(postID),
+	).Delete().Exec(BaseCtx)
+	if err != nil {
+		return nil, err
+	}
+
 	// The following comment block is kept as a homage to the great recursive SQL function that once resided here.
 	// May the soul of this legendary query rest in peace. It was a honor to use you.
 
@@ -202,6 +254,37 @@ func InternalDeleteUser(username string) (*db.UserModel, error) {
 		}
 	}
 
+	_, err = Client.Identity.FindMany(
+		db.Identity.UserID.Equals(username),
+	).Delete().Exec(BaseCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = Client.APIToken.FindMany(
+		db.APIToken.OwnerID.Equals(username),
+	).Delete().Exec(BaseCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = Client.NotificationPreference.FindMany(
+		db.NotificationPreference.UserID.Equals(username),
+	).Delete().Exec(BaseCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = Client.Notification.FindMany(
+		db.Notification.Or(
+			db.Notification.RecipientID.Equals(username),
+			db.Notification.ActorID.Equals(username),
+		),
+	).Delete().Exec(BaseCtx)
+	if err != nil {
+		return nil, err
+	}
+
 	_, err = Client.User.FindUnique(
 		db.User.Username.Equals(username),
 	).Delete().Exec(BaseCtx)
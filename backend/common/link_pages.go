@@ -0,0 +1,36 @@
+package common
+
+import (
+	"html/template"
+	"net/http"
+)
+
+// Opening a link in an email must not change anything on its own, since mail scanners open links too
+var confirmLinkPage = template.Must(template.New("confirm").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{.Button}}</title></head>
+<body>
+<form method="POST">
+<p>{{.Question}}</p>
+<button type="submit">{{.Button}}</button>
+</form>
+</body>
+</html>
+`))
+
+// Ask to confirm what a link does with a form that POSTs back to it
+func WriteConfirmPage(w http.ResponseWriter, question string, button string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	confirmLinkPage.Execute(w, map[string]string{
+		"Question": question,
+		"Button":   button,
+	})
+}
+
+// Write a plain text answer to a link that was clicked
+func WriteLinkResponse(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write([]byte(message))
+}
@@ -0,0 +1,300 @@
+package common
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Longest password we hash, so that huge passwords can't be used to slow the server down
+const MaxPasswordLength = 256
+
+// An Argon2Params stores the cost of argon2id hashes
+type Argon2Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// Parameters new hashes are made with. Hashes made with other parameters get upgraded on login.
+var PasswordHashParams = Argon2Params{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// SHA-1 hashes of passwords known to be in breaches, in uppercase hex, when the list is made of plain passwords
+var breachedPasswords = map[string]bool{}
+
+// The breached password list when it is made of hashes. Those lists are tens of gigabytes, so they are searched on disk.
+var breachedHashFile *sortedHashFile
+
+// Hashing with argon2id takes PasswordHashParams.Memory for a while, so only this many hashes run at once
+var hashSlots chan struct{}
+
+var ErrPasswordTooLong = fmt.Errorf("password can't be longer than %d bytes", MaxPasswordLength)
+var ErrBreachedPassword = errors.New("this password has appeared in a data breach, please choose another one")
+
+// Read argon2id parameters from ARGON2_MEMORY (in KiB), ARGON2_ITERATIONS, ARGON2_PARALLELISM and ARGON2_CONCURRENCY,
+// and load the breached password list from BREACHED_PASSWORDS_FILE
+func InitPasswordHashing() {
+	concurrency := runtime.NumCPU()
+	if limit, err := strconv.Atoi(os.Getenv("ARGON2_CONCURRENCY")); err == nil && limit > 0 {
+		concurrency = limit
+	}
+	hashSlots = make(chan struct{}, concurrency)
+
+	if memory, err := strconv.ParseUint(os.Getenv("ARGON2_MEMORY"), 10, 32); err == nil && memory > 0 {
+		PasswordHashParams.Memory = uint32(memory)
+	}
+	if iterations, err := strconv.ParseUint(os.Getenv("ARGON2_ITERATIONS"), 10, 32); err == nil && iterations > 0 {
+		PasswordHashParams.Iterations = uint32(iterations)
+	}
+	if parallelism, err := strconv.ParseUint(os.Getenv("ARGON2_PARALLELISM"), 10, 8); err == nil && parallelism > 0 {
+		PasswordHashParams.Parallelism = uint8(parallelism)
+	}
+
+	path := os.Getenv("BREACHED_PASSWORDS_FILE")
+	if path == "" {
+		path = "breached_passwords.txt"
+	}
+	err := loadBreachedPasswords(path)
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Printf("Error loading breached passwords: %v\n", err)
+	}
+}
+
+// Load a list of breached passwords, one per line.
+// Lines can be plain passwords, or SHA-1 hashes sorted in order like the ones from Have I Been Pwned (HASH:count).
+// Lists of hashes stay on disk and are binary searched, plain passwords are read into memory.
+func loadBreachedPasswords(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if _, ok := hashFromLine(line); ok {
+			info, err := file.Stat()
+			if err != nil {
+				file.Close()
+				return err
+			}
+			breachedHashFile = &sortedHashFile{file: file, size: info.Size()}
+			return nil
+		}
+		breachedPasswords[sha1Hex(line)] = true
+	}
+	file.Close()
+	return scanner.Err()
+}
+
+// Read the SHA-1 hash at the start of a line like HASH:count
+func hashFromLine(line string) (string, bool) {
+	hash := strings.TrimSpace(strings.SplitN(line, ":", 2)[0])
+	if _, err := hex.DecodeString(hash); err != nil || len(hash) != sha1.Size*2 {
+		return "", false
+	}
+	return strings.ToUpper(hash), true
+}
+
+// A sortedHashFile is a file of SHA-1 hashes, one per line, sorted in order
+type sortedHashFile struct {
+	file io.ReaderAt
+	size int64
+}
+
+// Read the first line that starts at or after an offset.
+// Returns where it starts, its hash, and where the line after it starts.
+func (f *sortedHashFile) lineFrom(offset int64) (int64, string, int64, error) {
+	start := offset
+	if offset > 0 {
+		start = offset - 1
+	}
+	reader := bufio.NewReaderSize(io.NewSectionReader(f.file, start, f.size-start), 256)
+
+	// Unless the offset is right after a newline, it is in the middle of a line that belongs to the lines before it
+	if offset > 0 {
+		skipped, err := reader.ReadString('\n')
+		if err == io.EOF {
+			return f.size, "", f.size, nil
+		}
+		if err != nil {
+			return 0, "", 0, err
+		}
+		start += int64(len(skipped))
+	}
+
+	line, err := reader.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return 0, "", 0, err
+	}
+	if line == "" {
+		return f.size, "", f.size, nil
+	}
+	hash, _ := hashFromLine(line)
+	return start, hash, start + int64(len(line)), nil
+}
+
+// Binary search the file for a hash
+func (f *sortedHashFile) contains(hash string) (bool, error) {
+	// Lines starting before low have smaller hashes, and lines starting at or after high have bigger ones
+	low, high := int64(0), f.size
+	for low < high {
+		middle := low + (high-low)/2
+		start, lineHash, next, err := f.lineFrom(middle)
+		if err != nil {
+			return false, err
+		}
+		switch {
+		case start >= high || lineHash > hash:
+			high = middle
+		case lineHash < hash:
+			low = next
+		default:
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func sha1Hex(password string) string {
+	digest := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(digest[:]))
+}
+
+// Check if a password is in the breached password list
+func IsBreachedPassword(password string) bool {
+	hash := sha1Hex(password)
+	if breachedHashFile != nil {
+		found, err := breachedHashFile.contains(hash)
+		if err != nil {
+			fmt.Printf("Error searching breached passwords: %v\n", err)
+		}
+		return found
+	}
+	return breachedPasswords[hash]
+}
+
+// Run argon2id once a hashing slot is free
+func argon2IDKey(password []byte, salt []byte, params Argon2Params) []byte {
+	if hashSlots != nil {
+		hashSlots <- struct{}{}
+		defer func() { <-hashSlots }()
+	}
+	return argon2.IDKey(password, salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+}
+
+// Hash a password with argon2id, in the PHC string format
+// e.g. $argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>
+func HashPassword(password string) (string, error) {
+	if len(password) > MaxPasswordLength {
+		return "", ErrPasswordTooLong
+	}
+
+	params := PasswordHashParams
+	salt := make([]byte, params.SaltLength)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", err
+	}
+
+	hash := argon2IDKey([]byte(password), salt, params)
+	return fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		params.Memory,
+		params.Iterations,
+		params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(hash),
+	), nil
+}
+
+// Split an argon2id PHC string into its parameters, salt and hash
+func parseArgon2Hash(encoded string) (Argon2Params, []byte, []byte, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return Argon2Params{}, nil, nil, errors.New("invalid argon2id hash")
+	}
+
+	var version int
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return Argon2Params{}, nil, nil, errors.New("unsupported argon2 version")
+	}
+
+	params := Argon2Params{}
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism)
+	if err != nil {
+		return Argon2Params{}, nil, nil, errors.New("invalid argon2id parameters")
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return Argon2Params{}, nil, nil, errors.New("invalid argon2id salt")
+	}
+	hash, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return Argon2Params{}, nil, nil, errors.New("invalid argon2id hash")
+	}
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(hash))
+
+	return params, salt, hash, nil
+}
+
+// Check a password against a stored hash.
+// Also returns whether the hash should be replaced, because it uses an older algorithm or parameters.
+func VerifyPassword(password string, encoded string) (bool, bool, error) {
+	if len(password) > MaxPasswordLength {
+		return false, false, nil
+	}
+
+	// Accounts made before argon2id have bcrypt hashes
+	if strings.HasPrefix(encoded, "$2") {
+		err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return false, false, nil
+		}
+		if err != nil {
+			return false, false, err
+		}
+		return true, true, nil
+	}
+
+	params, salt, hash, err := parseArgon2Hash(encoded)
+	if err != nil {
+		return false, false, err
+	}
+
+	computed := argon2IDKey([]byte(password), salt, params)
+	if subtle.ConstantTimeCompare(hash, computed) != 1 {
+		return false, false, nil
+	}
+
+	return true, params != PasswordHashParams, nil
+}
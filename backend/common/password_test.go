@@ -0,0 +1,139 @@
+package common
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// Write a breached password list to a temporary file and load it
+func loadTestBreachedPasswords(t *testing.T, lines []string) {
+	path := filepath.Join(t.TempDir(), "breached_passwords.txt")
+	err := ioutil.WriteFile(path, []byte(strings.Join(lines, "\r\n")+"\r\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	breachedPasswords = map[string]bool{}
+	breachedHashFile = nil
+	err = loadBreachedPasswords(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if breachedHashFile != nil {
+			breachedHashFile.file.(*os.File).Close()
+		}
+		breachedPasswords = map[string]bool{}
+		breachedHashFile = nil
+	})
+}
+
+func TestBreachedPasswordHashes(t *testing.T) {
+	breached := []string{"password", "123456", "qwerty", "letmein", "dragon", "a", "zzzzzzzz"}
+	lines := []string{}
+	for i, password := range breached {
+		lines = append(lines, sha1Hex(password)+":"+strings.Repeat("9", i+1))
+	}
+	sort.Strings(lines)
+	loadTestBreachedPasswords(t, lines)
+
+	if breachedHashFile == nil {
+		t.Fatal("a list of hashes was read into memory instead of searched on disk")
+	}
+	for _, password := range breached {
+		if !IsBreachedPassword(password) {
+			t.Errorf("IsBreachedPassword(%q) = false, want true", password)
+		}
+	}
+	for _, password := range []string{"correct horse battery staple", "", "Password", "zzzzzzzzz"} {
+		if IsBreachedPassword(password) {
+			t.Errorf("IsBreachedPassword(%q) = true, want false", password)
+		}
+	}
+}
+
+func TestSortedHashFileEdges(t *testing.T) {
+	lines := []string{
+		"0000000000000000000000000000000000000000:1",
+		"7FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF:2",
+		"FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF:3",
+	}
+	loadTestBreachedPasswords(t, lines)
+
+	tests := map[string]bool{
+		"0000000000000000000000000000000000000000": true,
+		"7FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF": true,
+		"FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF": true,
+		"0000000000000000000000000000000000000001": false,
+		"8000000000000000000000000000000000000000": false,
+		"FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFE": false,
+	}
+	for hash, want := range tests {
+		found, err := breachedHashFile.contains(hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found != want {
+			t.Errorf("contains(%s) = %v, want %v", hash, found, want)
+		}
+	}
+}
+
+func TestBreachedPlainPasswords(t *testing.T) {
+	loadTestBreachedPasswords(t, []string{"password", "hunter2"})
+
+	if breachedHashFile != nil {
+		t.Fatal("a list of plain passwords was searched as hashes")
+	}
+	if !IsBreachedPassword("hunter2") {
+		t.Error("IsBreachedPassword(\"hunter2\") = false, want true")
+	}
+	if IsBreachedPassword("hunter3") {
+		t.Error("IsBreachedPassword(\"hunter3\") = true, want false")
+	}
+}
+
+func TestHashPassword(t *testing.T) {
+	hashSlots = make(chan struct{}, 1)
+	defer func() { hashSlots = nil }()
+
+	hash, err := HashPassword("hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid, needsRehash, err := VerifyPassword("hunter2", hash)
+	if err != nil || !valid || needsRehash {
+		t.Errorf("VerifyPassword(right password) = %v, %v, %v, want true, false, nil", valid, needsRehash, err)
+	}
+	valid, _, err = VerifyPassword("hunter3", hash)
+	if err != nil || valid {
+		t.Errorf("VerifyPassword(wrong password) = %v, %v, want false, nil", valid, err)
+	}
+}
+
+func TestValidatePasswordLength(t *testing.T) {
+	Validate = validator.New()
+	strong := "Aa1!"
+
+	tests := []struct {
+		password string
+		want     error
+	}{
+		{strings.Repeat(strong, MaxPasswordLength/len(strong)), nil},
+		{strings.Repeat(strong, MaxPasswordLength/len(strong)) + "a", ErrPasswordTooLong},
+	}
+
+	for _, test := range tests {
+		err := ValidatePassword(test.password)
+		if err != test.want {
+			t.Errorf("ValidatePassword() of %d bytes = %v, want %v", len(test.password), err, test.want)
+		}
+	}
+}
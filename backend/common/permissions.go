@@ -0,0 +1,116 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/soumitradev/Dwitter/backend/prisma/db"
+	"github.com/soumitradev/Dwitter/backend/util"
+)
+
+// Roles a user can have
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// Things only some roles are allowed to do
+const (
+	PermDeleteAnyDweet = "dweet:delete:any"
+	PermEditAnyUser    = "user:edit:any"
+	PermDeleteAnyUser  = "user:delete:any"
+	PermSuspendUser    = "user:suspend"
+	PermViewReports    = "report:view"
+	PermManageRoles    = "role:manage"
+	PermViewAuditLog   = "audit:view"
+	PermViewInstances  = "instance:view"
+)
+
+var rolePermissions = map[string]map[string]bool{
+	RoleUser: {},
+	RoleModerator: {
+		PermDeleteAnyDweet: true,
+		PermSuspendUser:    true,
+		PermViewReports:    true,
+	},
+	RoleAdmin: {
+		PermDeleteAnyDweet: true,
+		PermEditAnyUser:    true,
+		PermDeleteAnyUser:  true,
+		PermSuspendUser:    true,
+		PermViewReports:    true,
+		PermManageRoles:    true,
+		PermViewAuditLog:   true,
+		PermViewInstances:  true,
+	},
+}
+
+var ErrForbidden = errors.New("Unauthorized: you don't have permission to do this")
+
+// Check if a role exists
+func IsValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// Check if a user's role has a permission
+func HasPermission(username string, permission string) (bool, error) {
+	user, err := Client.User.FindUnique(
+		db.User.Username.Equals(username),
+	).Exec(BaseCtx)
+	if err == db.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("internal server error: %v", err)
+	}
+	return rolePermissions[user.Role][permission], nil
+}
+
+// Check that a user can act on something owned by someone.
+// Owners can always act on their own things, anyone else needs the permission.
+func Authorize(actor string, owner string, permission string) error {
+	if actor == owner {
+		return nil
+	}
+
+	allowed, err := HasPermission(actor, permission)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// Write down a privileged action. Failing to write it doesn't stop the action, but is logged.
+func WriteAuditLog(actor string, action string, targetType string, targetID string, details string) {
+	_, err := Client.AuditLog.CreateOne(
+		db.AuditLog.ActorID.Set(actor),
+		db.AuditLog.Action.Set(action),
+		db.AuditLog.TargetType.Set(targetType),
+		db.AuditLog.TargetID.Set(targetID),
+		db.AuditLog.Details.Set(details),
+		db.AuditLog.CreatedAt.Set(time.Now().UTC()),
+	).Exec(BaseCtx)
+	if err != nil {
+		fmt.Printf("Error writing audit log: %v\n", err)
+	}
+}
+
+// Get the error to send a suspended user, or nil if they aren't suspended
+func SuspensionError(user *db.UserModel) error {
+	suspendedUntil, suspended := user.SuspendedUntil()
+	if !suspended || time.Now().UTC().After(suspendedUntil) {
+		return nil
+	}
+
+	message := "account suspended until " + suspendedUntil.UTC().Format(util.TimeUTCFormat)
+	if user.SuspensionReason != "" {
+		message += ": " + user.SuspensionReason
+	}
+	return errors.New(message)
+}
@@ -0,0 +1,77 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/soumitradev/Dwitter/backend/auth"
+	"github.com/soumitradev/Dwitter/backend/cache"
+	"github.com/soumitradev/Dwitter/backend/cdn"
+	"github.com/soumitradev/Dwitter/backend/common"
+	"github.com/soumitradev/Dwitter/backend/prisma/db"
+)
+
+// Delete a media object and its thumbnail if there is one, logging anything that goes wrong
+func deleteMediaLink(link string, deleteThumb bool) {
+	loc, err := cdn.LinkToLocation(link)
+	if err != nil {
+		return
+	}
+	err = cdn.DeleteLocation(loc, deleteThumb)
+	if err != nil {
+		fmt.Printf("Error deleting media %s: %v\n", loc, err)
+	}
+}
+
+// Delete a user along with everything they made: dweets, redweets, likes, follows, uploaded media and cache entries
+func PurgeUser(username string) error {
+	user, err := common.Client.User.FindUnique(
+		db.User.Username.Equals(username),
+	).With(
+		db.User.Dweets.Fetch(),
+		db.User.Redweets.Fetch(),
+		db.User.LikedDweets.Fetch(),
+		db.User.Followers.Fetch(),
+		db.User.Following.Fetch(),
+	).Exec(common.BaseCtx)
+	if err != nil {
+		return err
+	}
+
+	for _, dweet := range user.Dweets() {
+		for _, mediaLink := range dweet.Media {
+			deleteMediaLink(mediaLink, true)
+		}
+	}
+
+	// Everyone starts with the default profile picture, which isn't theirs to delete
+	if loc, err := cdn.LinkToLocation(user.ProfilePicURL); err == nil && strings.HasPrefix(loc, "pfp/") {
+		deleteMediaLink(user.ProfilePicURL, false)
+	}
+
+	err = cache.DeleteUserCacheUpdate(*user)
+	if err != nil {
+		return err
+	}
+
+	_, err = common.InternalDeleteUser(username)
+	return err
+}
+
+// Delete accounts whose grace period is over, every few minutes
+func SweepDeletedAccounts() {
+	for {
+		due, err := auth.DueAccountDeletions()
+		if err != nil {
+			fmt.Printf("Error finding accounts to delete: %v\n", err)
+		}
+		for _, user := range due {
+			err = PurgeUser(user.Username)
+			if err != nil {
+				fmt.Printf("Error deleting user: %v\n", err)
+			}
+		}
+		time.Sleep(auth.AccountDeletionSweepInterval)
+	}
+}
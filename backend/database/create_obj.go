@@ -8,12 +8,12 @@ import (
 
 	"github.com/soumitradev/Dwitter/backend/auth"
 	"github.com/soumitradev/Dwitter/backend/cache"
+	"github.com/soumitradev/Dwitter/backend/cdn"
 	"github.com/soumitradev/Dwitter/backend/common"
+	"github.com/soumitradev/Dwitter/backend/events"
 	"github.com/soumitradev/Dwitter/backend/prisma/db"
 	"github.com/soumitradev/Dwitter/backend/schema"
-	"github.com/soumitradev/Dwitter/backend/subscriptions"
 	"github.com/soumitradev/Dwitter/backend/util"
-	"golang.org/x/crypto/bcrypt"
 )
 
 // Create a User
@@ -24,9 +24,9 @@ func SignUpUser(username string, password string, name string, bio string, email
 		return schema.UserType{}, err
 	}
 
-	err = common.Validate.Var(password, "required,lte=128,gte=8,containsany=ABCDEFGHIJKLMNOPQRSTUVWXYZ,containsany=abcdefghijklmnopqrstuvwxyz,containsany=1234567890,containsany=!@#$%^&*`~-_=+/?.")
+	err = common.ValidatePassword(password)
 	if err != nil {
-		return schema.UserType{}, fmt.Errorf("password must be minimum eight characters, maximum 128 characters, have at least one uppercase letter, one lowercase letter, one number and one special character : %v", err)
+		return schema.UserType{}, err
 	}
 
 	err = common.Validate.Var(name, "required,lte=80")
@@ -44,7 +44,7 @@ func SignUpUser(username string, password string, name string, bio string, email
 		return schema.UserType{}, err
 	}
 
-	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	passwordHash, err := common.HashPassword(password)
 	if err != nil {
 		return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
 	}
@@ -57,23 +57,10 @@ func SignUpUser(username string, password string, name string, bio string, email
 		db.User.Email.Equals(email),
 	).Exec(common.BaseCtx)
 	if (err1 == db.ErrNotFound) && (err2 == db.ErrNotFound) {
-		// Send verification email
-		token := util.GenToken(5)
-
-		common.AccountCreatedButNotVerified[token] = username
-		link := "http://localhost:5000/api/verify/" + token
-		_, err := auth.SendVerificationEmail(email, link)
-
-		go auth.DeleteUserAfterExpire(60, token)
-
-		if err != nil {
-			return schema.UserType{}, errors.New("error verifying email, please try again later")
-		}
-
 		// Create user if no such user exists
 		createdUser, err := common.Client.User.CreateOne(
 			db.User.Username.Set(username),
-			db.User.PasswordHash.Set(string(passwordHash)),
+			db.User.PasswordHash.Set(passwordHash),
 			db.User.Name.Set(name),
 			db.User.Email.Set(email),
 			db.User.Bio.Set(bio),
@@ -94,6 +81,12 @@ func SignUpUser(username string, password string, name string, bio string, email
 			return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
 		}
 
+		// Send verification email, the account is deleted if it isn't verified in time
+		err = auth.StartVerification(username, email)
+		if err != nil {
+			return schema.UserType{}, err
+		}
+
 		nuser, err := schema.FormatAsUserType(createdUser, []db.UserModel{}, []db.UserModel{}, "", []interface{}{}, true)
 		return nuser, err
 	} else {
@@ -169,15 +162,17 @@ func NewDweet(body, username string, mediaLinks []string) (schema.DweetType, err
 	}
 
 	// Mark media as used to prevent deletion on expiry
-	for _, link := range mediaLinks {
-		common.MediaCreatedButNotUsed[link] = false
-		delete(common.MediaCreatedButNotUsed, link)
+	err = cdn.MarkMediaUsed(mediaLinks)
+	if err != nil {
+		return schema.DweetType{}, fmt.Errorf("internal server error: %v", err)
 	}
 
-	subscriptions.NotifyUserSubscribersDweet("newDweet", *createdPost, createdPost.Author().Subscribers)
+	notifyUserSubscribers(createdPost.AuthorID, NotificationNewDweet, *createdPost)
+	notifyMentions(*createdPost)
 
 	// Format and return
 	post := schema.FormatAsDweetType(createdPost, []db.UserModel{}, []db.UserModel{})
+	events.Publish(events.Event{Type: events.DweetCreated, Actor: username, Owner: username, DweetID: post.ID, Object: post})
 	return post, err
 }
 
@@ -252,8 +247,9 @@ func NewReply(originalPostID string, body string, authorUsername string, mediaLi
 	if err != nil {
 		return schema.DweetType{}, fmt.Errorf("internal server error: %v", err)
 	}
-	for _, link := range mediaLinks {
-		delete(common.MediaCreatedButNotUsed, link)
+	err = cdn.MarkMediaUsed(mediaLinks)
+	if err != nil {
+		return schema.DweetType{}, fmt.Errorf("internal server error: %v", err)
 	}
 
 	err = cache.CreateReplyCacheUpdate(*createdReply)
@@ -262,7 +258,7 @@ func NewReply(originalPostID string, body string, authorUsername string, mediaLi
 	}
 
 	// Update original Dweet to show reply
-	replied, err := common.Client.Dweet.FindUnique(
+	_, err = common.Client.Dweet.FindUnique(
 		db.Dweet.ID.Equals(originalPostID),
 	).Update(
 		db.Dweet.ReplyDweets.Link(
@@ -277,11 +273,12 @@ func NewReply(originalPostID string, body string, authorUsername string, mediaLi
 		return schema.DweetType{}, fmt.Errorf("internal server error: %v", err)
 	}
 
-	subscriptions.NotifyDweetSubscribers("editDweet", *replied, replied.Subscribers)
-
-	subscriptions.NotifyUserSubscribersDweet("newDweet", *createdReply, createdReply.Author().Subscribers)
+	notifyReply(originalPostID, *createdReply)
+	notifyUserSubscribers(createdReply.AuthorID, NotificationNewDweet, *createdReply)
+	notifyMentions(*createdReply)
 
 	post := schema.FormatAsDweetType(createdReply, []db.UserModel{}, []db.UserModel{})
+	events.Publish(events.Event{Type: events.DweetCreated, Actor: authorUsername, Owner: authorUsername, DweetID: post.ID, Object: post})
 	return post, err
 }
 
@@ -366,7 +363,11 @@ func Redweet(originalPostID, username string) (schema.RedweetType, error) {
 		return schema.RedweetType{}, fmt.Errorf("internal server error: %v", err)
 	}
 
-	subscriptions.NotifyUserSubscribersRedweet("newDweet", *createdRedweet, createdRedweet.Author().Subscribers)
+	redweeted := createdRedweet.RedweetOf()
+	notify([]recipient{eventRecipient(*redweeted.Author(), NotificationRedweet)}, createdRedweet.AuthorID, NotificationRedweet, redweeted)
+	notifyUserSubscribers(createdRedweet.AuthorID, NotificationNewRedweet, *redweeted)
 
-	return schema.FormatAsRedweetType(createdRedweet), err
+	formatted := schema.FormatAsRedweetType(createdRedweet)
+	events.Publish(events.Event{Type: events.RedweetCreated, Actor: username, Owner: username, DweetID: originalPostID, Object: formatted})
+	return formatted, err
 }
@@ -1,12 +1,13 @@
 package database
 
 import (
-	"errors"
 	"fmt"
 
+	"github.com/soumitradev/Dwitter/backend/auth"
 	"github.com/soumitradev/Dwitter/backend/cache"
 	"github.com/soumitradev/Dwitter/backend/cdn"
 	"github.com/soumitradev/Dwitter/backend/common"
+	"github.com/soumitradev/Dwitter/backend/events"
 	"github.com/soumitradev/Dwitter/backend/prisma/db"
 	"github.com/soumitradev/Dwitter/backend/schema"
 	"github.com/soumitradev/Dwitter/backend/util"
@@ -14,6 +15,12 @@ import (
 
 // Delete a dweet
 func DeleteDweet(postID string, username string, repliesToFetch int, replyOffset int) (schema.DweetType, error) {
+	return deleteDweet(postID, username, "", repliesToFetch, replyOffset)
+}
+
+// Delete a dweet as a user, who needs to be its author or allowed to delete any dweet.
+// The reason is written to the audit log when it isn't the author deleting it.
+func deleteDweet(postID string, username string, reason string, repliesToFetch int, replyOffset int) (schema.DweetType, error) {
 	// Validate params
 	err := common.Validate.Var(postID, "required,alphanum,len=10")
 	if err != nil {
@@ -89,390 +96,96 @@ func DeleteDweet(postID string, username string, repliesToFetch int, replyOffset
 		return schema.DweetType{}, fmt.Errorf("internal server error: %v", err)
 	}
 
+	// Check if authorized to delete dweet
+	err = common.Authorize(username, deleted.Author().Username, common.PermDeleteAnyDweet)
+	if err != nil {
+		return schema.DweetType{}, err
+	}
+
 	err = cache.DeleteDweetCacheUpdate(deleted.ID)
 	if err != nil {
 		return schema.DweetType{}, fmt.Errorf("internal server error: %v", err)
 	}
 
-	// Check if authorized to delete dweet
-	if deleted.Author().Username == username {
-		_, err := common.InternalDeleteDweet(postID)
-
-		// Delete the media that isn't used anymore
-		oldMedia := deleted.Media
-		for _, mediaLink := range oldMedia {
-			loc, err := cdn.LinkToLocation(mediaLink)
-			if err != nil {
-				return schema.DweetType{}, err
-			}
-			err = cdn.DeleteLocation(loc, true)
-			if err != nil {
-				return schema.DweetType{}, err
-			}
-		}
+	_, err = common.InternalDeleteDweet(postID)
 
+	// Delete the media that isn't used anymore
+	oldMedia := deleted.Media
+	for _, mediaLink := range oldMedia {
+		loc, err := cdn.LinkToLocation(mediaLink)
 		if err != nil {
-			return schema.DweetType{}, fmt.Errorf("internal server error: %v", err)
+			return schema.DweetType{}, err
 		}
+		err = cdn.DeleteLocation(loc, true)
+		if err != nil {
+			return schema.DweetType{}, err
+		}
+	}
 
-		// Format and return with common likes
-		knownUsers := deleted.Author().Following()
-		knownUsers = append(knownUsers, *deleted.Author())
-
-		mutualLikes := util.HashIntersectUsers(deleted.LikeUsers(), knownUsers)
-		mutualRedweets := util.HashIntersectUsers(deleted.RedweetUsers(), knownUsers)
+	if err != nil {
+		return schema.DweetType{}, fmt.Errorf("internal server error: %v", err)
+	}
 
-		formatted := schema.FormatAsDweetType(deleted, mutualLikes, mutualRedweets)
-		return formatted, err
+	if deleted.Author().Username != username {
+		common.WriteAuditLog(username, "dweet.delete", "dweet", postID, reason)
 	}
 
-	return schema.DweetType{}, fmt.Errorf("internal server error: %v", errors.New("Unauthorized"))
+	events.Publish(events.Event{Type: events.DweetDeleted, Actor: username, Owner: deleted.AuthorID, DweetID: deleted.ID})
+
+	// Format and return with common likes
+	knownUsers := deleted.Author().Following()
+	knownUsers = append(knownUsers, *deleted.Author())
+
+	mutualLikes := util.HashIntersectUsers(deleted.LikeUsers(), knownUsers)
+	mutualRedweets := util.HashIntersectUsers(deleted.RedweetUsers(), knownUsers)
+
+	formatted := schema.FormatAsDweetType(deleted, mutualLikes, mutualRedweets)
+	return formatted, err
 }
 
-// Delete User
-func DeleteUser(username string, objectsToFetch string, feedObjectsToFetch int, feedObjectsOffset int) (schema.UserType, error) {
+// Delete a user and everything they made right away as an admin, and log them out everywhere.
+// Users delete their own accounts with deleteAccount instead, which gives them time to change their mind.
+func DeleteUser(actor string, username string, reason string) (schema.BasicUserType, error) {
 	// Validate params
 	err := common.Validate.Var(username, "required,alphanum,lte=20,gt=0")
 	if err != nil {
-		return schema.UserType{}, err
+		return schema.BasicUserType{}, err
 	}
 
-	err = common.Validate.Var(objectsToFetch, "required,alpha,gt=0,oneof=feed dweet redweet redweetedDweet liked")
+	err = common.Validate.Var(reason, "lte=280")
 	if err != nil {
-		return schema.UserType{}, err
+		return schema.BasicUserType{}, err
 	}
 
-	err = common.Validate.Var(feedObjectsOffset, "gte=0")
+	err = requirePermission(actor, common.PermDeleteAnyUser)
 	if err != nil {
-		return schema.UserType{}, err
+		return schema.BasicUserType{}, err
 	}
 
-	var user *db.UserModel
-	var alsoFollowedBy []db.UserModel
-	var alsoFollowing []db.UserModel
-	var feedObjectList []interface{}
-
-	if feedObjectsToFetch < 0 {
-		switch objectsToFetch {
-		case "feed":
-			user, err = common.Client.User.FindUnique(
-				db.User.Username.Equals(username),
-			).With(
-				db.User.Dweets.Fetch().With(
-					db.Dweet.Author.Fetch(),
-				).OrderBy(
-					db.Dweet.PostedAt.Order(db.DESC),
-				),
-				db.User.Redweets.Fetch().With(
-					db.Redweet.Author.Fetch(),
-					db.Redweet.RedweetOf.Fetch().With(
-						db.Dweet.Author.Fetch(),
-					),
-				).OrderBy(
-					db.Redweet.RedweetTime.Order(db.DESC),
-				),
-				db.User.Followers.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-				db.User.Following.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-			).Exec(common.BaseCtx)
-			if err == db.ErrNotFound {
-				return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-			}
-			if err != nil {
-				return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-			}
-
-			merged := util.MergeDweetRedweetList(user.Dweets(), user.Redweets())
-
-			feedObjectList = append(feedObjectList, merged...)
-		case "dweet":
-			user, err = common.Client.User.FindUnique(
-				db.User.Username.Equals(username),
-			).With(
-				db.User.Dweets.Fetch().With(
-					db.Dweet.Author.Fetch(),
-				).OrderBy(
-					db.Dweet.PostedAt.Order(db.DESC),
-				),
-				db.User.Followers.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-				db.User.Following.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-			).Exec(common.BaseCtx)
-			if err == db.ErrNotFound {
-				return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-			}
-			if err != nil {
-				return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-			}
-
-			dweets := user.Dweets()
-			for i := 0; i < len(dweets); i++ {
-				feedObjectList = append(feedObjectList, dweets[i])
-			}
-		case "redweet":
-			user, err = common.Client.User.FindUnique(
-				db.User.Username.Equals(username),
-			).With(
-				db.User.Redweets.Fetch().With(
-					db.Redweet.Author.Fetch(),
-					db.Redweet.RedweetOf.Fetch().With(
-						db.Dweet.Author.Fetch(),
-					),
-				).OrderBy(
-					db.Redweet.RedweetTime.Order(db.DESC),
-				),
-				db.User.Followers.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-				db.User.Following.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-			).Exec(common.BaseCtx)
-			if err == db.ErrNotFound {
-				return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-			}
-			if err != nil {
-				return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-			}
-
-			redweets := user.Redweets()
-			for i := 0; i < len(redweets); i++ {
-				feedObjectList = append(feedObjectList, redweets[i])
-			}
-		case "redweetedDweet":
-			user, err = common.Client.User.FindUnique(
-				db.User.Username.Equals(username),
-			).With(
-				db.User.RedweetedDweets.Fetch().With(
-					db.Dweet.Author.Fetch(),
-				).OrderBy(
-					db.Dweet.PostedAt.Order(db.DESC),
-				),
-				db.User.Followers.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-				db.User.Following.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-			).Exec(common.BaseCtx)
-			if err == db.ErrNotFound {
-				return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-			}
-			if err != nil {
-				return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-			}
-
-			redweetedDweets := user.RedweetedDweets()
-			for i := 0; i < len(redweetedDweets); i++ {
-				feedObjectList = append(feedObjectList, redweetedDweets[i])
-			}
-		case "liked":
-			user, err = common.Client.User.FindUnique(
-				db.User.Username.Equals(username),
-			).With(
-				db.User.LikedDweets.Fetch().With(
-					db.Dweet.Author.Fetch(),
-				).OrderBy(
-					db.Dweet.PostedAt.Order(db.DESC),
-				),
-				db.User.Followers.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-				db.User.Following.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-			).Exec(common.BaseCtx)
-			if err == db.ErrNotFound {
-				return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-			}
-			if err != nil {
-				return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-			}
-
-			likes := user.LikedDweets()
-			for i := 0; i < len(likes); i++ {
-				feedObjectList = append(feedObjectList, likes[i])
-			}
-		default:
-			break
-		}
-	} else {
-		switch objectsToFetch {
-		case "feed":
-			user, err = common.Client.User.FindUnique(
-				db.User.Username.Equals(username),
-			).With(
-				db.User.Dweets.Fetch().With(
-					db.Dweet.Author.Fetch(),
-				).OrderBy(
-					db.Dweet.PostedAt.Order(db.DESC),
-				).Take(feedObjectsToFetch+feedObjectsOffset),
-				db.User.Redweets.Fetch().With(
-					db.Redweet.Author.Fetch(),
-					db.Redweet.RedweetOf.Fetch().With(
-						db.Dweet.Author.Fetch(),
-					),
-				).OrderBy(
-					db.Redweet.RedweetTime.Order(db.DESC),
-				).Take(feedObjectsToFetch+feedObjectsOffset),
-				db.User.Followers.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-				db.User.Following.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-			).Exec(common.BaseCtx)
-			if err == db.ErrNotFound {
-				return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-			}
-			if err != nil {
-				return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-			}
-
-			merged := util.MergeDweetRedweetList(user.Dweets(), user.Redweets())
-
-			for i := 0; i < util.Min(feedObjectsToFetch, len(merged)); i++ {
-				feedObjectList = append(feedObjectList, merged[i+feedObjectsOffset])
-			}
-		case "dweet":
-			user, err = common.Client.User.FindUnique(
-				db.User.Username.Equals(username),
-			).With(
-				db.User.Dweets.Fetch().With(
-					db.Dweet.Author.Fetch(),
-				).OrderBy(
-					db.Dweet.PostedAt.Order(db.DESC),
-				).Skip(feedObjectsOffset).Take(feedObjectsToFetch),
-				db.User.Followers.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-				db.User.Following.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-			).Exec(common.BaseCtx)
-			if err == db.ErrNotFound {
-				return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-			}
-			if err != nil {
-				return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-			}
-
-			dweets := user.Dweets()
-			for i := 0; i < len(dweets); i++ {
-				feedObjectList = append(feedObjectList, dweets[i])
-			}
-		case "redweet":
-			user, err = common.Client.User.FindUnique(
-				db.User.Username.Equals(username),
-			).With(
-				db.User.Redweets.Fetch().With(
-					db.Redweet.Author.Fetch(),
-					db.Redweet.RedweetOf.Fetch().With(
-						db.Dweet.Author.Fetch(),
-					),
-				).OrderBy(
-					db.Redweet.RedweetTime.Order(db.DESC),
-				).Skip(feedObjectsOffset).Take(feedObjectsToFetch),
-				db.User.Followers.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-				db.User.Following.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-			).Exec(common.BaseCtx)
-			if err == db.ErrNotFound {
-				return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-			}
-			if err != nil {
-				return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-			}
-
-			redweets := user.Redweets()
-			for i := 0; i < len(redweets); i++ {
-				feedObjectList = append(feedObjectList, redweets[i])
-			}
-		case "redweetedDweet":
-			user, err = common.Client.User.FindUnique(
-				db.User.Username.Equals(username),
-			).With(
-				db.User.RedweetedDweets.Fetch().With(
-					db.Dweet.Author.Fetch(),
-				).OrderBy(
-					db.Dweet.PostedAt.Order(db.DESC),
-				).Skip(feedObjectsOffset).Take(feedObjectsToFetch),
-				db.User.Followers.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-				db.User.Following.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-			).Exec(common.BaseCtx)
-			if err == db.ErrNotFound {
-				return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-			}
-			if err != nil {
-				return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-			}
-
-			redweetedDweets := user.RedweetedDweets()
-			for i := 0; i < len(redweetedDweets); i++ {
-				feedObjectList = append(feedObjectList, redweetedDweets[i])
-			}
-		case "liked":
-			user, err = common.Client.User.FindUnique(
-				db.User.Username.Equals(username),
-			).With(
-				db.User.LikedDweets.Fetch().With(
-					db.Dweet.Author.Fetch(),
-				).OrderBy(
-					db.Dweet.PostedAt.Order(db.DESC),
-				).Skip(feedObjectsOffset).Take(feedObjectsToFetch),
-				db.User.Followers.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-				db.User.Following.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-			).Exec(common.BaseCtx)
-			if err == db.ErrNotFound {
-				return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-			}
-			if err != nil {
-				return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-			}
-
-			likes := user.LikedDweets()
-			for i := 0; i < len(likes); i++ {
-				feedObjectList = append(feedObjectList, likes[i])
-			}
-		default:
-			break
-		}
+	user, err := checkModeratable(actor, username)
+	if err != nil {
+		return schema.BasicUserType{}, err
 	}
-	var showEmail bool
-
-	alsoFollowedBy = user.Followers()
-	alsoFollowing = user.Following()
-	showEmail = true
+	formatted := schema.FormatAsBasicUserType(user)
 
-	// Send back the user requested, along with mutuals in the followers field
-	nuser, err := schema.FormatAsUserType(user, alsoFollowedBy, alsoFollowing, objectsToFetch, feedObjectList, showEmail)
+	err = auth.RevokeAllSessions(username)
 	if err != nil {
-		return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
+		return schema.BasicUserType{}, err
 	}
 
 	// Delete the user
-	_, err = common.InternalDeleteUser(username)
+	err = PurgeUser(username)
 	if err != nil {
-		return schema.UserType{}, fmt.Errorf("error deleting user: %v", err)
+		return schema.BasicUserType{}, fmt.Errorf("error deleting user: %v", err)
 	}
-	return nuser, err
+
+	common.WriteAuditLog(actor, "user.delete", "user", username, fmt.Sprintf("reason=%q", reason))
+	err = resolveReportsOn(actor, "user", username)
+	if err != nil {
+		return schema.BasicUserType{}, fmt.Errorf("internal server error: %v", err)
+	}
+
+	return formatted, nil
 }
 
 // Delete a redweet
@@ -508,6 +221,8 @@ func DeleteRedweet(postID string, username string) (schema.RedweetType, error) {
 		return schema.RedweetType{}, err
 	}
 
+	events.Publish(events.Event{Type: events.RedweetDeleted, Actor: username, Owner: username, DweetID: postID})
+
 	formatted := schema.FormatAsRedweetType(redweet)
 	return formatted, err
 }
@@ -5,13 +5,14 @@ import (
 
 	"github.com/soumitradev/Dwitter/backend/cache"
 	"github.com/soumitradev/Dwitter/backend/common"
+	"github.com/soumitradev/Dwitter/backend/events"
 	"github.com/soumitradev/Dwitter/backend/prisma/db"
 	"github.com/soumitradev/Dwitter/backend/schema"
 	"github.com/soumitradev/Dwitter/backend/util"
 )
 
 // Create a follower relation
-func Follow(followedID string, followerID string, objectsToFetch string, feedObjectsToFetch int, feedObjectsOffset int) (schema.UserType, error) {
+func Follow(followedID string, followerID string, includes UserIncludes) (schema.UserType, error) {
 	// Validate params
 	err := common.Validate.Var(followedID, "required,alphanum,lte=20,gt=0")
 	if err != nil {
@@ -23,12 +24,7 @@ func Follow(followedID string, followerID string, objectsToFetch string, feedObj
 		return schema.UserType{}, err
 	}
 
-	err = common.Validate.Var(objectsToFetch, "required,alpha,gt=0,oneof=feed dweet redweet redweetedDweet")
-	if err != nil {
-		return schema.UserType{}, err
-	}
-
-	err = common.Validate.Var(feedObjectsOffset, "gte=0")
+	err = includes.validate()
 	if err != nil {
 		return schema.UserType{}, err
 	}
@@ -48,206 +44,20 @@ func Follow(followedID string, followerID string, objectsToFetch string, feedObj
 		return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
 	}
 
-	var user *db.UserModel
-	var feedObjectList []interface{}
+	// Users are only cached with one list, so queries selecting more drop the cached users instead of updating them
+	includes, objectsToFetch, cachedPage, cacheable := includes.forCache()
+	withs, err := includes.with(followedID, followerID)
+	if err != nil {
+		return schema.UserType{}, err
+	}
 
 	// If yes, then skip following the user
 	if len(personBeingFollowed.Followers()) > 0 {
-		if feedObjectsToFetch < 0 {
-			switch objectsToFetch {
-			case "feed":
-				user, err = common.Client.User.FindUnique(
-					db.User.Username.Equals(followedID),
-				).With(
-					db.User.Dweets.Fetch().With(
-						db.Dweet.Author.Fetch(),
-					).OrderBy(
-						db.Dweet.PostedAt.Order(db.DESC),
-					),
-					db.User.Redweets.Fetch().With(
-						db.Redweet.Author.Fetch(),
-						db.Redweet.RedweetOf.Fetch(),
-					).OrderBy(
-						db.Redweet.RedweetTime.Order(db.DESC),
-					),
-					db.User.Followers.Fetch().OrderBy(
-						db.User.FollowerCount.Order(db.DESC),
-					),
-					db.User.Following.Fetch().OrderBy(
-						db.User.FollowerCount.Order(db.DESC),
-					),
-				).Exec(common.BaseCtx)
-
-				merged := util.MergeDweetRedweetList(user.Dweets(), user.Redweets())
-
-				feedObjectList = append(feedObjectList, merged...)
-
-			case "dweet":
-				user, err = common.Client.User.FindUnique(
-					db.User.Username.Equals(followedID),
-				).With(
-					db.User.Dweets.Fetch().With(
-						db.Dweet.Author.Fetch(),
-					).OrderBy(
-						db.Dweet.PostedAt.Order(db.DESC),
-					),
-					db.User.Followers.Fetch().OrderBy(
-						db.User.FollowerCount.Order(db.DESC),
-					),
-					db.User.Following.Fetch().OrderBy(
-						db.User.FollowerCount.Order(db.DESC),
-					),
-				).Exec(common.BaseCtx)
-
-				dweets := user.Dweets()
-				for i := 0; i < len(dweets); i++ {
-					feedObjectList = append(feedObjectList, dweets[i])
-				}
-			case "redweet":
-				user, err = common.Client.User.FindUnique(
-					db.User.Username.Equals(followedID),
-				).With(
-					db.User.Redweets.Fetch().With(
-						db.Redweet.Author.Fetch(),
-						db.Redweet.RedweetOf.Fetch(),
-					).OrderBy(
-						db.Redweet.RedweetTime.Order(db.DESC),
-					),
-					db.User.Followers.Fetch().OrderBy(
-						db.User.FollowerCount.Order(db.DESC),
-					),
-					db.User.Following.Fetch().OrderBy(
-						db.User.FollowerCount.Order(db.DESC),
-					),
-				).Exec(common.BaseCtx)
-
-				redweets := user.Redweets()
-				for i := 0; i < len(redweets); i++ {
-					feedObjectList = append(feedObjectList, redweets[i])
-				}
-			case "redweetedDweet":
-				user, err = common.Client.User.FindUnique(
-					db.User.Username.Equals(followedID),
-				).With(
-					db.User.RedweetedDweets.Fetch().With(
-						db.Dweet.Author.Fetch(),
-					).OrderBy(
-						db.Dweet.PostedAt.Order(db.DESC),
-					),
-					db.User.Followers.Fetch().OrderBy(
-						db.User.FollowerCount.Order(db.DESC),
-					),
-					db.User.Following.Fetch().OrderBy(
-						db.User.FollowerCount.Order(db.DESC),
-					),
-				).Exec(common.BaseCtx)
-
-				redweetedDweets := user.RedweetedDweets()
-				for i := 0; i < len(redweetedDweets); i++ {
-					feedObjectList = append(feedObjectList, redweetedDweets[i])
-				}
-			default:
-				break
-			}
-		} else {
-			switch objectsToFetch {
-			case "feed":
-				user, err = common.Client.User.FindUnique(
-					db.User.Username.Equals(followedID),
-				).With(
-					db.User.Dweets.Fetch().With(
-						db.Dweet.Author.Fetch(),
-					).OrderBy(
-						db.Dweet.PostedAt.Order(db.DESC),
-					).Take(feedObjectsToFetch+feedObjectsOffset),
-					db.User.Redweets.Fetch().With(
-						db.Redweet.Author.Fetch(),
-						db.Redweet.RedweetOf.Fetch(),
-					).OrderBy(
-						db.Redweet.RedweetTime.Order(db.DESC),
-					).Take(feedObjectsToFetch+feedObjectsOffset),
-					db.User.Followers.Fetch().OrderBy(
-						db.User.FollowerCount.Order(db.DESC),
-					),
-					db.User.Following.Fetch().OrderBy(
-						db.User.FollowerCount.Order(db.DESC),
-					),
-				).Exec(common.BaseCtx)
-
-				merged := util.MergeDweetRedweetList(user.Dweets(), user.Redweets())
-
-				for i := 0; i < util.Min(feedObjectsToFetch, len(merged)); i++ {
-					feedObjectList = append(feedObjectList, merged[i+feedObjectsOffset])
-				}
-			case "dweet":
-				user, err = common.Client.User.FindUnique(
-					db.User.Username.Equals(followedID),
-				).With(
-					db.User.Dweets.Fetch().With(
-						db.Dweet.Author.Fetch(),
-					).OrderBy(
-						db.Dweet.PostedAt.Order(db.DESC),
-					).Skip(feedObjectsOffset).Take(feedObjectsToFetch),
-					db.User.Followers.Fetch().OrderBy(
-						db.User.FollowerCount.Order(db.DESC),
-					),
-					db.User.Following.Fetch().OrderBy(
-						db.User.FollowerCount.Order(db.DESC),
-					),
-				).Exec(common.BaseCtx)
-
-				dweets := user.Dweets()
-				for i := 0; i < len(dweets); i++ {
-					feedObjectList = append(feedObjectList, dweets[i])
-				}
-			case "redweet":
-				user, err = common.Client.User.FindUnique(
-					db.User.Username.Equals(followedID),
-				).With(
-					db.User.Redweets.Fetch().With(
-						db.Redweet.Author.Fetch(),
-						db.Redweet.RedweetOf.Fetch(),
-					).OrderBy(
-						db.Redweet.RedweetTime.Order(db.DESC),
-					).Skip(feedObjectsOffset).Take(feedObjectsToFetch),
-					db.User.Followers.Fetch().OrderBy(
-						db.User.FollowerCount.Order(db.DESC),
-					),
-					db.User.Following.Fetch().OrderBy(
-						db.User.FollowerCount.Order(db.DESC),
-					),
-				).Exec(common.BaseCtx)
-
-				redweets := user.Redweets()
-				for i := 0; i < len(redweets); i++ {
-					feedObjectList = append(feedObjectList, redweets[i])
-				}
-			case "redweetedDweet":
-				user, err = common.Client.User.FindUnique(
-					db.User.Username.Equals(followedID),
-				).With(
-					db.User.RedweetedDweets.Fetch().With(
-						db.Dweet.Author.Fetch(),
-					).OrderBy(
-						db.Dweet.PostedAt.Order(db.DESC),
-					).Skip(feedObjectsOffset).Take(feedObjectsToFetch),
-					db.User.Followers.Fetch().OrderBy(
-						db.User.FollowerCount.Order(db.DESC),
-					),
-					db.User.Following.Fetch().OrderBy(
-						db.User.FollowerCount.Order(db.DESC),
-					),
-				).Exec(common.BaseCtx)
-
-				redweetedDweets := user.RedweetedDweets()
-				for i := 0; i < len(redweetedDweets); i++ {
-					feedObjectList = append(feedObjectList, redweetedDweets[i])
-				}
-			default:
-				break
-			}
-		}
-
+		user, err := common.Client.User.FindUnique(
+			db.User.Username.Equals(followedID),
+		).With(
+			withs...,
+		).Exec(common.BaseCtx)
 		if err == db.ErrNotFound {
 			return schema.UserType{}, fmt.Errorf("user not found: %v", err)
 		}
@@ -269,263 +79,27 @@ func Follow(followedID string, followerID string, objectsToFetch string, feedObj
 			return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
 		}
 
-		knownUsers := authenticatedUser.Following()
-		knownUsers = append(knownUsers, *authenticatedUser)
-
-		followers := user.Followers()
-		following := user.Following()
-
-		knownFollowers := util.HashIntersectUsers(followers, knownUsers)
-		knownFollowing := util.HashIntersectUsers(following, knownUsers)
-
-		formatted, err := schema.FormatAsUserType(user, knownFollowers, knownFollowing, objectsToFetch, feedObjectList, false)
+		alsoFollowedBy, alsoFollowing := mutualFollows(user, includes, authenticatedUser)
+		formatted, err := schema.FormatAsUserType(user, alsoFollowedBy, alsoFollowing, "", []interface{}{}, false)
+		if err != nil {
+			return schema.UserType{}, err
+		}
+		err = formatUserIncludes(user, includes, &formatted)
 		return formatted, err
 	}
 
 	// Else, create new follow relation
 	// Add follower to followed's follower list
-
-	if feedObjectsToFetch < 0 {
-		switch objectsToFetch {
-		case "feed":
-			user, err = common.Client.User.FindUnique(
-				db.User.Username.Equals(followedID),
-			).With(
-				db.User.Dweets.Fetch().With(
-					db.Dweet.Author.Fetch(),
-				).OrderBy(
-					db.Dweet.PostedAt.Order(db.DESC),
-				),
-				db.User.Redweets.Fetch().With(
-					db.Redweet.Author.Fetch(),
-					db.Redweet.RedweetOf.Fetch().With(
-						db.Dweet.Author.Fetch(),
-					),
-				).OrderBy(
-					db.Redweet.RedweetTime.Order(db.DESC),
-				),
-				db.User.Followers.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-				db.User.Following.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-			).Update(
-				db.User.FollowerCount.Increment(1),
-				db.User.Followers.Link(
-					db.User.Username.Equals(followerID),
-				),
-			).Exec(common.BaseCtx)
-
-			merged := util.MergeDweetRedweetList(user.Dweets(), user.Redweets())
-
-			feedObjectList = append(feedObjectList, merged...)
-		case "dweet":
-			user, err = common.Client.User.FindUnique(
-				db.User.Username.Equals(followedID),
-			).With(
-				db.User.Dweets.Fetch().With(
-					db.Dweet.Author.Fetch(),
-				).OrderBy(
-					db.Dweet.PostedAt.Order(db.DESC),
-				),
-				db.User.Followers.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-				db.User.Following.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-			).Update(
-				db.User.FollowerCount.Increment(1),
-				db.User.Followers.Link(
-					db.User.Username.Equals(followerID),
-				),
-			).Exec(common.BaseCtx)
-
-			dweets := user.Dweets()
-			for i := 0; i < len(dweets); i++ {
-				feedObjectList = append(feedObjectList, dweets[i])
-			}
-		case "redweet":
-			user, err = common.Client.User.FindUnique(
-				db.User.Username.Equals(followedID),
-			).With(
-				db.User.Redweets.Fetch().With(
-					db.Redweet.Author.Fetch(),
-					db.Redweet.RedweetOf.Fetch().With(
-						db.Dweet.Author.Fetch(),
-					),
-				).OrderBy(
-					db.Redweet.RedweetTime.Order(db.DESC),
-				),
-				db.User.Followers.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-				db.User.Following.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-			).Update(
-				db.User.FollowerCount.Increment(1),
-				db.User.Followers.Link(
-					db.User.Username.Equals(followerID),
-				),
-			).Exec(common.BaseCtx)
-
-			redweets := user.Redweets()
-			for i := 0; i < len(redweets); i++ {
-				feedObjectList = append(feedObjectList, redweets[i])
-			}
-		case "redweetedDweet":
-			user, err = common.Client.User.FindUnique(
-				db.User.Username.Equals(followedID),
-			).With(
-				db.User.RedweetedDweets.Fetch().With(
-					db.Dweet.Author.Fetch(),
-				).OrderBy(
-					db.Dweet.PostedAt.Order(db.DESC),
-				),
-				db.User.Followers.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-				db.User.Following.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-			).Update(
-				db.User.FollowerCount.Increment(1),
-				db.User.Followers.Link(
-					db.User.Username.Equals(followerID),
-				),
-			).Exec(common.BaseCtx)
-
-			redweetedDweets := user.RedweetedDweets()
-			for i := 0; i < len(redweetedDweets); i++ {
-				feedObjectList = append(feedObjectList, redweetedDweets[i])
-			}
-		default:
-			break
-		}
-	} else {
-		switch objectsToFetch {
-		case "feed":
-			user, err = common.Client.User.FindUnique(
-				db.User.Username.Equals(followedID),
-			).With(
-				db.User.Dweets.Fetch().With(
-					db.Dweet.Author.Fetch(),
-				).OrderBy(
-					db.Dweet.PostedAt.Order(db.DESC),
-				).Take(feedObjectsToFetch+feedObjectsOffset),
-				db.User.Redweets.Fetch().With(
-					db.Redweet.Author.Fetch(),
-					db.Redweet.RedweetOf.Fetch().With(
-						db.Dweet.Author.Fetch(),
-					),
-				).OrderBy(
-					db.Redweet.RedweetTime.Order(db.DESC),
-				).Take(feedObjectsToFetch+feedObjectsOffset),
-				db.User.Followers.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-				db.User.Following.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-			).Update(
-				db.User.FollowerCount.Increment(1),
-				db.User.Followers.Link(
-					db.User.Username.Equals(followerID),
-				),
-			).Exec(common.BaseCtx)
-
-			merged := util.MergeDweetRedweetList(user.Dweets(), user.Redweets())
-
-			for i := 0; i < util.Min(feedObjectsToFetch, len(merged)); i++ {
-				feedObjectList = append(feedObjectList, merged[i+feedObjectsOffset])
-			}
-		case "dweet":
-			user, err = common.Client.User.FindUnique(
-				db.User.Username.Equals(followedID),
-			).With(
-				db.User.Dweets.Fetch().With(
-					db.Dweet.Author.Fetch(),
-				).OrderBy(
-					db.Dweet.PostedAt.Order(db.DESC),
-				).Skip(feedObjectsOffset).Take(feedObjectsToFetch),
-				db.User.Followers.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-				db.User.Following.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-			).Update(
-				db.User.FollowerCount.Increment(1),
-				db.User.Followers.Link(
-					db.User.Username.Equals(followerID),
-				),
-			).Exec(common.BaseCtx)
-
-			dweets := user.Dweets()
-			for i := 0; i < len(dweets); i++ {
-				feedObjectList = append(feedObjectList, dweets[i])
-			}
-		case "redweet":
-			user, err = common.Client.User.FindUnique(
-				db.User.Username.Equals(followedID),
-			).With(
-				db.User.Redweets.Fetch().With(
-					db.Redweet.Author.Fetch(),
-					db.Redweet.RedweetOf.Fetch().With(
-						db.Dweet.Author.Fetch(),
-					),
-				).OrderBy(
-					db.Redweet.RedweetTime.Order(db.DESC),
-				).Skip(feedObjectsOffset).Take(feedObjectsToFetch),
-				db.User.Followers.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-				db.User.Following.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-			).Update(
-				db.User.FollowerCount.Increment(1),
-				db.User.Followers.Link(
-					db.User.Username.Equals(followerID),
-				),
-			).Exec(common.BaseCtx)
-
-			redweets := user.Redweets()
-			for i := 0; i < len(redweets); i++ {
-				feedObjectList = append(feedObjectList, redweets[i])
-			}
-		case "redweetedDweet":
-			user, err = common.Client.User.FindUnique(
-				db.User.Username.Equals(followedID),
-			).With(
-				db.User.RedweetedDweets.Fetch().With(
-					db.Dweet.Author.Fetch(),
-				).OrderBy(
-					db.Dweet.PostedAt.Order(db.DESC),
-				).Skip(feedObjectsOffset).Take(feedObjectsToFetch),
-				db.User.Followers.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-				db.User.Following.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-			).Update(
-				db.User.FollowerCount.Increment(1),
-				db.User.Followers.Link(
-					db.User.Username.Equals(followerID),
-				),
-			).Exec(common.BaseCtx)
-
-			redweetedDweets := user.RedweetedDweets()
-			for i := 0; i < len(redweetedDweets); i++ {
-				feedObjectList = append(feedObjectList, redweetedDweets[i])
-			}
-		default:
-			break
-		}
-	}
+	user, err := common.Client.User.FindUnique(
+		db.User.Username.Equals(followedID),
+	).With(
+		withs...,
+	).Update(
+		db.User.FollowerCount.Increment(1),
+		db.User.Followers.Link(
+			db.User.Username.Equals(followerID),
+		),
+	).Exec(common.BaseCtx)
 	if err == db.ErrNotFound {
 		return schema.UserType{}, fmt.Errorf("user not found: %v", err)
 	}
@@ -553,35 +127,24 @@ func Follow(followedID string, followerID string, objectsToFetch string, feedObj
 		return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
 	}
 
-	err = cache.FollowCacheUpdate(*user, *authenticatedUser, objectsToFetch, feedObjectsToFetch, feedObjectsOffset)
+	if cacheable {
+		err = cache.FollowCacheUpdate(*user, *authenticatedUser, objectsToFetch, cachedPage.Take, cachedPage.Skip)
+	} else {
+		err = cache.DropUsers(followedID, followerID)
+	}
 	if err != nil {
 		return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
 	}
 
-	knownUsers := authenticatedUser.Following()
-	knownUsers = append(knownUsers, *authenticatedUser)
-
-	followers := user.Followers()
-	following := user.Following()
+	notify([]recipient{eventRecipient(*user, NotificationFollow)}, followerID, NotificationFollow, nil)
+	events.Publish(events.Event{Type: events.UserFollowed, Actor: followerID, Owner: followedID})
 
-	// Check if user iss in followers list
-	found := false
-	for _, follower := range followers {
-		if follower.Username == followerID {
-			found = true
-			break
-		}
-	}
-
-	// If not, add them
-	if !found {
-		followers = append(followers, *authenticatedUser)
+	alsoFollowedBy, alsoFollowing := mutualFollows(user, includes, authenticatedUser)
+	formatted, err := schema.FormatAsUserType(user, alsoFollowedBy, alsoFollowing, "", []interface{}{}, false)
+	if err != nil {
+		return schema.UserType{}, err
 	}
-
-	knownFollowers := util.HashIntersectUsers(followers, knownUsers)
-	knownFollowing := util.HashIntersectUsers(following, knownUsers)
-
-	formatted, err := schema.FormatAsUserType(user, knownFollowers, knownFollowing, objectsToFetch, feedObjectList, false)
+	err = formatUserIncludes(user, includes, &formatted)
 	return formatted, err
 }
 
@@ -790,6 +353,9 @@ func Like(likedPostID string, userID string, repliesToFetch int, replyOffset int
 		return schema.DweetType{}, fmt.Errorf("internal server error: %v", err)
 	}
 
+	notify([]recipient{eventRecipient(*like.Author(), NotificationLike)}, userID, NotificationLike, like)
+	events.Publish(events.Event{Type: events.DweetLiked, Actor: userID, Owner: like.AuthorID, DweetID: like.ID})
+
 	// Find known people that liked thw dweet
 
 	knownUsers := user.Following()
@@ -1002,6 +568,8 @@ func Unlike(postID string, userID string, repliesToFetch int, replyOffset int) (
 		return schema.DweetType{}, fmt.Errorf("internal server error: %v", err)
 	}
 
+	events.Publish(events.Event{Type: events.DweetUnliked, Actor: userID, Owner: post.AuthorID, DweetID: post.ID})
+
 	knownUsers := user.Following()
 	knownUsers = append(knownUsers, *user)
 
@@ -1023,7 +591,7 @@ func Unlike(postID string, userID string, repliesToFetch int, replyOffset int) (
 }
 
 // Delete a follower relation
-func Unfollow(followedID string, followerID string, objectsToFetch string, feedObjectsToFetch int, feedObjectsOffset int) (schema.UserType, error) {
+func Unfollow(followedID string, followerID string, includes UserIncludes) (schema.UserType, error) {
 	// Validate params
 	err := common.Validate.Var(followedID, "required,alphanum,lte=20,gt=0")
 	if err != nil {
@@ -1035,12 +603,7 @@ func Unfollow(followedID string, followerID string, objectsToFetch string, feedO
 		return schema.UserType{}, err
 	}
 
-	err = common.Validate.Var(objectsToFetch, "required,alpha,gt=0,oneof=feed dweet redweet redweetedDweet")
-	if err != nil {
-		return schema.UserType{}, err
-	}
-
-	err = common.Validate.Var(feedObjectsOffset, "gte=0")
+	err = includes.validate()
 	if err != nil {
 		return schema.UserType{}, err
 	}
@@ -1060,204 +623,20 @@ func Unfollow(followedID string, followerID string, objectsToFetch string, feedO
 		return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
 	}
 
-	var user *db.UserModel
-	var feedObjectList []interface{}
+	// Users are only cached with one list, so queries selecting more drop the cached users instead of updating them
+	includes, objectsToFetch, cachedPage, cacheable := includes.forCache()
+	withs, err := includes.with(followedID, followerID)
+	if err != nil {
+		return schema.UserType{}, err
+	}
 
 	// If yes, then skip unfollowing the user
 	if len(personBeingUnfollowed.Followers()) == 0 {
-		if feedObjectsToFetch < 0 {
-			switch objectsToFetch {
-			case "feed":
-				user, err = common.Client.User.FindUnique(
-					db.User.Username.Equals(followedID),
-				).With(
-					db.User.Dweets.Fetch().With(
-						db.Dweet.Author.Fetch(),
-					).OrderBy(
-						db.Dweet.PostedAt.Order(db.DESC),
-					),
-					db.User.Redweets.Fetch().With(
-						db.Redweet.Author.Fetch(),
-						db.Redweet.RedweetOf.Fetch(),
-					).OrderBy(
-						db.Redweet.RedweetTime.Order(db.DESC),
-					),
-					db.User.Followers.Fetch().OrderBy(
-						db.User.FollowerCount.Order(db.DESC),
-					),
-					db.User.Following.Fetch().OrderBy(
-						db.User.FollowerCount.Order(db.DESC),
-					),
-				).Exec(common.BaseCtx)
-
-				merged := util.MergeDweetRedweetList(user.Dweets(), user.Redweets())
-
-				feedObjectList = append(feedObjectList, merged...)
-			case "dweet":
-				user, err = common.Client.User.FindUnique(
-					db.User.Username.Equals(followedID),
-				).With(
-					db.User.Dweets.Fetch().With(
-						db.Dweet.Author.Fetch(),
-					).OrderBy(
-						db.Dweet.PostedAt.Order(db.DESC),
-					),
-					db.User.Followers.Fetch().OrderBy(
-						db.User.FollowerCount.Order(db.DESC),
-					),
-					db.User.Following.Fetch().OrderBy(
-						db.User.FollowerCount.Order(db.DESC),
-					),
-				).Exec(common.BaseCtx)
-
-				dweets := user.Dweets()
-				for i := 0; i < len(dweets); i++ {
-					feedObjectList = append(feedObjectList, dweets[i])
-				}
-			case "redweet":
-				user, err = common.Client.User.FindUnique(
-					db.User.Username.Equals(followedID),
-				).With(
-					db.User.Redweets.Fetch().With(
-						db.Redweet.Author.Fetch(),
-						db.Redweet.RedweetOf.Fetch(),
-					).OrderBy(
-						db.Redweet.RedweetTime.Order(db.DESC),
-					),
-					db.User.Followers.Fetch().OrderBy(
-						db.User.FollowerCount.Order(db.DESC),
-					),
-					db.User.Following.Fetch().OrderBy(
-						db.User.FollowerCount.Order(db.DESC),
-					),
-				).Exec(common.BaseCtx)
-
-				redweets := user.Redweets()
-				for i := 0; i < len(redweets); i++ {
-					feedObjectList = append(feedObjectList, redweets[i])
-				}
-			case "redweetedDweet":
-				user, err = common.Client.User.FindUnique(
-					db.User.Username.Equals(followedID),
-				).With(
-					db.User.RedweetedDweets.Fetch().With(
-						db.Dweet.Author.Fetch(),
-					).OrderBy(
-						db.Dweet.PostedAt.Order(db.DESC),
-					),
-					db.User.Followers.Fetch().OrderBy(
-						db.User.FollowerCount.Order(db.DESC),
-					),
-					db.User.Following.Fetch().OrderBy(
-						db.User.FollowerCount.Order(db.DESC),
-					),
-				).Exec(common.BaseCtx)
-
-				redweetedDweets := user.RedweetedDweets()
-				for i := 0; i < len(redweetedDweets); i++ {
-					feedObjectList = append(feedObjectList, redweetedDweets[i])
-				}
-			default:
-				break
-			}
-		} else {
-			switch objectsToFetch {
-			case "feed":
-				user, err = common.Client.User.FindUnique(
-					db.User.Username.Equals(followedID),
-				).With(
-					db.User.Dweets.Fetch().With(
-						db.Dweet.Author.Fetch(),
-					).OrderBy(
-						db.Dweet.PostedAt.Order(db.DESC),
-					).Take(feedObjectsToFetch+feedObjectsOffset),
-					db.User.Redweets.Fetch().With(
-						db.Redweet.Author.Fetch(),
-						db.Redweet.RedweetOf.Fetch(),
-					).OrderBy(
-						db.Redweet.RedweetTime.Order(db.DESC),
-					).Take(feedObjectsToFetch+feedObjectsOffset),
-					db.User.Followers.Fetch().OrderBy(
-						db.User.FollowerCount.Order(db.DESC),
-					),
-					db.User.Following.Fetch().OrderBy(
-						db.User.FollowerCount.Order(db.DESC),
-					),
-				).Exec(common.BaseCtx)
-
-				merged := util.MergeDweetRedweetList(user.Dweets(), user.Redweets())
-
-				for i := 0; i < util.Min(feedObjectsToFetch, len(merged)); i++ {
-					feedObjectList = append(feedObjectList, merged[i+feedObjectsOffset])
-				}
-			case "dweet":
-				user, err = common.Client.User.FindUnique(
-					db.User.Username.Equals(followedID),
-				).With(
-					db.User.Dweets.Fetch().With(
-						db.Dweet.Author.Fetch(),
-					).OrderBy(
-						db.Dweet.PostedAt.Order(db.DESC),
-					).Skip(feedObjectsOffset).Take(feedObjectsToFetch),
-					db.User.Followers.Fetch().OrderBy(
-						db.User.FollowerCount.Order(db.DESC),
-					),
-					db.User.Following.Fetch().OrderBy(
-						db.User.FollowerCount.Order(db.DESC),
-					),
-				).Exec(common.BaseCtx)
-
-				dweets := user.Dweets()
-				for i := 0; i < len(dweets); i++ {
-					feedObjectList = append(feedObjectList, dweets[i])
-				}
-			case "redweet":
-				user, err = common.Client.User.FindUnique(
-					db.User.Username.Equals(followedID),
-				).With(
-					db.User.Redweets.Fetch().With(
-						db.Redweet.Author.Fetch(),
-						db.Redweet.RedweetOf.Fetch(),
-					).OrderBy(
-						db.Redweet.RedweetTime.Order(db.DESC),
-					).Skip(feedObjectsOffset).Take(feedObjectsToFetch),
-					db.User.Followers.Fetch().OrderBy(
-						db.User.FollowerCount.Order(db.DESC),
-					),
-					db.User.Following.Fetch().OrderBy(
-						db.User.FollowerCount.Order(db.DESC),
-					),
-				).Exec(common.BaseCtx)
-
-				redweets := user.Redweets()
-				for i := 0; i < len(redweets); i++ {
-					feedObjectList = append(feedObjectList, redweets[i])
-				}
-			case "redweetedDweet":
-				user, err = common.Client.User.FindUnique(
-					db.User.Username.Equals(followedID),
-				).With(
-					db.User.RedweetedDweets.Fetch().With(
-						db.Dweet.Author.Fetch(),
-					).OrderBy(
-						db.Dweet.PostedAt.Order(db.DESC),
-					).Skip(feedObjectsOffset).Take(feedObjectsToFetch),
-					db.User.Followers.Fetch().OrderBy(
-						db.User.FollowerCount.Order(db.DESC),
-					),
-					db.User.Following.Fetch().OrderBy(
-						db.User.FollowerCount.Order(db.DESC),
-					),
-				).Exec(common.BaseCtx)
-
-				redweetedDweets := user.RedweetedDweets()
-				for i := 0; i < len(redweetedDweets); i++ {
-					feedObjectList = append(feedObjectList, redweetedDweets[i])
-				}
-			default:
-				break
-			}
-		}
+		user, err := common.Client.User.FindUnique(
+			db.User.Username.Equals(followedID),
+		).With(
+			withs...,
+		).Exec(common.BaseCtx)
 		if err == db.ErrNotFound {
 			return schema.UserType{}, fmt.Errorf("user not found: %v", err)
 		}
@@ -1279,260 +658,26 @@ func Unfollow(followedID string, followerID string, objectsToFetch string, feedO
 			return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
 		}
 
-		knownUsers := authenticatedUser.Following()
-		knownUsers = append(knownUsers, *authenticatedUser)
-
-		// Find known people that liked the dweet
-		knownFollowers := util.HashIntersectUsers(user.Followers(), knownUsers)
-		knownFollowing := util.HashIntersectUsers(user.Following(), knownUsers)
-
-		formatted, err := schema.FormatAsUserType(user, knownFollowers, knownFollowing, objectsToFetch, feedObjectList, false)
+		alsoFollowedBy, alsoFollowing := mutualFollows(user, includes, authenticatedUser)
+		formatted, err := schema.FormatAsUserType(user, alsoFollowedBy, alsoFollowing, "", []interface{}{}, false)
+		if err != nil {
+			return schema.UserType{}, err
+		}
+		err = formatUserIncludes(user, includes, &formatted)
 		return formatted, err
 	}
 
-	// Add follower to followed's follower list
-
-	if feedObjectsToFetch < 0 {
-		switch objectsToFetch {
-		case "feed":
-			user, err = common.Client.User.FindUnique(
-				db.User.Username.Equals(followedID),
-			).With(
-				db.User.Dweets.Fetch().With(
-					db.Dweet.Author.Fetch(),
-				).OrderBy(
-					db.Dweet.PostedAt.Order(db.DESC),
-				),
-				db.User.Redweets.Fetch().With(
-					db.Redweet.Author.Fetch(),
-					db.Redweet.RedweetOf.Fetch().With(
-						db.Dweet.Author.Fetch(),
-					),
-				).OrderBy(
-					db.Redweet.RedweetTime.Order(db.DESC),
-				),
-				db.User.Followers.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-				db.User.Following.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-			).Update(
-				db.User.FollowerCount.Decrement(1),
-				db.User.Followers.Unlink(
-					db.User.Username.Equals(followerID),
-				),
-			).Exec(common.BaseCtx)
-
-			merged := util.MergeDweetRedweetList(user.Dweets(), user.Redweets())
-
-			feedObjectList = append(feedObjectList, merged...)
-		case "dweet":
-			user, err = common.Client.User.FindUnique(
-				db.User.Username.Equals(followedID),
-			).With(
-				db.User.Dweets.Fetch().With(
-					db.Dweet.Author.Fetch(),
-				).OrderBy(
-					db.Dweet.PostedAt.Order(db.DESC),
-				),
-				db.User.Followers.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-				db.User.Following.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-			).Update(
-				db.User.FollowerCount.Decrement(1),
-				db.User.Followers.Unlink(
-					db.User.Username.Equals(followerID),
-				),
-			).Exec(common.BaseCtx)
-
-			dweets := user.Dweets()
-			for i := 0; i < len(dweets); i++ {
-				feedObjectList = append(feedObjectList, dweets[i])
-			}
-		case "redweet":
-			user, err = common.Client.User.FindUnique(
-				db.User.Username.Equals(followedID),
-			).With(
-				db.User.Redweets.Fetch().With(
-					db.Redweet.Author.Fetch(),
-					db.Redweet.RedweetOf.Fetch().With(
-						db.Dweet.Author.Fetch(),
-					),
-				).OrderBy(
-					db.Redweet.RedweetTime.Order(db.DESC),
-				),
-				db.User.Followers.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-				db.User.Following.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-			).Update(
-				db.User.FollowerCount.Decrement(1),
-				db.User.Followers.Unlink(
-					db.User.Username.Equals(followerID),
-				),
-			).Exec(common.BaseCtx)
-
-			redweets := user.Redweets()
-			for i := 0; i < len(redweets); i++ {
-				feedObjectList = append(feedObjectList, redweets[i])
-			}
-		case "redweetedDweet":
-			user, err = common.Client.User.FindUnique(
-				db.User.Username.Equals(followedID),
-			).With(
-				db.User.RedweetedDweets.Fetch().With(
-					db.Dweet.Author.Fetch(),
-				).OrderBy(
-					db.Dweet.PostedAt.Order(db.DESC),
-				),
-				db.User.Followers.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-				db.User.Following.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-			).Update(
-				db.User.FollowerCount.Decrement(1),
-				db.User.Followers.Unlink(
-					db.User.Username.Equals(followerID),
-				),
-			).Exec(common.BaseCtx)
-
-			redweetedDweets := user.RedweetedDweets()
-			for i := 0; i < len(redweetedDweets); i++ {
-				feedObjectList = append(feedObjectList, redweetedDweets[i])
-			}
-		default:
-			break
-		}
-	} else {
-		switch objectsToFetch {
-		case "feed":
-			user, err = common.Client.User.FindUnique(
-				db.User.Username.Equals(followedID),
-			).With(
-				db.User.Dweets.Fetch().With(
-					db.Dweet.Author.Fetch(),
-				).OrderBy(
-					db.Dweet.PostedAt.Order(db.DESC),
-				).Take(feedObjectsToFetch+feedObjectsOffset),
-				db.User.Redweets.Fetch().With(
-					db.Redweet.Author.Fetch(),
-					db.Redweet.RedweetOf.Fetch().With(
-						db.Dweet.Author.Fetch(),
-					),
-				).OrderBy(
-					db.Redweet.RedweetTime.Order(db.DESC),
-				).Take(feedObjectsToFetch+feedObjectsOffset),
-				db.User.Followers.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-				db.User.Following.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-			).Update(
-				db.User.FollowerCount.Decrement(1),
-				db.User.Followers.Unlink(
-					db.User.Username.Equals(followerID),
-				),
-			).Exec(common.BaseCtx)
-
-			merged := util.MergeDweetRedweetList(user.Dweets(), user.Redweets())
-
-			for i := 0; i < util.Min(feedObjectsToFetch, len(merged)); i++ {
-				feedObjectList = append(feedObjectList, merged[i+feedObjectsOffset])
-			}
-		case "dweet":
-			user, err = common.Client.User.FindUnique(
-				db.User.Username.Equals(followedID),
-			).With(
-				db.User.Dweets.Fetch().With(
-					db.Dweet.Author.Fetch(),
-				).OrderBy(
-					db.Dweet.PostedAt.Order(db.DESC),
-				).Skip(feedObjectsOffset).Take(feedObjectsToFetch),
-				db.User.Followers.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-				db.User.Following.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-			).Update(
-				db.User.FollowerCount.Decrement(1),
-				db.User.Followers.Unlink(
-					db.User.Username.Equals(followerID),
-				),
-			).Exec(common.BaseCtx)
-
-			dweets := user.Dweets()
-			for i := 0; i < len(dweets); i++ {
-				feedObjectList = append(feedObjectList, dweets[i])
-			}
-		case "redweet":
-			user, err = common.Client.User.FindUnique(
-				db.User.Username.Equals(followedID),
-			).With(
-				db.User.Redweets.Fetch().With(
-					db.Redweet.Author.Fetch(),
-					db.Redweet.RedweetOf.Fetch().With(
-						db.Dweet.Author.Fetch(),
-					),
-				).OrderBy(
-					db.Redweet.RedweetTime.Order(db.DESC),
-				).Skip(feedObjectsOffset).Take(feedObjectsToFetch),
-				db.User.Followers.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-				db.User.Following.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-			).Update(
-				db.User.FollowerCount.Decrement(1),
-				db.User.Followers.Unlink(
-					db.User.Username.Equals(followerID),
-				),
-			).Exec(common.BaseCtx)
-
-			redweets := user.Redweets()
-			for i := 0; i < len(redweets); i++ {
-				feedObjectList = append(feedObjectList, redweets[i])
-			}
-		case "redweetedDweet":
-			user, err = common.Client.User.FindUnique(
-				db.User.Username.Equals(followedID),
-			).With(
-				db.User.RedweetedDweets.Fetch().With(
-					db.Dweet.Author.Fetch(),
-				).OrderBy(
-					db.Dweet.PostedAt.Order(db.DESC),
-				).Skip(feedObjectsOffset).Take(feedObjectsToFetch),
-				db.User.Followers.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-				db.User.Following.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-			).Update(
-				db.User.FollowerCount.Decrement(1),
-				db.User.Followers.Unlink(
-					db.User.Username.Equals(followerID),
-				),
-			).Exec(common.BaseCtx)
-
-			redweetedDweets := user.RedweetedDweets()
-			for i := 0; i < len(redweetedDweets); i++ {
-				feedObjectList = append(feedObjectList, redweetedDweets[i])
-			}
-		default:
-			break
-		}
-	}
+	// Remove follower from followed's follower list
+	user, err := common.Client.User.FindUnique(
+		db.User.Username.Equals(followedID),
+	).With(
+		withs...,
+	).Update(
+		db.User.FollowerCount.Decrement(1),
+		db.User.Followers.Unlink(
+			db.User.Username.Equals(followerID),
+		),
+	).Exec(common.BaseCtx)
 	if err == db.ErrNotFound {
 		return schema.UserType{}, fmt.Errorf("user not found: %v", err)
 	}
@@ -1540,7 +685,7 @@ func Unfollow(followedID string, followerID string, objectsToFetch string, feedO
 		return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
 	}
 
-	// Add followed to follower's following list
+	// Remove followed from follower's following list
 	authenticatedUser, err := common.Client.User.FindUnique(
 		db.User.Username.Equals(followerID),
 	).With(
@@ -1560,26 +705,22 @@ func Unfollow(followedID string, followerID string, objectsToFetch string, feedO
 		return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
 	}
 
-	err = cache.UnfollowCacheUpdate(*user, *authenticatedUser, objectsToFetch, feedObjectsToFetch, feedObjectsOffset)
+	if cacheable {
+		err = cache.UnfollowCacheUpdate(*user, *authenticatedUser, objectsToFetch, cachedPage.Take, cachedPage.Skip)
+	} else {
+		err = cache.DropUsers(followedID, followerID)
+	}
 	if err != nil {
 		return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
 	}
 
-	knownUsers := authenticatedUser.Following()
-	knownUsers = append(knownUsers, *authenticatedUser)
-
-	// Find known people that liked the dweet
-	knownFollowers := util.HashIntersectUsers(user.Followers(), knownUsers)
-	knownFollowing := util.HashIntersectUsers(user.Following(), knownUsers)
-
-	var knownFollowersRemoved []db.UserModel
+	events.Publish(events.Event{Type: events.UserUnfollowed, Actor: followerID, Owner: followedID})
 
-	for _, user := range knownFollowers {
-		if authenticatedUser.Username != user.Username {
-			knownFollowersRemoved = append(knownFollowersRemoved, user)
-		}
+	alsoFollowedBy, alsoFollowing := mutualFollows(user, includes, authenticatedUser)
+	formatted, err := schema.FormatAsUserType(user, alsoFollowedBy, alsoFollowing, "", []interface{}{}, false)
+	if err != nil {
+		return schema.UserType{}, err
 	}
-
-	formatted, err := schema.FormatAsUserType(user, knownFollowersRemoved, knownFollowing, objectsToFetch, feedObjectList, false)
+	err = formatUserIncludes(user, includes, &formatted)
 	return formatted, err
 }
@@ -0,0 +1,162 @@
+package database
+
+import (
+	"errors"
+
+	"github.com/soumitradev/Dwitter/backend/common"
+	"github.com/soumitradev/Dwitter/backend/prisma/db"
+	"github.com/soumitradev/Dwitter/backend/schema"
+)
+
+func validateConnectionUsers(username string, viewerUsername string) error {
+	err := common.Validate.Var(username, "required,alphanum,lte=20,gt=0")
+	if err != nil {
+		return err
+	}
+
+	return common.Validate.Var(viewerUsername, "omitempty,alphanum,lte=20")
+}
+
+// Search dweets by content, newest first. Pass an empty viewer when not authenticated.
+func SearchPostsConnection(query string, page Page, viewerUsername string) (schema.DweetConnectionType, error) {
+	// Validate params
+	err := common.Validate.Var(query, "required,gt=0")
+	if err != nil {
+		return schema.DweetConnectionType{}, err
+	}
+
+	err = common.Validate.Var(viewerUsername, "omitempty,alphanum,lte=20")
+	if err != nil {
+		return schema.DweetConnectionType{}, err
+	}
+
+	return pageDweets([]db.DweetWhereParam{
+		db.Dweet.DweetBody.Contains(query),
+	}, page, viewerUsername)
+}
+
+// Search users by username. Pass an empty viewer when not authenticated.
+func SearchUsersConnection(query string, page Page, viewerUsername string) (schema.UserConnectionType, error) {
+	// Validate params
+	err := common.Validate.Var(query, "required,gt=0")
+	if err != nil {
+		return schema.UserConnectionType{}, err
+	}
+
+	err = common.Validate.Var(viewerUsername, "omitempty,alphanum,lte=20")
+	if err != nil {
+		return schema.UserConnectionType{}, err
+	}
+
+	return pageUsers([]db.UserWhereParam{
+		db.User.Username.Contains(query),
+	}, page, viewerUsername)
+}
+
+// Get a page of the dweets a user posted
+func GetDweetsConnection(username string, page Page, viewerUsername string) (schema.DweetConnectionType, error) {
+	err := validateConnectionUsers(username, viewerUsername)
+	if err != nil {
+		return schema.DweetConnectionType{}, err
+	}
+
+	return pageDweets([]db.DweetWhereParam{
+		db.Dweet.AuthorID.Equals(username),
+	}, page, viewerUsername)
+}
+
+// Get a page of the redweets a user made
+func GetRedweetsConnection(username string, page Page) (schema.RedweetConnectionType, error) {
+	err := validateConnectionUsers(username, "")
+	if err != nil {
+		return schema.RedweetConnectionType{}, err
+	}
+
+	return pageRedweets([]db.RedweetWhereParam{
+		db.Redweet.AuthorID.Equals(username),
+	}, page)
+}
+
+// Get a page of the dweets a user redweeted, the most recently redweeted first
+func GetRedweetedDweetsConnection(username string, page Page, viewerUsername string) (schema.DweetConnectionType, error) {
+	err := validateConnectionUsers(username, viewerUsername)
+	if err != nil {
+		return schema.DweetConnectionType{}, err
+	}
+
+	return pageRedweetedDweets(username, page, viewerUsername)
+}
+
+// Get a page of the dweets and redweets a user made
+func GetFeedObjectsConnection(username string, page Page, viewerUsername string) (schema.FeedObjectConnectionType, error) {
+	err := validateConnectionUsers(username, viewerUsername)
+	if err != nil {
+		return schema.FeedObjectConnectionType{}, err
+	}
+
+	return pageFeedObjects(username, page, viewerUsername)
+}
+
+// Get a page of the dweets a user liked. Only the user can see them.
+func GetLikedDweetsConnection(username string, page Page, viewerUsername string) (schema.DweetConnectionType, error) {
+	err := validateConnectionUsers(username, viewerUsername)
+	if err != nil {
+		return schema.DweetConnectionType{}, err
+	}
+
+	if username != viewerUsername {
+		return schema.DweetConnectionType{}, errors.New("Unauthorized")
+	}
+
+	return pageDweets([]db.DweetWhereParam{
+		db.Dweet.LikeUsers.Some(
+			db.User.Username.Equals(username),
+		),
+	}, page, viewerUsername)
+}
+
+// Get a page of the users that follow a user
+func GetFollowersConnection(username string, page Page, viewerUsername string) (schema.UserConnectionType, error) {
+	err := validateConnectionUsers(username, viewerUsername)
+	if err != nil {
+		return schema.UserConnectionType{}, err
+	}
+
+	return pageUsers([]db.UserWhereParam{
+		db.User.Following.Some(
+			db.User.Username.Equals(username),
+		),
+	}, page, viewerUsername)
+}
+
+// Get a page of the users a user follows
+func GetFollowingConnection(username string, page Page, viewerUsername string) (schema.UserConnectionType, error) {
+	err := validateConnectionUsers(username, viewerUsername)
+	if err != nil {
+		return schema.UserConnectionType{}, err
+	}
+
+	return pageUsers([]db.UserWhereParam{
+		db.User.Followers.Some(
+			db.User.Username.Equals(username),
+		),
+	}, page, viewerUsername)
+}
+
+// Get a page of the replies to a dweet
+func GetRepliesConnection(postID string, page Page, viewerUsername string) (schema.DweetConnectionType, error) {
+	// Validate params
+	err := common.Validate.Var(postID, "required,alphanum,len=10")
+	if err != nil {
+		return schema.DweetConnectionType{}, err
+	}
+
+	err = common.Validate.Var(viewerUsername, "omitempty,alphanum,lte=20")
+	if err != nil {
+		return schema.DweetConnectionType{}, err
+	}
+
+	return pageDweets([]db.DweetWhereParam{
+		db.Dweet.OriginalReplyID.Equals(postID),
+	}, page, viewerUsername)
+}
@@ -262,3 +262,26 @@ func GetFeed(username string) ([]interface{}, error) {
 	}
 	return formatted, err
 }
+
+// Of some users, find the ones whose feed shows the dweets and redweets of a user
+func FeedAudience(username string, candidates []string) ([]string, error) {
+	if len(candidates) == 0 {
+		return []string{}, nil
+	}
+
+	users, err := common.Client.User.FindMany(
+		db.User.Username.In(candidates),
+		db.User.Following.Some(
+			db.User.Username.Equals(username),
+		),
+	).Exec(common.BaseCtx)
+	if err != nil {
+		return []string{}, fmt.Errorf("internal server error: %v", err)
+	}
+
+	audience := []string{}
+	for _, user := range users {
+		audience = append(audience, user.Username)
+	}
+	return audience, nil
+}
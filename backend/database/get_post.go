@@ -293,7 +293,9 @@ func SubscribePost(postID string, repliesToFetch int, replyOffset int, viewerUse
 				db.User.FollowerCount.Order(db.DESC),
 			),
 		).Update(
-			db.Dweet.Subscribers.Push([]string{viewUser.Email}),
+			db.Dweet.Subscribers.Link(
+				db.User.Username.Equals(viewerUsername),
+			),
 		).Exec(common.BaseCtx)
 	} else {
 		post, err = common.Client.Dweet.FindUnique(
@@ -315,7 +317,9 @@ func SubscribePost(postID string, repliesToFetch int, replyOffset int, viewerUse
 				db.User.FollowerCount.Order(db.DESC),
 			),
 		).Update(
-			db.Dweet.Subscribers.Push([]string{viewUser.Email}),
+			db.Dweet.Subscribers.Link(
+				db.User.Username.Equals(viewerUsername),
+			),
 		).Exec(common.BaseCtx)
 	}
 	if err == db.ErrNotFound {
@@ -13,297 +13,57 @@ import (
 )
 
 // Get user when not authenticated
-func GetUserUnauth(username string, objectsToFetch string, feedObjectsToFetch int, feedObjectsOffset int) (schema.UserType, error) {
+func GetUserUnauth(username string, includes UserIncludes) (schema.UserType, error) {
 	// Validate params
 	err := common.Validate.Var(username, "required,alphanum,lte=20,gt=0")
 	if err != nil {
 		return schema.UserType{}, err
 	}
 
-	err = common.Validate.Var(objectsToFetch, "required,alpha,gt=0,oneof=feed dweet redweet redweetedDweet")
+	err = includes.validate()
 	if err != nil {
 		return schema.UserType{}, err
 	}
 
-	err = common.Validate.Var(feedObjectsOffset, "gte=0")
+	// Followers and following are only shown to people that know them
+	includes.Followers = false
+	includes.Following = false
+
+	withs, err := includes.with(username, "")
 	if err != nil {
 		return schema.UserType{}, err
 	}
 
-	var user *db.UserModel
-	var feedObjectList []interface{}
-
-	if feedObjectsToFetch < 0 {
-		switch objectsToFetch {
-		case "feed":
-			user, err = common.Client.User.FindUnique(
-				db.User.Username.Equals(username),
-			).With(
-				db.User.Dweets.Fetch().With(
-					db.Dweet.Author.Fetch(),
-				).OrderBy(
-					db.Dweet.PostedAt.Order(db.DESC),
-				),
-				db.User.Redweets.Fetch().With(
-					db.Redweet.Author.Fetch(),
-					db.Redweet.RedweetOf.Fetch().With(
-						db.Dweet.Author.Fetch(),
-					),
-				).OrderBy(
-					db.Redweet.RedweetTime.Order(db.DESC),
-				),
-				db.User.Followers.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-				db.User.Following.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-			).Exec(common.BaseCtx)
-			if err == db.ErrNotFound {
-				return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-			}
-			if err != nil {
-				return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-			}
-
-			merged := util.MergeDweetRedweetList(user.Dweets(), user.Redweets())
-
-			feedObjectList = append(feedObjectList, merged...)
-		case "dweet":
-			user, err = common.Client.User.FindUnique(
-				db.User.Username.Equals(username),
-			).With(
-				db.User.Dweets.Fetch().With(
-					db.Dweet.Author.Fetch(),
-				).OrderBy(
-					db.Dweet.PostedAt.Order(db.DESC),
-				),
-				db.User.Followers.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-				db.User.Following.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-			).Exec(common.BaseCtx)
-			if err == db.ErrNotFound {
-				return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-			}
-			if err != nil {
-				return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-			}
-
-			dweets := user.Dweets()
-			for i := 0; i < len(dweets); i++ {
-				feedObjectList = append(feedObjectList, dweets[i])
-			}
-		case "redweet":
-			user, err = common.Client.User.FindUnique(
-				db.User.Username.Equals(username),
-			).With(
-				db.User.Redweets.Fetch().With(
-					db.Redweet.Author.Fetch(),
-					db.Redweet.RedweetOf.Fetch().With(
-						db.Dweet.Author.Fetch(),
-					),
-				).OrderBy(
-					db.Redweet.RedweetTime.Order(db.DESC),
-				),
-				db.User.Followers.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-				db.User.Following.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-			).Exec(common.BaseCtx)
-			if err == db.ErrNotFound {
-				return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-			}
-			if err != nil {
-				return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-			}
-
-			redweets := user.Redweets()
-			for i := 0; i < len(redweets); i++ {
-				feedObjectList = append(feedObjectList, redweets[i])
-			}
-		case "redweetedDweet":
-			user, err = common.Client.User.FindUnique(
-				db.User.Username.Equals(username),
-			).With(
-				db.User.RedweetedDweets.Fetch().With(
-					db.Dweet.Author.Fetch(),
-				).OrderBy(
-					db.Dweet.PostedAt.Order(db.DESC),
-				),
-				db.User.Followers.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-				db.User.Following.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-			).Exec(common.BaseCtx)
-			if err == db.ErrNotFound {
-				return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-			}
-			if err != nil {
-				return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-			}
-
-			redweetedDweets := user.RedweetedDweets()
-			for i := 0; i < len(redweetedDweets); i++ {
-				feedObjectList = append(feedObjectList, redweetedDweets[i])
-			}
-		default:
-			break
-		}
-	} else {
-		switch objectsToFetch {
-		case "feed":
-			user, err = common.Client.User.FindUnique(
-				db.User.Username.Equals(username),
-			).With(
-				db.User.Dweets.Fetch().With(
-					db.Dweet.Author.Fetch(),
-				).OrderBy(
-					db.Dweet.PostedAt.Order(db.DESC),
-				).Take(feedObjectsToFetch+feedObjectsOffset),
-				db.User.Redweets.Fetch().With(
-					db.Redweet.Author.Fetch(),
-					db.Redweet.RedweetOf.Fetch().With(
-						db.Dweet.Author.Fetch(),
-					),
-				).OrderBy(
-					db.Redweet.RedweetTime.Order(db.DESC),
-				).Take(feedObjectsToFetch+feedObjectsOffset),
-				db.User.Followers.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-				db.User.Following.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-			).Exec(common.BaseCtx)
-			if err == db.ErrNotFound {
-				return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-			}
-			if err != nil {
-				return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-			}
-
-			merged := util.MergeDweetRedweetList(user.Dweets(), user.Redweets())
-
-			for i := 0; i < util.Min(feedObjectsToFetch, len(merged)); i++ {
-				feedObjectList = append(feedObjectList, merged[i+feedObjectsOffset])
-			}
-		case "dweet":
-			user, err = common.Client.User.FindUnique(
-				db.User.Username.Equals(username),
-			).With(
-				db.User.Dweets.Fetch().With(
-					db.Dweet.Author.Fetch(),
-				).OrderBy(
-					db.Dweet.PostedAt.Order(db.DESC),
-				).Skip(feedObjectsOffset).Take(feedObjectsToFetch),
-				db.User.Followers.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-				db.User.Following.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-			).Exec(common.BaseCtx)
-			if err == db.ErrNotFound {
-				return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-			}
-			if err != nil {
-				return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-			}
-
-			dweets := user.Dweets()
-			for i := 0; i < len(dweets); i++ {
-				feedObjectList = append(feedObjectList, dweets[i])
-			}
-		case "redweet":
-			user, err = common.Client.User.FindUnique(
-				db.User.Username.Equals(username),
-			).With(
-				db.User.Redweets.Fetch().With(
-					db.Redweet.Author.Fetch(),
-					db.Redweet.RedweetOf.Fetch().With(
-						db.Dweet.Author.Fetch(),
-					),
-				).OrderBy(
-					db.Redweet.RedweetTime.Order(db.DESC),
-				).Skip(feedObjectsOffset).Take(feedObjectsToFetch),
-				db.User.Followers.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-				db.User.Following.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-			).Exec(common.BaseCtx)
-			if err == db.ErrNotFound {
-				return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-			}
-			if err != nil {
-				return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-			}
-
-			redweets := user.Redweets()
-			for i := 0; i < len(redweets); i++ {
-				feedObjectList = append(feedObjectList, redweets[i])
-			}
-		case "redweetedDweet":
-			user, err = common.Client.User.FindUnique(
-				db.User.Username.Equals(username),
-			).With(
-				db.User.RedweetedDweets.Fetch().With(
-					db.Dweet.Author.Fetch(),
-				).OrderBy(
-					db.Dweet.PostedAt.Order(db.DESC),
-				).Skip(feedObjectsOffset).Take(feedObjectsToFetch),
-				db.User.Followers.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-				db.User.Following.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-			).Exec(common.BaseCtx)
-			if err == db.ErrNotFound {
-				return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-			}
-			if err != nil {
-				return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-			}
-
-			redweetedDweets := user.RedweetedDweets()
-			for i := 0; i < len(redweetedDweets); i++ {
-				feedObjectList = append(feedObjectList, redweetedDweets[i])
-			}
-		default:
-			break
-		}
+	user, err := common.Client.User.FindUnique(
+		db.User.Username.Equals(username),
+	).With(
+		withs...,
+	).Exec(common.BaseCtx)
+	if err == db.ErrNotFound {
+		return schema.UserType{}, fmt.Errorf("user not found: %v", err)
+	}
+	if err != nil {
+		return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
 	}
 
-	// TODO: Some kind of weird bug where you get nil objects in list when requesting dweets and redweets
-
-	// Send back the user requested, along with mutuals in the followers field
-	nuser, err := schema.FormatAsUserType(user, []db.UserModel{}, []db.UserModel{}, objectsToFetch, feedObjectList, false)
+	// Send back the user requested, along with the lists selected
+	nuser, err := schema.FormatAsUserType(user, []db.UserModel{}, []db.UserModel{}, "", []interface{}{}, false)
+	if err != nil {
+		return schema.UserType{}, err
+	}
+	err = formatUserIncludes(user, includes, &nuser)
 	return nuser, err
 }
 
 // Get user when authenticated
-func GetUser(username string, objectsToFetch string, feedObjectsToFetch int, feedObjectsOffset int, viewerUsername string) (schema.UserType, error) {
+func GetUser(username string, includes UserIncludes, viewerUsername string) (schema.UserType, error) {
 	// Validate params
 	err := common.Validate.Var(username, "required,alphanum,lte=20,gt=0")
 	if err != nil {
 		return schema.UserType{}, err
 	}
 
-	err = common.Validate.Var(objectsToFetch, "required,alpha,gt=0,oneof=feed dweet redweet redweetedDweet liked")
-	if err != nil {
-		return schema.UserType{}, err
-	}
-
-	err = common.Validate.Var(feedObjectsOffset, "gte=0")
+	err = includes.validate()
 	if err != nil {
 		return schema.UserType{}, err
 	}
@@ -313,9 +73,6 @@ func GetUser(username string, objectsToFetch string, feedObjectsToFetch int, fee
 		return schema.UserType{}, err
 	}
 
-	var user *db.UserModel
-	var feedObjectList []interface{}
-
 	// Get your own following-list
 	viewUser, err := common.Client.User.FindUnique(
 		db.User.Username.Equals(viewerUsername),
@@ -331,403 +88,82 @@ func GetUser(username string, objectsToFetch string, feedObjectsToFetch int, fee
 		return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
 	}
 
-	isCached := true
-	cachedObj, err := cache.GetCachedUserFull(username, objectsToFetch, feedObjectsToFetch, feedObjectsOffset)
-	if err != nil {
-		if err == redis.Nil {
-			isCached = false
-		} else {
-			return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-		}
-	}
-
-	if isCached {
-		fmt.Println("Grabbing from cache")
-	} else {
-		fmt.Println("Cache miss")
+	// Liked dweets are checked before the cache is, since they are cached along with the user
+	if includes.LikedDweets != nil && viewerUsername != username {
+		return schema.UserType{}, errors.New("unauthorized")
 	}
 
-	// isCached = false
-
-	if !isCached {
-		if feedObjectsToFetch < 0 {
-			switch objectsToFetch {
-			case "feed":
-				user, err = common.Client.User.FindUnique(
-					db.User.Username.Equals(username),
-				).With(
-					db.User.Dweets.Fetch().With(
-						db.Dweet.Author.Fetch(),
-					).OrderBy(
-						db.Dweet.PostedAt.Order(db.DESC),
-					),
-					db.User.Redweets.Fetch().With(
-						db.Redweet.Author.Fetch(),
-						db.Redweet.RedweetOf.Fetch().With(
-							db.Dweet.Author.Fetch(),
-						),
-					).OrderBy(
-						db.Redweet.RedweetTime.Order(db.DESC),
-					),
-					db.User.Followers.Fetch().OrderBy(
-						db.User.FollowerCount.Order(db.DESC),
-					),
-					db.User.Following.Fetch().OrderBy(
-						db.User.FollowerCount.Order(db.DESC),
-					),
-				).Exec(common.BaseCtx)
-				if err == db.ErrNotFound {
-					return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-				}
-				if err != nil {
-					return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-				}
-
-				merged := util.MergeDweetRedweetList(user.Dweets(), user.Redweets())
-
-				feedObjectList = append(feedObjectList, merged...)
-			case "dweet":
-				user, err = common.Client.User.FindUnique(
-					db.User.Username.Equals(username),
-				).With(
-					db.User.Dweets.Fetch().With(
-						db.Dweet.Author.Fetch(),
-					).OrderBy(
-						db.Dweet.PostedAt.Order(db.DESC),
-					),
-					db.User.Followers.Fetch().OrderBy(
-						db.User.FollowerCount.Order(db.DESC),
-					),
-					db.User.Following.Fetch().OrderBy(
-						db.User.FollowerCount.Order(db.DESC),
-					),
-				).Exec(common.BaseCtx)
-				if err == db.ErrNotFound {
-					return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-				}
-				if err != nil {
-					return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-				}
-
-				dweets := user.Dweets()
-				for i := 0; i < len(dweets); i++ {
-					feedObjectList = append(feedObjectList, dweets[i])
-				}
-			case "redweet":
-				user, err = common.Client.User.FindUnique(
-					db.User.Username.Equals(username),
-				).With(
-					db.User.Redweets.Fetch().With(
-						db.Redweet.Author.Fetch(),
-						db.Redweet.RedweetOf.Fetch().With(
-							db.Dweet.Author.Fetch(),
-						),
-					).OrderBy(
-						db.Redweet.RedweetTime.Order(db.DESC),
-					),
-					db.User.Followers.Fetch().OrderBy(
-						db.User.FollowerCount.Order(db.DESC),
-					),
-					db.User.Following.Fetch().OrderBy(
-						db.User.FollowerCount.Order(db.DESC),
-					),
-				).Exec(common.BaseCtx)
-				if err == db.ErrNotFound {
-					return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-				}
-				if err != nil {
-					return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-				}
-
-				redweets := user.Redweets()
-				for i := 0; i < len(redweets); i++ {
-					feedObjectList = append(feedObjectList, redweets[i])
-				}
-			case "redweetedDweet":
-				user, err = common.Client.User.FindUnique(
-					db.User.Username.Equals(username),
-				).With(
-					db.User.RedweetedDweets.Fetch().With(
-						db.Dweet.Author.Fetch(),
-					).OrderBy(
-						db.Dweet.PostedAt.Order(db.DESC),
-					),
-					db.User.Followers.Fetch().OrderBy(
-						db.User.FollowerCount.Order(db.DESC),
-					),
-					db.User.Following.Fetch().OrderBy(
-						db.User.FollowerCount.Order(db.DESC),
-					),
-				).Exec(common.BaseCtx)
-				if err == db.ErrNotFound {
-					return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-				}
-				if err != nil {
-					return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-				}
-
-				redweetedDweets := user.RedweetedDweets()
-				for i := 0; i < len(redweetedDweets); i++ {
-					feedObjectList = append(feedObjectList, redweetedDweets[i])
-				}
-			case "liked":
-				if viewerUsername == username {
-					user, err = common.Client.User.FindUnique(
-						db.User.Username.Equals(username),
-					).With(
-						db.User.LikedDweets.Fetch().With(
-							db.Dweet.Author.Fetch(),
-						).OrderBy(
-							db.Dweet.PostedAt.Order(db.DESC),
-						),
-						db.User.Followers.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						),
-						db.User.Following.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						),
-					).Exec(common.BaseCtx)
-					if err == db.ErrNotFound {
-						return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-					}
-					if err != nil {
-						return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-					}
-
-					likes := user.LikedDweets()
-					for i := 0; i < len(likes); i++ {
-						feedObjectList = append(feedObjectList, likes[i])
-					}
-				} else {
-					return schema.UserType{}, errors.New("unauthorized")
-				}
-			default:
-				break
-			}
-		} else {
-			switch objectsToFetch {
-			case "feed":
-				user, err = common.Client.User.FindUnique(
-					db.User.Username.Equals(username),
-				).With(
-					db.User.Dweets.Fetch().With(
-						db.Dweet.Author.Fetch(),
-					).OrderBy(
-						db.Dweet.PostedAt.Order(db.DESC),
-					).Take(feedObjectsToFetch+feedObjectsOffset),
-					db.User.Redweets.Fetch().With(
-						db.Redweet.Author.Fetch(),
-						db.Redweet.RedweetOf.Fetch().With(
-							db.Dweet.Author.Fetch(),
-						),
-					).OrderBy(
-						db.Redweet.RedweetTime.Order(db.DESC),
-					).Take(feedObjectsToFetch+feedObjectsOffset),
-					db.User.Followers.Fetch().OrderBy(
-						db.User.FollowerCount.Order(db.DESC),
-					),
-					db.User.Following.Fetch().OrderBy(
-						db.User.FollowerCount.Order(db.DESC),
-					),
-				).Exec(common.BaseCtx)
-				if err == db.ErrNotFound {
-					return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-				}
-				if err != nil {
-					return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-				}
-
-				merged := util.MergeDweetRedweetList(user.Dweets(), user.Redweets())
-
-				for i := 0; i < util.Min(feedObjectsToFetch, len(merged)); i++ {
-					feedObjectList = append(feedObjectList, merged[i+feedObjectsOffset])
-				}
-			case "dweet":
-				user, err = common.Client.User.FindUnique(
-					db.User.Username.Equals(username),
-				).With(
-					db.User.Dweets.Fetch().With(
-						db.Dweet.Author.Fetch(),
-					).OrderBy(
-						db.Dweet.PostedAt.Order(db.DESC),
-					).Skip(feedObjectsOffset).Take(feedObjectsToFetch),
-					db.User.Followers.Fetch().OrderBy(
-						db.User.FollowerCount.Order(db.DESC),
-					),
-					db.User.Following.Fetch().OrderBy(
-						db.User.FollowerCount.Order(db.DESC),
-					),
-				).Exec(common.BaseCtx)
-				if err == db.ErrNotFound {
-					return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-				}
-				if err != nil {
-					return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-				}
-
-				dweets := user.Dweets()
-				for i := 0; i < len(dweets); i++ {
-					feedObjectList = append(feedObjectList, dweets[i])
-				}
-			case "redweet":
-				user, err = common.Client.User.FindUnique(
-					db.User.Username.Equals(username),
-				).With(
-					db.User.Redweets.Fetch().With(
-						db.Redweet.Author.Fetch(),
-						db.Redweet.RedweetOf.Fetch().With(
-							db.Dweet.Author.Fetch(),
-						),
-					).OrderBy(
-						db.Redweet.RedweetTime.Order(db.DESC),
-					).Skip(feedObjectsOffset).Take(feedObjectsToFetch),
-					db.User.Followers.Fetch().OrderBy(
-						db.User.FollowerCount.Order(db.DESC),
-					),
-					db.User.Following.Fetch().OrderBy(
-						db.User.FollowerCount.Order(db.DESC),
-					),
-				).Exec(common.BaseCtx)
-				if err == db.ErrNotFound {
-					return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-				}
-				if err != nil {
-					return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-				}
-
-				redweets := user.Redweets()
-				for i := 0; i < len(redweets); i++ {
-					feedObjectList = append(feedObjectList, redweets[i])
-				}
-			case "redweetedDweet":
-				user, err = common.Client.User.FindUnique(
-					db.User.Username.Equals(username),
-				).With(
-					db.User.RedweetedDweets.Fetch().With(
-						db.Dweet.Author.Fetch(),
-					).OrderBy(
-						db.Dweet.PostedAt.Order(db.DESC),
-					).Skip(feedObjectsOffset).Take(feedObjectsToFetch),
-					db.User.Followers.Fetch().OrderBy(
-						db.User.FollowerCount.Order(db.DESC),
-					),
-					db.User.Following.Fetch().OrderBy(
-						db.User.FollowerCount.Order(db.DESC),
-					),
-				).Exec(common.BaseCtx)
-				if err == db.ErrNotFound {
-					return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-				}
-				if err != nil {
-					return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-				}
-
-				redweetedDweets := user.RedweetedDweets()
-				for i := 0; i < len(redweetedDweets); i++ {
-					feedObjectList = append(feedObjectList, redweetedDweets[i])
-				}
-			case "liked":
-				if viewerUsername == username {
-					user, err = common.Client.User.FindUnique(
-						db.User.Username.Equals(username),
-					).With(
-						db.User.LikedDweets.Fetch().With(
-							db.Dweet.Author.Fetch(),
-						).OrderBy(
-							db.Dweet.PostedAt.Order(db.DESC),
-						).Skip(feedObjectsOffset).Take(feedObjectsToFetch),
-						db.User.Followers.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						),
-						db.User.Following.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						),
-					).Exec(common.BaseCtx)
-					if err == db.ErrNotFound {
-						return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-					}
-					if err != nil {
-						return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-					}
-
-					likes := user.LikedDweets()
-					for i := 0; i < len(likes); i++ {
-						feedObjectList = append(feedObjectList, likes[i])
-					}
-				} else {
-					return schema.UserType{}, errors.New("unauthorized")
-				}
-			default:
-				break
+	// Users are only cached with one list, so queries selecting more always go to the database
+	includes, objectsToFetch, cachedPage, cacheable := includes.forCache()
+	if cacheable {
+		cachedObj, err := cache.GetCachedUserFull(username, objectsToFetch, cachedPage.Take, cachedPage.Skip)
+		if err == nil {
+			if viewerUsername == username {
+				return cachedObj, nil
 			}
-		}
-
-		var showEmail bool
-		var alsoFollowedBy []db.UserModel
-		var alsoFollowing []db.UserModel
-
-		if viewerUsername == username {
-			alsoFollowedBy = user.Followers()
-			alsoFollowing = user.Following()
-			showEmail = true
-		} else {
-			usersFollowed := append(viewUser.Following(), *viewUser)
 
-			// Get mutuals
-			followers := user.Followers()
-			following := user.Following()
-			showEmail = false
-
-			alsoFollowedBy = util.HashIntersectUsers(followers, usersFollowed)
-			alsoFollowing = util.HashIntersectUsers(following, usersFollowed)
-		}
-
-		err := cache.CacheUser("full", username, user, objectsToFetch, feedObjectsToFetch, feedObjectsOffset)
-		if err != nil {
-			return schema.UserType{}, err
-		}
-
-		// Send back the user requested, along with mutuals in the followers field
-		nuser, err := schema.FormatAsUserType(user, alsoFollowedBy, alsoFollowing, objectsToFetch, feedObjectList, showEmail)
-		return nuser, err
-	} else {
-		if viewerUsername == username {
-			return cachedObj, nil
-		} else {
 			followingDB := viewUser.Following()
 			followingSchema := make([]schema.BasicUserType, len(followingDB)+1)
 			for i, user := range followingDB {
 				followingSchema[i] = schema.FormatAsBasicUserType(&user)
 			}
 			followingSchema[len(followingDB)] = schema.FormatAsBasicUserType(viewUser)
-
 			// Get mutuals
 			followers := cachedObj.Followers
 			following := cachedObj.Following
 			cachedObj.Email = ""
-
 			cachedObj.Followers = util.HashIntersectUserSchema(followers, followingSchema)
 			cachedObj.Following = util.HashIntersectUserSchema(following, followingSchema)
-
 			return cachedObj, nil
 		}
+		if err != redis.Nil {
+			return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
+		}
 	}
-}
 
-// Get user when authenticated
-func SubscribeToUser(username string, objectsToFetch string, feedObjectsToFetch int, feedObjectsOffset int, viewerUsername string) (schema.UserType, error) {
-	// Validate params
-	err := common.Validate.Var(username, "required,alphanum,lte=20,gt=0")
+	withs, err := includes.with(username, viewerUsername)
+	if err != nil {
+		return schema.UserType{}, err
+	}
+
+	user, err := common.Client.User.FindUnique(
+		db.User.Username.Equals(username),
+	).With(
+		withs...,
+	).Exec(common.BaseCtx)
+	if err == db.ErrNotFound {
+		return schema.UserType{}, fmt.Errorf("user not found: %v", err)
+	}
+	if err != nil {
+		return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
+	}
+
+	if cacheable {
+		err = cache.CacheUser("full", username, user, objectsToFetch, cachedPage.Take, cachedPage.Skip)
+		if err != nil {
+			return schema.UserType{}, err
+		}
+	}
+
+	// Send back the user requested, along with mutuals in the followers field
+	alsoFollowedBy, alsoFollowing := mutualFollows(user, includes, viewUser)
+	nuser, err := schema.FormatAsUserType(user, alsoFollowedBy, alsoFollowing, "", []interface{}{}, viewerUsername == username)
 	if err != nil {
 		return schema.UserType{}, err
 	}
+	err = formatUserIncludes(user, includes, &nuser)
+	return nuser, err
+}
 
-	err = common.Validate.Var(objectsToFetch, "required,alpha,gt=0,oneof=feed dweet redweet redweetedDweet liked")
+// Get user when authenticated, and subscribe to their activity
+func SubscribeToUser(username string, includes UserIncludes, viewerUsername string) (schema.UserType, error) {
+	// Validate params
+	err := common.Validate.Var(username, "required,alphanum,lte=20,gt=0")
 	if err != nil {
 		return schema.UserType{}, err
 	}
 
-	err = common.Validate.Var(feedObjectsOffset, "gte=0")
+	err = includes.validate()
 	if err != nil {
 		return schema.UserType{}, err
 	}
@@ -737,11 +173,6 @@ func SubscribeToUser(username string, objectsToFetch string, feedObjectsToFetch
 		return schema.UserType{}, err
 	}
 
-	var user *db.UserModel
-	var alsoFollowedBy []db.UserModel
-	var alsoFollowing []db.UserModel
-	var feedObjectList []interface{}
-
 	// Get your own following-list
 	viewUser, err := common.Client.User.FindUnique(
 		db.User.Username.Equals(viewerUsername),
@@ -757,354 +188,33 @@ func SubscribeToUser(username string, objectsToFetch string, feedObjectsToFetch
 		return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
 	}
 
-	if feedObjectsToFetch < 0 {
-		switch objectsToFetch {
-		case "feed":
-			user, err = common.Client.User.FindUnique(
-				db.User.Username.Equals(username),
-			).With(
-				db.User.Dweets.Fetch().With(
-					db.Dweet.Author.Fetch(),
-				).OrderBy(
-					db.Dweet.PostedAt.Order(db.DESC),
-				),
-				db.User.Redweets.Fetch().With(
-					db.Redweet.Author.Fetch(),
-					db.Redweet.RedweetOf.Fetch().With(
-						db.Dweet.Author.Fetch(),
-					),
-				).OrderBy(
-					db.Redweet.RedweetTime.Order(db.DESC),
-				),
-				db.User.Followers.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-				db.User.Following.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-			).Update(
-				db.User.Subscribers.Push([]string{viewUser.Email}),
-			).Exec(common.BaseCtx)
-			if err == db.ErrNotFound {
-				return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-			}
-			if err != nil {
-				return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-			}
-
-			merged := util.MergeDweetRedweetList(user.Dweets(), user.Redweets())
-
-			feedObjectList = append(feedObjectList, merged...)
-		case "dweet":
-			user, err = common.Client.User.FindUnique(
-				db.User.Username.Equals(username),
-			).With(
-				db.User.Dweets.Fetch().With(
-					db.Dweet.Author.Fetch(),
-				).OrderBy(
-					db.Dweet.PostedAt.Order(db.DESC),
-				),
-				db.User.Followers.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-				db.User.Following.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-			).Update(
-				db.User.Subscribers.Push([]string{viewUser.Email}),
-			).Exec(common.BaseCtx)
-			if err == db.ErrNotFound {
-				return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-			}
-			if err != nil {
-				return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-			}
-
-			dweets := user.Dweets()
-			for i := 0; i < len(dweets); i++ {
-				feedObjectList = append(feedObjectList, dweets[i])
-			}
-		case "redweet":
-			user, err = common.Client.User.FindUnique(
-				db.User.Username.Equals(username),
-			).With(
-				db.User.Redweets.Fetch().With(
-					db.Redweet.Author.Fetch(),
-					db.Redweet.RedweetOf.Fetch().With(
-						db.Dweet.Author.Fetch(),
-					),
-				).OrderBy(
-					db.Redweet.RedweetTime.Order(db.DESC),
-				),
-				db.User.Followers.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-				db.User.Following.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-			).Update(
-				db.User.Subscribers.Push([]string{viewUser.Email}),
-			).Exec(common.BaseCtx)
-			if err == db.ErrNotFound {
-				return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-			}
-			if err != nil {
-				return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-			}
-
-			redweets := user.Redweets()
-			for i := 0; i < len(redweets); i++ {
-				feedObjectList = append(feedObjectList, redweets[i])
-			}
-		case "redweetedDweet":
-			user, err = common.Client.User.FindUnique(
-				db.User.Username.Equals(username),
-			).With(
-				db.User.RedweetedDweets.Fetch().With(
-					db.Dweet.Author.Fetch(),
-				).OrderBy(
-					db.Dweet.PostedAt.Order(db.DESC),
-				),
-				db.User.Followers.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-				db.User.Following.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-			).Update(
-				db.User.Subscribers.Push([]string{viewUser.Email}),
-			).Exec(common.BaseCtx)
-			if err == db.ErrNotFound {
-				return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-			}
-			if err != nil {
-				return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-			}
-
-			redweetedDweets := user.RedweetedDweets()
-			for i := 0; i < len(redweetedDweets); i++ {
-				feedObjectList = append(feedObjectList, redweetedDweets[i])
-			}
-		case "liked":
-			if viewerUsername == username {
-				user, err = common.Client.User.FindUnique(
-					db.User.Username.Equals(username),
-				).With(
-					db.User.LikedDweets.Fetch().With(
-						db.Dweet.Author.Fetch(),
-					).OrderBy(
-						db.Dweet.PostedAt.Order(db.DESC),
-					),
-					db.User.Followers.Fetch().OrderBy(
-						db.User.FollowerCount.Order(db.DESC),
-					),
-					db.User.Following.Fetch().OrderBy(
-						db.User.FollowerCount.Order(db.DESC),
-					),
-				).Update(
-					db.User.Subscribers.Push([]string{viewUser.Email}),
-				).Exec(common.BaseCtx)
-				if err == db.ErrNotFound {
-					return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-				}
-				if err != nil {
-					return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-				}
-
-				likes := user.LikedDweets()
-				for i := 0; i < len(likes); i++ {
-					feedObjectList = append(feedObjectList, likes[i])
-				}
-			} else {
-				return schema.UserType{}, errors.New("unauthorized")
-			}
-		default:
-			break
-		}
-	} else {
-		switch objectsToFetch {
-		case "feed":
-			user, err = common.Client.User.FindUnique(
-				db.User.Username.Equals(username),
-			).With(
-				db.User.Dweets.Fetch().With(
-					db.Dweet.Author.Fetch(),
-				).OrderBy(
-					db.Dweet.PostedAt.Order(db.DESC),
-				).Take(feedObjectsToFetch+feedObjectsOffset),
-				db.User.Redweets.Fetch().With(
-					db.Redweet.Author.Fetch(),
-					db.Redweet.RedweetOf.Fetch().With(
-						db.Dweet.Author.Fetch(),
-					),
-				).OrderBy(
-					db.Redweet.RedweetTime.Order(db.DESC),
-				).Take(feedObjectsToFetch+feedObjectsOffset),
-				db.User.Followers.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-				db.User.Following.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-			).Update(
-				db.User.Subscribers.Push([]string{viewUser.Email}),
-			).Exec(common.BaseCtx)
-			if err == db.ErrNotFound {
-				return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-			}
-			if err != nil {
-				return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-			}
-
-			merged := util.MergeDweetRedweetList(user.Dweets(), user.Redweets())
-
-			for i := 0; i < util.Min(feedObjectsToFetch, len(merged)); i++ {
-				feedObjectList = append(feedObjectList, merged[i+feedObjectsOffset])
-			}
-		case "dweet":
-			user, err = common.Client.User.FindUnique(
-				db.User.Username.Equals(username),
-			).With(
-				db.User.Dweets.Fetch().With(
-					db.Dweet.Author.Fetch(),
-				).OrderBy(
-					db.Dweet.PostedAt.Order(db.DESC),
-				).Skip(feedObjectsOffset).Take(feedObjectsToFetch),
-				db.User.Followers.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-				db.User.Following.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-			).Update(
-				db.User.Subscribers.Push([]string{viewUser.Email}),
-			).Exec(common.BaseCtx)
-			if err == db.ErrNotFound {
-				return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-			}
-			if err != nil {
-				return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-			}
-
-			dweets := user.Dweets()
-			for i := 0; i < len(dweets); i++ {
-				feedObjectList = append(feedObjectList, dweets[i])
-			}
-		case "redweet":
-			user, err = common.Client.User.FindUnique(
-				db.User.Username.Equals(username),
-			).With(
-				db.User.Redweets.Fetch().With(
-					db.Redweet.Author.Fetch(),
-					db.Redweet.RedweetOf.Fetch().With(
-						db.Dweet.Author.Fetch(),
-					),
-				).OrderBy(
-					db.Redweet.RedweetTime.Order(db.DESC),
-				).Skip(feedObjectsOffset).Take(feedObjectsToFetch),
-				db.User.Followers.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-				db.User.Following.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-			).Update(
-				db.User.Subscribers.Push([]string{viewUser.Email}),
-			).Exec(common.BaseCtx)
-			if err == db.ErrNotFound {
-				return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-			}
-			if err != nil {
-				return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-			}
-
-			redweets := user.Redweets()
-			for i := 0; i < len(redweets); i++ {
-				feedObjectList = append(feedObjectList, redweets[i])
-			}
-		case "redweetedDweet":
-			user, err = common.Client.User.FindUnique(
-				db.User.Username.Equals(username),
-			).With(
-				db.User.RedweetedDweets.Fetch().With(
-					db.Dweet.Author.Fetch(),
-				).OrderBy(
-					db.Dweet.PostedAt.Order(db.DESC),
-				).Skip(feedObjectsOffset).Take(feedObjectsToFetch),
-				db.User.Followers.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-				db.User.Following.Fetch().OrderBy(
-					db.User.FollowerCount.Order(db.DESC),
-				),
-			).Exec(common.BaseCtx)
-			if err == db.ErrNotFound {
-				return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-			}
-			if err != nil {
-				return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-			}
-
-			redweetedDweets := user.RedweetedDweets()
-			for i := 0; i < len(redweetedDweets); i++ {
-				feedObjectList = append(feedObjectList, redweetedDweets[i])
-			}
-		case "liked":
-			if viewerUsername == username {
-				user, err = common.Client.User.FindUnique(
-					db.User.Username.Equals(username),
-				).With(
-					db.User.LikedDweets.Fetch().With(
-						db.Dweet.Author.Fetch(),
-					).OrderBy(
-						db.Dweet.PostedAt.Order(db.DESC),
-					).Skip(feedObjectsOffset).Take(feedObjectsToFetch),
-					db.User.Followers.Fetch().OrderBy(
-						db.User.FollowerCount.Order(db.DESC),
-					),
-					db.User.Following.Fetch().OrderBy(
-						db.User.FollowerCount.Order(db.DESC),
-					),
-				).Update(
-					db.User.Subscribers.Push([]string{viewUser.Email}),
-				).Exec(common.BaseCtx)
-				if err == db.ErrNotFound {
-					return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-				}
-				if err != nil {
-					return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-				}
-
-				likes := user.LikedDweets()
-				for i := 0; i < len(likes); i++ {
-					feedObjectList = append(feedObjectList, likes[i])
-				}
-			} else {
-				return schema.UserType{}, errors.New("unauthorized")
-			}
-		default:
-			break
-		}
+	withs, err := includes.with(username, viewerUsername)
+	if err != nil {
+		return schema.UserType{}, err
 	}
-	var showEmail bool
-
-	if viewerUsername == username {
-		alsoFollowedBy = user.Followers()
-		alsoFollowing = user.Following()
-		showEmail = true
-	} else {
-		usersFollowed := append(viewUser.Following(), *viewUser)
 
-		// Get mutuals
-		followers := user.Followers()
-		following := user.Following()
-		showEmail = false
-
-		alsoFollowedBy = util.HashIntersectUsers(followers, usersFollowed)
-		alsoFollowing = util.HashIntersectUsers(following, usersFollowed)
+	user, err := common.Client.User.FindUnique(
+		db.User.Username.Equals(username),
+	).With(
+		withs...,
+	).Update(
+		db.User.Subscribers.Link(
+			db.User.Username.Equals(viewerUsername),
+		),
+	).Exec(common.BaseCtx)
+	if err == db.ErrNotFound {
+		return schema.UserType{}, fmt.Errorf("user not found: %v", err)
+	}
+	if err != nil {
+		return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
 	}
 
 	// Send back the user requested, along with mutuals in the followers field
-	nuser, err := schema.FormatAsUserType(user, alsoFollowedBy, alsoFollowing, objectsToFetch, feedObjectList, showEmail)
+	alsoFollowedBy, alsoFollowing := mutualFollows(user, includes, viewUser)
+	nuser, err := schema.FormatAsUserType(user, alsoFollowedBy, alsoFollowing, "", []interface{}{}, viewerUsername == username)
+	if err != nil {
+		return schema.UserType{}, err
+	}
+	err = formatUserIncludes(user, includes, &nuser)
 	return nuser, err
 }
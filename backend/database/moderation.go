@@ -0,0 +1,422 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/soumitradev/Dwitter/backend/auth"
+	"github.com/soumitradev/Dwitter/backend/common"
+	"github.com/soumitradev/Dwitter/backend/events"
+	"github.com/soumitradev/Dwitter/backend/prisma/db"
+	"github.com/soumitradev/Dwitter/backend/schema"
+	"github.com/soumitradev/Dwitter/backend/util"
+)
+
+// Make sure a user has a permission
+func requirePermission(username string, permission string) error {
+	allowed, err := common.HasPermission(username, permission)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return common.ErrForbidden
+	}
+	return nil
+}
+
+// Turn a stored report into what we send back
+func formatReport(report *db.ReportModel) schema.ReportType {
+	formatted := schema.ReportType{
+		ID:         report.ID,
+		Reporter:   report.ReporterID,
+		TargetType: report.TargetType,
+		TargetID:   report.TargetID,
+		Reason:     report.Reason,
+		CreatedAt:  report.CreatedAt,
+		Resolved:   report.Resolved,
+		ResolvedBy: report.ResolvedBy,
+	}
+	if resolvedAt, ok := report.ResolvedAt(); ok {
+		formatted.ResolvedAt = &resolvedAt
+	}
+	return formatted
+}
+
+// Report a dweet or a user to the moderators
+func CreateReport(reporter string, targetType string, targetID string, reason string) (schema.ReportType, error) {
+	err := common.Validate.Var(targetType, "required,oneof=dweet user")
+	if err != nil {
+		return schema.ReportType{}, err
+	}
+
+	err = common.Validate.Var(reason, "required,lte=280")
+	if err != nil {
+		return schema.ReportType{}, err
+	}
+
+	// Make sure what is reported exists
+	if targetType == "dweet" {
+		err = common.Validate.Var(targetID, "required,alphanum,len=10")
+		if err != nil {
+			return schema.ReportType{}, err
+		}
+		_, err = common.Client.Dweet.FindUnique(
+			db.Dweet.ID.Equals(targetID),
+		).Exec(common.BaseCtx)
+	} else {
+		err = common.Validate.Var(targetID, "required,alphanum,lte=20,gt=0")
+		if err != nil {
+			return schema.ReportType{}, err
+		}
+		_, err = common.Client.User.FindUnique(
+			db.User.Username.Equals(targetID),
+		).Exec(common.BaseCtx)
+	}
+	if err == db.ErrNotFound {
+		return schema.ReportType{}, fmt.Errorf("%s not found: %v", targetType, err)
+	}
+	if err != nil {
+		return schema.ReportType{}, fmt.Errorf("internal server error: %v", err)
+	}
+
+	// Reporting the same thing again doesn't help anyone
+	_, err = common.Client.Report.FindFirst(
+		db.Report.ReporterID.Equals(reporter),
+		db.Report.TargetType.Equals(targetType),
+		db.Report.TargetID.Equals(targetID),
+		db.Report.Resolved.Equals(false),
+	).Exec(common.BaseCtx)
+	if err == nil {
+		return schema.ReportType{}, errors.New("you have already reported this")
+	}
+	if err != db.ErrNotFound {
+		return schema.ReportType{}, fmt.Errorf("internal server error: %v", err)
+	}
+
+	report, err := common.Client.Report.CreateOne(
+		db.Report.ID.Set(util.GenID(10)),
+		db.Report.ReporterID.Set(reporter),
+		db.Report.TargetType.Set(targetType),
+		db.Report.TargetID.Set(targetID),
+		db.Report.Reason.Set(reason),
+		db.Report.CreatedAt.Set(time.Now().UTC()),
+	).Exec(common.BaseCtx)
+	if err != nil {
+		return schema.ReportType{}, fmt.Errorf("internal server error: %v", err)
+	}
+
+	return formatReport(report), nil
+}
+
+// Get reports, newest first, as someone allowed to view them
+func GetReports(viewer string, includeResolved bool, numberToFetch int, numOffset int) ([]schema.ReportType, error) {
+	err := common.Validate.Var(numberToFetch, "gte=0,lte=100")
+	if err != nil {
+		return nil, err
+	}
+
+	err = common.Validate.Var(numOffset, "gte=0")
+	if err != nil {
+		return nil, err
+	}
+
+	err = requirePermission(viewer, common.PermViewReports)
+	if err != nil {
+		return nil, err
+	}
+
+	filters := []db.ReportWhereParam{}
+	if !includeResolved {
+		filters = append(filters, db.Report.Resolved.Equals(false))
+	}
+
+	reports, err := common.Client.Report.FindMany(
+		filters...,
+	).OrderBy(
+		db.Report.CreatedAt.Order(db.DESC),
+	).Take(numberToFetch).Skip(numOffset).Exec(common.BaseCtx)
+	if err != nil {
+		return nil, fmt.Errorf("internal server error: %v", err)
+	}
+
+	formatted := []schema.ReportType{}
+	for i := range reports {
+		formatted = append(formatted, formatReport(&reports[i]))
+	}
+	return formatted, nil
+}
+
+// Mark every open report about something as resolved
+func resolveReportsOn(actor string, targetType string, targetID string) error {
+	_, err := common.Client.Report.FindMany(
+		db.Report.TargetType.Equals(targetType),
+		db.Report.TargetID.Equals(targetID),
+		db.Report.Resolved.Equals(false),
+	).Update(
+		db.Report.Resolved.Set(true),
+		db.Report.ResolvedBy.Set(actor),
+		db.Report.ResolvedAt.Set(time.Now().UTC()),
+	).Exec(common.BaseCtx)
+	return err
+}
+
+// Mark a report as resolved, as someone allowed to view reports
+func ResolveReport(actor string, reportID string) (schema.ReportType, error) {
+	err := common.Validate.Var(reportID, "required,alphanum,len=10")
+	if err != nil {
+		return schema.ReportType{}, err
+	}
+
+	err = requirePermission(actor, common.PermViewReports)
+	if err != nil {
+		return schema.ReportType{}, err
+	}
+
+	report, err := common.Client.Report.FindUnique(
+		db.Report.ID.Equals(reportID),
+	).Update(
+		db.Report.Resolved.Set(true),
+		db.Report.ResolvedBy.Set(actor),
+		db.Report.ResolvedAt.Set(time.Now().UTC()),
+	).Exec(common.BaseCtx)
+	if err == db.ErrNotFound {
+		return schema.ReportType{}, fmt.Errorf("report not found: %v", err)
+	}
+	if err != nil {
+		return schema.ReportType{}, fmt.Errorf("internal server error: %v", err)
+	}
+
+	common.WriteAuditLog(actor, "report.resolve", "report", reportID, "")
+	return formatReport(report), nil
+}
+
+// Remove someone else's dweet as a moderator, and resolve the reports about it
+func RemoveDweet(actor string, postID string, reason string) (schema.DweetType, error) {
+	err := common.Validate.Var(reason, "lte=280")
+	if err != nil {
+		return schema.DweetType{}, err
+	}
+
+	err = requirePermission(actor, common.PermDeleteAnyDweet)
+	if err != nil {
+		return schema.DweetType{}, err
+	}
+
+	removed, err := deleteDweet(postID, actor, reason, 0, 0)
+	if err != nil {
+		return schema.DweetType{}, err
+	}
+
+	err = resolveReportsOn(actor, "dweet", postID)
+	if err != nil {
+		return schema.DweetType{}, fmt.Errorf("internal server error: %v", err)
+	}
+	return removed, nil
+}
+
+// Check that an actor can moderate a user. Only admins can moderate other moderators and admins.
+func checkModeratable(actor string, username string) (*db.UserModel, error) {
+	if actor == username {
+		return nil, errors.New("you can't do this to your own account")
+	}
+
+	user, err := common.Client.User.FindUnique(
+		db.User.Username.Equals(username),
+	).Exec(common.BaseCtx)
+	if err == db.ErrNotFound {
+		return nil, fmt.Errorf("user not found: %v", err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("internal server error: %v", err)
+	}
+
+	if user.Role != common.RoleUser {
+		err = requirePermission(actor, common.PermManageRoles)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+// Suspend a user for some days, and log them out everywhere
+func SuspendUser(actor string, username string, days int, reason string) (schema.BasicUserType, error) {
+	err := common.Validate.Var(username, "required,alphanum,lte=20,gt=0")
+	if err != nil {
+		return schema.BasicUserType{}, err
+	}
+
+	err = common.Validate.Var(days, "gt=0,lte=3650")
+	if err != nil {
+		return schema.BasicUserType{}, err
+	}
+
+	err = common.Validate.Var(reason, "lte=280")
+	if err != nil {
+		return schema.BasicUserType{}, err
+	}
+
+	err = requirePermission(actor, common.PermSuspendUser)
+	if err != nil {
+		return schema.BasicUserType{}, err
+	}
+
+	_, err = checkModeratable(actor, username)
+	if err != nil {
+		return schema.BasicUserType{}, err
+	}
+
+	user, err := common.Client.User.FindUnique(
+		db.User.Username.Equals(username),
+	).Update(
+		db.User.SuspendedUntil.Set(time.Now().UTC().AddDate(0, 0, days)),
+		db.User.SuspensionReason.Set(reason),
+	).Exec(common.BaseCtx)
+	if err != nil {
+		return schema.BasicUserType{}, fmt.Errorf("internal server error: %v", err)
+	}
+
+	err = auth.RevokeAllSessions(username)
+	if err != nil {
+		return schema.BasicUserType{}, err
+	}
+
+	common.WriteAuditLog(actor, "user.suspend", "user", username, fmt.Sprintf("days=%d reason=%q", days, reason))
+	err = resolveReportsOn(actor, "user", username)
+	if err != nil {
+		return schema.BasicUserType{}, fmt.Errorf("internal server error: %v", err)
+	}
+
+	return schema.FormatAsBasicUserType(user), nil
+}
+
+// Lift the suspension of a user
+func UnsuspendUser(actor string, username string) (schema.BasicUserType, error) {
+	err := common.Validate.Var(username, "required,alphanum,lte=20,gt=0")
+	if err != nil {
+		return schema.BasicUserType{}, err
+	}
+
+	err = requirePermission(actor, common.PermSuspendUser)
+	if err != nil {
+		return schema.BasicUserType{}, err
+	}
+
+	_, err = checkModeratable(actor, username)
+	if err != nil {
+		return schema.BasicUserType{}, err
+	}
+
+	// A suspension that has already ended is the same as none
+	user, err := common.Client.User.FindUnique(
+		db.User.Username.Equals(username),
+	).Update(
+		db.User.SuspendedUntil.Set(time.Now().UTC()),
+		db.User.SuspensionReason.Set(""),
+	).Exec(common.BaseCtx)
+	if err != nil {
+		return schema.BasicUserType{}, fmt.Errorf("internal server error: %v", err)
+	}
+
+	common.WriteAuditLog(actor, "user.unsuspend", "user", username, "")
+	return schema.FormatAsBasicUserType(user), nil
+}
+
+// Change the role of a user, as an admin
+func SetRole(actor string, username string, role string) (schema.BasicUserType, error) {
+	err := common.Validate.Var(username, "required,alphanum,lte=20,gt=0")
+	if err != nil {
+		return schema.BasicUserType{}, err
+	}
+
+	if !common.IsValidRole(role) {
+		return schema.BasicUserType{}, fmt.Errorf("unknown role: %s", role)
+	}
+
+	err = requirePermission(actor, common.PermManageRoles)
+	if err != nil {
+		return schema.BasicUserType{}, err
+	}
+
+	// Admins can't demote themselves, so there is always someone left to manage roles
+	user, err := checkModeratable(actor, username)
+	if err != nil {
+		return schema.BasicUserType{}, err
+	}
+	oldRole := user.Role
+
+	user, err = common.Client.User.FindUnique(
+		db.User.Username.Equals(username),
+	).Update(
+		db.User.Role.Set(role),
+	).Exec(common.BaseCtx)
+	if err != nil {
+		return schema.BasicUserType{}, fmt.Errorf("internal server error: %v", err)
+	}
+
+	common.WriteAuditLog(actor, "user.role", "user", username, oldRole+" -> "+role)
+	return schema.FormatAsBasicUserType(user), nil
+}
+
+// Get the audit log, newest first, as an admin
+func GetAuditLog(viewer string, numberToFetch int, numOffset int) ([]schema.AuditLogEntryType, error) {
+	err := common.Validate.Var(numberToFetch, "gte=0,lte=100")
+	if err != nil {
+		return nil, err
+	}
+
+	err = common.Validate.Var(numOffset, "gte=0")
+	if err != nil {
+		return nil, err
+	}
+
+	err = requirePermission(viewer, common.PermViewAuditLog)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := common.Client.AuditLog.FindMany().OrderBy(
+		db.AuditLog.CreatedAt.Order(db.DESC),
+	).Take(numberToFetch).Skip(numOffset).Exec(common.BaseCtx)
+	if err != nil {
+		return nil, fmt.Errorf("internal server error: %v", err)
+	}
+
+	formatted := []schema.AuditLogEntryType{}
+	for _, entry := range entries {
+		formatted = append(formatted, schema.AuditLogEntryType{
+			Actor:      entry.ActorID,
+			Action:     entry.Action,
+			TargetType: entry.TargetType,
+			TargetID:   entry.TargetID,
+			Details:    entry.Details,
+			CreatedAt:  entry.CreatedAt,
+		})
+	}
+	return formatted, nil
+}
+
+// Get the API servers that are running and how many websocket clients each has, if the viewer is allowed to see them
+func GetInstances(viewer string) ([]schema.InstanceType, error) {
+	err := requirePermission(viewer, common.PermViewInstances)
+	if err != nil {
+		return nil, err
+	}
+
+	instances, err := events.Instances()
+	if err != nil {
+		return nil, fmt.Errorf("internal server error: %v", err)
+	}
+
+	formatted := []schema.InstanceType{}
+	for _, instance := range instances {
+		formatted = append(formatted, schema.InstanceType{
+			ID:            instance.ID,
+			Connections:   instance.Connections,
+			Subscriptions: instance.Subscriptions,
+			HeartbeatAt:   instance.HeartbeatAt,
+		})
+	}
+	return formatted, nil
+}
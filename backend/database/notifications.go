@@ -0,0 +1,382 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/soumitradev/Dwitter/backend/common"
+	"github.com/soumitradev/Dwitter/backend/events"
+	"github.com/soumitradev/Dwitter/backend/prisma/db"
+	"github.com/soumitradev/Dwitter/backend/schema"
+	"github.com/soumitradev/Dwitter/backend/subscriptions"
+	"github.com/soumitradev/Dwitter/backend/util"
+)
+
+// Types of notifications
+const (
+	NotificationLike       = "like"
+	NotificationReply      = "reply"
+	NotificationRedweet    = "redweet"
+	NotificationFollow     = "follow"
+	NotificationMention    = "mention"
+	NotificationNewDweet   = "newDweet"
+	NotificationNewRedweet = "newRedweet"
+)
+
+// The event each type of notification belongs to, which decides how users are notified about it
+var notificationEvents = map[string]string{
+	NotificationLike:       subscriptions.EventLike,
+	NotificationReply:      subscriptions.EventReply,
+	NotificationRedweet:    subscriptions.EventRedweet,
+	NotificationFollow:     subscriptions.EventFollow,
+	NotificationMention:    subscriptions.EventMention,
+	NotificationNewDweet:   subscriptions.EventSubscribedPost,
+	NotificationNewRedweet: subscriptions.EventSubscribedPost,
+}
+
+// Emails about these are collected into a digest for users who picked one
+var digestedNotifications = map[string]bool{
+	NotificationReply:      true,
+	NotificationNewDweet:   true,
+	NotificationNewRedweet: true,
+}
+
+// Mentions look like @username, at the start of the dweet or after something that can't be in a username,
+// so that email addresses like someone@example.com don't mention anyone
+var mentionRegex = regexp.MustCompile(`(?:^|[^a-zA-Z0-9_@.])@([a-zA-Z0-9]{1,20})\b`)
+
+// Someone to notify, and what the unsubscribe link in their email stops
+type recipient struct {
+	user       db.UserModel
+	targetType string
+	targetID   string
+}
+
+// Notify a user about something done to their own things. Unsubscribing stops emails about that event.
+func eventRecipient(user db.UserModel, notificationType string) recipient {
+	return recipient{user: user, targetType: subscriptions.TargetEvent, targetID: notificationEvents[notificationType]}
+}
+
+// Notify subscribers of a dweet or a user. Unsubscribing ends the subscription.
+func subscriberRecipients(users []db.UserModel, targetType string, targetID string) []recipient {
+	recipients := []recipient{}
+	for _, user := range users {
+		recipients = append(recipients, recipient{user: user, targetType: targetType, targetID: targetID})
+	}
+	return recipients
+}
+
+// Turn a stored notification into what we send back
+func formatNotification(notification *db.NotificationModel) schema.NotificationType {
+	return schema.NotificationType{
+		ID:        notification.ID,
+		Type:      notification.Type,
+		Actor:     notification.ActorID,
+		DweetID:   notification.DweetID,
+		Read:      notification.Read,
+		CreatedAt: notification.CreatedAt,
+	}
+}
+
+// Store an in-app notification and push it to its recipient.
+// A notification the recipient already has from the same actor about the same thing isn't stored again,
+// so liking and unliking or following and unfollowing over and over doesn't pile up notifications.
+func createNotification(recipient string, actor string, notificationType string, dweetID string) error {
+	_, err := common.Client.Notification.FindFirst(
+		db.Notification.RecipientID.Equals(recipient),
+		db.Notification.ActorID.Equals(actor),
+		db.Notification.Type.Equals(notificationType),
+		db.Notification.DweetID.Equals(dweetID),
+	).Exec(common.BaseCtx)
+	if err == nil {
+		return nil
+	}
+	if err != db.ErrNotFound {
+		return err
+	}
+
+	// Generate a unique ID
+	randID := util.GenID(10)
+	_, err = common.Client.Notification.FindUnique(
+		db.Notification.ID.Equals(randID),
+	).Exec(common.BaseCtx)
+	for err != db.ErrNotFound {
+		if err != nil {
+			return err
+		}
+		randID = util.GenID(10)
+		_, err = common.Client.Notification.FindUnique(
+			db.Notification.ID.Equals(randID),
+		).Exec(common.BaseCtx)
+	}
+
+	notification, err := common.Client.Notification.CreateOne(
+		db.Notification.ID.Set(randID),
+		db.Notification.RecipientID.Set(recipient),
+		db.Notification.ActorID.Set(actor),
+		db.Notification.Type.Set(notificationType),
+		db.Notification.DweetID.Set(dweetID),
+		db.Notification.CreatedAt.Set(time.Now().UTC()),
+	).Exec(common.BaseCtx)
+	if err != nil {
+		return err
+	}
+
+	events.Publish(events.Event{Type: events.NotificationCreated, Actor: actor, Owner: recipient, Object: formatNotification(notification)})
+	return nil
+}
+
+// Notify users about something someone did, through the channels each of them picked.
+// Nobody is notified about what they did themselves, and nobody is notified twice, so put the recipients with the most specific unsubscribe link first.
+// Failing to notify shouldn't fail what caused the notification, so errors are only logged.
+func notify(recipients []recipient, actor string, notificationType string, dweet *db.DweetModel) {
+	dweetID := ""
+	if dweet != nil {
+		dweetID = dweet.ID
+	}
+
+	unique := []recipient{}
+	usernames := []string{}
+	seen := map[string]bool{}
+	for _, r := range recipients {
+		if r.user.Username == actor || seen[r.user.Username] {
+			continue
+		}
+		seen[r.user.Username] = true
+		unique = append(unique, r)
+		usernames = append(usernames, r.user.Username)
+	}
+	if len(unique) == 0 {
+		return
+	}
+
+	preferences, err := subscriptions.PreferencesFor(usernames, notificationEvents[notificationType])
+	if err != nil {
+		fmt.Printf("Error reading notification preferences: %v\n", err)
+		return
+	}
+
+	for _, r := range unique {
+		preference := preferences[r.user.Username]
+		if preference.InApp {
+			err = createNotification(r.user.Username, actor, notificationType, dweetID)
+			if err != nil {
+				fmt.Printf("Error creating notification: %v\n", err)
+			}
+		}
+		if preference.Email {
+			if digestedNotifications[notificationType] && r.user.EmailDigest != subscriptions.DigestOff {
+				err = subscriptions.AddToDigest(r.user, notificationType, actor, dweet)
+			} else {
+				key := notificationType + ":" + actor + ":" + dweetID
+				err = subscriptions.EmailNotification(key, notificationType, r.user, actor, dweet, r.targetType, r.targetID)
+			}
+			if err != nil {
+				fmt.Printf("Error queueing notification email: %v\n", err)
+			}
+		}
+	}
+}
+
+// Get the usernames mentioned in the body of a dweet, once each
+func mentionedUsernames(body string) []string {
+	mentioned := []string{}
+	seen := map[string]bool{}
+	for _, match := range mentionRegex.FindAllStringSubmatch(body, -1) {
+		if !seen[match[1]] {
+			seen[match[1]] = true
+			mentioned = append(mentioned, match[1])
+		}
+	}
+	return mentioned
+}
+
+// Notify every user mentioned in a dweet
+func notifyMentions(dweet db.DweetModel) {
+	mentioned := mentionedUsernames(dweet.DweetBody)
+	if len(mentioned) == 0 {
+		return
+	}
+
+	// Only notify users that exist
+	users, err := common.Client.User.FindMany(
+		db.User.Username.In(mentioned),
+	).Exec(common.BaseCtx)
+	if err != nil {
+		fmt.Printf("Error finding mentioned users: %v\n", err)
+		return
+	}
+
+	recipients := []recipient{}
+	for _, user := range users {
+		recipients = append(recipients, eventRecipient(user, NotificationMention))
+	}
+	notify(recipients, dweet.AuthorID, NotificationMention, &dweet)
+}
+
+// Notify the subscribers of a user about their new dweet or redweet
+func notifyUserSubscribers(author string, notificationType string, dweet db.DweetModel) {
+	user, err := common.Client.User.FindUnique(
+		db.User.Username.Equals(author),
+	).With(
+		db.User.Subscribers.Fetch(),
+	).Exec(common.BaseCtx)
+	if err != nil {
+		fmt.Printf("Error finding subscribers: %v\n", err)
+		return
+	}
+
+	notify(subscriberRecipients(user.Subscribers(), subscriptions.TargetUser, author), author, notificationType, &dweet)
+}
+
+// Notify the author and the subscribers of a dweet about a reply to it
+func notifyReply(repliedID string, reply db.DweetModel) {
+	replied, err := common.Client.Dweet.FindUnique(
+		db.Dweet.ID.Equals(repliedID),
+	).With(
+		db.Dweet.Author.Fetch(),
+		db.Dweet.Subscribers.Fetch(),
+	).Exec(common.BaseCtx)
+	if err != nil {
+		fmt.Printf("Error finding subscribers: %v\n", err)
+		return
+	}
+
+	recipients := subscriberRecipients(replied.Subscribers(), subscriptions.TargetDweet, replied.ID)
+	recipients = append(recipients, eventRecipient(*replied.Author(), NotificationReply))
+	notify(recipients, reply.AuthorID, NotificationReply, &reply)
+}
+
+// Get notifications of a user, newest first. Pass the ID of the last notification seen to get the ones after it.
+func GetNotifications(username string, first int, after string) ([]schema.NotificationType, error) {
+	err := common.Validate.Var(first, "gte=0,lte=100")
+	if err != nil {
+		return nil, err
+	}
+
+	err = common.Validate.Var(after, "omitempty,alphanum,len=10")
+	if err != nil {
+		return nil, err
+	}
+
+	query := common.Client.Notification.FindMany(
+		db.Notification.RecipientID.Equals(username),
+	).OrderBy(
+		db.Notification.CreatedAt.Order(db.DESC),
+		db.Notification.ID.Order(db.DESC),
+	)
+	if after != "" {
+		_, err = common.Client.Notification.FindFirst(
+			db.Notification.ID.Equals(after),
+			db.Notification.RecipientID.Equals(username),
+		).Exec(common.BaseCtx)
+		if err == db.ErrNotFound {
+			return nil, fmt.Errorf("notification not found: %v", err)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("internal server error: %v", err)
+		}
+		query = query.Cursor(db.Notification.ID.Cursor(after)).Skip(1)
+	}
+
+	notifications, err := query.Take(first).Exec(common.BaseCtx)
+	if err != nil {
+		return nil, fmt.Errorf("internal server error: %v", err)
+	}
+
+	formatted := []schema.NotificationType{}
+	for i := range notifications {
+		formatted = append(formatted, formatNotification(&notifications[i]))
+	}
+	return formatted, nil
+}
+
+// Count the notifications a user hasn't read yet
+func GetUnreadNotificationCount(username string) (int, error) {
+	var result []struct {
+		Count int `json:"count"`
+	}
+	query := `SELECT COUNT(*)::int AS count FROM public."Notification" WHERE "recipientID" = $1 AND read = false;`
+	err := common.Client.Prisma.QueryRaw(query, username).Exec(common.BaseCtx, &result)
+	if err != nil {
+		return 0, fmt.Errorf("internal server error: %v", err)
+	}
+	if len(result) == 0 {
+		return 0, errors.New("internal server error: no count returned")
+	}
+	return result[0].Count, nil
+}
+
+// Mark notifications of a user as read, or all of them if no IDs are given.
+// Returns how many notifications are still unread.
+func MarkNotificationsRead(username string, ids []string) (int, error) {
+	err := common.Validate.Var(ids, "lte=100,dive,alphanum,len=10")
+	if err != nil {
+		return 0, err
+	}
+
+	filters := []db.NotificationWhereParam{
+		db.Notification.RecipientID.Equals(username),
+		db.Notification.Read.Equals(false),
+	}
+	if len(ids) > 0 {
+		filters = append(filters, db.Notification.ID.In(ids))
+	}
+
+	_, err = common.Client.Notification.FindMany(
+		filters...,
+	).Update(
+		db.Notification.Read.Set(true),
+	).Exec(common.BaseCtx)
+	if err != nil {
+		return 0, fmt.Errorf("internal server error: %v", err)
+	}
+
+	return GetUnreadNotificationCount(username)
+}
+
+// Stop getting notified about replies to a dweet
+func UnsubscribeFromPost(postID string, viewerUsername string) (bool, error) {
+	err := common.Validate.Var(postID, "required,alphanum,len=10")
+	if err != nil {
+		return false, err
+	}
+
+	err = subscriptions.Unsubscribe(viewerUsername, subscriptions.TargetDweet, postID)
+	if err == db.ErrNotFound {
+		return false, fmt.Errorf("dweet not found: %v", err)
+	}
+	if err != nil {
+		return false, fmt.Errorf("internal server error: %v", err)
+	}
+	return true, nil
+}
+
+// Stop getting notified about new dweets and redweets of a user
+func UnsubscribeFromUser(username string, viewerUsername string) (bool, error) {
+	err := common.Validate.Var(username, "required,alphanum,lte=20,gt=0")
+	if err != nil {
+		return false, err
+	}
+
+	err = subscriptions.Unsubscribe(viewerUsername, subscriptions.TargetUser, username)
+	if err == db.ErrNotFound {
+		return false, fmt.Errorf("user not found: %v", err)
+	}
+	if err != nil {
+		return false, fmt.Errorf("internal server error: %v", err)
+	}
+	return true, nil
+}
+
+// Get how a user wants to be notified about every event
+func GetNotificationPreferences(username string) ([]schema.NotificationPreferenceType, error) {
+	return subscriptions.GetPreferences(username)
+}
+
+// Set how a user wants to be notified about an event
+func SetNotificationPreference(username string, event string, email bool, inApp bool) (schema.NotificationPreferenceType, error) {
+	return subscriptions.SetPreference(username, event, email, inApp)
+}
@@ -0,0 +1,34 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMentionedUsernames(t *testing.T) {
+	tests := []struct {
+		body string
+		want []string
+	}{
+		{"@alice", []string{"alice"}},
+		{"hi @alice and @bob", []string{"alice", "bob"}},
+		{"@alice @alice @bob", []string{"alice", "bob"}},
+		{"(@alice), @bob!", []string{"alice", "bob"}},
+		{"@alice,@bob", []string{"alice", "bob"}},
+		{"line\n@alice", []string{"alice"}},
+		{"mail me at alice@example.com", []string{}},
+		{"alice@example.com, @bob", []string{"bob"}},
+		{"@@alice", []string{}},
+		{"@a_b", []string{}},
+		{"@abcdefghijklmnopqrst", []string{"abcdefghijklmnopqrst"}},
+		{"@abcdefghijklmnopqrstu", []string{}},
+		{"no mentions @ all", []string{}},
+	}
+
+	for _, test := range tests {
+		got := mentionedUsernames(test.body)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("mentionedUsernames(%q) = %q, want %q", test.body, got, test.want)
+		}
+	}
+}
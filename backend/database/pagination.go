@@ -0,0 +1,625 @@
+package database
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/soumitradev/Dwitter/backend/common"
+	"github.com/soumitradev/Dwitter/backend/prisma/db"
+	"github.com/soumitradev/Dwitter/backend/schema"
+)
+
+// A Page picks part of a list. Pass First to read forwards from After, or Last to read backwards from Before.
+type Page struct {
+	First  int
+	After  string
+	Last   int
+	Before string
+}
+
+// How many items a page has when neither First nor Last is given
+const defaultPageSize = 20
+
+var errBadCursor = errors.New("invalid request: bad cursor")
+
+func (page Page) validate() error {
+	err := common.Validate.Var(page.First, "gte=0,lte=100")
+	if err != nil {
+		return err
+	}
+
+	err = common.Validate.Var(page.Last, "gte=0,lte=100")
+	if err != nil {
+		return err
+	}
+
+	if page.First > 0 && page.Last > 0 {
+		return errors.New("invalid request: pass first or last, not both")
+	}
+	return nil
+}
+
+// Whether the page is read from its end, and how many items it has
+func (page Page) size() (bool, int) {
+	if page.Last > 0 {
+		return true, page.Last
+	}
+	if page.First > 0 {
+		return false, page.First
+	}
+	return false, defaultPageSize
+}
+
+// Work out where a page sits from the cursors on it, knowing whether there were more items past the end it was read towards
+func (page Page) info(backwards bool, hasMore bool, cursors []string) schema.PageInfoType {
+	info := schema.PageInfoType{}
+	if len(cursors) > 0 {
+		info.StartCursor = cursors[0]
+		info.EndCursor = cursors[len(cursors)-1]
+	}
+	if backwards {
+		info.HasPreviousPage = hasMore
+		info.HasNextPage = page.Before != ""
+	} else {
+		info.HasNextPage = hasMore
+		info.HasPreviousPage = page.After != ""
+	}
+	return info
+}
+
+// Cursors hold the columns a list is sorted by, so that pages don't shift when items are added or removed
+func encodeCursor(parts ...string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strings.Join(parts, "\x00")))
+}
+
+func decodeCursor(cursor string, parts int) ([]string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, errBadCursor
+	}
+	decoded := strings.Split(string(raw), "\x00")
+	if len(decoded) != parts {
+		return nil, errBadCursor
+	}
+	return decoded, nil
+}
+
+// Cursor of an item in a list sorted by time, with a unique key to break ties
+func timeCursor(at time.Time, key string) string {
+	return encodeCursor(at.UTC().Format(time.RFC3339Nano), key)
+}
+
+func decodeTimeCursor(cursor string) (time.Time, string, error) {
+	parts, err := decodeCursor(cursor, 2)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	at, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return time.Time{}, "", errBadCursor
+	}
+	return at, parts[1], nil
+}
+
+// The viewer and the users they follow, whose likes, redweets and follows are shown on what the viewer sees
+func knownBy(viewerUsername string) db.UserWhereParam {
+	return db.User.Or(
+		db.User.Username.Equals(viewerUsername),
+		db.User.Followers.Some(
+			db.User.Username.Equals(viewerUsername),
+		),
+	)
+}
+
+// Dweets are listed newest first, and their cursors hold when they were posted and their ID
+func dweetBounds(page Page) ([]db.DweetWhereParam, error) {
+	bounds := []db.DweetWhereParam{}
+	if page.After != "" {
+		at, id, err := decodeTimeCursor(page.After)
+		if err != nil {
+			return nil, err
+		}
+		bounds = append(bounds, db.Dweet.Or(
+			db.Dweet.PostedAt.Lt(at),
+			db.Dweet.And(
+				db.Dweet.PostedAt.Equals(at),
+				db.Dweet.ID.Lt(id),
+			),
+		))
+	}
+	if page.Before != "" {
+		at, id, err := decodeTimeCursor(page.Before)
+		if err != nil {
+			return nil, err
+		}
+		bounds = append(bounds, db.Dweet.Or(
+			db.Dweet.PostedAt.Gt(at),
+			db.Dweet.And(
+				db.Dweet.PostedAt.Equals(at),
+				db.Dweet.ID.Gt(id),
+			),
+		))
+	}
+	return bounds, nil
+}
+
+// What a dweet on a page is fetched with. Replies are paged through replyDweetsConnection, so none are fetched here.
+func dweetNodeIncludes(viewerUsername string) []db.DweetRelationWith {
+	includes := []db.DweetRelationWith{
+		db.Dweet.Author.Fetch(),
+		db.Dweet.ReplyTo.Fetch().With(
+			db.Dweet.Author.Fetch(),
+		),
+		db.Dweet.ReplyDweets.Fetch().Take(0),
+	}
+	if viewerUsername != "" {
+		includes = append(includes,
+			db.Dweet.LikeUsers.Fetch(knownBy(viewerUsername)).OrderBy(
+				db.User.FollowerCount.Order(db.DESC),
+			),
+			db.Dweet.RedweetUsers.Fetch(knownBy(viewerUsername)).OrderBy(
+				db.User.FollowerCount.Order(db.DESC),
+			),
+		)
+	}
+	return includes
+}
+
+func formatDweetNode(post *db.DweetModel, viewerUsername string) schema.DweetType {
+	if viewerUsername == "" {
+		return schema.FormatAsDweetType(post, []db.UserModel{}, []db.UserModel{})
+	}
+	return schema.FormatAsDweetType(post, post.LikeUsers(), post.RedweetUsers())
+}
+
+// Get a page of the dweets that match some filters. Pass an empty viewer when not authenticated.
+func pageDweets(filters []db.DweetWhereParam, page Page, viewerUsername string) (schema.DweetConnectionType, error) {
+	err := page.validate()
+	if err != nil {
+		return schema.DweetConnectionType{}, err
+	}
+
+	bounds, err := dweetBounds(page)
+	if err != nil {
+		return schema.DweetConnectionType{}, err
+	}
+	filters = append(filters, bounds...)
+
+	backwards, size := page.size()
+	order := db.DESC
+	if backwards {
+		order = db.ASC
+	}
+
+	posts, err := common.Client.Dweet.FindMany(
+		filters...,
+	).With(
+		dweetNodeIncludes(viewerUsername)...,
+	).OrderBy(
+		db.Dweet.PostedAt.Order(order),
+		db.Dweet.ID.Order(order),
+	).Take(size + 1).Exec(common.BaseCtx)
+	if err != nil {
+		return schema.DweetConnectionType{}, fmt.Errorf("internal server error: %v", err)
+	}
+
+	hasMore := len(posts) > size
+	if hasMore {
+		posts = posts[:size]
+	}
+	if backwards {
+		for i, j := 0, len(posts)-1; i < j; i, j = i+1, j-1 {
+			posts[i], posts[j] = posts[j], posts[i]
+		}
+	}
+
+	connection := schema.DweetConnectionType{Edges: []schema.DweetEdgeType{}}
+	cursors := []string{}
+	for i := range posts {
+		cursor := timeCursor(posts[i].PostedAt, posts[i].ID)
+		cursors = append(cursors, cursor)
+		connection.Edges = append(connection.Edges, schema.DweetEdgeType{
+			Cursor: cursor,
+			Node:   formatDweetNode(&posts[i], viewerUsername),
+		})
+	}
+	connection.PageInfo = page.info(backwards, hasMore, cursors)
+	return connection, nil
+}
+
+// Users are listed by username, which is also their cursor
+func userBounds(page Page) ([]db.UserWhereParam, error) {
+	bounds := []db.UserWhereParam{}
+	if page.After != "" {
+		parts, err := decodeCursor(page.After, 1)
+		if err != nil {
+			return nil, err
+		}
+		bounds = append(bounds, db.User.Username.Gt(parts[0]))
+	}
+	if page.Before != "" {
+		parts, err := decodeCursor(page.Before, 1)
+		if err != nil {
+			return nil, err
+		}
+		bounds = append(bounds, db.User.Username.Lt(parts[0]))
+	}
+	return bounds, nil
+}
+
+// Get a page of the users that match some filters.
+// Followers and following of each user only list the ones the viewer knows. Pass an empty viewer when not authenticated.
+func pageUsers(filters []db.UserWhereParam, page Page, viewerUsername string) (schema.UserConnectionType, error) {
+	err := page.validate()
+	if err != nil {
+		return schema.UserConnectionType{}, err
+	}
+
+	bounds, err := userBounds(page)
+	if err != nil {
+		return schema.UserConnectionType{}, err
+	}
+	filters = append(filters, bounds...)
+
+	backwards, size := page.size()
+	order := db.ASC
+	if backwards {
+		order = db.DESC
+	}
+
+	includes := []db.UserRelationWith{}
+	if viewerUsername != "" {
+		includes = append(includes,
+			db.User.Followers.Fetch(knownBy(viewerUsername)).OrderBy(
+				db.User.FollowerCount.Order(db.DESC),
+			),
+			db.User.Following.Fetch(knownBy(viewerUsername)).OrderBy(
+				db.User.FollowerCount.Order(db.DESC),
+			),
+		)
+	}
+
+	users, err := common.Client.User.FindMany(
+		filters...,
+	).With(
+		includes...,
+	).OrderBy(
+		db.User.Username.Order(order),
+	).Take(size + 1).Exec(common.BaseCtx)
+	if err != nil {
+		return schema.UserConnectionType{}, fmt.Errorf("internal server error: %v", err)
+	}
+
+	hasMore := len(users) > size
+	if hasMore {
+		users = users[:size]
+	}
+	if backwards {
+		for i, j := 0, len(users)-1; i < j; i, j = i+1, j-1 {
+			users[i], users[j] = users[j], users[i]
+		}
+	}
+
+	connection := schema.UserConnectionType{Edges: []schema.UserEdgeType{}}
+	cursors := []string{}
+	for i := range users {
+		alsoFollowedBy := []db.UserModel{}
+		alsoFollowing := []db.UserModel{}
+		if viewerUsername != "" {
+			alsoFollowedBy = users[i].Followers()
+			alsoFollowing = users[i].Following()
+		}
+
+		node, err := schema.FormatAsUserType(&users[i], alsoFollowedBy, alsoFollowing, "", []interface{}{}, users[i].Username == viewerUsername)
+		if err != nil {
+			return schema.UserConnectionType{}, err
+		}
+		cursor := encodeCursor(users[i].Username)
+		cursors = append(cursors, cursor)
+		connection.Edges = append(connection.Edges, schema.UserEdgeType{
+			Cursor: cursor,
+			Node:   node,
+		})
+	}
+	connection.PageInfo = page.info(backwards, hasMore, cursors)
+	return connection, nil
+}
+
+// Redweets are listed newest first, and their cursors hold when they were made and their database ID
+func redweetBounds(page Page) ([]db.RedweetWhereParam, error) {
+	bounds := []db.RedweetWhereParam{}
+	if page.After != "" {
+		at, id, err := decodeTimeCursor(page.After)
+		if err != nil {
+			return nil, err
+		}
+		bounds = append(bounds, db.Redweet.Or(
+			db.Redweet.RedweetTime.Lt(at),
+			db.Redweet.And(
+				db.Redweet.RedweetTime.Equals(at),
+				db.Redweet.DbID.Lt(id),
+			),
+		))
+	}
+	if page.Before != "" {
+		at, id, err := decodeTimeCursor(page.Before)
+		if err != nil {
+			return nil, err
+		}
+		bounds = append(bounds, db.Redweet.Or(
+			db.Redweet.RedweetTime.Gt(at),
+			db.Redweet.And(
+				db.Redweet.RedweetTime.Equals(at),
+				db.Redweet.DbID.Gt(id),
+			),
+		))
+	}
+	return bounds, nil
+}
+
+// Get a page of the redweets that match some filters
+func pageRedweets(filters []db.RedweetWhereParam, page Page) (schema.RedweetConnectionType, error) {
+	err := page.validate()
+	if err != nil {
+		return schema.RedweetConnectionType{}, err
+	}
+
+	bounds, err := redweetBounds(page)
+	if err != nil {
+		return schema.RedweetConnectionType{}, err
+	}
+	filters = append(filters, bounds...)
+
+	backwards, size := page.size()
+	order := db.DESC
+	if backwards {
+		order = db.ASC
+	}
+
+	redweets, err := common.Client.Redweet.FindMany(
+		filters...,
+	).With(
+		db.Redweet.Author.Fetch(),
+		db.Redweet.RedweetOf.Fetch().With(
+			db.Dweet.Author.Fetch(),
+		),
+	).OrderBy(
+		db.Redweet.RedweetTime.Order(order),
+		db.Redweet.DbID.Order(order),
+	).Take(size + 1).Exec(common.BaseCtx)
+	if err != nil {
+		return schema.RedweetConnectionType{}, fmt.Errorf("internal server error: %v", err)
+	}
+
+	hasMore := len(redweets) > size
+	if hasMore {
+		redweets = redweets[:size]
+	}
+	if backwards {
+		for i, j := 0, len(redweets)-1; i < j; i, j = i+1, j-1 {
+			redweets[i], redweets[j] = redweets[j], redweets[i]
+		}
+	}
+
+	connection := schema.RedweetConnectionType{Edges: []schema.RedweetEdgeType{}}
+	cursors := []string{}
+	for i := range redweets {
+		cursor := timeCursor(redweets[i].RedweetTime, redweets[i].DbID)
+		cursors = append(cursors, cursor)
+		connection.Edges = append(connection.Edges, schema.RedweetEdgeType{
+			Cursor: cursor,
+			Node:   schema.FormatAsRedweetType(&redweets[i]),
+		})
+	}
+	connection.PageInfo = page.info(backwards, hasMore, cursors)
+	return connection, nil
+}
+
+// Get a page of the dweets a user redweeted, in the order they were redweeted, newest first.
+// Cursors point at the redweets, so they hold when the dweet was redweeted and the database ID of the redweet.
+func pageRedweetedDweets(username string, page Page, viewerUsername string) (schema.DweetConnectionType, error) {
+	err := page.validate()
+	if err != nil {
+		return schema.DweetConnectionType{}, err
+	}
+
+	bounds, err := redweetBounds(page)
+	if err != nil {
+		return schema.DweetConnectionType{}, err
+	}
+	filters := append([]db.RedweetWhereParam{
+		db.Redweet.AuthorID.Equals(username),
+	}, bounds...)
+
+	backwards, size := page.size()
+	order := db.DESC
+	if backwards {
+		order = db.ASC
+	}
+
+	redweets, err := common.Client.Redweet.FindMany(
+		filters...,
+	).With(
+		db.Redweet.RedweetOf.Fetch().With(
+			dweetNodeIncludes(viewerUsername)...,
+		),
+	).OrderBy(
+		db.Redweet.RedweetTime.Order(order),
+		db.Redweet.DbID.Order(order),
+	).Take(size + 1).Exec(common.BaseCtx)
+	if err != nil {
+		return schema.DweetConnectionType{}, fmt.Errorf("internal server error: %v", err)
+	}
+
+	hasMore := len(redweets) > size
+	if hasMore {
+		redweets = redweets[:size]
+	}
+	if backwards {
+		for i, j := 0, len(redweets)-1; i < j; i, j = i+1, j-1 {
+			redweets[i], redweets[j] = redweets[j], redweets[i]
+		}
+	}
+
+	connection := schema.DweetConnectionType{Edges: []schema.DweetEdgeType{}}
+	cursors := []string{}
+	for i := range redweets {
+		cursor := timeCursor(redweets[i].RedweetTime, redweets[i].DbID)
+		cursors = append(cursors, cursor)
+		connection.Edges = append(connection.Edges, schema.DweetEdgeType{
+			Cursor: cursor,
+			Node:   formatDweetNode(redweets[i].RedweetOf(), viewerUsername),
+		})
+	}
+	connection.PageInfo = page.info(backwards, hasMore, cursors)
+	return connection, nil
+}
+
+// A dweet or redweet on a page of feed objects.
+// Keys start with "d" for dweets and "r" for redweets, so that a cursor tells which list it points into.
+type feedItem struct {
+	at   time.Time
+	key  string
+	node interface{}
+}
+
+// Merge the dweets and redweets of a page, each in the order the database returned them, into one list in that order.
+// Newest first, redweets come before dweets made at the same time, and oldest first it is the other way around.
+// IDs are never compared here, since Postgres and Go can sort strings differently.
+func mergeFeedItems(dweets []feedItem, redweets []feedItem, backwards bool) []feedItem {
+	items := make([]feedItem, 0, len(dweets)+len(redweets))
+	i, j := 0, 0
+	for i < len(dweets) && j < len(redweets) {
+		redweetFirst := !redweets[j].at.Before(dweets[i].at)
+		if backwards {
+			redweetFirst = redweets[j].at.Before(dweets[i].at)
+		}
+		if redweetFirst {
+			items = append(items, redweets[j])
+			j++
+		} else {
+			items = append(items, dweets[i])
+			i++
+		}
+	}
+	items = append(items, dweets[i:]...)
+	return append(items, redweets[j:]...)
+}
+
+// Get a page of the dweets and redweets of a user, newest first. Pass an empty viewer when not authenticated.
+func pageFeedObjects(username string, page Page, viewerUsername string) (schema.FeedObjectConnectionType, error) {
+	err := page.validate()
+	if err != nil {
+		return schema.FeedObjectConnectionType{}, err
+	}
+
+	dweetFilters := []db.DweetWhereParam{
+		db.Dweet.AuthorID.Equals(username),
+	}
+	redweetFilters := []db.RedweetWhereParam{
+		db.Redweet.AuthorID.Equals(username),
+	}
+
+	// Both lists are cut at the cursors, looking at the kind of item each cursor points at to break ties
+	if page.After != "" {
+		at, key, err := decodeTimeCursor(page.After)
+		if err != nil || len(key) < 2 {
+			return schema.FeedObjectConnectionType{}, errBadCursor
+		}
+		dweetTie := db.Dweet.PostedAt.Lt(at)
+		redweetTie := db.Redweet.RedweetTime.Lt(at)
+		if key[0] == 'd' {
+			dweetTie = db.Dweet.And(db.Dweet.PostedAt.Equals(at), db.Dweet.ID.Lt(key[1:]))
+		} else {
+			dweetTie = db.Dweet.PostedAt.Equals(at)
+			redweetTie = db.Redweet.And(db.Redweet.RedweetTime.Equals(at), db.Redweet.DbID.Lt(key[1:]))
+		}
+		dweetFilters = append(dweetFilters, db.Dweet.Or(db.Dweet.PostedAt.Lt(at), dweetTie))
+		redweetFilters = append(redweetFilters, db.Redweet.Or(db.Redweet.RedweetTime.Lt(at), redweetTie))
+	}
+	if page.Before != "" {
+		at, key, err := decodeTimeCursor(page.Before)
+		if err != nil || len(key) < 2 {
+			return schema.FeedObjectConnectionType{}, errBadCursor
+		}
+		dweetTie := db.Dweet.PostedAt.Gt(at)
+		redweetTie := db.Redweet.RedweetTime.Equals(at)
+		if key[0] == 'd' {
+			dweetTie = db.Dweet.And(db.Dweet.PostedAt.Equals(at), db.Dweet.ID.Gt(key[1:]))
+		} else {
+			redweetTie = db.Redweet.And(db.Redweet.RedweetTime.Equals(at), db.Redweet.DbID.Gt(key[1:]))
+		}
+		dweetFilters = append(dweetFilters, db.Dweet.Or(db.Dweet.PostedAt.Gt(at), dweetTie))
+		redweetFilters = append(redweetFilters, db.Redweet.Or(db.Redweet.RedweetTime.Gt(at), redweetTie))
+	}
+
+	backwards, size := page.size()
+	order := db.DESC
+	if backwards {
+		order = db.ASC
+	}
+
+	posts, err := common.Client.Dweet.FindMany(
+		dweetFilters...,
+	).With(
+		dweetNodeIncludes(viewerUsername)...,
+	).OrderBy(
+		db.Dweet.PostedAt.Order(order),
+		db.Dweet.ID.Order(order),
+	).Take(size + 1).Exec(common.BaseCtx)
+	if err != nil {
+		return schema.FeedObjectConnectionType{}, fmt.Errorf("internal server error: %v", err)
+	}
+
+	redweets, err := common.Client.Redweet.FindMany(
+		redweetFilters...,
+	).With(
+		db.Redweet.Author.Fetch(),
+		db.Redweet.RedweetOf.Fetch().With(
+			db.Dweet.Author.Fetch(),
+		),
+	).OrderBy(
+		db.Redweet.RedweetTime.Order(order),
+		db.Redweet.DbID.Order(order),
+	).Take(size + 1).Exec(common.BaseCtx)
+	if err != nil {
+		return schema.FeedObjectConnectionType{}, fmt.Errorf("internal server error: %v", err)
+	}
+
+	dweetItems := []feedItem{}
+	for i := range posts {
+		dweetItems = append(dweetItems, feedItem{at: posts[i].PostedAt, key: "d" + posts[i].ID, node: formatDweetNode(&posts[i], viewerUsername)})
+	}
+	redweetItems := []feedItem{}
+	for i := range redweets {
+		redweetItems = append(redweetItems, feedItem{at: redweets[i].RedweetTime, key: "r" + redweets[i].DbID, node: schema.FormatAsRedweetType(&redweets[i])})
+	}
+
+	// In the same order the cursors cut the lists in, and read from the end when going backwards
+	items := mergeFeedItems(dweetItems, redweetItems, backwards)
+	hasMore := len(items) > size
+	if hasMore {
+		items = items[:size]
+	}
+	if backwards {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+	}
+
+	connection := schema.FeedObjectConnectionType{Edges: []schema.FeedObjectEdgeType{}}
+	cursors := []string{}
+	for _, item := range items {
+		cursor := timeCursor(item.at, item.key)
+		cursors = append(cursors, cursor)
+		connection.Edges = append(connection.Edges, schema.FeedObjectEdgeType{
+			Cursor: cursor,
+			Node:   item.node,
+		})
+	}
+	connection.PageInfo = page.info(backwards, hasMore, cursors)
+	return connection, nil
+}
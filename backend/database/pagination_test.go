@@ -0,0 +1,230 @@
+package database
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/soumitradev/Dwitter/backend/common"
+	"github.com/soumitradev/Dwitter/backend/schema"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	tests := [][]string{
+		{"someone"},
+		{"2022-02-14T10:00:00Z", "abcdefghij"},
+		{"", ""},
+		{"with spaces", "and/slashes+plus=", "ünïcödé"},
+	}
+
+	for _, parts := range tests {
+		cursor := encodeCursor(parts...)
+		if strings.ContainsAny(cursor, "+/=") {
+			t.Errorf("encodeCursor(%q) = %q, which isn't safe in a URL", parts, cursor)
+		}
+		decoded, err := decodeCursor(cursor, len(parts))
+		if err != nil || !reflect.DeepEqual(decoded, parts) {
+			t.Errorf("decodeCursor(encodeCursor(%q)) = %q, %v", parts, decoded, err)
+		}
+	}
+}
+
+func TestDecodeCursorErrors(t *testing.T) {
+	tests := map[string]struct {
+		cursor string
+		parts  int
+	}{
+		"not base64":      {"!!!", 1},
+		"padded base64":   {"YQ==", 1},
+		"too few parts":   {encodeCursor("a"), 2},
+		"too many parts":  {encodeCursor("a", "b", "c"), 2},
+		"one part wanted": {encodeCursor("a", "b"), 1},
+	}
+
+	for name, test := range tests {
+		_, err := decodeCursor(test.cursor, test.parts)
+		if err != errBadCursor {
+			t.Errorf("%s: decodeCursor(%q, %d) error = %v, want %v", name, test.cursor, test.parts, err, errBadCursor)
+		}
+	}
+}
+
+func TestTimeCursor(t *testing.T) {
+	// Cursors keep every nanosecond, since items made in the same millisecond still have to be told apart
+	at := time.Date(2022, 2, 14, 10, 30, 15, 123456789, time.FixedZone("IST", 19800))
+	at2, key, err := decodeTimeCursor(timeCursor(at, "abcdefghij"))
+	if err != nil || !at2.Equal(at) || at2.Location() != time.UTC || key != "abcdefghij" {
+		t.Errorf("decodeTimeCursor(timeCursor(%v, abcdefghij)) = %v, %q, %v", at, at2, key, err)
+	}
+
+	// Equal times make equal cursors whatever zone they are in, so ties are broken by the key alone
+	if timeCursor(at, "a") != timeCursor(at.UTC(), "a") {
+		t.Error("timeCursor() depends on the time zone")
+	}
+
+	for _, cursor := range []string{encodeCursor("yesterday", "abcdefghij"), encodeCursor("abcdefghij")} {
+		_, _, err := decodeTimeCursor(cursor)
+		if err != errBadCursor {
+			t.Errorf("decodeTimeCursor(%q) error = %v, want %v", cursor, err, errBadCursor)
+		}
+	}
+}
+
+func TestPageValidate(t *testing.T) {
+	common.Validate = validator.New()
+
+	tests := []struct {
+		page    Page
+		wantErr bool
+	}{
+		{Page{}, false},
+		{Page{First: 10}, false},
+		{Page{Last: 100}, false},
+		{Page{First: 101}, true},
+		{Page{Last: -1}, true},
+		{Page{First: -1}, true},
+		{Page{First: 1, Last: 1}, true},
+	}
+
+	for _, test := range tests {
+		err := test.page.validate()
+		if (err != nil) != test.wantErr {
+			t.Errorf("%+v.validate() = %v, want error %v", test.page, err, test.wantErr)
+		}
+	}
+}
+
+func TestPageSize(t *testing.T) {
+	tests := []struct {
+		page          Page
+		wantBackwards bool
+		wantSize      int
+	}{
+		{Page{}, false, defaultPageSize},
+		{Page{First: 5}, false, 5},
+		{Page{Last: 5}, true, 5},
+		{Page{After: "x"}, false, defaultPageSize},
+	}
+
+	for _, test := range tests {
+		backwards, size := test.page.size()
+		if backwards != test.wantBackwards || size != test.wantSize {
+			t.Errorf("%+v.size() = %v, %d, want %v, %d", test.page, backwards, size, test.wantBackwards, test.wantSize)
+		}
+	}
+}
+
+func TestPageInfo(t *testing.T) {
+	cursors := []string{"a", "b", "c"}
+	tests := []struct {
+		page      Page
+		backwards bool
+		hasMore   bool
+		want      schema.PageInfoType
+	}{
+		{Page{First: 3}, false, true, schema.PageInfoType{HasNextPage: true, StartCursor: "a", EndCursor: "c"}},
+		{Page{First: 3, After: "x"}, false, false, schema.PageInfoType{HasPreviousPage: true, StartCursor: "a", EndCursor: "c"}},
+		{Page{Last: 3}, true, true, schema.PageInfoType{HasPreviousPage: true, StartCursor: "a", EndCursor: "c"}},
+		{Page{Last: 3, Before: "x"}, true, false, schema.PageInfoType{HasNextPage: true, StartCursor: "a", EndCursor: "c"}},
+	}
+
+	for _, test := range tests {
+		got := test.page.info(test.backwards, test.hasMore, cursors)
+		if got != test.want {
+			t.Errorf("%+v.info(%v, %v) = %+v, want %+v", test.page, test.backwards, test.hasMore, got, test.want)
+		}
+	}
+
+	if got := (Page{}).info(false, false, []string{}); got != (schema.PageInfoType{}) {
+		t.Errorf("info() of an empty page = %+v, want no cursors", got)
+	}
+}
+
+// Make feed items at minutes after a fixed time, in the order the database would return them
+func testFeedItems(prefix string, minutes []int, keys []string) []feedItem {
+	start := time.Date(2022, 2, 14, 10, 0, 0, 0, time.UTC)
+	items := []feedItem{}
+	for i := range minutes {
+		items = append(items, feedItem{at: start.Add(time.Minute * time.Duration(minutes[i])), key: prefix + keys[i]})
+	}
+	return items
+}
+
+func feedItemKeys(items []feedItem) []string {
+	keys := []string{}
+	for _, item := range items {
+		keys = append(keys, item.key)
+	}
+	return keys
+}
+
+func TestMergeFeedItems(t *testing.T) {
+	tests := []struct {
+		name      string
+		dweets    []feedItem
+		redweets  []feedItem
+		backwards bool
+		want      []string
+	}{
+		{
+			name:     "newest first",
+			dweets:   testFeedItems("d", []int{5, 3, 1}, []string{"5", "3", "1"}),
+			redweets: testFeedItems("r", []int{4, 2}, []string{"4", "2"}),
+			want:     []string{"d5", "r4", "d3", "r2", "d1"},
+		},
+		{
+			name:      "oldest first",
+			dweets:    testFeedItems("d", []int{1, 3, 5}, []string{"1", "3", "5"}),
+			redweets:  testFeedItems("r", []int{2, 4}, []string{"2", "4"}),
+			backwards: true,
+			want:      []string{"d1", "r2", "d3", "r4", "d5"},
+		},
+		{
+			name:     "redweets before dweets made at the same time",
+			dweets:   testFeedItems("d", []int{2, 2}, []string{"b", "a"}),
+			redweets: testFeedItems("r", []int{2, 2}, []string{"y", "x"}),
+			want:     []string{"ry", "rx", "db", "da"},
+		},
+		{
+			name:      "dweets before redweets made at the same time, read backwards",
+			dweets:    testFeedItems("d", []int{2, 2}, []string{"a", "b"}),
+			redweets:  testFeedItems("r", []int{2, 2}, []string{"x", "y"}),
+			backwards: true,
+			want:      []string{"da", "db", "rx", "ry"},
+		},
+		{
+			// Postgres can sort "a" before "B" while Go sorts it after, so the order of each list is kept as it is
+			name:     "ties keep the order of the database",
+			dweets:   testFeedItems("d", []int{2, 2, 2}, []string{"a", "B", "9"}),
+			redweets: testFeedItems("r", []int{3, 2, 1}, []string{"z", "a", "B"}),
+			want:     []string{"rz", "ra", "da", "dB", "d9", "rB"},
+		},
+		{
+			name:     "only dweets",
+			dweets:   testFeedItems("d", []int{2, 1}, []string{"2", "1"}),
+			redweets: []feedItem{},
+			want:     []string{"d2", "d1"},
+		},
+		{
+			name:     "only redweets",
+			dweets:   []feedItem{},
+			redweets: testFeedItems("r", []int{2, 1}, []string{"2", "1"}),
+			want:     []string{"r2", "r1"},
+		},
+		{
+			name:     "nothing",
+			dweets:   []feedItem{},
+			redweets: []feedItem{},
+			want:     []string{},
+		},
+	}
+
+	for _, test := range tests {
+		got := feedItemKeys(mergeFeedItems(test.dweets, test.redweets, test.backwards))
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: mergeFeedItems() = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
@@ -5,11 +5,15 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/soumitradev/Dwitter/backend/auth"
 	"github.com/soumitradev/Dwitter/backend/cache"
 	"github.com/soumitradev/Dwitter/backend/cdn"
 	"github.com/soumitradev/Dwitter/backend/common"
+	"github.com/soumitradev/Dwitter/backend/events"
+	"github.com/soumitradev/Dwitter/backend/mailer"
 	"github.com/soumitradev/Dwitter/backend/prisma/db"
 	"github.com/soumitradev/Dwitter/backend/schema"
+	"github.com/soumitradev/Dwitter/backend/subscriptions"
 	"github.com/soumitradev/Dwitter/backend/util"
 )
 
@@ -135,8 +139,9 @@ func UpdateDweet(postID string, username string, body string, mediaLinks []strin
 	}
 
 	// Mark media as used to prevent auto-deletion on expiry
-	for _, link := range mediaLinks {
-		delete(common.MediaCreatedButNotUsed, link)
+	err = cdn.MarkMediaUsed(mediaLinks)
+	if err != nil {
+		return schema.DweetType{}, fmt.Errorf("internal server error: %v", err)
 	}
 
 	// Add common likes and format
@@ -157,17 +162,25 @@ func UpdateDweet(postID string, username string, body string, mediaLinks []strin
 	mutualLikes := util.HashIntersectUsers(user.Following(), post.LikeUsers())
 	mutualRedweets := util.HashIntersectUsers(user.Following(), post.RedweetUsers())
 
+	events.Publish(events.Event{Type: events.DweetEdited, Actor: username, Owner: post.AuthorID, DweetID: post.ID})
+
 	npost := schema.FormatAsDweetType(post, mutualLikes, mutualRedweets)
 	return npost, err
 }
 
-// Update a user
-func UpdateUser(username string, name string, email string, bio string, PfpUrl string, followersToFetch int, followersOffset int, followingToFetch int, followingOffset int, objectsToFetch string, feedObjectsToFetch int, feedObjectsOffset int) (schema.UserType, error) {
+// Update a user as someone, who needs to be that user or allowed to edit any user
+func UpdateUser(actor string, username string, name string, email string, bio string, PfpUrl string, includes UserIncludes) (schema.UserType, error) {
 	// Validate params
 	err := common.Validate.Var(username, "required,alphanum,lte=20,gt=0")
 	if err != nil {
 		return schema.UserType{}, err
 	}
+
+	err = common.Authorize(actor, username, common.PermEditAnyUser)
+	if err != nil {
+		return schema.UserType{}, err
+	}
+
 	basicUser, err := common.Client.User.FindUnique(
 		db.User.Username.Equals(username),
 	).Exec(common.BaseCtx)
@@ -178,9 +191,18 @@ func UpdateUser(username string, name string, email string, bio string, PfpUrl s
 	if name == "" {
 		name = basicUser.Name
 	}
-	if email == "" {
-		email = basicUser.Email
+	// A new email only replaces the old one once the link sent to it is clicked
+	if email != "" && email != basicUser.Email {
+		// Whoever gets the link gets the account, so only the owner can ask for it
+		if actor != username {
+			return schema.UserType{}, errors.New("only the owner of an account can change its email")
+		}
+		err = auth.StartEmailChange(username, email)
+		if err != nil {
+			return schema.UserType{}, err
+		}
 	}
+	email = basicUser.Email
 	if PfpUrl == "" {
 		PfpUrl = basicUser.ProfilePicURL
 	}
@@ -205,1438 +227,137 @@ func UpdateUser(username string, name string, email string, bio string, PfpUrl s
 		return schema.UserType{}, err
 	}
 
-	err = common.Validate.Var(objectsToFetch, "required,alpha,gt=0,oneof=feed dweet redweet redweetedDweet liked")
+	err = includes.validate()
 	if err != nil {
 		return schema.UserType{}, err
 	}
 
-	err = common.Validate.Var(followersOffset, "gte=0")
+	// Users are only cached with one list, so queries selecting more drop the cached user instead of updating it
+	includes, objectsToFetch, cachedPage, cacheable := includes.forCache()
+	withs, err := includes.with(username, actor)
 	if err != nil {
 		return schema.UserType{}, err
 	}
 
-	err = common.Validate.Var(followingOffset, "gte=0")
-	if err != nil {
-		return schema.UserType{}, err
+	user, err := common.Client.User.FindUnique(
+		db.User.Username.Equals(username),
+	).With(
+		withs...,
+	).Update(
+		db.User.Name.Set(name),
+		db.User.Email.Set(email),
+		db.User.Bio.Set(bio),
+		db.User.ProfilePicURL.Set(PfpUrl),
+	).Exec(common.BaseCtx)
+	if err == db.ErrNotFound {
+		return schema.UserType{}, fmt.Errorf("user not found: %v", err)
 	}
-
-	err = common.Validate.Var(feedObjectsOffset, "gte=0")
 	if err != nil {
-		return schema.UserType{}, err
+		return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
 	}
 
-	var user *db.UserModel
-	var feedObjectList []interface{}
-
-	// Check params and return data accordingly
-	if followingToFetch < 0 {
-		if followersToFetch < 0 {
-			if feedObjectsToFetch < 0 {
-				switch objectsToFetch {
-				case "feed":
-					user, err = common.Client.User.FindUnique(
-						db.User.Username.Equals(username),
-					).With(
-						db.User.Dweets.Fetch().With(
-							db.Dweet.Author.Fetch(),
-						).OrderBy(
-							db.Dweet.PostedAt.Order(db.DESC),
-						),
-						db.User.Redweets.Fetch().With(
-							db.Redweet.Author.Fetch(),
-							db.Redweet.RedweetOf.Fetch(),
-						).OrderBy(
-							db.Redweet.RedweetTime.Order(db.DESC),
-						),
-						db.User.Followers.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						),
-						db.User.Following.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						),
-					).Update(
-						db.User.Name.Set(name),
-						db.User.Email.Set(email),
-						db.User.Bio.Set(bio),
-						db.User.ProfilePicURL.Set(PfpUrl),
-					).Exec(common.BaseCtx)
-					if err == db.ErrNotFound {
-						return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-					}
-					if err != nil {
-						return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-					}
-
-					merged := util.MergeDweetRedweetList(user.Dweets(), user.Redweets())
-					iterLen := util.Min(feedObjectsToFetch, len(merged))
-					feedObjectList := make([]interface{}, iterLen)
-					for i := 0; i < iterLen; i++ {
-						feedObjectList[i] = merged[i+feedObjectsOffset]
-					}
-				case "dweet":
-					user, err = common.Client.User.FindUnique(
-						db.User.Username.Equals(username),
-					).With(
-						db.User.Dweets.Fetch().With(
-							db.Dweet.Author.Fetch(),
-						).OrderBy(
-							db.Dweet.PostedAt.Order(db.DESC),
-						),
-						db.User.Followers.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						),
-						db.User.Following.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						),
-					).Update(
-						db.User.Name.Set(name),
-						db.User.Email.Set(email),
-						db.User.Bio.Set(bio),
-						db.User.ProfilePicURL.Set(PfpUrl),
-					).Exec(common.BaseCtx)
-					if err == db.ErrNotFound {
-						return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-					}
-					if err != nil {
-						return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-					}
-
-					dweets := user.Dweets()
-					for i := 0; i < len(dweets); i++ {
-						feedObjectList = append(feedObjectList, dweets[i])
-					}
-				case "redweet":
-					user, err = common.Client.User.FindUnique(
-						db.User.Username.Equals(username),
-					).With(
-						db.User.Redweets.Fetch().With(
-							db.Redweet.Author.Fetch(),
-							db.Redweet.RedweetOf.Fetch(),
-						).OrderBy(
-							db.Redweet.RedweetTime.Order(db.DESC),
-						),
-						db.User.Followers.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						),
-						db.User.Following.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						),
-					).Update(
-						db.User.Name.Set(name),
-						db.User.Email.Set(email),
-						db.User.Bio.Set(bio),
-						db.User.ProfilePicURL.Set(PfpUrl),
-					).Exec(common.BaseCtx)
-					if err == db.ErrNotFound {
-						return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-					}
-					if err != nil {
-						return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-					}
-
-					redweets := user.Redweets()
-					for i := 0; i < len(redweets); i++ {
-						feedObjectList = append(feedObjectList, redweets[i])
-					}
-				case "redweetedDweet":
-					user, err = common.Client.User.FindUnique(
-						db.User.Username.Equals(username),
-					).With(
-						db.User.RedweetedDweets.Fetch().With(
-							db.Dweet.Author.Fetch(),
-						).OrderBy(
-							db.Dweet.PostedAt.Order(db.DESC),
-						),
-						db.User.Followers.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						),
-						db.User.Following.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						),
-					).Update(
-						db.User.Name.Set(name),
-						db.User.Email.Set(email),
-						db.User.Bio.Set(bio),
-						db.User.ProfilePicURL.Set(PfpUrl),
-					).Exec(common.BaseCtx)
-					if err == db.ErrNotFound {
-						return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-					}
-					if err != nil {
-						return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-					}
-
-					redweetedDweets := user.RedweetedDweets()
-					for i := 0; i < len(redweetedDweets); i++ {
-						feedObjectList = append(feedObjectList, redweetedDweets[i])
-					}
-				case "liked":
-					user, err = common.Client.User.FindUnique(
-						db.User.Username.Equals(username),
-					).With(
-						db.User.LikedDweets.Fetch().With(
-							db.Dweet.Author.Fetch(),
-						).OrderBy(
-							db.Dweet.PostedAt.Order(db.DESC),
-						),
-						db.User.Followers.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						),
-						db.User.Following.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						),
-					).Update(
-						db.User.Name.Set(name),
-						db.User.Email.Set(email),
-						db.User.Bio.Set(bio),
-						db.User.ProfilePicURL.Set(PfpUrl),
-					).Exec(common.BaseCtx)
-					if err == db.ErrNotFound {
-						return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-					}
-					if err != nil {
-						return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-					}
-
-					likes := user.LikedDweets()
-					for i := 0; i < len(likes); i++ {
-						feedObjectList = append(feedObjectList, likes[i])
-					}
-				default:
-					break
-				}
-			} else {
-				switch objectsToFetch {
-				case "feed":
-					user, err = common.Client.User.FindUnique(
-						db.User.Username.Equals(username),
-					).With(
-						db.User.Dweets.Fetch().With(
-							db.Dweet.Author.Fetch(),
-						).OrderBy(
-							db.Dweet.PostedAt.Order(db.DESC),
-						).Take(feedObjectsOffset+feedObjectsToFetch),
-						db.User.Redweets.Fetch().With(
-							db.Redweet.Author.Fetch(),
-							db.Redweet.RedweetOf.Fetch(),
-						).OrderBy(
-							db.Redweet.RedweetTime.Order(db.DESC),
-						).Take(feedObjectsOffset+feedObjectsToFetch),
-						db.User.Followers.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						),
-						db.User.Following.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						),
-					).Update(
-						db.User.Name.Set(name),
-						db.User.Email.Set(email),
-						db.User.Bio.Set(bio),
-						db.User.ProfilePicURL.Set(PfpUrl),
-					).Exec(common.BaseCtx)
-					if err == db.ErrNotFound {
-						return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-					}
-					if err != nil {
-						return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-					}
-
-					merged := util.MergeDweetRedweetList(user.Dweets(), user.Redweets())
-
-					for i := 0; i < util.Min(feedObjectsToFetch, len(merged)); i++ {
-						feedObjectList = append(feedObjectList, merged[i+feedObjectsOffset])
-					}
-				case "dweet":
-					user, err = common.Client.User.FindUnique(
-						db.User.Username.Equals(username),
-					).With(
-						db.User.Dweets.Fetch().With(
-							db.Dweet.Author.Fetch(),
-						).OrderBy(
-							db.Dweet.PostedAt.Order(db.DESC),
-						).Skip(feedObjectsOffset).Take(feedObjectsToFetch),
-						db.User.Followers.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						),
-						db.User.Following.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						),
-					).Update(
-						db.User.Name.Set(name),
-						db.User.Email.Set(email),
-						db.User.Bio.Set(bio),
-						db.User.ProfilePicURL.Set(PfpUrl),
-					).Exec(common.BaseCtx)
-					if err == db.ErrNotFound {
-						return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-					}
-					if err != nil {
-						return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-					}
-
-					dweets := user.Dweets()
-					for i := 0; i < len(dweets); i++ {
-						feedObjectList = append(feedObjectList, dweets[i])
-					}
-				case "redweet":
-					user, err = common.Client.User.FindUnique(
-						db.User.Username.Equals(username),
-					).With(
-						db.User.Redweets.Fetch().With(
-							db.Redweet.Author.Fetch(),
-							db.Redweet.RedweetOf.Fetch(),
-						).OrderBy(
-							db.Redweet.RedweetTime.Order(db.DESC),
-						).Skip(feedObjectsOffset).Take(feedObjectsToFetch),
-						db.User.Followers.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						),
-						db.User.Following.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						),
-					).Update(
-						db.User.Name.Set(name),
-						db.User.Email.Set(email),
-						db.User.Bio.Set(bio),
-						db.User.ProfilePicURL.Set(PfpUrl),
-					).Exec(common.BaseCtx)
-					if err == db.ErrNotFound {
-						return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-					}
-					if err != nil {
-						return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-					}
-
-					redweets := user.Redweets()
-					for i := 0; i < len(redweets); i++ {
-						feedObjectList = append(feedObjectList, redweets[i])
-					}
-				case "redweetedDweet":
-					user, err = common.Client.User.FindUnique(
-						db.User.Username.Equals(username),
-					).With(
-						db.User.RedweetedDweets.Fetch().With(
-							db.Dweet.Author.Fetch(),
-						).OrderBy(
-							db.Dweet.PostedAt.Order(db.DESC),
-						).Skip(feedObjectsOffset).Take(feedObjectsToFetch),
-						db.User.Followers.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						),
-						db.User.Following.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						),
-					).Update(
-						db.User.Name.Set(name),
-						db.User.Email.Set(email),
-						db.User.Bio.Set(bio),
-						db.User.ProfilePicURL.Set(PfpUrl),
-					).Exec(common.BaseCtx)
-					if err == db.ErrNotFound {
-						return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-					}
-					if err != nil {
-						return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-					}
-
-					redweetedDweets := user.RedweetedDweets()
-					for i := 0; i < len(redweetedDweets); i++ {
-						feedObjectList = append(feedObjectList, redweetedDweets[i])
-					}
-				case "liked":
-					user, err = common.Client.User.FindUnique(
-						db.User.Username.Equals(username),
-					).With(
-						db.User.LikedDweets.Fetch().With(
-							db.Dweet.Author.Fetch(),
-						).OrderBy(
-							db.Dweet.PostedAt.Order(db.DESC),
-						).Skip(feedObjectsOffset).Take(feedObjectsToFetch),
-						db.User.Followers.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						),
-						db.User.Following.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						),
-					).Update(
-						db.User.Name.Set(name),
-						db.User.Email.Set(email),
-						db.User.Bio.Set(bio),
-						db.User.ProfilePicURL.Set(PfpUrl),
-					).Exec(common.BaseCtx)
-					if err == db.ErrNotFound {
-						return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-					}
-					if err != nil {
-						return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-					}
-
-					likes := user.LikedDweets()
-					for i := 0; i < len(likes); i++ {
-						feedObjectList = append(feedObjectList, likes[i])
-					}
-				default:
-					break
-				}
-			}
-		} else {
-			if feedObjectsToFetch < 0 {
-				switch objectsToFetch {
-				case "feed":
-					user, err = common.Client.User.FindUnique(
-						db.User.Username.Equals(username),
-					).With(
-						db.User.Dweets.Fetch().With(
-							db.Dweet.Author.Fetch(),
-						).OrderBy(
-							db.Dweet.PostedAt.Order(db.DESC),
-						),
-						db.User.Redweets.Fetch().With(
-							db.Redweet.Author.Fetch(),
-							db.Redweet.RedweetOf.Fetch(),
-						).OrderBy(
-							db.Redweet.RedweetTime.Order(db.DESC),
-						),
-						db.User.Followers.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						).Take(followersToFetch).Skip(followersOffset),
-						db.User.Following.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						),
-					).Update(
-						db.User.Name.Set(name),
-						db.User.Email.Set(email),
-						db.User.Bio.Set(bio),
-						db.User.ProfilePicURL.Set(PfpUrl),
-					).Exec(common.BaseCtx)
-					if err == db.ErrNotFound {
-						return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-					}
-					if err != nil {
-						return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-					}
-
-					merged := util.MergeDweetRedweetList(user.Dweets(), user.Redweets())
-					iterLen := util.Min(feedObjectsToFetch, len(merged))
-					feedObjectList := make([]interface{}, iterLen)
-					for i := 0; i < iterLen; i++ {
-						feedObjectList[i] = merged[i+feedObjectsOffset]
-					}
-				case "dweet":
-					user, err = common.Client.User.FindUnique(
-						db.User.Username.Equals(username),
-					).With(
-						db.User.Dweets.Fetch().With(
-							db.Dweet.Author.Fetch(),
-						).OrderBy(
-							db.Dweet.PostedAt.Order(db.DESC),
-						),
-						db.User.Followers.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						).Take(followersToFetch).Skip(followersOffset),
-						db.User.Following.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						),
-					).Update(
-						db.User.Name.Set(name),
-						db.User.Email.Set(email),
-						db.User.Bio.Set(bio),
-						db.User.ProfilePicURL.Set(PfpUrl),
-					).Exec(common.BaseCtx)
-					if err == db.ErrNotFound {
-						return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-					}
-					if err != nil {
-						return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-					}
-
-					dweets := user.Dweets()
-					for i := 0; i < len(dweets); i++ {
-						feedObjectList = append(feedObjectList, dweets[i])
-					}
-				case "redweet":
-					user, err = common.Client.User.FindUnique(
-						db.User.Username.Equals(username),
-					).With(
-						db.User.Redweets.Fetch().With(
-							db.Redweet.Author.Fetch(),
-							db.Redweet.RedweetOf.Fetch(),
-						).OrderBy(
-							db.Redweet.RedweetTime.Order(db.DESC),
-						),
-						db.User.Followers.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						).Take(followersToFetch).Skip(followersOffset),
-						db.User.Following.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						),
-					).Update(
-						db.User.Name.Set(name),
-						db.User.Email.Set(email),
-						db.User.Bio.Set(bio),
-						db.User.ProfilePicURL.Set(PfpUrl),
-					).Exec(common.BaseCtx)
-					if err == db.ErrNotFound {
-						return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-					}
-					if err != nil {
-						return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-					}
-
-					redweets := user.Redweets()
-					for i := 0; i < len(redweets); i++ {
-						feedObjectList = append(feedObjectList, redweets[i])
-					}
-				case "redweetedDweet":
-					user, err = common.Client.User.FindUnique(
-						db.User.Username.Equals(username),
-					).With(
-						db.User.RedweetedDweets.Fetch().With(
-							db.Dweet.Author.Fetch(),
-						).OrderBy(
-							db.Dweet.PostedAt.Order(db.DESC),
-						),
-						db.User.Followers.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						).Take(followersToFetch).Skip(followersOffset),
-						db.User.Following.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						),
-					).Update(
-						db.User.Name.Set(name),
-						db.User.Email.Set(email),
-						db.User.Bio.Set(bio),
-						db.User.ProfilePicURL.Set(PfpUrl),
-					).Exec(common.BaseCtx)
-					if err == db.ErrNotFound {
-						return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-					}
-					if err != nil {
-						return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-					}
-
-					redweetedDweets := user.RedweetedDweets()
-					for i := 0; i < len(redweetedDweets); i++ {
-						feedObjectList = append(feedObjectList, redweetedDweets[i])
-					}
-				case "liked":
-					user, err = common.Client.User.FindUnique(
-						db.User.Username.Equals(username),
-					).With(
-						db.User.LikedDweets.Fetch().With(
-							db.Dweet.Author.Fetch(),
-						).OrderBy(
-							db.Dweet.PostedAt.Order(db.DESC),
-						),
-						db.User.Followers.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						).Take(followersToFetch).Skip(followersOffset),
-						db.User.Following.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						),
-					).Update(
-						db.User.Name.Set(name),
-						db.User.Email.Set(email),
-						db.User.Bio.Set(bio),
-						db.User.ProfilePicURL.Set(PfpUrl),
-					).Exec(common.BaseCtx)
-					if err == db.ErrNotFound {
-						return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-					}
-					if err != nil {
-						return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-					}
-
-					likes := user.LikedDweets()
-					for i := 0; i < len(likes); i++ {
-						feedObjectList = append(feedObjectList, likes[i])
-					}
-				default:
-					break
-				}
-			} else {
-				switch objectsToFetch {
-				case "feed":
-					user, err = common.Client.User.FindUnique(
-						db.User.Username.Equals(username),
-					).With(
-						db.User.Dweets.Fetch().With(
-							db.Dweet.Author.Fetch(),
-						).OrderBy(
-							db.Dweet.PostedAt.Order(db.DESC),
-						).Take(feedObjectsToFetch+feedObjectsOffset),
-						db.User.Redweets.Fetch().With(
-							db.Redweet.Author.Fetch(),
-							db.Redweet.RedweetOf.Fetch(),
-						).OrderBy(
-							db.Redweet.RedweetTime.Order(db.DESC),
-						).Take(feedObjectsToFetch+feedObjectsOffset),
-						db.User.Followers.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						).Take(followersToFetch).Skip(followersOffset),
-						db.User.Following.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						),
-					).Update(
-						db.User.Name.Set(name),
-						db.User.Email.Set(email),
-						db.User.Bio.Set(bio),
-						db.User.ProfilePicURL.Set(PfpUrl),
-					).Exec(common.BaseCtx)
-					if err == db.ErrNotFound {
-						return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-					}
-					if err != nil {
-						return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-					}
-
-					merged := util.MergeDweetRedweetList(user.Dweets(), user.Redweets())
-
-					for i := 0; i < util.Min(feedObjectsToFetch, len(merged)); i++ {
-						feedObjectList = append(feedObjectList, merged[i+feedObjectsOffset])
-					}
-				case "dweet":
-					user, err = common.Client.User.FindUnique(
-						db.User.Username.Equals(username),
-					).With(
-						db.User.Dweets.Fetch().With(
-							db.Dweet.Author.Fetch(),
-						).OrderBy(
-							db.Dweet.PostedAt.Order(db.DESC),
-						).Skip(feedObjectsOffset).Take(feedObjectsToFetch),
-						db.User.Followers.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						).Take(followersToFetch).Skip(followersOffset),
-						db.User.Following.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						),
-					).Update(
-						db.User.Name.Set(name),
-						db.User.Email.Set(email),
-						db.User.Bio.Set(bio),
-						db.User.ProfilePicURL.Set(PfpUrl),
-					).Exec(common.BaseCtx)
-					if err == db.ErrNotFound {
-						return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-					}
-					if err != nil {
-						return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-					}
-
-					dweets := user.Dweets()
-					for i := 0; i < len(dweets); i++ {
-						feedObjectList = append(feedObjectList, dweets[i])
-					}
-				case "redweet":
-					user, err = common.Client.User.FindUnique(
-						db.User.Username.Equals(username),
-					).With(
-						db.User.Redweets.Fetch().With(
-							db.Redweet.Author.Fetch(),
-							db.Redweet.RedweetOf.Fetch(),
-						).OrderBy(
-							db.Redweet.RedweetTime.Order(db.DESC),
-						).Skip(feedObjectsOffset).Take(feedObjectsToFetch),
-						db.User.Followers.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						).Take(followersToFetch).Skip(followersOffset),
-						db.User.Following.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						),
-					).Update(
-						db.User.Name.Set(name),
-						db.User.Email.Set(email),
-						db.User.Bio.Set(bio),
-						db.User.ProfilePicURL.Set(PfpUrl),
-					).Exec(common.BaseCtx)
-					if err == db.ErrNotFound {
-						return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-					}
-					if err != nil {
-						return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-					}
-
-					redweets := user.Redweets()
-					for i := 0; i < len(redweets); i++ {
-						feedObjectList = append(feedObjectList, redweets[i])
-					}
-				case "redweetedDweet":
-					user, err = common.Client.User.FindUnique(
-						db.User.Username.Equals(username),
-					).With(
-						db.User.RedweetedDweets.Fetch().With(
-							db.Dweet.Author.Fetch(),
-						).OrderBy(
-							db.Dweet.PostedAt.Order(db.DESC),
-						).Skip(feedObjectsOffset).Take(feedObjectsToFetch),
-						db.User.Followers.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						).Take(followersToFetch).Skip(followersOffset),
-						db.User.Following.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						),
-					).Update(
-						db.User.Name.Set(name),
-						db.User.Email.Set(email),
-						db.User.Bio.Set(bio),
-						db.User.ProfilePicURL.Set(PfpUrl),
-					).Exec(common.BaseCtx)
-					if err == db.ErrNotFound {
-						return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-					}
-					if err != nil {
-						return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-					}
-
-					redweetedDweets := user.RedweetedDweets()
-					for i := 0; i < len(redweetedDweets); i++ {
-						feedObjectList = append(feedObjectList, redweetedDweets[i])
-					}
-				case "liked":
-					user, err = common.Client.User.FindUnique(
-						db.User.Username.Equals(username),
-					).With(
-						db.User.LikedDweets.Fetch().With(
-							db.Dweet.Author.Fetch(),
-						).OrderBy(
-							db.Dweet.PostedAt.Order(db.DESC),
-						).Skip(feedObjectsOffset).Take(feedObjectsToFetch),
-						db.User.Followers.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						).Take(followersToFetch).Skip(followersOffset),
-						db.User.Following.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						),
-					).Update(
-						db.User.Name.Set(name),
-						db.User.Email.Set(email),
-						db.User.Bio.Set(bio),
-						db.User.ProfilePicURL.Set(PfpUrl),
-					).Exec(common.BaseCtx)
-					if err == db.ErrNotFound {
-						return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-					}
-					if err != nil {
-						return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-					}
-
-					likes := user.LikedDweets()
-					for i := 0; i < len(likes); i++ {
-						feedObjectList = append(feedObjectList, likes[i])
-					}
-				default:
-					break
-				}
-			}
-
-		}
+	if cacheable {
+		err = cache.EditUserCacheUpdate(*user, objectsToFetch, cachedPage.Take, cachedPage.Skip)
 	} else {
-		if followersToFetch < 0 {
-			if feedObjectsToFetch < 0 {
-				switch objectsToFetch {
-				case "feed":
-					user, err = common.Client.User.FindUnique(
-						db.User.Username.Equals(username),
-					).With(
-						db.User.Dweets.Fetch().With(
-							db.Dweet.Author.Fetch(),
-						).OrderBy(
-							db.Dweet.PostedAt.Order(db.DESC),
-						),
-						db.User.Redweets.Fetch().With(
-							db.Redweet.Author.Fetch(),
-							db.Redweet.RedweetOf.Fetch(),
-						).OrderBy(
-							db.Redweet.RedweetTime.Order(db.DESC),
-						),
-						db.User.Followers.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						),
-						db.User.Following.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						).Take(followingToFetch).Skip(followingOffset),
-					).Update(
-						db.User.Name.Set(name),
-						db.User.Email.Set(email),
-						db.User.Bio.Set(bio),
-						db.User.ProfilePicURL.Set(PfpUrl),
-					).Exec(common.BaseCtx)
-					if err == db.ErrNotFound {
-						return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-					}
-					if err != nil {
-						return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-					}
-
-					merged := util.MergeDweetRedweetList(user.Dweets(), user.Redweets())
-					iterLen := util.Min(feedObjectsToFetch, len(merged))
-					feedObjectList := make([]interface{}, iterLen)
-					for i := 0; i < iterLen; i++ {
-						feedObjectList[i] = merged[i+feedObjectsOffset]
-					}
-				case "dweet":
-					user, err = common.Client.User.FindUnique(
-						db.User.Username.Equals(username),
-					).With(
-						db.User.Dweets.Fetch().With(
-							db.Dweet.Author.Fetch(),
-						).OrderBy(
-							db.Dweet.PostedAt.Order(db.DESC),
-						),
-						db.User.Followers.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						),
-						db.User.Following.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						).Take(followingToFetch).Skip(followingOffset),
-					).Update(
-						db.User.Name.Set(name),
-						db.User.Email.Set(email),
-						db.User.Bio.Set(bio),
-						db.User.ProfilePicURL.Set(PfpUrl),
-					).Exec(common.BaseCtx)
-					if err == db.ErrNotFound {
-						return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-					}
-					if err != nil {
-						return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-					}
-
-					dweets := user.Dweets()
-					for i := 0; i < len(dweets); i++ {
-						feedObjectList = append(feedObjectList, dweets[i])
-					}
-				case "redweet":
-					user, err = common.Client.User.FindUnique(
-						db.User.Username.Equals(username),
-					).With(
-						db.User.Redweets.Fetch().With(
-							db.Redweet.Author.Fetch(),
-							db.Redweet.RedweetOf.Fetch(),
-						).OrderBy(
-							db.Redweet.RedweetTime.Order(db.DESC),
-						),
-						db.User.Followers.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						),
-						db.User.Following.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						).Take(followingToFetch).Skip(followingOffset),
-					).Update(
-						db.User.Name.Set(name),
-						db.User.Email.Set(email),
-						db.User.Bio.Set(bio),
-						db.User.ProfilePicURL.Set(PfpUrl),
-					).Exec(common.BaseCtx)
-					if err == db.ErrNotFound {
-						return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-					}
-					if err != nil {
-						return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-					}
-
-					redweets := user.Redweets()
-					for i := 0; i < len(redweets); i++ {
-						feedObjectList = append(feedObjectList, redweets[i])
-					}
-				case "redweetedDweet":
-					user, err = common.Client.User.FindUnique(
-						db.User.Username.Equals(username),
-					).With(
-						db.User.RedweetedDweets.Fetch().With(
-							db.Dweet.Author.Fetch(),
-						).OrderBy(
-							db.Dweet.PostedAt.Order(db.DESC),
-						),
-						db.User.Followers.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						),
-						db.User.Following.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						).Take(followingToFetch).Skip(followingOffset),
-					).Update(
-						db.User.Name.Set(name),
-						db.User.Email.Set(email),
-						db.User.Bio.Set(bio),
-						db.User.ProfilePicURL.Set(PfpUrl),
-					).Exec(common.BaseCtx)
-					if err == db.ErrNotFound {
-						return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-					}
-					if err != nil {
-						return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-					}
-
-					redweetedDweets := user.RedweetedDweets()
-					for i := 0; i < len(redweetedDweets); i++ {
-						feedObjectList = append(feedObjectList, redweetedDweets[i])
-					}
-				case "liked":
-					user, err = common.Client.User.FindUnique(
-						db.User.Username.Equals(username),
-					).With(
-						db.User.LikedDweets.Fetch().With(
-							db.Dweet.Author.Fetch(),
-						).OrderBy(
-							db.Dweet.PostedAt.Order(db.DESC),
-						),
-						db.User.Followers.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						),
-						db.User.Following.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						).Take(followingToFetch).Skip(followingOffset),
-					).Update(
-						db.User.Name.Set(name),
-						db.User.Email.Set(email),
-						db.User.Bio.Set(bio),
-						db.User.ProfilePicURL.Set(PfpUrl),
-					).Exec(common.BaseCtx)
-					if err == db.ErrNotFound {
-						return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-					}
-					if err != nil {
-						return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-					}
-
-					likes := user.LikedDweets()
-					for i := 0; i < len(likes); i++ {
-						feedObjectList = append(feedObjectList, likes[i])
-					}
-				default:
-					break
-				}
-			} else {
-				switch objectsToFetch {
-				case "feed":
-					user, err = common.Client.User.FindUnique(
-						db.User.Username.Equals(username),
-					).With(
-						db.User.Dweets.Fetch().With(
-							db.Dweet.Author.Fetch(),
-						).OrderBy(
-							db.Dweet.PostedAt.Order(db.DESC),
-						).Take(feedObjectsToFetch+feedObjectsOffset),
-						db.User.Redweets.Fetch().With(
-							db.Redweet.Author.Fetch(),
-							db.Redweet.RedweetOf.Fetch(),
-						).OrderBy(
-							db.Redweet.RedweetTime.Order(db.DESC),
-						).Take(feedObjectsToFetch+feedObjectsOffset),
-						db.User.Followers.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						),
-						db.User.Following.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						).Take(followingToFetch).Skip(followingOffset),
-					).Update(
-						db.User.Name.Set(name),
-						db.User.Email.Set(email),
-						db.User.Bio.Set(bio),
-						db.User.ProfilePicURL.Set(PfpUrl),
-					).Exec(common.BaseCtx)
-					if err == db.ErrNotFound {
-						return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-					}
-					if err != nil {
-						return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-					}
-
-					merged := util.MergeDweetRedweetList(user.Dweets(), user.Redweets())
-
-					for i := 0; i < util.Min(feedObjectsToFetch, len(merged)); i++ {
-						feedObjectList = append(feedObjectList, merged[i+feedObjectsOffset])
-					}
-				case "dweet":
-					user, err = common.Client.User.FindUnique(
-						db.User.Username.Equals(username),
-					).With(
-						db.User.Dweets.Fetch().With(
-							db.Dweet.Author.Fetch(),
-						).OrderBy(
-							db.Dweet.PostedAt.Order(db.DESC),
-						).Skip(feedObjectsOffset).Take(feedObjectsToFetch),
-						db.User.Followers.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						),
-						db.User.Following.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						).Take(followingToFetch).Skip(followingOffset),
-					).Update(
-						db.User.Name.Set(name),
-						db.User.Email.Set(email),
-						db.User.Bio.Set(bio),
-						db.User.ProfilePicURL.Set(PfpUrl),
-					).Exec(common.BaseCtx)
-					if err == db.ErrNotFound {
-						return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-					}
-					if err != nil {
-						return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-					}
-
-					dweets := user.Dweets()
-					for i := 0; i < len(dweets); i++ {
-						feedObjectList = append(feedObjectList, dweets[i])
-					}
-				case "redweet":
-					user, err = common.Client.User.FindUnique(
-						db.User.Username.Equals(username),
-					).With(
-						db.User.Redweets.Fetch().With(
-							db.Redweet.Author.Fetch(),
-							db.Redweet.RedweetOf.Fetch(),
-						).OrderBy(
-							db.Redweet.RedweetTime.Order(db.DESC),
-						).Skip(feedObjectsOffset).Take(feedObjectsToFetch),
-						db.User.Followers.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						),
-						db.User.Following.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						).Take(followingToFetch).Skip(followingOffset),
-					).Update(
-						db.User.Name.Set(name),
-						db.User.Email.Set(email),
-						db.User.Bio.Set(bio),
-						db.User.ProfilePicURL.Set(PfpUrl),
-					).Exec(common.BaseCtx)
-					if err == db.ErrNotFound {
-						return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-					}
-					if err != nil {
-						return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-					}
-
-					redweets := user.Redweets()
-					for i := 0; i < len(redweets); i++ {
-						feedObjectList = append(feedObjectList, redweets[i])
-					}
-				case "redweetedDweet":
-					user, err = common.Client.User.FindUnique(
-						db.User.Username.Equals(username),
-					).With(
-						db.User.RedweetedDweets.Fetch().With(
-							db.Dweet.Author.Fetch(),
-						).OrderBy(
-							db.Dweet.PostedAt.Order(db.DESC),
-						).Skip(feedObjectsOffset).Take(feedObjectsToFetch),
-						db.User.Followers.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						),
-						db.User.Following.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						).Take(followingToFetch).Skip(followingOffset),
-					).Update(
-						db.User.Name.Set(name),
-						db.User.Email.Set(email),
-						db.User.Bio.Set(bio),
-						db.User.ProfilePicURL.Set(PfpUrl),
-					).Exec(common.BaseCtx)
-					if err == db.ErrNotFound {
-						return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-					}
-					if err != nil {
-						return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-					}
-
-					redweetedDweets := user.RedweetedDweets()
-					for i := 0; i < len(redweetedDweets); i++ {
-						feedObjectList = append(feedObjectList, redweetedDweets[i])
-					}
-				case "liked":
-					user, err = common.Client.User.FindUnique(
-						db.User.Username.Equals(username),
-					).With(
-						db.User.LikedDweets.Fetch().With(
-							db.Dweet.Author.Fetch(),
-						).OrderBy(
-							db.Dweet.PostedAt.Order(db.DESC),
-						).Skip(feedObjectsOffset).Take(feedObjectsToFetch),
-						db.User.Followers.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						),
-						db.User.Following.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						).Take(followingToFetch).Skip(followingOffset),
-					).Update(
-						db.User.Name.Set(name),
-						db.User.Email.Set(email),
-						db.User.Bio.Set(bio),
-						db.User.ProfilePicURL.Set(PfpUrl),
-					).Exec(common.BaseCtx)
-					if err == db.ErrNotFound {
-						return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-					}
-					if err != nil {
-						return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-					}
-
-					likes := user.LikedDweets()
-					for i := 0; i < len(likes); i++ {
-						feedObjectList = append(feedObjectList, likes[i])
-					}
-				default:
-					break
-				}
-			}
-		} else {
-			if feedObjectsToFetch < 0 {
-				switch objectsToFetch {
-				case "feed":
-					user, err = common.Client.User.FindUnique(
-						db.User.Username.Equals(username),
-					).With(
-						db.User.Dweets.Fetch().With(
-							db.Dweet.Author.Fetch(),
-						).OrderBy(
-							db.Dweet.PostedAt.Order(db.DESC),
-						),
-						db.User.Redweets.Fetch().With(
-							db.Redweet.Author.Fetch(),
-							db.Redweet.RedweetOf.Fetch(),
-						).OrderBy(
-							db.Redweet.RedweetTime.Order(db.DESC),
-						),
-						db.User.Followers.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						).Take(followersToFetch).Skip(followersOffset),
-						db.User.Following.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						).Take(followingToFetch).Skip(followingOffset),
-					).Update(
-						db.User.Name.Set(name),
-						db.User.Email.Set(email),
-						db.User.Bio.Set(bio),
-						db.User.ProfilePicURL.Set(PfpUrl),
-					).Exec(common.BaseCtx)
-					if err == db.ErrNotFound {
-						return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-					}
-					if err != nil {
-						return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-					}
-
-					merged := util.MergeDweetRedweetList(user.Dweets(), user.Redweets())
-					iterLen := util.Min(feedObjectsToFetch, len(merged))
-					feedObjectList := make([]interface{}, iterLen)
-					for i := 0; i < iterLen; i++ {
-						feedObjectList[i] = merged[i+feedObjectsOffset]
-					}
-				case "dweet":
-					user, err = common.Client.User.FindUnique(
-						db.User.Username.Equals(username),
-					).With(
-						db.User.Dweets.Fetch().With(
-							db.Dweet.Author.Fetch(),
-						).OrderBy(
-							db.Dweet.PostedAt.Order(db.DESC),
-						),
-						db.User.Followers.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						).Take(followersToFetch).Skip(followersOffset),
-						db.User.Following.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						).Take(followingToFetch).Skip(followingOffset),
-					).Update(
-						db.User.Name.Set(name),
-						db.User.Email.Set(email),
-						db.User.Bio.Set(bio),
-						db.User.ProfilePicURL.Set(PfpUrl),
-					).Exec(common.BaseCtx)
-					if err == db.ErrNotFound {
-						return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-					}
-					if err != nil {
-						return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-					}
+		err = cache.DropUsers(username)
+	}
+	if err != nil {
+		return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
+	}
 
-					dweets := user.Dweets()
-					for i := 0; i < len(dweets); i++ {
-						feedObjectList = append(feedObjectList, dweets[i])
-					}
-				case "redweet":
-					user, err = common.Client.User.FindUnique(
-						db.User.Username.Equals(username),
-					).With(
-						db.User.Redweets.Fetch().With(
-							db.Redweet.Author.Fetch(),
-							db.Redweet.RedweetOf.Fetch(),
-						).OrderBy(
-							db.Redweet.RedweetTime.Order(db.DESC),
-						),
-						db.User.Followers.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						).Take(followersToFetch).Skip(followersOffset),
-						db.User.Following.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						).Take(followingToFetch).Skip(followingOffset),
-					).Update(
-						db.User.Name.Set(name),
-						db.User.Email.Set(email),
-						db.User.Bio.Set(bio),
-						db.User.ProfilePicURL.Set(PfpUrl),
-					).Exec(common.BaseCtx)
-					if err == db.ErrNotFound {
-						return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-					}
-					if err != nil {
-						return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-					}
+	if actor != username {
+		common.WriteAuditLog(actor, "user.edit", "user", username, fmt.Sprintf("name=%q bio=%q pfpURL=%q", name, bio, PfpUrl))
+	}
 
-					redweets := user.Redweets()
-					for i := 0; i < len(redweets); i++ {
-						feedObjectList = append(feedObjectList, redweets[i])
-					}
-				case "redweetedDweet":
-					user, err = common.Client.User.FindUnique(
-						db.User.Username.Equals(username),
-					).With(
-						db.User.RedweetedDweets.Fetch().With(
-							db.Dweet.Author.Fetch(),
-						).OrderBy(
-							db.Dweet.PostedAt.Order(db.DESC),
-						),
-						db.User.Followers.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						).Take(followersToFetch).Skip(followersOffset),
-						db.User.Following.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						).Take(followingToFetch).Skip(followingOffset),
-					).Update(
-						db.User.Name.Set(name),
-						db.User.Email.Set(email),
-						db.User.Bio.Set(bio),
-						db.User.ProfilePicURL.Set(PfpUrl),
-					).Exec(common.BaseCtx)
-					if err == db.ErrNotFound {
-						return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-					}
-					if err != nil {
-						return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-					}
+	events.Publish(events.Event{Type: events.UserUpdated, Actor: actor, Owner: username})
 
-					redweetedDweets := user.RedweetedDweets()
-					for i := 0; i < len(redweetedDweets); i++ {
-						feedObjectList = append(feedObjectList, redweetedDweets[i])
-					}
-				case "liked":
-					user, err = common.Client.User.FindUnique(
-						db.User.Username.Equals(username),
-					).With(
-						db.User.LikedDweets.Fetch().With(
-							db.Dweet.Author.Fetch(),
-						).OrderBy(
-							db.Dweet.PostedAt.Order(db.DESC),
-						),
-						db.User.Followers.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						).Take(followersToFetch).Skip(followersOffset),
-						db.User.Following.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						).Take(followingToFetch).Skip(followingOffset),
-					).Update(
-						db.User.Name.Set(name),
-						db.User.Email.Set(email),
-						db.User.Bio.Set(bio),
-						db.User.ProfilePicURL.Set(PfpUrl),
-					).Exec(common.BaseCtx)
-					if err == db.ErrNotFound {
-						return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-					}
-					if err != nil {
-						return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-					}
+	// Whoever can edit a user sees all of their followers and following
+	followers := []db.UserModel{}
+	if includes.Followers {
+		followers = user.Followers()
+	}
+	following := []db.UserModel{}
+	if includes.Following {
+		following = user.Following()
+	}
 
-					likes := user.LikedDweets()
-					for i := 0; i < len(likes); i++ {
-						feedObjectList = append(feedObjectList, likes[i])
-					}
-				default:
-					break
-				}
-			} else {
-				switch objectsToFetch {
-				case "feed":
-					user, err = common.Client.User.FindUnique(
-						db.User.Username.Equals(username),
-					).With(
-						db.User.Dweets.Fetch().With(
-							db.Dweet.Author.Fetch(),
-						).OrderBy(
-							db.Dweet.PostedAt.Order(db.DESC),
-						).Take(feedObjectsToFetch+feedObjectsOffset),
-						db.User.Redweets.Fetch().With(
-							db.Redweet.Author.Fetch(),
-							db.Redweet.RedweetOf.Fetch(),
-						).OrderBy(
-							db.Redweet.RedweetTime.Order(db.DESC),
-						).Take(feedObjectsToFetch+feedObjectsOffset),
-						db.User.Followers.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						).Take(followersToFetch).Skip(followersOffset),
-						db.User.Following.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						).Take(followingToFetch).Skip(followingOffset),
-					).Update(
-						db.User.Name.Set(name),
-						db.User.Email.Set(email),
-						db.User.Bio.Set(bio),
-						db.User.ProfilePicURL.Set(PfpUrl),
-					).Exec(common.BaseCtx)
-					if err == db.ErrNotFound {
-						return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-					}
-					if err != nil {
-						return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-					}
+	nuser, err := schema.FormatAsUserType(user, followers, following, "", []interface{}{}, true)
+	if err != nil {
+		return schema.UserType{}, err
+	}
+	err = formatUserIncludes(user, includes, &nuser)
+	return nuser, err
+}
 
-					merged := util.MergeDweetRedweetList(user.Dweets(), user.Redweets())
+// Set how often a user gets emails about replies and new posts of users they subscribed to
+func SetEmailDigest(username string, frequency string) (string, error) {
+	if !subscriptions.IsDigestFrequency(frequency) {
+		return "", errors.New("invalid request: frequency must be off, hourly, daily or none")
+	}
 
-					for i := 0; i < util.Min(feedObjectsToFetch, len(merged)); i++ {
-						feedObjectList = append(feedObjectList, merged[i+feedObjectsOffset])
-					}
-				case "dweet":
-					user, err = common.Client.User.FindUnique(
-						db.User.Username.Equals(username),
-					).With(
-						db.User.Dweets.Fetch().With(
-							db.Dweet.Author.Fetch(),
-						).OrderBy(
-							db.Dweet.PostedAt.Order(db.DESC),
-						).Skip(feedObjectsOffset).Take(feedObjectsToFetch),
-						db.User.Followers.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						).Take(followersToFetch).Skip(followersOffset),
-						db.User.Following.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						).Take(followingToFetch).Skip(followingOffset),
-					).Update(
-						db.User.Name.Set(name),
-						db.User.Email.Set(email),
-						db.User.Bio.Set(bio),
-						db.User.ProfilePicURL.Set(PfpUrl),
-					).Exec(common.BaseCtx)
-					if err == db.ErrNotFound {
-						return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-					}
-					if err != nil {
-						return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-					}
+	user, err := common.Client.User.FindUnique(
+		db.User.Username.Equals(username),
+	).Exec(common.BaseCtx)
+	if err == db.ErrNotFound {
+		return "", fmt.Errorf("user not found: %v", err)
+	}
+	if err != nil {
+		return "", fmt.Errorf("internal server error: %v", err)
+	}
+	if user.EmailDigest == frequency {
+		return user.EmailDigest, nil
+	}
 
-					dweets := user.Dweets()
-					for i := 0; i < len(dweets); i++ {
-						feedObjectList = append(feedObjectList, dweets[i])
-					}
-				case "redweet":
-					user, err = common.Client.User.FindUnique(
-						db.User.Username.Equals(username),
-					).With(
-						db.User.Redweets.Fetch().With(
-							db.Redweet.Author.Fetch(),
-							db.Redweet.RedweetOf.Fetch(),
-						).OrderBy(
-							db.Redweet.RedweetTime.Order(db.DESC),
-						).Skip(feedObjectsOffset).Take(feedObjectsToFetch),
-						db.User.Followers.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						).Take(followersToFetch).Skip(followersOffset),
-						db.User.Following.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						).Take(followingToFetch).Skip(followingOffset),
-					).Update(
-						db.User.Name.Set(name),
-						db.User.Email.Set(email),
-						db.User.Bio.Set(bio),
-						db.User.ProfilePicURL.Set(PfpUrl),
-					).Exec(common.BaseCtx)
-					if err == db.ErrNotFound {
-						return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-					}
-					if err != nil {
-						return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-					}
+	user, err = common.Client.User.FindUnique(
+		db.User.Username.Equals(username),
+	).Update(
+		db.User.EmailDigest.Set(frequency),
+	).Exec(common.BaseCtx)
+	if err == db.ErrNotFound {
+		return "", fmt.Errorf("user not found: %v", err)
+	}
+	if err != nil {
+		return "", fmt.Errorf("internal server error: %v", err)
+	}
 
-					redweets := user.Redweets()
-					for i := 0; i < len(redweets); i++ {
-						feedObjectList = append(feedObjectList, redweets[i])
-					}
-				case "redweetedDweet":
-					user, err = common.Client.User.FindUnique(
-						db.User.Username.Equals(username),
-					).With(
-						db.User.RedweetedDweets.Fetch().With(
-							db.Dweet.Author.Fetch(),
-						).OrderBy(
-							db.Dweet.PostedAt.Order(db.DESC),
-						).Skip(feedObjectsOffset).Take(feedObjectsToFetch),
-						db.User.Followers.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						).Take(followersToFetch).Skip(followersOffset),
-						db.User.Following.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						).Take(followingToFetch).Skip(followingOffset),
-					).Update(
-						db.User.Name.Set(name),
-						db.User.Email.Set(email),
-						db.User.Bio.Set(bio),
-						db.User.ProfilePicURL.Set(PfpUrl),
-					).Exec(common.BaseCtx)
-					if err == db.ErrNotFound {
-						return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-					}
-					if err != nil {
-						return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-					}
+	// A digest that is waiting goes out when the new frequency says, not the old one
+	err = subscriptions.RescheduleDigest(username, frequency)
+	if err != nil {
+		return "", fmt.Errorf("internal server error: %v", err)
+	}
+	return user.EmailDigest, nil
+}
 
-					redweetedDweets := user.RedweetedDweets()
-					for i := 0; i < len(redweetedDweets); i++ {
-						feedObjectList = append(feedObjectList, redweetedDweets[i])
-					}
-				case "liked":
-					user, err = common.Client.User.FindUnique(
-						db.User.Username.Equals(username),
-					).With(
-						db.User.LikedDweets.Fetch().With(
-							db.Dweet.Author.Fetch(),
-						).OrderBy(
-							db.Dweet.PostedAt.Order(db.DESC),
-						).Skip(feedObjectsOffset).Take(feedObjectsToFetch),
-						db.User.Followers.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						).Take(followersToFetch).Skip(followersOffset),
-						db.User.Following.Fetch().OrderBy(
-							db.User.FollowerCount.Order(db.DESC),
-						).Take(followingToFetch).Skip(followingOffset),
-					).Update(
-						db.User.Name.Set(name),
-						db.User.Email.Set(email),
-						db.User.Bio.Set(bio),
-						db.User.ProfilePicURL.Set(PfpUrl),
-					).Exec(common.BaseCtx)
-					if err == db.ErrNotFound {
-						return schema.UserType{}, fmt.Errorf("user not found: %v", err)
-					}
-					if err != nil {
-						return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
-					}
+// Get how often a user gets emails about replies and new posts of users they subscribed to
+func GetEmailDigest(username string) (string, error) {
+	user, err := common.Client.User.FindUnique(
+		db.User.Username.Equals(username),
+	).Exec(common.BaseCtx)
+	if err == db.ErrNotFound {
+		return "", fmt.Errorf("user not found: %v", err)
+	}
+	if err != nil {
+		return "", fmt.Errorf("internal server error: %v", err)
+	}
+	return user.EmailDigest, nil
+}
 
-					likes := user.LikedDweets()
-					for i := 0; i < len(likes); i++ {
-						feedObjectList = append(feedObjectList, likes[i])
-					}
-				default:
-					break
-				}
-			}
-		}
+// Set the language a user gets emails in
+func SetLanguage(username string, language string) (string, error) {
+	if !mailer.IsSupportedLanguage(language) {
+		return "", errors.New("invalid request: unsupported language")
 	}
 
-	err = cache.EditUserCacheUpdate(*user, objectsToFetch, feedObjectsToFetch, feedObjectsOffset)
+	user, err := common.Client.User.FindUnique(
+		db.User.Username.Equals(username),
+	).Update(
+		db.User.Language.Set(language),
+	).Exec(common.BaseCtx)
+	if err == db.ErrNotFound {
+		return "", fmt.Errorf("user not found: %v", err)
+	}
 	if err != nil {
-		return schema.UserType{}, fmt.Errorf("internal server error: %v", err)
+		return "", fmt.Errorf("internal server error: %v", err)
 	}
-
-	nuser, err := schema.FormatAsUserType(user, user.Followers(), user.Following(), objectsToFetch, feedObjectList, true)
-	return nuser, err
+	return user.Language, nil
 }
@@ -0,0 +1,291 @@
+package database
+
+import (
+	"errors"
+
+	"github.com/soumitradev/Dwitter/backend/common"
+	"github.com/soumitradev/Dwitter/backend/prisma/db"
+	"github.com/soumitradev/Dwitter/backend/schema"
+	"github.com/soumitradev/Dwitter/backend/util"
+)
+
+// A ListPage picks part of a list fetched along with an object. A negative Take fetches the rest of the list.
+type ListPage struct {
+	Take int
+	Skip int
+}
+
+// What is fetched along with a user, worked out from the fields a query selects. Lists that aren't selected are nil.
+type UserIncludes struct {
+	Dweets          *ListPage
+	Redweets        *ListPage
+	RedweetedDweets *ListPage
+	FeedObjects     *ListPage
+	LikedDweets     *ListPage
+	Followers       bool
+	Following       bool
+}
+
+func (includes UserIncludes) validate() error {
+	for _, page := range []*ListPage{includes.Dweets, includes.Redweets, includes.RedweetedDweets, includes.FeedObjects, includes.LikedDweets} {
+		if page == nil {
+			continue
+		}
+		err := common.Validate.Var(page.Take, "gte=-1")
+		if err != nil {
+			return err
+		}
+		err = common.Validate.Var(page.Skip, "gte=0")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Where a page ends in its list, or -1 when it runs to the end
+func (page ListPage) end() int {
+	if page.Take < 0 {
+		return -1
+	}
+	return page.Skip + page.Take
+}
+
+// Feed objects are cut from the newest dweets and redweets merged together, so both are read from the start
+func (page *ListPage) fromStart() *ListPage {
+	if page == nil {
+		return nil
+	}
+	return &ListPage{Take: page.end(), Skip: 0}
+}
+
+// The part of a relation to fetch so that every page reading it can be cut from it, or nil when no page reads it
+func fetchWindow(pages ...*ListPage) *ListPage {
+	var window *ListPage
+	for _, page := range pages {
+		if page == nil {
+			continue
+		}
+		if window == nil {
+			only := *page
+			window = &only
+			continue
+		}
+
+		end := -1
+		if window.end() >= 0 && page.end() >= 0 {
+			end = window.end()
+			if page.end() > end {
+				end = page.end()
+			}
+		}
+		window = &ListPage{Take: end, Skip: 0}
+	}
+	return window
+}
+
+// Where a page starts and ends in a list fetched for a window
+func (page ListPage) cut(window ListPage, length int) (int, int) {
+	start := util.Min(page.Skip-window.Skip, length)
+	if page.Take < 0 {
+		return start, length
+	}
+	return start, util.Min(start+page.Take, length)
+}
+
+func (includes UserIncludes) dweetsWindow() *ListPage {
+	return fetchWindow(includes.Dweets, includes.FeedObjects.fromStart())
+}
+
+func (includes UserIncludes) redweetsWindow() *ListPage {
+	return fetchWindow(includes.Redweets, includes.FeedObjects.fromStart())
+}
+
+// The cache keeps one list along with a user, with its followers and following.
+// Get what to fetch so that the user can be cached, and which list it keeps, or false when a query selects more than one list.
+func (includes UserIncludes) forCache() (UserIncludes, string, ListPage, bool) {
+	objectsToFetch := ""
+	page := &ListPage{}
+	selected := 0
+	for kind, list := range map[string]*ListPage{
+		"feed":           includes.FeedObjects,
+		"dweet":          includes.Dweets,
+		"redweet":        includes.Redweets,
+		"redweetedDweet": includes.RedweetedDweets,
+		"liked":          includes.LikedDweets,
+	} {
+		if list != nil {
+			objectsToFetch = kind
+			page = list
+			selected++
+		}
+	}
+	if selected > 1 {
+		return includes, "", ListPage{}, false
+	}
+	if selected == 0 {
+		// An empty feed stands in for no lists at all
+		objectsToFetch = "feed"
+		includes.FeedObjects = page
+	}
+
+	includes.Followers = true
+	includes.Following = true
+	return includes, objectsToFetch, *page, true
+}
+
+// Build the relations to fetch along with a user. Liked dweets are only fetched for the user themselves.
+func (includes UserIncludes) with(username string, viewerUsername string) ([]db.UserRelationWith, error) {
+	withs := []db.UserRelationWith{}
+
+	if window := includes.dweetsWindow(); window != nil {
+		dweets := db.User.Dweets.Fetch().With(
+			db.Dweet.Author.Fetch(),
+		).OrderBy(
+			db.Dweet.PostedAt.Order(db.DESC),
+		).Skip(window.Skip)
+		if window.Take >= 0 {
+			dweets = dweets.Take(window.Take)
+		}
+		withs = append(withs, dweets)
+	}
+
+	if window := includes.redweetsWindow(); window != nil {
+		redweets := db.User.Redweets.Fetch().With(
+			db.Redweet.Author.Fetch(),
+			db.Redweet.RedweetOf.Fetch().With(
+				db.Dweet.Author.Fetch(),
+			),
+		).OrderBy(
+			db.Redweet.RedweetTime.Order(db.DESC),
+		).Skip(window.Skip)
+		if window.Take >= 0 {
+			redweets = redweets.Take(window.Take)
+		}
+		withs = append(withs, redweets)
+	}
+
+	if window := includes.RedweetedDweets; window != nil {
+		redweetedDweets := db.User.RedweetedDweets.Fetch().With(
+			db.Dweet.Author.Fetch(),
+		).OrderBy(
+			db.Dweet.PostedAt.Order(db.DESC),
+		).Skip(window.Skip)
+		if window.Take >= 0 {
+			redweetedDweets = redweetedDweets.Take(window.Take)
+		}
+		withs = append(withs, redweetedDweets)
+	}
+
+	if window := includes.LikedDweets; window != nil {
+		if viewerUsername != username {
+			return nil, errors.New("unauthorized")
+		}
+		likedDweets := db.User.LikedDweets.Fetch().With(
+			db.Dweet.Author.Fetch(),
+		).OrderBy(
+			db.Dweet.PostedAt.Order(db.DESC),
+		).Skip(window.Skip)
+		if window.Take >= 0 {
+			likedDweets = likedDweets.Take(window.Take)
+		}
+		withs = append(withs, likedDweets)
+	}
+
+	if includes.Followers {
+		withs = append(withs, db.User.Followers.Fetch().OrderBy(
+			db.User.FollowerCount.Order(db.DESC),
+		))
+	}
+
+	if includes.Following {
+		withs = append(withs, db.User.Following.Fetch().OrderBy(
+			db.User.FollowerCount.Order(db.DESC),
+		))
+	}
+
+	return withs, nil
+}
+
+// Build the relations to fetch along with each user of a list. Liked dweets are only shown to the user themselves, so lists can't select them.
+func (includes UserIncludes) withForList() ([]db.UserRelationWith, error) {
+	if includes.LikedDweets != nil {
+		return nil, errors.New("unauthorized")
+	}
+	return includes.with("", "")
+}
+
+func formatBasicDweets(dweets []db.DweetModel) []schema.BasicDweetType {
+	formatted := make([]schema.BasicDweetType, len(dweets))
+	for i := range dweets {
+		formatted[i] = schema.FormatAsBasicDweetType(&dweets[i])
+	}
+	return formatted
+}
+
+// Fill in the lists a query selected on a formatted user
+func formatUserIncludes(user *db.UserModel, includes UserIncludes, nuser *schema.UserType) error {
+	if includes.Dweets != nil {
+		dweets := user.Dweets()
+		start, end := includes.Dweets.cut(*includes.dweetsWindow(), len(dweets))
+		nuser.Dweets = formatBasicDweets(dweets[start:end])
+	}
+
+	if includes.Redweets != nil {
+		redweets := user.Redweets()
+		start, end := includes.Redweets.cut(*includes.redweetsWindow(), len(redweets))
+		nuser.Redweets = make([]schema.RedweetType, 0, end-start)
+		for i := start; i < end; i++ {
+			nuser.Redweets = append(nuser.Redweets, schema.FormatAsRedweetType(&redweets[i]))
+		}
+	}
+
+	if includes.RedweetedDweets != nil {
+		redweetedDweets := user.RedweetedDweets()
+		start, end := includes.RedweetedDweets.cut(*includes.RedweetedDweets, len(redweetedDweets))
+		nuser.RedweetedDweets = formatBasicDweets(redweetedDweets[start:end])
+	}
+
+	if includes.LikedDweets != nil {
+		likedDweets := user.LikedDweets()
+		start, end := includes.LikedDweets.cut(*includes.LikedDweets, len(likedDweets))
+		nuser.LikedDweets = formatBasicDweets(likedDweets[start:end])
+	}
+
+	if includes.FeedObjects != nil {
+		merged := util.MergeDweetRedweetList(user.Dweets(), user.Redweets())
+		start, end := includes.FeedObjects.cut(ListPage{}, len(merged))
+		nuser.FeedObjects = make([]interface{}, 0, end-start)
+		for _, obj := range merged[start:end] {
+			if dweet, ok := obj.(db.DweetModel); ok {
+				nuser.FeedObjects = append(nuser.FeedObjects, schema.FormatAsBasicDweetType(&dweet))
+			} else if redweet, ok := obj.(db.RedweetModel); ok {
+				nuser.FeedObjects = append(nuser.FeedObjects, schema.FormatAsRedweetType(&redweet))
+			} else {
+				return errors.New("internal server error")
+			}
+		}
+	}
+
+	return nil
+}
+
+// Work out which followers and following of a user to show the viewer. Others only see the ones they know.
+func mutualFollows(user *db.UserModel, includes UserIncludes, viewUser *db.UserModel) ([]db.UserModel, []db.UserModel) {
+	alsoFollowedBy := []db.UserModel{}
+	alsoFollowing := []db.UserModel{}
+	usersFollowed := append(viewUser.Following(), *viewUser)
+	if includes.Followers {
+		alsoFollowedBy = user.Followers()
+		if viewUser.Username != user.Username {
+			alsoFollowedBy = util.HashIntersectUsers(alsoFollowedBy, usersFollowed)
+		}
+	}
+	if includes.Following {
+		alsoFollowing = user.Following()
+		if viewUser.Username != user.Username {
+			alsoFollowing = util.HashIntersectUsers(alsoFollowing, usersFollowed)
+		}
+	}
+	return alsoFollowedBy, alsoFollowing
+}
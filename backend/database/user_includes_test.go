@@ -0,0 +1,158 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/soumitradev/Dwitter/backend/common"
+)
+
+func TestUserIncludesValidate(t *testing.T) {
+	common.Validate = validator.New()
+
+	tests := []struct {
+		includes UserIncludes
+		wantErr  bool
+	}{
+		{UserIncludes{}, false},
+		{UserIncludes{Dweets: &ListPage{Take: 20, Skip: 0}}, false},
+		{UserIncludes{Dweets: &ListPage{Take: -1, Skip: 5}}, false},
+		{UserIncludes{Dweets: &ListPage{Take: -2, Skip: 0}}, true},
+		{UserIncludes{Dweets: &ListPage{Take: 20, Skip: -1}}, true},
+		{UserIncludes{Dweets: &ListPage{Take: 20, Skip: 0}, LikedDweets: &ListPage{Take: -5, Skip: 0}}, true},
+	}
+
+	for _, test := range tests {
+		err := test.includes.validate()
+		if (err != nil) != test.wantErr {
+			t.Errorf("validate() of %+v = %v, want error %v", test.includes, err, test.wantErr)
+		}
+	}
+}
+
+func TestFetchWindow(t *testing.T) {
+	tests := []struct {
+		name  string
+		pages []*ListPage
+		want  *ListPage
+	}{
+		{"no pages", []*ListPage{}, nil},
+		{"only unselected pages", []*ListPage{nil, nil}, nil},
+		{"one page", []*ListPage{{Take: 5, Skip: 10}}, &ListPage{Take: 5, Skip: 10}},
+		{"unselected pages are skipped", []*ListPage{nil, {Take: 5, Skip: 10}, nil}, &ListPage{Take: 5, Skip: 10}},
+		{"overlapping pages", []*ListPage{{Take: 5, Skip: 0}, {Take: 5, Skip: 3}}, &ListPage{Take: 8, Skip: 0}},
+		{"page inside another", []*ListPage{{Take: 20, Skip: 0}, {Take: 5, Skip: 10}}, &ListPage{Take: 20, Skip: 0}},
+		{"pages apart", []*ListPage{{Take: 5, Skip: 30}, {Take: 5, Skip: 0}}, &ListPage{Take: 35, Skip: 0}},
+		{"a page with the rest of the list", []*ListPage{{Take: 5, Skip: 0}, {Take: -1, Skip: 10}}, &ListPage{Take: -1, Skip: 0}},
+		{"the rest of the list first", []*ListPage{{Take: -1, Skip: 10}, {Take: 5, Skip: 0}}, &ListPage{Take: -1, Skip: 0}},
+	}
+
+	for _, test := range tests {
+		got := fetchWindow(test.pages...)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: fetchWindow() = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestListPageCut(t *testing.T) {
+	tests := []struct {
+		name      string
+		page      ListPage
+		window    ListPage
+		length    int
+		wantStart int
+		wantEnd   int
+	}{
+		{"page is the window", ListPage{Take: 5, Skip: 10}, ListPage{Take: 5, Skip: 10}, 5, 0, 5},
+		{"page is the end of the window", ListPage{Take: 5, Skip: 10}, ListPage{Take: 15, Skip: 0}, 15, 10, 15},
+		{"page is the start of the window", ListPage{Take: 5, Skip: 0}, ListPage{Take: 15, Skip: 0}, 15, 0, 5},
+		{"list ends inside the page", ListPage{Take: 5, Skip: 10}, ListPage{Take: 15, Skip: 0}, 12, 10, 12},
+		{"list ends before the page", ListPage{Take: 5, Skip: 10}, ListPage{Take: 15, Skip: 0}, 8, 8, 8},
+		{"rest of the list", ListPage{Take: -1, Skip: 3}, ListPage{Take: -1, Skip: 0}, 10, 3, 10},
+		{"rest of a short list", ListPage{Take: -1, Skip: 3}, ListPage{Take: -1, Skip: 0}, 2, 2, 2},
+		{"empty page", ListPage{Take: 0, Skip: 0}, ListPage{Take: 0, Skip: 0}, 0, 0, 0},
+	}
+
+	for _, test := range tests {
+		start, end := test.page.cut(test.window, test.length)
+		if start != test.wantStart || end != test.wantEnd {
+			t.Errorf("%s: cut() = %d, %d, want %d, %d", test.name, start, end, test.wantStart, test.wantEnd)
+		}
+	}
+}
+
+func TestFeedWindows(t *testing.T) {
+	// Feed objects are merged from the start of both lists, so dweets are fetched far enough for both pages
+	includes := UserIncludes{
+		Dweets:      &ListPage{Take: 5, Skip: 0},
+		FeedObjects: &ListPage{Take: 10, Skip: 10},
+	}
+
+	dweetsWindow := includes.dweetsWindow()
+	if !reflect.DeepEqual(dweetsWindow, &ListPage{Take: 20, Skip: 0}) {
+		t.Errorf("dweetsWindow() = %+v, want the first 20 dweets", dweetsWindow)
+	}
+	redweetsWindow := includes.redweetsWindow()
+	if !reflect.DeepEqual(redweetsWindow, &ListPage{Take: 20, Skip: 0}) {
+		t.Errorf("redweetsWindow() = %+v, want the first 20 redweets", redweetsWindow)
+	}
+	if start, end := includes.Dweets.cut(*dweetsWindow, 20); start != 0 || end != 5 {
+		t.Errorf("Dweets.cut() = %d, %d, want 0, 5", start, end)
+	}
+
+	// Without feed objects, the dweets page is fetched on its own
+	includes = UserIncludes{Dweets: &ListPage{Take: 5, Skip: 10}}
+	if window := includes.dweetsWindow(); !reflect.DeepEqual(window, &ListPage{Take: 5, Skip: 10}) {
+		t.Errorf("dweetsWindow() = %+v, want 5 dweets after 10", window)
+	}
+	if window := includes.redweetsWindow(); window != nil {
+		t.Errorf("redweetsWindow() = %+v, want no redweets", window)
+	}
+}
+
+func TestForCache(t *testing.T) {
+	tests := []struct {
+		name      string
+		includes  UserIncludes
+		wantKind  string
+		wantPage  ListPage
+		cacheable bool
+	}{
+		{"no lists", UserIncludes{}, "feed", ListPage{}, true},
+		{"feed objects", UserIncludes{FeedObjects: &ListPage{Take: 20, Skip: 5}}, "feed", ListPage{Take: 20, Skip: 5}, true},
+		{"dweets", UserIncludes{Dweets: &ListPage{Take: 5, Skip: 0}}, "dweet", ListPage{Take: 5, Skip: 0}, true},
+		{"redweets", UserIncludes{Redweets: &ListPage{Take: -1, Skip: 0}}, "redweet", ListPage{Take: -1, Skip: 0}, true},
+		{"redweeted dweets", UserIncludes{RedweetedDweets: &ListPage{Take: 3, Skip: 1}}, "redweetedDweet", ListPage{Take: 3, Skip: 1}, true},
+		{"liked dweets", UserIncludes{LikedDweets: &ListPage{Take: 20, Skip: 0}}, "liked", ListPage{Take: 20, Skip: 0}, true},
+		{"two lists", UserIncludes{Dweets: &ListPage{Take: 5, Skip: 0}, FeedObjects: &ListPage{Take: 5, Skip: 0}}, "", ListPage{}, false},
+	}
+
+	for _, test := range tests {
+		includes, kind, page, cacheable := test.includes.forCache()
+		if kind != test.wantKind || page != test.wantPage || cacheable != test.cacheable {
+			t.Errorf("%s: forCache() = %q, %+v, %v, want %q, %+v, %v", test.name, kind, page, cacheable, test.wantKind, test.wantPage, test.cacheable)
+		}
+		if !cacheable {
+			if !reflect.DeepEqual(includes, test.includes) {
+				t.Errorf("%s: forCache() changed what is fetched to %+v, for a user that isn't cached", test.name, includes)
+			}
+			continue
+		}
+		// The cache keeps followers and following along with the list
+		if !includes.Followers || !includes.Following {
+			t.Errorf("%s: forCache() = %+v, want followers and following fetched", test.name, includes)
+		}
+		if test.includes == (UserIncludes{}) && !reflect.DeepEqual(includes.FeedObjects, &ListPage{}) {
+			t.Errorf("%s: forCache() fetches feed objects %+v, want an empty feed", test.name, includes.FeedObjects)
+		}
+	}
+}
+
+func TestWithForListRejectsLikedDweets(t *testing.T) {
+	_, err := UserIncludes{LikedDweets: &ListPage{Take: 20, Skip: 0}}.withForList()
+	if err == nil {
+		t.Error("withForList() fetched liked dweets for a list of users")
+	}
+}
@@ -0,0 +1,193 @@
+// Package events provides an event bus shared by every API server through Redis pub/sub, so that live subscriptions hear about changes as soon as they are written
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/soumitradev/Dwitter/backend/common"
+	"github.com/soumitradev/Dwitter/backend/schema"
+	"github.com/soumitradev/Dwitter/backend/util"
+)
+
+// Types of events
+const (
+	DweetCreated        = "dweetCreated"
+	DweetEdited         = "dweetEdited"
+	DweetDeleted        = "dweetDeleted"
+	DweetLiked          = "dweetLiked"
+	DweetUnliked        = "dweetUnliked"
+	RedweetCreated      = "redweetCreated"
+	RedweetDeleted      = "redweetDeleted"
+	UserFollowed        = "userFollowed"
+	UserUnfollowed      = "userUnfollowed"
+	UserUpdated         = "userUpdated"
+	NotificationCreated = "notificationCreated"
+)
+
+// An Event is something that changed
+type Event struct {
+	Type string
+	// Who made the change
+	Actor string
+	// Who owns what changed: the author of the dweet or redweet, the followed user, or the recipient of the notification
+	Owner string
+	// The dweet that changed, if one did. For redweets, this is the dweet that was redweeted.
+	DweetID string
+	// What was created, formatted as we send it back, if anything was.
+	// This is a schema.DweetType, schema.RedweetType or schema.NotificationType.
+	Object interface{}
+}
+
+// How an event is sent to the other servers. The kind of object is sent along so that it can be read back into the right type.
+type message struct {
+	Type       string          `json:"type"`
+	Actor      string          `json:"actor"`
+	Owner      string          `json:"owner"`
+	DweetID    string          `json:"dweetID"`
+	ObjectType string          `json:"objectType"`
+	Object     json.RawMessage `json:"object"`
+}
+
+// A Handler is told about every event
+type Handler func(event Event)
+
+var handlers []Handler
+
+// Events waiting to be handled. Publishing never waits for handlers.
+var queue = make(chan Event, 1024)
+
+// Channel every server publishes events to and listens on
+const eventsChannel = "events"
+
+// Tells this server apart from the others in heartbeats
+var instanceID string
+
+// Pick the ID this server sends heartbeats with
+func Init() {
+	instanceID = util.GenID(10)
+}
+
+// Add a handler. Handlers should be added before Dispatch starts.
+func Subscribe(handler Handler) {
+	handlers = append(handlers, handler)
+}
+
+// Tell the handlers on every server about an event.
+// If Redis can't be reached, only the handlers on this server are told.
+func Publish(event Event) {
+	if common.RedisDB == nil {
+		enqueue(event)
+		return
+	}
+
+	raw, err := encode(event)
+	if err == nil {
+		err = common.RedisDB.Publish(common.BaseCtx, eventsChannel, raw).Err()
+	}
+	if err != nil {
+		fmt.Printf("Error publishing %s event, only this server will see it: %v\n", event.Type, err)
+		enqueue(event)
+	}
+}
+
+// Queue an event for the handlers on this server. If they are too far behind, the event is dropped, since it shouldn't slow down what caused it.
+func enqueue(event Event) {
+	select {
+	case queue <- event:
+	default:
+		fmt.Printf("Event queue is full, dropping %s event\n", event.Type)
+	}
+}
+
+// Listen for events from every server, and hand them to the handlers one at a time
+func Dispatch() {
+	if common.RedisDB != nil {
+		go listen()
+	}
+
+	for event := range queue {
+		for _, handler := range handlers {
+			handler(event)
+		}
+	}
+}
+
+// Queue the events published by every server, including this one. The connection is made again if it drops.
+func listen() {
+	pubsub := common.RedisDB.Subscribe(common.BaseCtx, eventsChannel)
+	defer pubsub.Close()
+
+	for received := range pubsub.Channel() {
+		event, err := decode([]byte(received.Payload))
+		if err != nil {
+			fmt.Printf("Error reading event: %v\n", err)
+			continue
+		}
+		enqueue(event)
+	}
+}
+
+func encode(event Event) ([]byte, error) {
+	sent := message{
+		Type:    event.Type,
+		Actor:   event.Actor,
+		Owner:   event.Owner,
+		DweetID: event.DweetID,
+	}
+
+	switch event.Object.(type) {
+	case nil:
+	case schema.DweetType:
+		sent.ObjectType = "dweet"
+	case schema.RedweetType:
+		sent.ObjectType = "redweet"
+	case schema.NotificationType:
+		sent.ObjectType = "notification"
+	default:
+		return nil, fmt.Errorf("cannot send %T with an event", event.Object)
+	}
+	if event.Object != nil {
+		object, err := json.Marshal(event.Object)
+		if err != nil {
+			return nil, err
+		}
+		sent.Object = object
+	}
+
+	return json.Marshal(sent)
+}
+
+func decode(raw []byte) (Event, error) {
+	var received message
+	err := json.Unmarshal(raw, &received)
+	if err != nil {
+		return Event{}, err
+	}
+
+	event := Event{
+		Type:    received.Type,
+		Actor:   received.Actor,
+		Owner:   received.Owner,
+		DweetID: received.DweetID,
+	}
+
+	switch received.ObjectType {
+	case "":
+	case "dweet":
+		var dweet schema.DweetType
+		err = json.Unmarshal(received.Object, &dweet)
+		event.Object = dweet
+	case "redweet":
+		var redweet schema.RedweetType
+		err = json.Unmarshal(received.Object, &redweet)
+		event.Object = redweet
+	case "notification":
+		var notification schema.NotificationType
+		err = json.Unmarshal(received.Object, &notification)
+		event.Object = notification
+	default:
+		err = fmt.Errorf("unknown object type %s", received.ObjectType)
+	}
+	return event, err
+}
@@ -0,0 +1,93 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/soumitradev/Dwitter/backend/common"
+)
+
+// An Instance is an API server, and the websocket clients connected to it
+type Instance struct {
+	ID            string    `json:"id"`
+	Connections   int       `json:"connections"`
+	Subscriptions int       `json:"subscriptions"`
+	HeartbeatAt   time.Time `json:"heartbeatAt"`
+}
+
+// Prefix of the keys that store the latest heartbeat of each server
+const instanceKeyPrefix = "events:instance:"
+
+// Key that stores the latest heartbeat of a server. It expires when the server stops sending heartbeats.
+func instanceKey(id string) string {
+	return instanceKeyPrefix + id
+}
+
+// How often a server sends a heartbeat
+var heartbeatInterval = time.Second * 10
+
+// A server that hasn't sent a heartbeat for this long is assumed to be gone, and its heartbeat expires
+var instanceTimeout = time.Second * 30
+
+// Tell the other servers that this one is alive, and how many clients it has, every few seconds.
+// Counts returns the number of connections with live subscriptions, and the number of those subscriptions.
+func Heartbeat(counts func() (int, int)) {
+	for {
+		connections, subscriptions := counts()
+		raw, err := json.Marshal(Instance{
+			ID:            instanceID,
+			Connections:   connections,
+			Subscriptions: subscriptions,
+			HeartbeatAt:   time.Now().UTC(),
+		})
+		if err == nil {
+			err = common.RedisDB.Set(common.BaseCtx, instanceKey(instanceID), raw, instanceTimeout).Err()
+		}
+		if err != nil {
+			fmt.Printf("Error sending heartbeat: %v\n", err)
+		}
+		time.Sleep(heartbeatInterval)
+	}
+}
+
+// Get the servers that are alive. The heartbeats of servers that stopped have expired.
+func Instances() ([]Instance, error) {
+	keys := []string{}
+	iter := common.RedisDB.Scan(common.BaseCtx, 0, instanceKeyPrefix+"*", 100).Iterator()
+	for iter.Next(common.BaseCtx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+
+	instances := []Instance{}
+	if len(keys) == 0 {
+		return instances, nil
+	}
+	stored, err := common.RedisDB.MGet(common.BaseCtx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, value := range stored {
+		// Heartbeats can expire between listing and reading them
+		raw, ok := value.(string)
+		if !ok {
+			continue
+		}
+		var instance Instance
+		err = json.Unmarshal([]byte(raw), &instance)
+		if err != nil {
+			continue
+		}
+		instances = append(instances, instance)
+	}
+
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].ID < instances[j].ID
+	})
+	return instances, nil
+}
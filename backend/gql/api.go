@@ -3,6 +3,8 @@ package gql
 
 import (
 	"errors"
+	"fmt"
+	"net/http"
 
 	"github.com/soumitradev/Dwitter/backend/auth"
 	"github.com/soumitradev/Dwitter/backend/database"
@@ -11,6 +13,84 @@ import (
 	"github.com/graphql-go/graphql"
 )
 
+// Field that subscribes the viewer to a dweet, in Mutation and the deprecated query
+func subscribeToDweetField() *graphql.Field {
+	return &graphql.Field{
+		Type:        schema.DweetSchema,
+		Description: "Subscribe to dweet by id",
+		Args: graphql.FieldConfigArgument{
+			"id": &graphql.ArgumentConfig{
+				Type: graphql.NewNonNull(graphql.String),
+			},
+			"repliesToFetch": &graphql.ArgumentConfig{
+				Type:         graphql.Int,
+				DefaultValue: 0,
+			},
+			"repliesOffset": &graphql.ArgumentConfig{
+				Type:         graphql.Int,
+				DefaultValue: 0,
+			},
+		},
+		Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+			data, isAuth, err := auth.ResolveViewer(params.Info.RootValue, auth.ScopeWriteProfile)
+			if err != nil {
+				return nil, err
+			}
+
+			if isAuth {
+				id, idPresent := params.Args["id"].(string)
+				numReplies, numPresent := params.Args["repliesToFetch"].(int)
+				replyOffset, offsetPresent := params.Args["repliesOffset"].(int)
+				if idPresent && numPresent && offsetPresent {
+					post, err := database.SubscribePost(id, numReplies, replyOffset, data.Username)
+					return post, err
+				}
+			} else {
+				return nil, errors.New("Unauthorized")
+			}
+
+			return nil, errors.New("param \"id\" or missing")
+		},
+	}
+}
+
+// Field that subscribes the viewer to a user, in Mutation and the deprecated query
+func subscribeToUserField() *graphql.Field {
+	return &graphql.Field{
+		Type:        schema.UserSchema,
+		Description: "Subscribe to user by username",
+		Args: userListArgs(graphql.FieldConfigArgument{
+			"username": &graphql.ArgumentConfig{
+				Type: graphql.NewNonNull(graphql.String),
+			},
+		}),
+		Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+			data, isAuth, err := auth.ResolveViewer(params.Info.RootValue, auth.ScopeWriteProfile)
+			if err != nil {
+				return nil, err
+			}
+
+			if isAuth {
+				username, userPresent := params.Args["username"].(string)
+				if userPresent {
+					user, err := database.SubscribeToUser(username, userIncludes(params), data.Username)
+					return user, err
+				}
+			} else {
+				return nil, errors.New("Unauthorized")
+			}
+
+			return nil, errors.New("param \"username\" missing")
+		},
+	}
+}
+
+// Mark a field as deprecated
+func deprecatedField(field *graphql.Field, reason string) *graphql.Field {
+	field.DeprecationReason = reason
+	return field
+}
+
 // Create a handler that handles graphql queries
 var queryHandler = graphql.NewObject(
 	graphql.ObjectConfig{
@@ -33,8 +113,7 @@ var queryHandler = graphql.NewObject(
 					},
 				},
 				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
-					cookieString := params.Info.RootValue.(map[string]interface{})["sid"].(string)
-					data, isAuth, err := auth.VerifySessionID(cookieString)
+					data, isAuth, err := auth.ResolveViewer(params.Info.RootValue, auth.ScopeRead)
 					if err != nil {
 						return nil, err
 					}
@@ -60,48 +139,13 @@ var queryHandler = graphql.NewObject(
 					return nil, errors.New("param \"id\" or missing")
 				},
 			},
-			"subscribeToDweet": &graphql.Field{
-				Type:        schema.DweetSchema,
-				Description: "Subscribe to dweet by id",
-				Args: graphql.FieldConfigArgument{
-					"id": &graphql.ArgumentConfig{
-						Type: graphql.NewNonNull(graphql.String),
-					},
-					"repliesToFetch": &graphql.ArgumentConfig{
-						Type:         graphql.Int,
-						DefaultValue: 0,
-					},
-					"repliesOffset": &graphql.ArgumentConfig{
-						Type:         graphql.Int,
-						DefaultValue: 0,
-					},
-				},
-				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
-					cookieString := params.Info.RootValue.(map[string]interface{})["sid"].(string)
-					data, isAuth, err := auth.VerifySessionID(cookieString)
-					if err != nil {
-						return nil, err
-					}
-
-					if isAuth {
-						id, idPresent := params.Args["id"].(string)
-						numReplies, numPresent := params.Args["repliesToFetch"].(int)
-						replyOffset, offsetPresent := params.Args["repliesOffset"].(int)
-						if idPresent && numPresent && offsetPresent {
-							post, err := database.SubscribePost(id, numReplies, replyOffset, data.Username)
-							return post, err
-						}
-					} else {
-						return nil, errors.New("Unauthorized")
-					}
-
-					return nil, errors.New("param \"id\" or missing")
-				},
-			},
+			// Subscribing changes what the user is notified about, so it's a mutation. This is kept for old clients.
+			"subscribeToDweet": deprecatedField(subscribeToDweetField(), "Use the subscribeToDweet mutation"),
 			// TODO: Advanced search
 			"dweets": &graphql.Field{
-				Type:        graphql.NewList(schema.DweetSchema),
-				Description: "Search dweets by content",
+				Type:              graphql.NewList(schema.DweetSchema),
+				Description:       "Search dweets by content",
+				DeprecationReason: "Use dweetsConnection",
 				Args: graphql.FieldConfigArgument{
 					"text": &graphql.ArgumentConfig{
 						Type: graphql.NewNonNull(graphql.String),
@@ -124,8 +168,7 @@ var queryHandler = graphql.NewObject(
 					},
 				},
 				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
-					cookieString := params.Info.RootValue.(map[string]interface{})["sid"].(string)
-					data, isAuth, err := auth.VerifySessionID(cookieString)
+					data, isAuth, err := auth.ResolveViewer(params.Info.RootValue, auth.ScopeRead)
 					if err != nil {
 						return nil, err
 					}
@@ -158,46 +201,27 @@ var queryHandler = graphql.NewObject(
 			"user": &graphql.Field{
 				Type:        schema.UserSchema,
 				Description: "Get user by username",
-				Args: graphql.FieldConfigArgument{
+				Args: userListArgs(graphql.FieldConfigArgument{
 					"username": &graphql.ArgumentConfig{
 						Type: graphql.NewNonNull(graphql.String),
 					},
-					"objectsToFetch": &graphql.ArgumentConfig{
-						Type:         graphql.String,
-						DefaultValue: "feed",
-					},
-					"feedObjectsToFetch": &graphql.ArgumentConfig{
-						Type:         graphql.Int,
-						DefaultValue: 0,
-					},
-					"feedObjectsOffset": &graphql.ArgumentConfig{
-						Type:         graphql.Int,
-						DefaultValue: 0,
-					},
-				},
+				}),
 				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
-					cookieString := params.Info.RootValue.(map[string]interface{})["sid"].(string)
-					data, isAuth, err := auth.VerifySessionID(cookieString)
+					data, isAuth, err := auth.ResolveViewer(params.Info.RootValue, auth.ScopeRead)
 					if err != nil {
 						return nil, err
 					}
 
 					if isAuth {
 						username, userPresent := params.Args["username"].(string)
-						objectsToFetch, objectsToFetchPresent := params.Args["objectsToFetch"].(string)
-						numFeedObjects, numPresent := params.Args["feedObjectsToFetch"].(int)
-						feedObjectsOffset, feedObjectsOffsetPresent := params.Args["feedObjectsOffset"].(int)
-						if userPresent && objectsToFetchPresent && numPresent && feedObjectsOffsetPresent {
-							user, err := database.GetUser(username, objectsToFetch, numFeedObjects, feedObjectsOffset, data.Username)
+						if userPresent {
+							user, err := database.GetUser(username, userIncludes(params), data.Username)
 							return user, err
 						}
 					} else {
 						username, userPresent := params.Args["username"].(string)
-						objectsToFetch, objectsToFetchPresent := params.Args["objectsToFetch"].(string)
-						numFeedObjects, numPresent := params.Args["feedObjectsToFetch"].(int)
-						feedObjectsOffset, feedObjectsOffsetPresent := params.Args["feedObjectsOffset"].(int)
-						if userPresent && objectsToFetchPresent && numPresent && feedObjectsOffsetPresent {
-							user, err := database.GetUserUnauth(username, objectsToFetch, numFeedObjects, feedObjectsOffset)
+						if userPresent {
+							user, err := database.GetUserUnauth(username, userIncludes(params))
 							return user, err
 						}
 					}
@@ -205,54 +229,14 @@ var queryHandler = graphql.NewObject(
 					return nil, errors.New("param \"username\" missing")
 				},
 			},
-			"subscribeToUser": &graphql.Field{
-				Type:        schema.UserSchema,
-				Description: "Subscribe to user by username",
-				Args: graphql.FieldConfigArgument{
-					"username": &graphql.ArgumentConfig{
-						Type: graphql.NewNonNull(graphql.String),
-					},
-					"objectsToFetch": &graphql.ArgumentConfig{
-						Type:         graphql.String,
-						DefaultValue: "feed",
-					},
-					"feedObjectsToFetch": &graphql.ArgumentConfig{
-						Type:         graphql.Int,
-						DefaultValue: 0,
-					},
-					"feedObjectsOffset": &graphql.ArgumentConfig{
-						Type:         graphql.Int,
-						DefaultValue: 0,
-					},
-				},
-				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
-					cookieString := params.Info.RootValue.(map[string]interface{})["sid"].(string)
-					data, isAuth, err := auth.VerifySessionID(cookieString)
-					if err != nil {
-						return nil, err
-					}
-
-					if isAuth {
-						username, userPresent := params.Args["username"].(string)
-						objectsToFetch, objectsToFetchPresent := params.Args["objectsToFetch"].(string)
-						numFeedObjects, numPresent := params.Args["feedObjectsToFetch"].(int)
-						feedObjectsOffset, feedObjectsOffsetPresent := params.Args["feedObjectsOffset"].(int)
-						if userPresent && objectsToFetchPresent && numPresent && feedObjectsOffsetPresent {
-							user, err := database.SubscribeToUser(username, objectsToFetch, numFeedObjects, feedObjectsOffset, data.Username)
-							return user, err
-						}
-					} else {
-						return nil, errors.New("Unauthorized")
-					}
-
-					return nil, errors.New("param \"username\" missing")
-				},
-			},
+			// Subscribing changes what the user is notified about, so it's a mutation. This is kept for old clients.
+			"subscribeToUser": deprecatedField(subscribeToUserField(), "Use the subscribeToUser mutation"),
 			// TODO: Advanced search
 			"users": &graphql.Field{
-				Type:        graphql.NewList(schema.UserSchema),
-				Description: "Search users by username",
-				Args: graphql.FieldConfigArgument{
+				Type:              graphql.NewList(schema.UserSchema),
+				Description:       "Search users by username",
+				DeprecationReason: "Use usersConnection",
+				Args: userListArgs(graphql.FieldConfigArgument{
 					"text": &graphql.ArgumentConfig{
 						Type: graphql.NewNonNull(graphql.String),
 					},
@@ -264,22 +248,9 @@ var queryHandler = graphql.NewObject(
 						Type:         graphql.Int,
 						DefaultValue: 0,
 					},
-					"objectsToFetch": &graphql.ArgumentConfig{
-						Type:         graphql.String,
-						DefaultValue: "feed",
-					},
-					"feedObjectsToFetch": &graphql.ArgumentConfig{
-						Type:         graphql.Int,
-						DefaultValue: 0,
-					},
-					"feedObjectsOffset": &graphql.ArgumentConfig{
-						Type:         graphql.Int,
-						DefaultValue: 0,
-					},
-				},
+				}),
 				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
-					cookieString := params.Info.RootValue.(map[string]interface{})["sid"].(string)
-					data, isAuth, err := auth.VerifySessionID(cookieString)
+					data, isAuth, err := auth.ResolveViewer(params.Info.RootValue, auth.ScopeRead)
 					if err != nil {
 						return nil, err
 					}
@@ -288,22 +259,16 @@ var queryHandler = graphql.NewObject(
 						txt, txtPresent := params.Args["text"].(string)
 						num, numPresent := params.Args["numberToFetch"].(int)
 						numOffset, numOffsetPresent := params.Args["numberOffset"].(int)
-						objectsToFetch, objectsToFetchPresent := params.Args["objectsToFetch"].(string)
-						numFeedObjects, numFeedObjectsPresent := params.Args["feedObjectsToFetch"].(int)
-						feedObjectsOffset, feedObjectsOffsetPresent := params.Args["feedObjectsOffset"].(int)
-						if txtPresent && numPresent && numOffsetPresent && objectsToFetchPresent && numFeedObjectsPresent && feedObjectsOffsetPresent {
-							posts, err := database.SearchUsers(txt, num, numOffset, objectsToFetch, numFeedObjects, feedObjectsOffset, data.Username)
+						if txtPresent && numPresent && numOffsetPresent {
+							posts, err := database.SearchUsers(txt, num, numOffset, userIncludes(params), data.Username)
 							return posts, err
 						}
 					} else {
 						txt, txtPresent := params.Args["text"].(string)
 						num, numPresent := params.Args["numberToFetch"].(int)
 						numOffset, numOffsetPresent := params.Args["numberOffset"].(int)
-						objectsToFetch, objectsToFetchPresent := params.Args["objectsToFetch"].(string)
-						numFeedObjects, numFeedObjectsPresent := params.Args["feedObjectsToFetch"].(int)
-						feedObjectsOffset, feedObjectsOffsetPresent := params.Args["feedObjectsOffset"].(int)
-						if txtPresent && numPresent && numOffsetPresent && objectsToFetchPresent && numFeedObjectsPresent && feedObjectsOffsetPresent {
-							posts, err := database.SearchUsersUnauth(txt, num, numOffset, objectsToFetch, numFeedObjects, feedObjectsOffset)
+						if txtPresent && numPresent && numOffsetPresent {
+							posts, err := database.SearchUsersUnauth(txt, num, numOffset, userIncludes(params))
 							return posts, err
 						}
 					}
@@ -312,8 +277,9 @@ var queryHandler = graphql.NewObject(
 				},
 			},
 			"likedDweets": &graphql.Field{
-				Type:        graphql.NewList(schema.DweetSchema),
-				Description: "Get liked dweets of authenticated user",
+				Type:              graphql.NewList(schema.DweetSchema),
+				Description:       "Get liked dweets of authenticated user",
+				DeprecationReason: "Use likedDweetsConnection",
 				Args: graphql.FieldConfigArgument{
 					"numberToFetch": &graphql.ArgumentConfig{
 						Type:         graphql.Int,
@@ -333,8 +299,7 @@ var queryHandler = graphql.NewObject(
 					},
 				},
 				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
-					cookieString := params.Info.RootValue.(map[string]interface{})["sid"].(string)
-					data, isAuth, err := auth.VerifySessionID(cookieString)
+					data, isAuth, err := auth.ResolveViewer(params.Info.RootValue, auth.ScopeRead)
 					if err != nil {
 						return nil, err
 					}
@@ -354,9 +319,10 @@ var queryHandler = graphql.NewObject(
 				},
 			},
 			"followers": &graphql.Field{
-				Type:        graphql.NewList(schema.UserSchema),
-				Description: "Get followers of authenticated user",
-				Args: graphql.FieldConfigArgument{
+				Type:              graphql.NewList(schema.UserSchema),
+				Description:       "Get followers of authenticated user",
+				DeprecationReason: "Use followersConnection",
+				Args: userListArgs(graphql.FieldConfigArgument{
 					"numberToFetch": &graphql.ArgumentConfig{
 						Type:         graphql.Int,
 						DefaultValue: 0,
@@ -365,22 +331,9 @@ var queryHandler = graphql.NewObject(
 						Type:         graphql.Int,
 						DefaultValue: 0,
 					},
-					"objectsToFetch": &graphql.ArgumentConfig{
-						Type:         graphql.String,
-						DefaultValue: "feed",
-					},
-					"feedObjectsToFetch": &graphql.ArgumentConfig{
-						Type:         graphql.Int,
-						DefaultValue: 0,
-					},
-					"feedObjectsOffset": &graphql.ArgumentConfig{
-						Type:         graphql.Int,
-						DefaultValue: 0,
-					},
-				},
+				}),
 				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
-					cookieString := params.Info.RootValue.(map[string]interface{})["sid"].(string)
-					data, isAuth, err := auth.VerifySessionID(cookieString)
+					data, isAuth, err := auth.ResolveViewer(params.Info.RootValue, auth.ScopeRead)
 					if err != nil {
 						return nil, err
 					}
@@ -388,11 +341,8 @@ var queryHandler = graphql.NewObject(
 					if isAuth {
 						numUsers, usersPresent := params.Args["numberToFetch"].(int)
 						numOffset, usersOffsetPresent := params.Args["numberOffset"].(int)
-						objectsToFetch, objectsToFetchPresent := params.Args["objectsToFetch"].(string)
-						numFeedObjects, numFeedObjectsPresent := params.Args["feedObjectsToFetch"].(int)
-						feedObjectsOffset, feedObjectsOffsetPresent := params.Args["feedObjectsOffset"].(int)
-						if usersPresent && usersOffsetPresent && objectsToFetchPresent && numFeedObjectsPresent && feedObjectsOffsetPresent {
-							post, err := database.GetFollowers(data.Username, numUsers, numOffset, objectsToFetch, numFeedObjects, feedObjectsOffset)
+						if usersPresent && usersOffsetPresent {
+							post, err := database.GetFollowers(data.Username, numUsers, numOffset, userIncludes(params))
 							return post, err
 						}
 					}
@@ -401,9 +351,10 @@ var queryHandler = graphql.NewObject(
 				},
 			},
 			"following": &graphql.Field{
-				Type:        graphql.NewList(schema.UserSchema),
-				Description: "Get users that authenticated user follows",
-				Args: graphql.FieldConfigArgument{
+				Type:              graphql.NewList(schema.UserSchema),
+				Description:       "Get users that authenticated user follows",
+				DeprecationReason: "Use followingConnection",
+				Args: userListArgs(graphql.FieldConfigArgument{
 					"numberToFetch": &graphql.ArgumentConfig{
 						Type:         graphql.Int,
 						DefaultValue: 0,
@@ -412,33 +363,17 @@ var queryHandler = graphql.NewObject(
 						Type:         graphql.Int,
 						DefaultValue: 0,
 					},
-					"objectsToFetch": &graphql.ArgumentConfig{
-						Type:         graphql.String,
-						DefaultValue: "feed",
-					},
-					"feedObjectsToFetch": &graphql.ArgumentConfig{
-						Type:         graphql.Int,
-						DefaultValue: 0,
-					},
-					"feedObjectsOffset": &graphql.ArgumentConfig{
-						Type:         graphql.Int,
-						DefaultValue: 0,
-					},
-				},
+				}),
 				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
-					cookieString := params.Info.RootValue.(map[string]interface{})["sid"].(string)
-					data, isAuth, err := auth.VerifySessionID(cookieString)
+					data, isAuth, err := auth.ResolveViewer(params.Info.RootValue, auth.ScopeRead)
 					if err != nil {
 						return nil, err
 					}
 					if isAuth {
 						numUsers, usersPresent := params.Args["numberToFetch"].(int)
 						numOffset, usersOffsetPresent := params.Args["numberOffset"].(int)
-						objectsToFetch, objectsToFetchPresent := params.Args["objectsToFetch"].(string)
-						numFeedObjects, numFeedObjectsPresent := params.Args["feedObjectsToFetch"].(int)
-						feedObjectsOffset, feedObjectsOffsetPresent := params.Args["feedObjectsOffset"].(int)
-						if usersPresent && usersOffsetPresent && objectsToFetchPresent && numFeedObjectsPresent && feedObjectsOffsetPresent {
-							post, err := database.GetFollowing(data.Username, numUsers, numOffset, objectsToFetch, numFeedObjects, feedObjectsOffset)
+						if usersPresent && usersOffsetPresent {
+							post, err := database.GetFollowing(data.Username, numUsers, numOffset, userIncludes(params))
 							return post, err
 						}
 					}
@@ -446,147 +381,1070 @@ var queryHandler = graphql.NewObject(
 					return nil, errors.New("Unauthorized")
 				},
 			},
-		},
-	},
-)
-
-// Create a handler that handles graphql mutations
-var mutationHandler = graphql.NewObject(
-	graphql.ObjectConfig{
-		Name: "Mutation",
-		Fields: graphql.Fields{
-			"createUser": &graphql.Field{
-				Type:        schema.UserSchema,
-				Description: "Create a user",
-				Args: graphql.FieldConfigArgument{
-					"username": &graphql.ArgumentConfig{
-						Type: graphql.NewNonNull(graphql.String),
-					},
-					"password": &graphql.ArgumentConfig{
-						Type: graphql.NewNonNull(graphql.String),
-					},
-					"name": &graphql.ArgumentConfig{
-						Type: graphql.NewNonNull(graphql.String),
-					},
-					"bio": &graphql.ArgumentConfig{
-						Type:         graphql.String,
-						DefaultValue: "",
-					},
-					"email": &graphql.ArgumentConfig{
+			"dweetsConnection": &graphql.Field{
+				Type:        schema.DweetConnectionSchema,
+				Description: "Search dweets by content, newest first",
+				Args: connectionArgs(graphql.FieldConfigArgument{
+					"text": &graphql.ArgumentConfig{
 						Type: graphql.NewNonNull(graphql.String),
 					},
-				},
+				}),
 				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
-					username, usernamePresent := params.Args["username"].(string)
-					password, passwordPresent := params.Args["password"].(string)
-					name, namePresent := params.Args["name"].(string)
-					bio, bioPresent := params.Args["bio"].(string)
-					email, emailPresent := params.Args["email"].(string)
-					if usernamePresent && passwordPresent && namePresent && bioPresent && emailPresent {
-						user, err := database.SignUpUser(username, password, name, bio, email)
-						return user, err
+					data, _, err := auth.ResolveViewer(params.Info.RootValue, auth.ScopeRead)
+					if err != nil {
+						return nil, err
 					}
-					return nil, errors.New("invalid request: missing argument")
+
+					txt, txtPresent := params.Args["text"].(string)
+					if !txtPresent {
+						return nil, errors.New("param \"text\" missing")
+					}
+					page, err := pageFromArgs(params.Args)
+					if err != nil {
+						return nil, err
+					}
+					return database.SearchPostsConnection(txt, page, data.Username)
 				},
 			},
-			"createDweet": &graphql.Field{
-				Type:        schema.DweetSchema,
-				Description: "Create a dweet authored by authenticated user",
-				Args: graphql.FieldConfigArgument{
-					"body": &graphql.ArgumentConfig{
+			"usersConnection": &graphql.Field{
+				Type:        schema.UserConnectionSchema,
+				Description: "Search users by username",
+				Args: connectionArgs(graphql.FieldConfigArgument{
+					"text": &graphql.ArgumentConfig{
 						Type: graphql.NewNonNull(graphql.String),
 					},
-					"media": &graphql.ArgumentConfig{
-						Type:         graphql.NewList(graphql.String),
-						DefaultValue: []interface{}{},
-					},
+				}),
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					data, _, err := auth.ResolveViewer(params.Info.RootValue, auth.ScopeRead)
+					if err != nil {
+						return nil, err
+					}
+
+					txt, txtPresent := params.Args["text"].(string)
+					if !txtPresent {
+						return nil, errors.New("param \"text\" missing")
+					}
+					page, err := pageFromArgs(params.Args)
+					if err != nil {
+						return nil, err
+					}
+					return database.SearchUsersConnection(txt, page, data.Username)
 				},
+			},
+			"likedDweetsConnection": &graphql.Field{
+				Type:        schema.DweetConnectionSchema,
+				Description: "Get liked dweets of authenticated user, newest first",
+				Args:        connectionArgs(graphql.FieldConfigArgument{}),
 				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
-					// Check authentication
-					cookieString := params.Info.RootValue.(map[string]interface{})["sid"].(string)
-					data, isAuth, err := auth.VerifySessionID(cookieString)
+					data, isAuth, err := auth.ResolveViewer(params.Info.RootValue, auth.ScopeRead)
 					if err != nil {
 						return nil, err
 					}
 
 					if isAuth {
-						// Create dweet, and return formatted
-						body, bodyPresent := params.Args["body"].(string)
-						media, mediaPresent := params.Args["media"].([]interface{})
-						if bodyPresent && mediaPresent {
-							mediaList := []string{}
-							for _, link := range media {
-								mediaList = append(mediaList, link.(string))
-							}
-							dweet, err := database.NewDweet(body, data.Username, mediaList)
-							return dweet, err
+						page, err := pageFromArgs(params.Args)
+						if err != nil {
+							return nil, err
 						}
-						return nil, errors.New("invalid request: missing argument")
+						return database.GetLikedDweetsConnection(data.Username, page, data.Username)
 					}
 
 					return nil, errors.New("Unauthorized")
 				},
 			},
-			"createReply": &graphql.Field{
-				Type:        schema.DweetSchema,
-				Description: "Create a reply to a dweet by authenticated user",
-				Args: graphql.FieldConfigArgument{
-					"id": &graphql.ArgumentConfig{
-						Type: graphql.NewNonNull(graphql.String),
-					},
-					"body": &graphql.ArgumentConfig{
-						Type: graphql.NewNonNull(graphql.String),
-					},
-					"media": &graphql.ArgumentConfig{
-						Type:         graphql.NewList(graphql.String),
-						DefaultValue: []interface{}{},
-					},
-				},
+			"followersConnection": &graphql.Field{
+				Type:        schema.UserConnectionSchema,
+				Description: "Get followers of authenticated user, by username",
+				Args:        connectionArgs(graphql.FieldConfigArgument{}),
 				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
-					// Check authentication
-					cookieString := params.Info.RootValue.(map[string]interface{})["sid"].(string)
-					data, isAuth, err := auth.VerifySessionID(cookieString)
+					data, isAuth, err := auth.ResolveViewer(params.Info.RootValue, auth.ScopeRead)
 					if err != nil {
 						return nil, err
 					}
 
 					if isAuth {
-						// Create a reply to a dweet, and return formatted
-						originalID, idPresent := params.Args["id"].(string)
-						body, bodyPresent := params.Args["body"].(string)
-						media, mediaPresent := params.Args["media"].([]interface{})
-						if bodyPresent && mediaPresent && idPresent {
-							mediaList := []string{}
-							for _, link := range media {
-								mediaList = append(mediaList, link.(string))
-							}
-							dweet, err := database.NewReply(originalID, body, data.Username, mediaList)
-							return dweet, err
+						page, err := pageFromArgs(params.Args)
+						if err != nil {
+							return nil, err
 						}
-						return nil, errors.New("invalid request: missing argument")
+						return database.GetFollowersConnection(data.Username, page, data.Username)
 					}
 
 					return nil, errors.New("Unauthorized")
 				},
 			},
-			"redweet": &graphql.Field{
-				Type:        schema.RedweetSchema,
-				Description: "Create a redweet of a dweet by authenticated user",
-				Args: graphql.FieldConfigArgument{
-					"id": &graphql.ArgumentConfig{
-						Type: graphql.NewNonNull(graphql.String),
-					},
-				},
+			"followingConnection": &graphql.Field{
+				Type:        schema.UserConnectionSchema,
+				Description: "Get users that authenticated user follows, by username",
+				Args:        connectionArgs(graphql.FieldConfigArgument{}),
 				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
-					// Check authentication
-					cookieString := params.Info.RootValue.(map[string]interface{})["sid"].(string)
-					data, isAuth, err := auth.VerifySessionID(cookieString)
+					data, isAuth, err := auth.ResolveViewer(params.Info.RootValue, auth.ScopeRead)
 					if err != nil {
 						return nil, err
 					}
 
 					if isAuth {
-						// Create a redweet, and return formatted
+						page, err := pageFromArgs(params.Args)
+						if err != nil {
+							return nil, err
+						}
+						return database.GetFollowingConnection(data.Username, page, data.Username)
+					}
+
+					return nil, errors.New("Unauthorized")
+				},
+			},
+			"sessions": &graphql.Field{
+				Type:        graphql.NewList(schema.SessionInfoSchema),
+				Description: "Get active sessions of authenticated user",
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					cookieString := params.Info.RootValue.(map[string]interface{})["sid"].(string)
+					data, isAuth, err := auth.VerifySessionID(cookieString)
+					if err != nil {
+						return nil, err
+					}
+
+					if isAuth {
+						sessions, err := auth.ListSessions(data.Username, cookieString)
+						return sessions, err
+					}
+
+					return nil, errors.New("Unauthorized")
+				},
+			},
+			"identities": &graphql.Field{
+				Type:        graphql.NewList(schema.IdentitySchema),
+				Description: "Get external accounts linked to authenticated user",
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					cookieString := params.Info.RootValue.(map[string]interface{})["sid"].(string)
+					data, isAuth, err := auth.VerifySessionID(cookieString)
+					if err != nil {
+						return nil, err
+					}
+
+					if isAuth {
+						identities, err := auth.ListIdentities(data.Username)
+						return identities, err
+					}
+
+					return nil, errors.New("Unauthorized")
+				},
+			},
+			"apiTokens": &graphql.Field{
+				Type:        graphql.NewList(schema.APITokenSchema),
+				Description: "Get API tokens of authenticated user",
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					cookieString := params.Info.RootValue.(map[string]interface{})["sid"].(string)
+					data, isAuth, err := auth.VerifySessionID(cookieString)
+					if err != nil {
+						return nil, err
+					}
+
+					if isAuth {
+						tokens, err := auth.ListAPITokens(data.Username)
+						return tokens, err
+					}
+
+					return nil, errors.New("Unauthorized")
+				},
+			},
+			"reports": &graphql.Field{
+				Type:        graphql.NewList(schema.ReportSchema),
+				Description: "Get reports, newest first, if authenticated user is a moderator",
+				Args: graphql.FieldConfigArgument{
+					"includeResolved": &graphql.ArgumentConfig{
+						Type:         graphql.Boolean,
+						DefaultValue: false,
+					},
+					"numberToFetch": &graphql.ArgumentConfig{
+						Type:         graphql.Int,
+						DefaultValue: 20,
+					},
+					"numberOffset": &graphql.ArgumentConfig{
+						Type:         graphql.Int,
+						DefaultValue: 0,
+					},
+				},
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					cookieString := params.Info.RootValue.(map[string]interface{})["sid"].(string)
+					data, isAuth, err := auth.VerifySessionID(cookieString)
+					if err != nil {
+						return nil, err
+					}
+
+					if isAuth {
+						includeResolved, includeResolvedPresent := params.Args["includeResolved"].(bool)
+						numberToFetch, numberPresent := params.Args["numberToFetch"].(int)
+						numOffset, offsetPresent := params.Args["numberOffset"].(int)
+						if includeResolvedPresent && numberPresent && offsetPresent {
+							reports, err := database.GetReports(data.Username, includeResolved, numberToFetch, numOffset)
+							return reports, err
+						}
+						return nil, errors.New("invalid request: missing argument")
+					}
+
+					return nil, errors.New("Unauthorized")
+				},
+			},
+			"auditLog": &graphql.Field{
+				Type:        graphql.NewList(schema.AuditLogEntrySchema),
+				Description: "Get the audit log, newest first, if authenticated user is an admin",
+				Args: graphql.FieldConfigArgument{
+					"numberToFetch": &graphql.ArgumentConfig{
+						Type:         graphql.Int,
+						DefaultValue: 20,
+					},
+					"numberOffset": &graphql.ArgumentConfig{
+						Type:         graphql.Int,
+						DefaultValue: 0,
+					},
+				},
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					cookieString := params.Info.RootValue.(map[string]interface{})["sid"].(string)
+					data, isAuth, err := auth.VerifySessionID(cookieString)
+					if err != nil {
+						return nil, err
+					}
+
+					if isAuth {
+						numberToFetch, numberPresent := params.Args["numberToFetch"].(int)
+						numOffset, offsetPresent := params.Args["numberOffset"].(int)
+						if numberPresent && offsetPresent {
+							entries, err := database.GetAuditLog(data.Username, numberToFetch, numOffset)
+							return entries, err
+						}
+						return nil, errors.New("invalid request: missing argument")
+					}
+
+					return nil, errors.New("Unauthorized")
+				},
+			},
+			"instances": &graphql.Field{
+				Type:        graphql.NewList(schema.InstanceSchema),
+				Description: "Get the running API servers and their websocket clients, if authenticated user is an admin",
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					cookieString := params.Info.RootValue.(map[string]interface{})["sid"].(string)
+					data, isAuth, err := auth.VerifySessionID(cookieString)
+					if err != nil {
+						return nil, err
+					}
+
+					if isAuth {
+						instances, err := database.GetInstances(data.Username)
+						return instances, err
+					}
+
+					return nil, errors.New("Unauthorized")
+				},
+			},
+			"notifications": &graphql.Field{
+				Type:        graphql.NewList(schema.NotificationSchema),
+				Description: "Get notifications of authenticated user, newest first",
+				Args: graphql.FieldConfigArgument{
+					"first": &graphql.ArgumentConfig{
+						Type:         graphql.Int,
+						DefaultValue: 20,
+					},
+					"after": &graphql.ArgumentConfig{
+						Type:         graphql.String,
+						DefaultValue: "",
+						Description:  "ID of the last notification already fetched",
+					},
+				},
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					data, isAuth, err := auth.ResolveViewer(params.Info.RootValue, auth.ScopeRead)
+					if err != nil {
+						return nil, err
+					}
+
+					if isAuth {
+						first, firstPresent := params.Args["first"].(int)
+						after, afterPresent := params.Args["after"].(string)
+						if firstPresent && afterPresent {
+							notifications, err := database.GetNotifications(data.Username, first, after)
+							return notifications, err
+						}
+						return nil, errors.New("invalid request: missing argument")
+					}
+
+					return nil, errors.New("Unauthorized")
+				},
+			},
+			"unreadNotificationCount": &graphql.Field{
+				Type:        graphql.Int,
+				Description: "Get the number of unread notifications of authenticated user",
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					data, isAuth, err := auth.ResolveViewer(params.Info.RootValue, auth.ScopeRead)
+					if err != nil {
+						return nil, err
+					}
+
+					if isAuth {
+						count, err := database.GetUnreadNotificationCount(data.Username)
+						return count, err
+					}
+
+					return nil, errors.New("Unauthorized")
+				},
+			},
+			"emailDigest": &graphql.Field{
+				Type:        graphql.String,
+				Description: "Get how often authenticated user gets emails about replies and new posts: off, hourly, daily or none",
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					data, isAuth, err := auth.ResolveViewer(params.Info.RootValue, auth.ScopeRead)
+					if err != nil {
+						return nil, err
+					}
+
+					if isAuth {
+						frequency, err := database.GetEmailDigest(data.Username)
+						return frequency, err
+					}
+
+					return nil, errors.New("Unauthorized")
+				},
+			},
+			"notificationPreferences": &graphql.Field{
+				Type:        graphql.NewList(schema.NotificationPreferenceSchema),
+				Description: "Get how authenticated user wants to be notified about each event",
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					data, isAuth, err := auth.ResolveViewer(params.Info.RootValue, auth.ScopeRead)
+					if err != nil {
+						return nil, err
+					}
+
+					if isAuth {
+						preferences, err := database.GetNotificationPreferences(data.Username)
+						return preferences, err
+					}
+
+					return nil, errors.New("Unauthorized")
+				},
+			},
+		},
+	},
+)
+
+// Create a handler that handles graphql mutations
+var mutationHandler = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"createUser": &graphql.Field{
+				Type:        schema.UserSchema,
+				Description: "Create a user",
+				Args: graphql.FieldConfigArgument{
+					"username": &graphql.ArgumentConfig{
+						Type: graphql.NewNonNull(graphql.String),
+					},
+					"password": &graphql.ArgumentConfig{
+						Type: graphql.NewNonNull(graphql.String),
+					},
+					"name": &graphql.ArgumentConfig{
+						Type: graphql.NewNonNull(graphql.String),
+					},
+					"bio": &graphql.ArgumentConfig{
+						Type:         graphql.String,
+						DefaultValue: "",
+					},
+					"email": &graphql.ArgumentConfig{
+						Type: graphql.NewNonNull(graphql.String),
+					},
+				},
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					username, usernamePresent := params.Args["username"].(string)
+					password, passwordPresent := params.Args["password"].(string)
+					name, namePresent := params.Args["name"].(string)
+					bio, bioPresent := params.Args["bio"].(string)
+					email, emailPresent := params.Args["email"].(string)
+					if usernamePresent && passwordPresent && namePresent && bioPresent && emailPresent {
+						user, err := database.SignUpUser(username, password, name, bio, email)
+						return user, err
+					}
+					return nil, errors.New("invalid request: missing argument")
+				},
+			},
+			"logout": &graphql.Field{
+				Type:        graphql.Boolean,
+				Description: "Log out authenticated user and revoke their session",
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					// Check authentication
+					root := params.Info.RootValue.(map[string]interface{})
+					cookieString := root["sid"].(string)
+					_, isAuth, err := auth.VerifySessionID(cookieString)
+					if err != nil {
+						return nil, err
+					}
+
+					if isAuth {
+						// Revoke the session, and clear the cookie if we can
+						err := auth.RevokeSession(cookieString)
+						if err != nil {
+							return nil, fmt.Errorf("internal server error: %v", err)
+						}
+						if w, ok := root["responseWriter"].(http.ResponseWriter); ok && w != nil {
+							auth.ClearSessionCookie(w)
+						}
+						return true, nil
+					}
+
+					return nil, errors.New("Unauthorized")
+				},
+			},
+			"revokeSession": &graphql.Field{
+				Type:        graphql.Boolean,
+				Description: "Revoke a session of authenticated user by id",
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{
+						Type: graphql.NewNonNull(graphql.String),
+					},
+				},
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					// Check authentication
+					cookieString := params.Info.RootValue.(map[string]interface{})["sid"].(string)
+					data, isAuth, err := auth.VerifySessionID(cookieString)
+					if err != nil {
+						return nil, err
+					}
+
+					if isAuth {
+						id, idPresent := params.Args["id"].(string)
+						if idPresent {
+							err := auth.RevokeSessionByID(data.Username, id)
+							if err != nil {
+								return nil, err
+							}
+							return true, nil
+						}
+						return nil, errors.New("invalid request: missing argument")
+					}
+
+					return nil, errors.New("Unauthorized")
+				},
+			},
+			"revokeAllSessions": &graphql.Field{
+				Type:        graphql.Boolean,
+				Description: "Log authenticated user out of every device",
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					// Check authentication
+					root := params.Info.RootValue.(map[string]interface{})
+					cookieString := root["sid"].(string)
+					data, isAuth, err := auth.VerifySessionID(cookieString)
+					if err != nil {
+						return nil, err
+					}
+
+					if isAuth {
+						err := auth.RevokeAllSessions(data.Username)
+						if err != nil {
+							return nil, err
+						}
+						// The current session was revoked too
+						if w, ok := root["responseWriter"].(http.ResponseWriter); ok && w != nil {
+							auth.ClearSessionCookie(w)
+						}
+						return true, nil
+					}
+
+					return nil, errors.New("Unauthorized")
+				},
+			},
+			"changePassword": &graphql.Field{
+				Type:        graphql.Boolean,
+				Description: "Change password of authenticated user, logging them out everywhere",
+				Args: graphql.FieldConfigArgument{
+					"oldPassword": &graphql.ArgumentConfig{
+						Type: graphql.NewNonNull(graphql.String),
+					},
+					"newPassword": &graphql.ArgumentConfig{
+						Type: graphql.NewNonNull(graphql.String),
+					},
+				},
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					// Check authentication
+					root := params.Info.RootValue.(map[string]interface{})
+					cookieString := root["sid"].(string)
+					data, isAuth, err := auth.VerifySessionID(cookieString)
+					if err != nil {
+						return nil, err
+					}
+
+					if isAuth {
+						oldPassword, oldPresent := params.Args["oldPassword"].(string)
+						newPassword, newPresent := params.Args["newPassword"].(string)
+						if oldPresent && newPresent {
+							ip, _ := root["ip"].(string)
+							err := auth.ChangePassword(data.Username, oldPassword, newPassword, ip)
+							if err != nil {
+								w, _ := root["responseWriter"].(http.ResponseWriter)
+								auth.SetLockedOutStatus(w, err)
+								return nil, err
+							}
+							// Every session was revoked, including this one
+							if w, ok := root["responseWriter"].(http.ResponseWriter); ok && w != nil {
+								auth.ClearSessionCookie(w)
+							}
+							return true, nil
+						}
+						return nil, errors.New("invalid request: missing argument")
+					}
+
+					return nil, errors.New("Unauthorized")
+				},
+			},
+			"deleteAccount": &graphql.Field{
+				Type:        graphql.DateTime,
+				Description: "Delete authenticated user after a grace period, logging them out everywhere. Logging back in before the returned time cancels it",
+				Args: graphql.FieldConfigArgument{
+					"password": &graphql.ArgumentConfig{
+						Type: graphql.NewNonNull(graphql.String),
+					},
+					"code": &graphql.ArgumentConfig{
+						Type:         graphql.String,
+						DefaultValue: "",
+						Description:  "Two-factor code, if two-factor authentication is enabled",
+					},
+				},
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					// Check authentication
+					root := params.Info.RootValue.(map[string]interface{})
+					cookieString := root["sid"].(string)
+					data, isAuth, err := auth.VerifySessionID(cookieString)
+					if err != nil {
+						return nil, err
+					}
+
+					if isAuth {
+						password, passwordPresent := params.Args["password"].(string)
+						code, codePresent := params.Args["code"].(string)
+						if passwordPresent && codePresent {
+							ip, _ := root["ip"].(string)
+							deleteAt, err := auth.ScheduleAccountDeletion(data.Username, password, code, ip)
+							if err != nil {
+								w, _ := root["responseWriter"].(http.ResponseWriter)
+								auth.SetLockedOutStatus(w, err)
+								return nil, err
+							}
+							// Every session was revoked, including this one
+							if w, ok := root["responseWriter"].(http.ResponseWriter); ok && w != nil {
+								auth.ClearSessionCookie(w)
+							}
+							return deleteAt, nil
+						}
+						return nil, errors.New("invalid request: missing argument")
+					}
+
+					return nil, errors.New("Unauthorized")
+				},
+			},
+			"setLanguage": &graphql.Field{
+				Type:        graphql.String,
+				Description: "Set the language authenticated user gets emails in",
+				Args: graphql.FieldConfigArgument{
+					"language": &graphql.ArgumentConfig{
+						Type:        graphql.NewNonNull(graphql.String),
+						Description: "Language code, like en or es",
+					},
+				},
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					// Check authentication
+					cookieString := params.Info.RootValue.(map[string]interface{})["sid"].(string)
+					data, isAuth, err := auth.VerifySessionID(cookieString)
+					if err != nil {
+						return nil, err
+					}
+
+					if isAuth {
+						language, languagePresent := params.Args["language"].(string)
+						if languagePresent {
+							return database.SetLanguage(data.Username, language)
+						}
+						return nil, errors.New("invalid request: missing argument")
+					}
+
+					return nil, errors.New("Unauthorized")
+				},
+			},
+			"markNotificationsRead": &graphql.Field{
+				Type:        graphql.Int,
+				Description: "Mark notifications of authenticated user as read, or all of them if no IDs are given. Returns the number still unread",
+				Args: graphql.FieldConfigArgument{
+					"ids": &graphql.ArgumentConfig{
+						Type:         graphql.NewList(graphql.String),
+						DefaultValue: []interface{}{},
+					},
+				},
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					data, isAuth, err := auth.ResolveViewer(params.Info.RootValue, auth.ScopeWriteProfile)
+					if err != nil {
+						return nil, err
+					}
+
+					if isAuth {
+						ids, idsPresent := params.Args["ids"].([]interface{})
+						if idsPresent {
+							idList := []string{}
+							for _, id := range ids {
+								idString, ok := id.(string)
+								if !ok {
+									return nil, errors.New("invalid request: notification IDs can't be null")
+								}
+								idList = append(idList, idString)
+							}
+							count, err := database.MarkNotificationsRead(data.Username, idList)
+							return count, err
+						}
+						return nil, errors.New("invalid request: missing argument")
+					}
+
+					return nil, errors.New("Unauthorized")
+				},
+			},
+			"setNotificationPreference": &graphql.Field{
+				Type:        schema.NotificationPreferenceSchema,
+				Description: "Set how authenticated user wants to be notified about an event. Turning both channels off mutes the event",
+				Args: graphql.FieldConfigArgument{
+					"event": &graphql.ArgumentConfig{
+						Type:        graphql.NewNonNull(graphql.String),
+						Description: "One of reply, like, redweet, follow, mention or subscribedPost",
+					},
+					"email": &graphql.ArgumentConfig{
+						Type: graphql.NewNonNull(graphql.Boolean),
+					},
+					"inApp": &graphql.ArgumentConfig{
+						Type: graphql.NewNonNull(graphql.Boolean),
+					},
+				},
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					data, isAuth, err := auth.ResolveViewer(params.Info.RootValue, auth.ScopeWriteProfile)
+					if err != nil {
+						return nil, err
+					}
+
+					if isAuth {
+						event, eventPresent := params.Args["event"].(string)
+						email, emailPresent := params.Args["email"].(bool)
+						inApp, inAppPresent := params.Args["inApp"].(bool)
+						if eventPresent && emailPresent && inAppPresent {
+							preference, err := database.SetNotificationPreference(data.Username, event, email, inApp)
+							return preference, err
+						}
+						return nil, errors.New("invalid request: missing argument")
+					}
+
+					return nil, errors.New("Unauthorized")
+				},
+			},
+			"setEmailDigest": &graphql.Field{
+				Type:        graphql.String,
+				Description: "Collect emails about replies and new posts into one digest for authenticated user, sent hourly or daily, turn the digest off, or stop these emails with none",
+				Args: graphql.FieldConfigArgument{
+					"frequency": &graphql.ArgumentConfig{
+						Type:        graphql.NewNonNull(graphql.String),
+						Description: "One of off, hourly, daily or none",
+					},
+				},
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					data, isAuth, err := auth.ResolveViewer(params.Info.RootValue, auth.ScopeWriteProfile)
+					if err != nil {
+						return nil, err
+					}
+
+					if isAuth {
+						frequency, frequencyPresent := params.Args["frequency"].(string)
+						if frequencyPresent {
+							return database.SetEmailDigest(data.Username, frequency)
+						}
+						return nil, errors.New("invalid request: missing argument")
+					}
+
+					return nil, errors.New("Unauthorized")
+				},
+			},
+			"subscribeToDweet": subscribeToDweetField(),
+			"subscribeToUser":  subscribeToUserField(),
+			"unsubscribeFromDweet": &graphql.Field{
+				Type:        graphql.Boolean,
+				Description: "Stop getting notified about replies to a dweet",
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{
+						Type: graphql.NewNonNull(graphql.String),
+					},
+				},
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					data, isAuth, err := auth.ResolveViewer(params.Info.RootValue, auth.ScopeWriteProfile)
+					if err != nil {
+						return nil, err
+					}
+
+					if isAuth {
+						id, idPresent := params.Args["id"].(string)
+						if idPresent {
+							unsubscribed, err := database.UnsubscribeFromPost(id, data.Username)
+							return unsubscribed, err
+						}
+						return nil, errors.New("invalid request: missing argument")
+					}
+
+					return nil, errors.New("Unauthorized")
+				},
+			},
+			"unsubscribeFromUser": &graphql.Field{
+				Type:        graphql.Boolean,
+				Description: "Stop getting notified about new dweets and redweets of a user",
+				Args: graphql.FieldConfigArgument{
+					"username": &graphql.ArgumentConfig{
+						Type: graphql.NewNonNull(graphql.String),
+					},
+				},
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					data, isAuth, err := auth.ResolveViewer(params.Info.RootValue, auth.ScopeWriteProfile)
+					if err != nil {
+						return nil, err
+					}
+
+					if isAuth {
+						username, usernamePresent := params.Args["username"].(string)
+						if usernamePresent {
+							unsubscribed, err := database.UnsubscribeFromUser(username, data.Username)
+							return unsubscribed, err
+						}
+						return nil, errors.New("invalid request: missing argument")
+					}
+
+					return nil, errors.New("Unauthorized")
+				},
+			},
+			"setupTwoFactor": &graphql.Field{
+				Type:        schema.TwoFactorSetupSchema,
+				Description: "Start setting up two-factor authentication for authenticated user",
+				Args: graphql.FieldConfigArgument{
+					"password": &graphql.ArgumentConfig{
+						Type: graphql.NewNonNull(graphql.String),
+					},
+				},
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					// Check authentication
+					root := params.Info.RootValue.(map[string]interface{})
+					cookieString := root["sid"].(string)
+					data, isAuth, err := auth.VerifySessionID(cookieString)
+					if err != nil {
+						return nil, err
+					}
+
+					if isAuth {
+						password, passwordPresent := params.Args["password"].(string)
+						if passwordPresent {
+							ip, _ := root["ip"].(string)
+							setup, err := auth.SetupTwoFactor(data.Username, password, ip)
+							if err != nil {
+								w, _ := root["responseWriter"].(http.ResponseWriter)
+								auth.SetLockedOutStatus(w, err)
+								return nil, err
+							}
+							return setup, nil
+						}
+						return nil, errors.New("invalid request: missing argument")
+					}
+
+					return nil, errors.New("Unauthorized")
+				},
+			},
+			"confirmTwoFactor": &graphql.Field{
+				Type:        graphql.NewList(graphql.String),
+				Description: "Finish setting up two-factor authentication, and get recovery codes",
+				Args: graphql.FieldConfigArgument{
+					"code": &graphql.ArgumentConfig{
+						Type: graphql.NewNonNull(graphql.String),
+					},
+				},
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					// Check authentication
+					cookieString := params.Info.RootValue.(map[string]interface{})["sid"].(string)
+					data, isAuth, err := auth.VerifySessionID(cookieString)
+					if err != nil {
+						return nil, err
+					}
+
+					if isAuth {
+						code, codePresent := params.Args["code"].(string)
+						if codePresent {
+							recoveryCodes, err := auth.ConfirmTwoFactor(data.Username, code)
+							return recoveryCodes, err
+						}
+						return nil, errors.New("invalid request: missing argument")
+					}
+
+					return nil, errors.New("Unauthorized")
+				},
+			},
+			"disableTwoFactor": &graphql.Field{
+				Type:        graphql.Boolean,
+				Description: "Turn off two-factor authentication for authenticated user",
+				Args: graphql.FieldConfigArgument{
+					"password": &graphql.ArgumentConfig{
+						Type: graphql.NewNonNull(graphql.String),
+					},
+					"code": &graphql.ArgumentConfig{
+						Type: graphql.NewNonNull(graphql.String),
+					},
+				},
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					// Check authentication
+					root := params.Info.RootValue.(map[string]interface{})
+					cookieString := root["sid"].(string)
+					data, isAuth, err := auth.VerifySessionID(cookieString)
+					if err != nil {
+						return nil, err
+					}
+
+					if isAuth {
+						password, passwordPresent := params.Args["password"].(string)
+						code, codePresent := params.Args["code"].(string)
+						if passwordPresent && codePresent {
+							ip, _ := root["ip"].(string)
+							err := auth.DisableTwoFactor(data.Username, password, code, ip)
+							if err != nil {
+								w, _ := root["responseWriter"].(http.ResponseWriter)
+								auth.SetLockedOutStatus(w, err)
+								return nil, err
+							}
+							return true, nil
+						}
+						return nil, errors.New("invalid request: missing argument")
+					}
+
+					return nil, errors.New("Unauthorized")
+				},
+			},
+			"linkIdentity": &graphql.Field{
+				Type:        graphql.String,
+				Description: "Start linking an external account to authenticated user, returns the URL to continue at",
+				Args: graphql.FieldConfigArgument{
+					"provider": &graphql.ArgumentConfig{
+						Type: graphql.NewNonNull(graphql.String),
+					},
+				},
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					// Check authentication
+					root := params.Info.RootValue.(map[string]interface{})
+					cookieString := root["sid"].(string)
+					data, isAuth, err := auth.VerifySessionID(cookieString)
+					if err != nil {
+						return nil, err
+					}
+
+					if isAuth {
+						provider, providerPresent := params.Args["provider"].(string)
+						if providerPresent {
+							// The OAuth state is tied to the browser with a cookie
+							w, _ := root["responseWriter"].(http.ResponseWriter)
+							return auth.StartLinkIdentity(w, data.Username, provider)
+						}
+						return nil, errors.New("invalid request: missing argument")
+					}
+
+					return nil, errors.New("Unauthorized")
+				},
+			},
+			"unlinkIdentity": &graphql.Field{
+				Type:        graphql.Boolean,
+				Description: "Unlink an external account from authenticated user",
+				Args: graphql.FieldConfigArgument{
+					"provider": &graphql.ArgumentConfig{
+						Type: graphql.NewNonNull(graphql.String),
+					},
+				},
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					// Check authentication
+					cookieString := params.Info.RootValue.(map[string]interface{})["sid"].(string)
+					data, isAuth, err := auth.VerifySessionID(cookieString)
+					if err != nil {
+						return nil, err
+					}
+
+					if isAuth {
+						provider, providerPresent := params.Args["provider"].(string)
+						if providerPresent {
+							err := auth.UnlinkIdentity(data.Username, provider)
+							if err != nil {
+								return nil, err
+							}
+							return true, nil
+						}
+						return nil, errors.New("invalid request: missing argument")
+					}
+
+					return nil, errors.New("Unauthorized")
+				},
+			},
+			"createAPIToken": &graphql.Field{
+				Type:        schema.APITokenSchema,
+				Description: "Create an API token for authenticated user, the token is only sent back this once",
+				Args: graphql.FieldConfigArgument{
+					"name": &graphql.ArgumentConfig{
+						Type: graphql.NewNonNull(graphql.String),
+					},
+					"scopes": &graphql.ArgumentConfig{
+						Type: graphql.NewNonNull(graphql.NewList(graphql.String)),
+					},
+					"expiresInDays": &graphql.ArgumentConfig{
+						Type:         graphql.Int,
+						DefaultValue: 0,
+					},
+				},
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					// Check authentication
+					cookieString := params.Info.RootValue.(map[string]interface{})["sid"].(string)
+					data, isAuth, err := auth.VerifySessionID(cookieString)
+					if err != nil {
+						return nil, err
+					}
+
+					if isAuth {
+						name, namePresent := params.Args["name"].(string)
+						scopes, scopesPresent := params.Args["scopes"].([]interface{})
+						expiresInDays, expiresPresent := params.Args["expiresInDays"].(int)
+						if namePresent && scopesPresent && expiresPresent {
+							scopeList := []string{}
+							for _, scope := range scopes {
+								scopeList = append(scopeList, scope.(string))
+							}
+							token, err := auth.CreateAPIToken(data.Username, name, scopeList, expiresInDays)
+							return token, err
+						}
+						return nil, errors.New("invalid request: missing argument")
+					}
+
+					return nil, errors.New("Unauthorized")
+				},
+			},
+			"revokeAPIToken": &graphql.Field{
+				Type:        graphql.Boolean,
+				Description: "Revoke an API token of authenticated user by id",
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{
+						Type: graphql.NewNonNull(graphql.String),
+					},
+				},
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					// Check authentication
+					cookieString := params.Info.RootValue.(map[string]interface{})["sid"].(string)
+					data, isAuth, err := auth.VerifySessionID(cookieString)
+					if err != nil {
+						return nil, err
+					}
+
+					if isAuth {
+						id, idPresent := params.Args["id"].(string)
+						if idPresent {
+							err := auth.RevokeAPIToken(data.Username, id)
+							if err != nil {
+								return nil, err
+							}
+							return true, nil
+						}
+						return nil, errors.New("invalid request: missing argument")
+					}
+
+					return nil, errors.New("Unauthorized")
+				},
+			},
+			"createDweet": &graphql.Field{
+				Type:        schema.DweetSchema,
+				Description: "Create a dweet authored by authenticated user",
+				Args: graphql.FieldConfigArgument{
+					"body": &graphql.ArgumentConfig{
+						Type: graphql.NewNonNull(graphql.String),
+					},
+					"media": &graphql.ArgumentConfig{
+						Type:         graphql.NewList(graphql.String),
+						DefaultValue: []interface{}{},
+					},
+				},
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					// Check authentication
+					data, isAuth, err := auth.ResolveViewer(params.Info.RootValue, auth.ScopeWriteDweets)
+					if err != nil {
+						return nil, err
+					}
+
+					if isAuth {
+						// Create dweet, and return formatted
+						body, bodyPresent := params.Args["body"].(string)
+						media, mediaPresent := params.Args["media"].([]interface{})
+						if bodyPresent && mediaPresent {
+							mediaList := []string{}
+							for _, link := range media {
+								mediaList = append(mediaList, link.(string))
+							}
+							dweet, err := database.NewDweet(body, data.Username, mediaList)
+							return dweet, err
+						}
+						return nil, errors.New("invalid request: missing argument")
+					}
+
+					return nil, errors.New("Unauthorized")
+				},
+			},
+			"createReply": &graphql.Field{
+				Type:        schema.DweetSchema,
+				Description: "Create a reply to a dweet by authenticated user",
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{
+						Type: graphql.NewNonNull(graphql.String),
+					},
+					"body": &graphql.ArgumentConfig{
+						Type: graphql.NewNonNull(graphql.String),
+					},
+					"media": &graphql.ArgumentConfig{
+						Type:         graphql.NewList(graphql.String),
+						DefaultValue: []interface{}{},
+					},
+				},
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					// Check authentication
+					data, isAuth, err := auth.ResolveViewer(params.Info.RootValue, auth.ScopeWriteDweets)
+					if err != nil {
+						return nil, err
+					}
+
+					if isAuth {
+						// Create a reply to a dweet, and return formatted
+						originalID, idPresent := params.Args["id"].(string)
+						body, bodyPresent := params.Args["body"].(string)
+						media, mediaPresent := params.Args["media"].([]interface{})
+						if bodyPresent && mediaPresent && idPresent {
+							mediaList := []string{}
+							for _, link := range media {
+								mediaList = append(mediaList, link.(string))
+							}
+							dweet, err := database.NewReply(originalID, body, data.Username, mediaList)
+							return dweet, err
+						}
+						return nil, errors.New("invalid request: missing argument")
+					}
+
+					return nil, errors.New("Unauthorized")
+				},
+			},
+			"redweet": &graphql.Field{
+				Type:        schema.RedweetSchema,
+				Description: "Create a redweet of a dweet by authenticated user",
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{
+						Type: graphql.NewNonNull(graphql.String),
+					},
+				},
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					// Check authentication
+					data, isAuth, err := auth.ResolveViewer(params.Info.RootValue, auth.ScopeWriteDweets)
+					if err != nil {
+						return nil, err
+					}
+
+					if isAuth {
+						// Create a redweet, and return formatted
 						originalID, idPresent := params.Args["id"].(string)
 						if idPresent {
 							redweet, err := database.Redweet(originalID, data.Username)
@@ -598,24 +1456,301 @@ var mutationHandler = graphql.NewObject(
 					return nil, errors.New("Unauthorized")
 				},
 			},
-			"follow": &graphql.Field{
-				Type:        schema.UserSchema,
-				Description: "Make authenticated user follow another user",
+			"follow": &graphql.Field{
+				Type:        schema.UserSchema,
+				Description: "Make authenticated user follow another user",
+				Args: userListArgs(graphql.FieldConfigArgument{
+					"username": &graphql.ArgumentConfig{
+						Type: graphql.NewNonNull(graphql.String),
+					},
+				}),
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					// Check authentication
+					data, isAuth, err := auth.ResolveViewer(params.Info.RootValue, auth.ScopeWriteProfile)
+					if err != nil {
+						return nil, err
+					}
+
+					if isAuth {
+						// Make user follow the other user, and return formatted
+						username, userPresent := params.Args["username"].(string)
+
+						if username == data.Username {
+							return nil, errors.New("can't follow self")
+						}
+
+						if userPresent {
+							user, err := database.Follow(username, data.Username, userIncludes(params))
+							return user, err
+						}
+						return nil, errors.New("invalid request: missing argument")
+					}
+
+					return nil, errors.New("Unauthorized")
+				},
+			},
+			"like": &graphql.Field{
+				Type:        schema.DweetSchema,
+				Description: "Add authenticated user like to a dweet",
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{
+						Type: graphql.NewNonNull(graphql.String),
+					},
+					"repliesToFetch": &graphql.ArgumentConfig{
+						Type:         graphql.Int,
+						DefaultValue: 0,
+					},
+					"repliesOffset": &graphql.ArgumentConfig{
+						Type:         graphql.Int,
+						DefaultValue: 0,
+					},
+				},
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					// Check authentication
+					data, isAuth, err := auth.ResolveViewer(params.Info.RootValue, auth.ScopeWriteDweets)
+					if err != nil {
+						return nil, err
+					}
+
+					if isAuth {
+						// Make user like dweet, and return formatted
+						id, idPresent := params.Args["id"].(string)
+						repliesToFetch, repliesPresent := params.Args["repliesToFetch"].(int)
+						replyOffset, offsetPresent := params.Args["repliesOffset"].(int)
+						if idPresent && repliesPresent && offsetPresent {
+							dweet, err := database.Like(id, data.Username, repliesToFetch, replyOffset)
+							return dweet, err
+						}
+						return nil, errors.New("invalid request: missing argument")
+					}
+
+					return nil, errors.New("Unauthorized")
+				},
+			},
+			"unlike": &graphql.Field{
+				Type:        schema.DweetSchema,
+				Description: "Remove authenticated user's like from dweet",
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{
+						Type: graphql.NewNonNull(graphql.String),
+					},
+					"repliesToFetch": &graphql.ArgumentConfig{
+						Type:         graphql.Int,
+						DefaultValue: 0,
+					},
+					"repliesOffset": &graphql.ArgumentConfig{
+						Type:         graphql.Int,
+						DefaultValue: 0,
+					},
+				},
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					// Check authentication
+					data, isAuth, err := auth.ResolveViewer(params.Info.RootValue, auth.ScopeWriteDweets)
+					if err != nil {
+						return nil, err
+					}
+
+					if isAuth {
+						// Make user unlike dweet, and return formatted
+						id, idPresent := params.Args["id"].(string)
+						repliesToFetch, repliesPresent := params.Args["repliesToFetch"].(int)
+						replyOffset, offsetPresent := params.Args["repliesOffset"].(int)
+						if idPresent && repliesPresent && offsetPresent {
+							dweet, err := database.Unlike(id, data.Username, repliesToFetch, replyOffset)
+							return dweet, err
+						}
+						return nil, errors.New("invalid request: missing argument")
+					}
+
+					return nil, errors.New("Unauthorized")
+				},
+			},
+			"unfollow": &graphql.Field{
+				Type:        schema.UserSchema,
+				Description: "Make authenticated user unfollow another user",
+				Args: userListArgs(graphql.FieldConfigArgument{
+					"username": &graphql.ArgumentConfig{
+						Type: graphql.NewNonNull(graphql.String),
+					},
+				}),
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					// Check authentication
+					data, isAuth, err := auth.ResolveViewer(params.Info.RootValue, auth.ScopeWriteProfile)
+					if err != nil {
+						return nil, err
+					}
+
+					if isAuth {
+						// Make user unfollow the other user, and return formatted
+						username, userPresent := params.Args["username"].(string)
+
+						if username == data.Username {
+							return nil, errors.New("can't unfollow self")
+						}
+
+						if userPresent {
+							user, err := database.Unfollow(username, data.Username, userIncludes(params))
+							return user, err
+						}
+						return nil, errors.New("invalid request: missing argument")
+					}
+
+					return nil, errors.New("Unauthorized")
+				},
+			},
+			"editDweet": &graphql.Field{
+				Type:        schema.DweetSchema,
+				Description: "Edit a dweet authored by authenticated user",
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{
+						Type: graphql.NewNonNull(graphql.String),
+					},
+					"body": &graphql.ArgumentConfig{
+						Type: graphql.NewNonNull(graphql.String),
+					},
+					"media": &graphql.ArgumentConfig{
+						Type:         graphql.NewList(graphql.String),
+						DefaultValue: []interface{}{},
+					},
+					"repliesToFetch": &graphql.ArgumentConfig{
+						Type:         graphql.Int,
+						DefaultValue: 0,
+					},
+					"repliesOffset": &graphql.ArgumentConfig{
+						Type:         graphql.Int,
+						DefaultValue: 0,
+					},
+				},
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					// Check authentication
+					data, isAuth, err := auth.ResolveViewer(params.Info.RootValue, auth.ScopeWriteDweets)
+					if err != nil {
+						return nil, err
+					}
+
+					if isAuth {
+						// Edit dweet, and return formatted
+						id, idPresent := params.Args["id"].(string)
+						body, bodyPresent := params.Args["body"].(string)
+						media, mediaPresent := params.Args["media"].([]interface{})
+						repliesToFetch, numPresent := params.Args["repliesToFetch"].(int)
+						replyOffset, offsetPresent := params.Args["repliesOffset"].(int)
+						if bodyPresent && mediaPresent && idPresent && numPresent && offsetPresent {
+							mediaList := []string{}
+							for _, link := range media {
+								mediaList = append(mediaList, link.(string))
+							}
+							dweet, err := database.UpdateDweet(id, data.Username, body, mediaList, repliesToFetch, replyOffset)
+							return dweet, err
+						}
+						return nil, errors.New("invalid request: missing argument")
+					}
+
+					return nil, errors.New("Unauthorized")
+				},
+			},
+			"editUser": &graphql.Field{
+				Type:        schema.UserSchema,
+				Description: "Edit authenticated user, or another user as an admin. A new email is only used once the link sent to it is clicked",
+				Args: userListArgs(graphql.FieldConfigArgument{
+					"username": &graphql.ArgumentConfig{
+						Type:         graphql.String,
+						DefaultValue: "",
+						Description:  "User to edit, defaults to authenticated user",
+					},
+					"name": &graphql.ArgumentConfig{
+						Type:         graphql.String,
+						DefaultValue: "",
+					},
+					"email": &graphql.ArgumentConfig{
+						Type:         graphql.String,
+						DefaultValue: "",
+					},
+					"bio": &graphql.ArgumentConfig{
+						Type: graphql.String,
+					},
+					"pfpURL": &graphql.ArgumentConfig{
+						Type:         graphql.String,
+						DefaultValue: "",
+					},
+				}),
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					// Check authentication
+					data, isAuth, err := auth.ResolveViewer(params.Info.RootValue, auth.ScopeWriteProfile)
+					if err != nil {
+						return nil, err
+					}
+
+					if isAuth {
+						// Edit user, and return formatted
+						username, usernamePresent := params.Args["username"].(string)
+						name, namePresent := params.Args["name"].(string)
+						email, emailPresent := params.Args["email"].(string)
+						bio, bioPresent := params.Args["bio"].(string)
+						PfpUrl, pfpPresent := params.Args["pfpURL"].(string)
+						if usernamePresent && namePresent && emailPresent && bioPresent && pfpPresent {
+							if username == "" {
+								username = data.Username
+							}
+							user, err := database.UpdateUser(data.Username, username, name, email, bio, PfpUrl, userIncludes(params))
+							return user, err
+						}
+						return nil, errors.New("invalid request: missing argument")
+					}
+
+					return nil, errors.New("Unauthorized")
+				},
+			},
+			"deleteDweet": &graphql.Field{
+				Type:        schema.DweetSchema,
+				Description: "Delete dweet authored by user",
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{
+						Type: graphql.NewNonNull(graphql.String),
+					},
+					"repliesToFetch": &graphql.ArgumentConfig{
+						Type:         graphql.Int,
+						DefaultValue: 0,
+					},
+					"repliesOffset": &graphql.ArgumentConfig{
+						Type:         graphql.Int,
+						DefaultValue: 0,
+					},
+				},
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					// Check authentication
+					data, isAuth, err := auth.ResolveViewer(params.Info.RootValue, auth.ScopeWriteDweets)
+					if err != nil {
+						return nil, err
+					}
+
+					if isAuth {
+						// Delete dweet, and return formatted
+						id, idPresent := params.Args["id"].(string)
+						repliesToFetch, repliesPresent := params.Args["repliesToFetch"].(int)
+						replyOffset, offsetPresent := params.Args["repliesOffset"].(int)
+						if idPresent && repliesPresent && offsetPresent {
+							dweet, err := database.DeleteDweet(id, data.Username, repliesToFetch, replyOffset)
+							return dweet, err
+						}
+						return nil, errors.New("invalid request: missing argument")
+					}
+
+					return nil, errors.New("Unauthorized")
+				},
+			},
+			"report": &graphql.Field{
+				Type:        schema.ReportSchema,
+				Description: "Report a dweet or a user to the moderators",
 				Args: graphql.FieldConfigArgument{
-					"username": &graphql.ArgumentConfig{
+					"targetType": &graphql.ArgumentConfig{
 						Type: graphql.NewNonNull(graphql.String),
 					},
-					"objectsToFetch": &graphql.ArgumentConfig{
-						Type:         graphql.String,
-						DefaultValue: "feed",
-					},
-					"feedObjectsToFetch": &graphql.ArgumentConfig{
-						Type:         graphql.Int,
-						DefaultValue: 0,
+					"targetID": &graphql.ArgumentConfig{
+						Type: graphql.NewNonNull(graphql.String),
 					},
-					"feedObjectsOffset": &graphql.ArgumentConfig{
-						Type:         graphql.Int,
-						DefaultValue: 0,
+					"reason": &graphql.ArgumentConfig{
+						Type: graphql.NewNonNull(graphql.String),
 					},
 				},
 				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
@@ -627,19 +1762,12 @@ var mutationHandler = graphql.NewObject(
 					}
 
 					if isAuth {
-						// Make user follow the other user, and return formatted
-						username, userPresent := params.Args["username"].(string)
-						objectsToFetch, objectsToFetchPresent := params.Args["objectsToFetch"].(string)
-						numFeedObjects, numFeedObjectsPresent := params.Args["feedObjectsToFetch"].(int)
-						feedObjectsOffset, feedObjectsOffsetPresent := params.Args["feedObjectsOffset"].(int)
-
-						if username == data.Username {
-							return nil, errors.New("can't follow self")
-						}
-
-						if userPresent && objectsToFetchPresent && numFeedObjectsPresent && feedObjectsOffsetPresent {
-							user, err := database.Follow(username, data.Username, objectsToFetch, numFeedObjects, feedObjectsOffset)
-							return user, err
+						targetType, targetTypePresent := params.Args["targetType"].(string)
+						targetID, targetIDPresent := params.Args["targetID"].(string)
+						reason, reasonPresent := params.Args["reason"].(string)
+						if targetTypePresent && targetIDPresent && reasonPresent {
+							report, err := database.CreateReport(data.Username, targetType, targetID, reason)
+							return report, err
 						}
 						return nil, errors.New("invalid request: missing argument")
 					}
@@ -647,20 +1775,16 @@ var mutationHandler = graphql.NewObject(
 					return nil, errors.New("Unauthorized")
 				},
 			},
-			"like": &graphql.Field{
+			"removeDweet": &graphql.Field{
 				Type:        schema.DweetSchema,
-				Description: "Add authenticated user like to a dweet",
+				Description: "Remove a dweet as a moderator, resolving the reports about it",
 				Args: graphql.FieldConfigArgument{
 					"id": &graphql.ArgumentConfig{
 						Type: graphql.NewNonNull(graphql.String),
 					},
-					"repliesToFetch": &graphql.ArgumentConfig{
-						Type:         graphql.Int,
-						DefaultValue: 0,
-					},
-					"repliesOffset": &graphql.ArgumentConfig{
-						Type:         graphql.Int,
-						DefaultValue: 0,
+					"reason": &graphql.ArgumentConfig{
+						Type:         graphql.String,
+						DefaultValue: "",
 					},
 				},
 				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
@@ -672,12 +1796,10 @@ var mutationHandler = graphql.NewObject(
 					}
 
 					if isAuth {
-						// Make user like dweet, and return formatted
 						id, idPresent := params.Args["id"].(string)
-						repliesToFetch, repliesPresent := params.Args["repliesToFetch"].(int)
-						replyOffset, offsetPresent := params.Args["repliesOffset"].(int)
-						if idPresent && repliesPresent && offsetPresent {
-							dweet, err := database.Like(id, data.Username, repliesToFetch, replyOffset)
+						reason, reasonPresent := params.Args["reason"].(string)
+						if idPresent && reasonPresent {
+							dweet, err := database.RemoveDweet(data.Username, id, reason)
 							return dweet, err
 						}
 						return nil, errors.New("invalid request: missing argument")
@@ -686,21 +1808,13 @@ var mutationHandler = graphql.NewObject(
 					return nil, errors.New("Unauthorized")
 				},
 			},
-			"unlike": &graphql.Field{
-				Type:        schema.DweetSchema,
-				Description: "Remove authenticated user's like from dweet",
+			"resolveReport": &graphql.Field{
+				Type:        schema.ReportSchema,
+				Description: "Mark a report as resolved as a moderator",
 				Args: graphql.FieldConfigArgument{
 					"id": &graphql.ArgumentConfig{
 						Type: graphql.NewNonNull(graphql.String),
 					},
-					"repliesToFetch": &graphql.ArgumentConfig{
-						Type:         graphql.Int,
-						DefaultValue: 0,
-					},
-					"repliesOffset": &graphql.ArgumentConfig{
-						Type:         graphql.Int,
-						DefaultValue: 0,
-					},
 				},
 				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
 					// Check authentication
@@ -711,13 +1825,10 @@ var mutationHandler = graphql.NewObject(
 					}
 
 					if isAuth {
-						// Make user unlike dweet, and return formatted
 						id, idPresent := params.Args["id"].(string)
-						repliesToFetch, repliesPresent := params.Args["repliesToFetch"].(int)
-						replyOffset, offsetPresent := params.Args["repliesOffset"].(int)
-						if idPresent && repliesPresent && offsetPresent {
-							dweet, err := database.Unlike(id, data.Username, repliesToFetch, replyOffset)
-							return dweet, err
+						if idPresent {
+							report, err := database.ResolveReport(data.Username, id)
+							return report, err
 						}
 						return nil, errors.New("invalid request: missing argument")
 					}
@@ -725,24 +1836,19 @@ var mutationHandler = graphql.NewObject(
 					return nil, errors.New("Unauthorized")
 				},
 			},
-			"unfollow": &graphql.Field{
-				Type:        schema.UserSchema,
-				Description: "Make authenticated user unfollow another user",
+			"suspendUser": &graphql.Field{
+				Type:        schema.BasicUserSchema,
+				Description: "Suspend a user for some days as a moderator, logging them out everywhere",
 				Args: graphql.FieldConfigArgument{
 					"username": &graphql.ArgumentConfig{
 						Type: graphql.NewNonNull(graphql.String),
 					},
-					"objectsToFetch": &graphql.ArgumentConfig{
-						Type:         graphql.String,
-						DefaultValue: "feed",
-					},
-					"feedObjectsToFetch": &graphql.ArgumentConfig{
-						Type:         graphql.Int,
-						DefaultValue: 0,
+					"days": &graphql.ArgumentConfig{
+						Type: graphql.NewNonNull(graphql.Int),
 					},
-					"feedObjectsOffset": &graphql.ArgumentConfig{
-						Type:         graphql.Int,
-						DefaultValue: 0,
+					"reason": &graphql.ArgumentConfig{
+						Type:         graphql.String,
+						DefaultValue: "",
 					},
 				},
 				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
@@ -754,18 +1860,11 @@ var mutationHandler = graphql.NewObject(
 					}
 
 					if isAuth {
-						// Make user unfollow the other user, and return formatted
-						username, userPresent := params.Args["username"].(string)
-						objectsToFetch, objectsToFetchPresent := params.Args["objectsToFetch"].(string)
-						numFeedObjects, numFeedObjectsPresent := params.Args["feedObjectsToFetch"].(int)
-						feedObjectsOffset, feedObjectsOffsetPresent := params.Args["feedObjectsOffset"].(int)
-
-						if username == data.Username {
-							return nil, errors.New("can't unfollow self")
-						}
-
-						if userPresent && objectsToFetchPresent && numFeedObjectsPresent && feedObjectsOffsetPresent {
-							user, err := database.Unfollow(username, data.Username, objectsToFetch, numFeedObjects, feedObjectsOffset)
+						username, usernamePresent := params.Args["username"].(string)
+						days, daysPresent := params.Args["days"].(int)
+						reason, reasonPresent := params.Args["reason"].(string)
+						if usernamePresent && daysPresent && reasonPresent {
+							user, err := database.SuspendUser(data.Username, username, days, reason)
 							return user, err
 						}
 						return nil, errors.New("invalid request: missing argument")
@@ -774,28 +1873,13 @@ var mutationHandler = graphql.NewObject(
 					return nil, errors.New("Unauthorized")
 				},
 			},
-			"editDweet": &graphql.Field{
-				Type:        schema.DweetSchema,
-				Description: "Edit a dweet authored by authenticated user",
+			"unsuspendUser": &graphql.Field{
+				Type:        schema.BasicUserSchema,
+				Description: "Lift the suspension of a user as a moderator",
 				Args: graphql.FieldConfigArgument{
-					"id": &graphql.ArgumentConfig{
-						Type: graphql.NewNonNull(graphql.String),
-					},
-					"body": &graphql.ArgumentConfig{
+					"username": &graphql.ArgumentConfig{
 						Type: graphql.NewNonNull(graphql.String),
 					},
-					"media": &graphql.ArgumentConfig{
-						Type:         graphql.NewList(graphql.String),
-						DefaultValue: []interface{}{},
-					},
-					"repliesToFetch": &graphql.ArgumentConfig{
-						Type:         graphql.Int,
-						DefaultValue: 0,
-					},
-					"repliesOffset": &graphql.ArgumentConfig{
-						Type:         graphql.Int,
-						DefaultValue: 0,
-					},
 				},
 				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
 					// Check authentication
@@ -806,19 +1890,10 @@ var mutationHandler = graphql.NewObject(
 					}
 
 					if isAuth {
-						// Edit dweet, and return formatted
-						id, idPresent := params.Args["id"].(string)
-						body, bodyPresent := params.Args["body"].(string)
-						media, mediaPresent := params.Args["media"].([]interface{})
-						repliesToFetch, numPresent := params.Args["repliesToFetch"].(int)
-						replyOffset, offsetPresent := params.Args["repliesOffset"].(int)
-						if bodyPresent && mediaPresent && idPresent && numPresent && offsetPresent {
-							mediaList := []string{}
-							for _, link := range media {
-								mediaList = append(mediaList, link.(string))
-							}
-							dweet, err := database.UpdateDweet(id, data.Username, body, mediaList, repliesToFetch, replyOffset)
-							return dweet, err
+						username, usernamePresent := params.Args["username"].(string)
+						if usernamePresent {
+							user, err := database.UnsuspendUser(data.Username, username)
+							return user, err
 						}
 						return nil, errors.New("invalid request: missing argument")
 					}
@@ -826,52 +1901,15 @@ var mutationHandler = graphql.NewObject(
 					return nil, errors.New("Unauthorized")
 				},
 			},
-			"editUser": &graphql.Field{
-				Type:        schema.UserSchema,
-				Description: "Edit authenticated user",
+			"setRole": &graphql.Field{
+				Type:        schema.BasicUserSchema,
+				Description: "Set the role of a user to user, moderator or admin as an admin",
 				Args: graphql.FieldConfigArgument{
-					"name": &graphql.ArgumentConfig{
-						Type:         graphql.String,
-						DefaultValue: "",
-					},
-					"email": &graphql.ArgumentConfig{
-						Type:         graphql.String,
-						DefaultValue: "",
-					},
-					"bio": &graphql.ArgumentConfig{
-						Type: graphql.String,
-					},
-					"pfpURL": &graphql.ArgumentConfig{
-						Type:         graphql.String,
-						DefaultValue: "",
-					},
-					"objectsToFetch": &graphql.ArgumentConfig{
-						Type:         graphql.String,
-						DefaultValue: "feed",
-					},
-					"feedObjectsToFetch": &graphql.ArgumentConfig{
-						Type:         graphql.Int,
-						DefaultValue: 0,
-					},
-					"feedObjectsOffset": &graphql.ArgumentConfig{
-						Type:         graphql.Int,
-						DefaultValue: 0,
-					},
-					"followersToFetch": &graphql.ArgumentConfig{
-						Type:         graphql.Int,
-						DefaultValue: 0,
-					},
-					"followersOffset": &graphql.ArgumentConfig{
-						Type:         graphql.Int,
-						DefaultValue: 0,
-					},
-					"followingToFetch": &graphql.ArgumentConfig{
-						Type:         graphql.Int,
-						DefaultValue: 0,
+					"username": &graphql.ArgumentConfig{
+						Type: graphql.NewNonNull(graphql.String),
 					},
-					"followingOffset": &graphql.ArgumentConfig{
-						Type:         graphql.Int,
-						DefaultValue: 0,
+					"role": &graphql.ArgumentConfig{
+						Type: graphql.NewNonNull(graphql.String),
 					},
 				},
 				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
@@ -883,20 +1921,10 @@ var mutationHandler = graphql.NewObject(
 					}
 
 					if isAuth {
-						// Edit user, and return formatted
-						name, namePresent := params.Args["name"].(string)
-						email, emailPresent := params.Args["email"].(string)
-						bio, bioPresent := params.Args["bio"].(string)
-						PfpUrl, pfpPresent := params.Args["pfpURL"].(string)
-						objectsToFetch, objectsToFetchPresent := params.Args["objectsToFetch"].(string)
-						numFeedObjects, numFeedObjectsPresent := params.Args["feedObjectsToFetch"].(int)
-						feedObjectsOffset, feedObjectsOffsetPresent := params.Args["feedObjectsOffset"].(int)
-						followersToFetch, followersPresent := params.Args["followersToFetch"].(int)
-						followersOffset, followersOffsetPresent := params.Args["followersOffset"].(int)
-						followingToFetch, followingPresent := params.Args["followingToFetch"].(int)
-						followingOffset, followingOffsetPresent := params.Args["followingOffset"].(int)
-						if namePresent && emailPresent && bioPresent && pfpPresent && objectsToFetchPresent && numFeedObjectsPresent && feedObjectsOffsetPresent && followersPresent && followersOffsetPresent && followingPresent && followingOffsetPresent {
-							user, err := database.UpdateUser(data.Username, name, email, bio, PfpUrl, followersToFetch, followersOffset, followingToFetch, followingOffset, objectsToFetch, numFeedObjects, feedObjectsOffset)
+						username, usernamePresent := params.Args["username"].(string)
+						role, rolePresent := params.Args["role"].(string)
+						if usernamePresent && rolePresent {
+							user, err := database.SetRole(data.Username, username, role)
 							return user, err
 						}
 						return nil, errors.New("invalid request: missing argument")
@@ -905,20 +1933,16 @@ var mutationHandler = graphql.NewObject(
 					return nil, errors.New("Unauthorized")
 				},
 			},
-			"deleteDweet": &graphql.Field{
-				Type:        schema.DweetSchema,
-				Description: "Delete dweet authored by user",
+			"deleteUser": &graphql.Field{
+				Type:        schema.BasicUserSchema,
+				Description: "Delete a user and everything they made right away as an admin, logging them out everywhere",
 				Args: graphql.FieldConfigArgument{
-					"id": &graphql.ArgumentConfig{
+					"username": &graphql.ArgumentConfig{
 						Type: graphql.NewNonNull(graphql.String),
 					},
-					"repliesToFetch": &graphql.ArgumentConfig{
-						Type:         graphql.Int,
-						DefaultValue: 0,
-					},
-					"repliesOffset": &graphql.ArgumentConfig{
-						Type:         graphql.Int,
-						DefaultValue: 0,
+					"reason": &graphql.ArgumentConfig{
+						Type:         graphql.String,
+						DefaultValue: "",
 					},
 				},
 				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
@@ -930,13 +1954,11 @@ var mutationHandler = graphql.NewObject(
 					}
 
 					if isAuth {
-						// Delete dweet, and return formatted
-						id, idPresent := params.Args["id"].(string)
-						repliesToFetch, repliesPresent := params.Args["repliesToFetch"].(int)
-						replyOffset, offsetPresent := params.Args["repliesOffset"].(int)
-						if idPresent && repliesPresent && offsetPresent {
-							dweet, err := database.DeleteDweet(id, data.Username, repliesToFetch, replyOffset)
-							return dweet, err
+						username, usernamePresent := params.Args["username"].(string)
+						reason, reasonPresent := params.Args["reason"].(string)
+						if usernamePresent && reasonPresent {
+							user, err := database.DeleteUser(data.Username, username, reason)
+							return user, err
 						}
 						return nil, errors.New("invalid request: missing argument")
 					}
@@ -954,8 +1976,7 @@ var mutationHandler = graphql.NewObject(
 				},
 				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
 					// Check authentication
-					cookieString := params.Info.RootValue.(map[string]interface{})["sid"].(string)
-					data, isAuth, err := auth.VerifySessionID(cookieString)
+					data, isAuth, err := auth.ResolveViewer(params.Info.RootValue, auth.ScopeWriteDweets)
 					if err != nil {
 						return nil, err
 					}
@@ -983,11 +2004,20 @@ var subscriptionHandler = graphql.NewObject(
 		Name: "Subscription",
 		Fields: graphql.Fields{
 			"feed": &graphql.Field{
-				Type: graphql.NewList(schema.FeedObjectSchema),
+				Type:        graphql.NewList(schema.FeedObjectSchema),
+				Description: "Get the whole feed of authenticated user when subscribing, and again each time it changes",
 				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					// Feeds are run for the user the connection belongs to
+					root, _ := params.Info.RootValue.(map[string]interface{})
+					if subscriber, ok := root["subscriber"].(string); ok {
+						if subscriber == "" {
+							return nil, errors.New("Unauthorized")
+						}
+						return database.GetFeed(subscriber)
+					}
+
 					// Check authentication
-					cookieString := params.Info.RootValue.(map[string]interface{})["sid"].(string)
-					data, isAuth, err := auth.VerifySessionID(cookieString)
+					data, isAuth, err := auth.ResolveViewer(params.Info.RootValue, auth.ScopeRead)
 					if err != nil {
 						return nil, err
 					}
@@ -1000,15 +2030,133 @@ var subscriptionHandler = graphql.NewObject(
 					return nil, errors.New("Unauthorized")
 				},
 			},
+			"feedItemAdded": &graphql.Field{
+				Type:        schema.FeedObjectSchema,
+				Description: "Get each new dweet or redweet in the feed of authenticated user as it is created, without the rest of the feed",
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					// New feed items are only pushed to the connections of users whose feed shows them
+					root, _ := params.Info.RootValue.(map[string]interface{})
+					if item, ok := root["feedItem"]; ok {
+						return item, nil
+					}
+					return nil, nil
+				},
+			},
+			"notificationAdded": &graphql.Field{
+				Type:        schema.NotificationSchema,
+				Description: "Get each new notification of authenticated user as it is created",
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					// Notifications are only pushed to the connections of their recipient
+					root, _ := params.Info.RootValue.(map[string]interface{})
+					if notification, ok := root["notification"].(schema.NotificationType); ok {
+						return notification, nil
+					}
+					return nil, nil
+				},
+			},
+			"dweetUpdated": &graphql.Field{
+				Type:        schema.DweetUpdateSchema,
+				Description: "Get a dweet again each time it is edited, liked, redweeted or replied to, and a tombstone when it is deleted",
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{
+						Type: graphql.NewNonNull(graphql.String),
+					},
+					"repliesToFetch": &graphql.ArgumentConfig{
+						Type:         graphql.Int,
+						DefaultValue: 0,
+					},
+					"repliesOffset": &graphql.ArgumentConfig{
+						Type:         graphql.Int,
+						DefaultValue: 0,
+					},
+				},
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					id, idPresent := params.Args["id"].(string)
+					numReplies, numPresent := params.Args["repliesToFetch"].(int)
+					replyOffset, offsetPresent := params.Args["repliesOffset"].(int)
+					if !idPresent || !numPresent || !offsetPresent {
+						return nil, errors.New("param \"id\" missing")
+					}
+
+					root, _ := params.Info.RootValue.(map[string]interface{})
+					if deleted, ok := root["deletedDweet"].(string); ok && deleted == id {
+						return schema.DweetUpdateType{ID: id, Deleted: true}, nil
+					}
+
+					viewer, err := subscriptionViewer(params.Info.RootValue)
+					if err != nil {
+						return nil, err
+					}
+
+					var post schema.DweetType
+					if viewer != "" {
+						post, err = database.GetPost(id, numReplies, replyOffset, viewer)
+					} else {
+						post, err = database.GetPostUnauth(id, numReplies, replyOffset)
+					}
+					if err != nil {
+						return nil, err
+					}
+					return schema.DweetUpdateType{ID: post.ID, Dweet: &post}, nil
+				},
+			},
+			"replyAdded": &graphql.Field{
+				Type:        schema.DweetSchema,
+				Description: "Get each new reply to a dweet as it is created",
+				Args: graphql.FieldConfigArgument{
+					"dweetID": &graphql.ArgumentConfig{
+						Type: graphql.NewNonNull(graphql.String),
+					},
+				},
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					// Replies are only pushed to the subscriptions watching the dweet they reply to
+					dweetID, _ := params.Args["dweetID"].(string)
+					root, _ := params.Info.RootValue.(map[string]interface{})
+					if reply, ok := root["reply"].(schema.DweetType); ok && reply.OriginalReplyID == dweetID {
+						return reply, nil
+					}
+					return nil, nil
+				},
+			},
+			"userActivity": &graphql.Field{
+				Type:        schema.UserSchema,
+				Description: "Get a user again each time they post, redweet, like, follow, get followed or edit their profile",
+				Args: userListArgs(graphql.FieldConfigArgument{
+					"username": &graphql.ArgumentConfig{
+						Type: graphql.NewNonNull(graphql.String),
+					},
+				}),
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					username, userPresent := params.Args["username"].(string)
+					if !userPresent {
+						return nil, errors.New("param \"username\" missing")
+					}
+
+					viewer, err := subscriptionViewer(params.Info.RootValue)
+					if err != nil {
+						return nil, err
+					}
+
+					if viewer != "" {
+						return database.GetUser(username, userIncludes(params), viewer)
+					}
+					return database.GetUserUnauth(username, userIncludes(params))
+				},
+			},
 		},
 	},
 )
 
 // Create schema from handlers
-var Schema, SchemaError = graphql.NewSchema(
-	graphql.SchemaConfig{
-		Query:        queryHandler,
-		Mutation:     mutationHandler,
-		Subscription: subscriptionHandler,
-	},
-)
+var Schema, SchemaError = newSchema()
+
+func newSchema() (graphql.Schema, error) {
+	addConnectionFields()
+	return graphql.NewSchema(
+		graphql.SchemaConfig{
+			Query:        queryHandler,
+			Mutation:     mutationHandler,
+			Subscription: subscriptionHandler,
+		},
+	)
+}
@@ -0,0 +1,165 @@
+// Package gql provides useful graphql API functionality
+package gql
+
+import (
+	"errors"
+
+	"github.com/soumitradev/Dwitter/backend/database"
+	"github.com/soumitradev/Dwitter/backend/schema"
+
+	"github.com/graphql-go/graphql"
+)
+
+// Add the arguments that pick a page of a connection to the other arguments of a field
+func connectionArgs(args graphql.FieldConfigArgument) graphql.FieldConfigArgument {
+	args["first"] = &graphql.ArgumentConfig{
+		Type:         graphql.Int,
+		DefaultValue: 0,
+		Description:  "Number of items to read after the \"after\" cursor",
+	}
+	args["after"] = &graphql.ArgumentConfig{
+		Type:         graphql.String,
+		DefaultValue: "",
+	}
+	args["last"] = &graphql.ArgumentConfig{
+		Type:         graphql.Int,
+		DefaultValue: 0,
+		Description:  "Number of items to read before the \"before\" cursor",
+	}
+	args["before"] = &graphql.ArgumentConfig{
+		Type:         graphql.String,
+		DefaultValue: "",
+	}
+	return args
+}
+
+// Read the page a connection field asks for
+func pageFromArgs(args map[string]interface{}) (database.Page, error) {
+	first, firstPresent := args["first"].(int)
+	after, afterPresent := args["after"].(string)
+	last, lastPresent := args["last"].(int)
+	before, beforePresent := args["before"].(string)
+	if !firstPresent || !afterPresent || !lastPresent || !beforePresent {
+		return database.Page{}, errors.New("invalid request: missing argument")
+	}
+	return database.Page{
+		First:  first,
+		After:  after,
+		Last:   last,
+		Before: before,
+	}, nil
+}
+
+// Find out who is looking at a nested connection. Nested connections can be inside subscriptions too.
+func connectionViewer(params graphql.ResolveParams) (string, database.Page, error) {
+	page, err := pageFromArgs(params.Args)
+	if err != nil {
+		return "", database.Page{}, err
+	}
+
+	viewer, err := subscriptionViewer(params.Info.RootValue)
+	if err != nil {
+		return "", database.Page{}, err
+	}
+	return viewer, page, nil
+}
+
+// Resolve a connection on a user
+func userConnection(resolve func(username string, page database.Page, viewer string) (interface{}, error)) graphql.FieldResolveFn {
+	return func(params graphql.ResolveParams) (interface{}, error) {
+		user, ok := params.Source.(schema.UserType)
+		if !ok {
+			return nil, nil
+		}
+
+		viewer, page, err := connectionViewer(params)
+		if err != nil {
+			return nil, err
+		}
+		return resolve(user.Username, page, viewer)
+	}
+}
+
+// Connections can't be part of the User and Dweet schemas themselves, since their nodes are users and dweets again, and they are read from the database
+func addConnectionFields() {
+	schema.UserSchema.AddFieldConfig("dweetsConnection", &graphql.Field{
+		Type:        schema.DweetConnectionSchema,
+		Description: "Dweets of the user, newest first",
+		Args:        connectionArgs(graphql.FieldConfigArgument{}),
+		Resolve: userConnection(func(username string, page database.Page, viewer string) (interface{}, error) {
+			return database.GetDweetsConnection(username, page, viewer)
+		}),
+	})
+	schema.UserSchema.AddFieldConfig("redweetsConnection", &graphql.Field{
+		Type:        schema.RedweetConnectionSchema,
+		Description: "Redweets of the user, newest first",
+		Args:        connectionArgs(graphql.FieldConfigArgument{}),
+		Resolve: userConnection(func(username string, page database.Page, viewer string) (interface{}, error) {
+			return database.GetRedweetsConnection(username, page)
+		}),
+	})
+	schema.UserSchema.AddFieldConfig("redweetedDweetsConnection", &graphql.Field{
+		Type:        schema.DweetConnectionSchema,
+		Description: "Dweets the user redweeted, most recently redweeted first",
+		Args:        connectionArgs(graphql.FieldConfigArgument{}),
+		Resolve: userConnection(func(username string, page database.Page, viewer string) (interface{}, error) {
+			return database.GetRedweetedDweetsConnection(username, page, viewer)
+		}),
+	})
+	schema.UserSchema.AddFieldConfig("feedObjectsConnection", &graphql.Field{
+		Type:        schema.FeedObjectConnectionSchema,
+		Description: "Dweets and redweets of the user, newest first",
+		Args:        connectionArgs(graphql.FieldConfigArgument{}),
+		Resolve: userConnection(func(username string, page database.Page, viewer string) (interface{}, error) {
+			return database.GetFeedObjectsConnection(username, page, viewer)
+		}),
+	})
+	schema.UserSchema.AddFieldConfig("likedDweetsConnection", &graphql.Field{
+		Type:        schema.DweetConnectionSchema,
+		Description: "Dweets the user liked, newest first. Only the user can see them.",
+		Args:        connectionArgs(graphql.FieldConfigArgument{}),
+		Resolve: userConnection(func(username string, page database.Page, viewer string) (interface{}, error) {
+			return database.GetLikedDweetsConnection(username, page, viewer)
+		}),
+	})
+	schema.UserSchema.AddFieldConfig("followersConnection", &graphql.Field{
+		Type:        schema.UserConnectionSchema,
+		Description: "Users that follow the user, by username",
+		Args:        connectionArgs(graphql.FieldConfigArgument{}),
+		Resolve: userConnection(func(username string, page database.Page, viewer string) (interface{}, error) {
+			return database.GetFollowersConnection(username, page, viewer)
+		}),
+	})
+	schema.UserSchema.AddFieldConfig("followingConnection", &graphql.Field{
+		Type:        schema.UserConnectionSchema,
+		Description: "Users the user follows, by username",
+		Args:        connectionArgs(graphql.FieldConfigArgument{}),
+		Resolve: userConnection(func(username string, page database.Page, viewer string) (interface{}, error) {
+			return database.GetFollowingConnection(username, page, viewer)
+		}),
+	})
+
+	schema.DweetSchema.AddFieldConfig("replyDweetsConnection", &graphql.Field{
+		Type:        schema.DweetConnectionSchema,
+		Description: "Replies to the dweet, newest first",
+		Args:        connectionArgs(graphql.FieldConfigArgument{}),
+		Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+			// Dweets sent by dweetUpdated are pointers
+			var postID string
+			switch post := params.Source.(type) {
+			case schema.DweetType:
+				postID = post.ID
+			case *schema.DweetType:
+				postID = post.ID
+			default:
+				return nil, nil
+			}
+
+			viewer, page, err := connectionViewer(params)
+			if err != nil {
+				return nil, err
+			}
+			return database.GetRepliesConnection(postID, page, viewer)
+		},
+	})
+}
@@ -0,0 +1,69 @@
+// Package gql provides useful graphql API functionality
+package gql
+
+import (
+	"sync"
+
+	"github.com/functionalfoundry/graphqlws"
+)
+
+// A subscription manager that can be used from many goroutines at once.
+// Websocket connections add and remove subscriptions while events are being pushed to them.
+type lockedSubscriptionManager struct {
+	manager graphqlws.SubscriptionManager
+	lock    sync.RWMutex
+}
+
+var subscriptionManager = &lockedSubscriptionManager{}
+
+// Get a copy of every subscription, which stays the same while subscriptions come and go
+func (m *lockedSubscriptionManager) Subscriptions() graphqlws.Subscriptions {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	subscriptions := graphqlws.Subscriptions{}
+	for conn, connSubscriptions := range m.manager.Subscriptions() {
+		copied := graphqlws.ConnectionSubscriptions{}
+		for id, subscription := range connSubscriptions {
+			copied[id] = subscription
+		}
+		subscriptions[conn] = copied
+	}
+	return subscriptions
+}
+
+// Add a subscription. Feed subscriptions are sent the current feed right away, so that clients don't need to query it first.
+func (m *lockedSubscriptionManager) AddSubscription(conn graphqlws.Connection, subscription *graphqlws.Subscription) []error {
+	m.lock.Lock()
+	errs := m.manager.AddSubscription(conn, subscription)
+	m.lock.Unlock()
+
+	if len(errs) == 0 && subscription.MatchesField("feed") {
+		go runSubscription(subscription, connectionUser(conn), nil)
+	}
+	return errs
+}
+
+func (m *lockedSubscriptionManager) RemoveSubscription(conn graphqlws.Connection, subscription *graphqlws.Subscription) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.manager.RemoveSubscription(conn, subscription)
+}
+
+func (m *lockedSubscriptionManager) RemoveSubscriptions(conn graphqlws.Connection) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.manager.RemoveSubscriptions(conn)
+}
+
+// Count the connections to this server with live subscriptions, and those subscriptions
+func SubscriptionCounts() (int, int) {
+	subscriptionManager.lock.RLock()
+	defer subscriptionManager.lock.RUnlock()
+
+	subscriptions := 0
+	for _, connSubscriptions := range subscriptionManager.manager.Subscriptions() {
+		subscriptions += len(connSubscriptions)
+	}
+	return len(subscriptionManager.manager.Subscriptions()), subscriptions
+}
@@ -0,0 +1,82 @@
+// Package gql provides useful graphql API functionality
+package gql
+
+import (
+	"github.com/soumitradev/Dwitter/backend/database"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// Lists on a user whose page size is set by arguments of the field that gets the user
+var userLists = []string{"dweets", "redweets", "redweetedDweets", "feedObjects", "likedDweets"}
+
+// Add the page size arguments of each list on a user to the other arguments of a field
+func userListArgs(args graphql.FieldConfigArgument) graphql.FieldConfigArgument {
+	for _, list := range userLists {
+		args[list+"ToFetch"] = &graphql.ArgumentConfig{
+			Type: graphql.Int,
+			// Selecting a list asks for it, so it isn't empty by default like it was with feedObjectsToFetch
+			DefaultValue: 20,
+			Description:  "Number of " + list + " to fetch if they are selected, or -1 for all of them",
+		}
+		args[list+"Offset"] = &graphql.ArgumentConfig{
+			Type:         graphql.Int,
+			DefaultValue: 0,
+		}
+	}
+	return args
+}
+
+// Find the names of the fields a query selects on the value of the field being resolved, looking inside fragments
+func selectedFields(info graphql.ResolveInfo) map[string]bool {
+	selected := map[string]bool{}
+	for _, field := range info.FieldASTs {
+		collectFields(field.SelectionSet, info.Fragments, selected)
+	}
+	return selected
+}
+
+func collectFields(selectionSet *ast.SelectionSet, fragments map[string]ast.Definition, selected map[string]bool) {
+	if selectionSet == nil {
+		return
+	}
+
+	for _, selection := range selectionSet.Selections {
+		switch selection := selection.(type) {
+		case *ast.Field:
+			selected[selection.Name.Value] = true
+		case *ast.InlineFragment:
+			collectFields(selection.SelectionSet, fragments, selected)
+		case *ast.FragmentSpread:
+			if fragment, ok := fragments[selection.Name.Value].(*ast.FragmentDefinition); ok {
+				collectFields(fragment.SelectionSet, fragments, selected)
+			}
+		}
+	}
+}
+
+// Work out what to fetch along with a user from the fields selected on it, and the page size arguments of each list
+func userIncludes(params graphql.ResolveParams) database.UserIncludes {
+	selected := selectedFields(params.Info)
+
+	pages := map[string]*database.ListPage{}
+	for _, list := range userLists {
+		if !selected[list] {
+			continue
+		}
+		take, _ := params.Args[list+"ToFetch"].(int)
+		skip, _ := params.Args[list+"Offset"].(int)
+		pages[list] = &database.ListPage{Take: take, Skip: skip}
+	}
+
+	return database.UserIncludes{
+		Dweets:          pages["dweets"],
+		Redweets:        pages["redweets"],
+		RedweetedDweets: pages["redweetedDweets"],
+		FeedObjects:     pages["feedObjects"],
+		LikedDweets:     pages["likedDweets"],
+		Followers:       selected["followers"],
+		Following:       selected["following"],
+	}
+}
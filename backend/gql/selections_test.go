@@ -0,0 +1,127 @@
+package gql
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/soumitradev/Dwitter/backend/database"
+)
+
+// Parse a query, and get the field it starts with along with the fragments it defines
+func parseField(t *testing.T, query string) (*ast.Field, map[string]ast.Definition) {
+	document, err := parser.Parse(parser.ParseParams{Source: query})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var field *ast.Field
+	fragments := map[string]ast.Definition{}
+	for _, definition := range document.Definitions {
+		switch definition := definition.(type) {
+		case *ast.OperationDefinition:
+			field = definition.SelectionSet.Selections[0].(*ast.Field)
+		case *ast.FragmentDefinition:
+			fragments[definition.Name.Value] = definition
+		}
+	}
+	return field, fragments
+}
+
+func TestCollectFields(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{
+			"fields",
+			`{ user(username: "someone") { username name dweets { id } } }`,
+			[]string{"username", "name", "dweets"},
+		},
+		{
+			"no fields",
+			`{ instances }`,
+			[]string{},
+		},
+		{
+			"fragment spread",
+			`{ user(username: "someone") { username ...lists } }
+			fragment lists on User { dweets { id } feedObjects { ... on Redweet { author { username } } } }`,
+			[]string{"username", "dweets", "feedObjects"},
+		},
+		{
+			"nested fragment spreads",
+			`{ user(username: "someone") { ...outer } }
+			fragment outer on User { ...inner followers { username } }
+			fragment inner on User { likedDweets { id } }`,
+			[]string{"followers", "likedDweets"},
+		},
+		{
+			"inline fragment",
+			`{ user(username: "someone") { ... on User { redweets { redweetTime } } following { username } } }`,
+			[]string{"redweets", "following"},
+		},
+		{
+			"fragment that isn't defined",
+			`{ user(username: "someone") { username ...missing } }`,
+			[]string{"username"},
+		},
+		{
+			"field selected twice",
+			`{ user(username: "someone") { dweets { id } ...lists } }
+			fragment lists on User { dweets { body } }`,
+			[]string{"dweets"},
+		},
+	}
+
+	for _, test := range tests {
+		field, fragments := parseField(t, test.query)
+		got := map[string]bool{}
+		collectFields(field.SelectionSet, fragments, got)
+
+		want := map[string]bool{}
+		for _, name := range test.want {
+			want[name] = true
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: collectFields() = %v, want %v", test.name, got, want)
+		}
+	}
+}
+
+func TestUserIncludes(t *testing.T) {
+	field, fragments := parseField(t, `{
+		user(username: "someone", dweetsToFetch: 5, feedObjectsToFetch: -1) {
+			username
+			dweets { id }
+			...feed
+			followers { username }
+		}
+	}
+	fragment feed on User { feedObjects { ... on Dweet { id } } }`)
+
+	args := map[string]interface{}{"username": "someone"}
+	for _, list := range userLists {
+		args[list+"ToFetch"] = 20
+		args[list+"Offset"] = 0
+	}
+	args["dweetsToFetch"] = 5
+	args["feedObjectsToFetch"] = -1
+	args["feedObjectsOffset"] = 10
+
+	got := userIncludes(graphql.ResolveParams{
+		Args: args,
+		Info: graphql.ResolveInfo{FieldASTs: []*ast.Field{field}, Fragments: fragments},
+	})
+	want := database.UserIncludes{
+		Dweets:      &database.ListPage{Take: 5, Skip: 0},
+		FeedObjects: &database.ListPage{Take: -1, Skip: 10},
+		Followers:   true,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("userIncludes() = %+v, want %+v", got, want)
+	}
+}
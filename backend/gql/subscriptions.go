@@ -2,17 +2,23 @@
 package gql
 
 import (
-	"time"
+	"errors"
+	"fmt"
 
 	"github.com/soumitradev/Dwitter/backend/auth"
 	"github.com/soumitradev/Dwitter/backend/common"
+	"github.com/soumitradev/Dwitter/backend/database"
+	"github.com/soumitradev/Dwitter/backend/events"
+	"github.com/soumitradev/Dwitter/backend/schema"
 
 	"github.com/functionalfoundry/graphqlws"
 	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
 )
 
 func init() {
-	common.SubscriptionManager = graphqlws.NewSubscriptionManager(&Schema)
+	subscriptionManager.manager = graphqlws.NewSubscriptionManager(&Schema)
+	common.SubscriptionManager = subscriptionManager
 	common.GraphqlwsHandler = graphqlws.NewHandler(graphqlws.HandlerConfig{
 		// Wire up the GraphqL WebSocket handler with the subscription manager
 		SubscriptionManager: common.SubscriptionManager,
@@ -20,55 +26,243 @@ func init() {
 		// Optional: Add a hook to resolve auth cookies into users that are
 		// then stored on the GraphQL WS connections
 		Authenticate: func(authCookie string) (interface{}, error) {
-			data, _, err := auth.VerifySessionID(authCookie)
+			data, isAuth, err := auth.VerifySessionID(authCookie)
 			if err != nil {
 				return nil, err
 			}
-			return data.Username, nil
+			if !isAuth {
+				return connectionSession{}, nil
+			}
+			return connectionSession{username: data.Username, sid: authCookie}, nil
 		},
 	})
 
-	go func() {
-		for {
-			// Every 5 mins, update the subscriptions
-			time.Sleep(5 * time.Minute)
-			subscriptions := common.SubscriptionManager.Subscriptions()
-
-			for conn := range subscriptions {
-				// Things you have access to here:
-				conn.ID()   // The connection ID
-				conn.User() // The user returned from the Authenticate function
-
-				for _, subscription := range subscriptions[conn] {
-					// Things you have access to here:
-					// subscription.ID            // The subscription ID (unique per conn)
-					// subscription.OperationName // The name of the operation
-					// subscription.Query         // The subscription query/queries string
-					// subscription.Variables     // The subscription variables
-					// subscription.Document      // The GraphQL AST for the subscription
-					// subscription.Fields        // The names of top-level queries
-					// subscription.Connection    // The GraphQL WS connection
-
-					// Re-execute the subscription query
-					params := graphql.Params{
-						Schema:         Schema, // The GraphQL schema
-						RequestString:  subscription.Query,
-						VariableValues: subscription.Variables,
-						OperationName:  subscription.OperationName,
-						Context:        common.BaseCtx,
-					}
-					result := graphql.Do(params)
-
-					// Send query results back to the subscriber at any point
-					data := graphqlws.DataMessagePayload{
-						// Data can be anything (interface{})
-						Data: result.Data,
-						// Errors is optional ([]error)
-						Errors: graphqlws.ErrorsFromGraphQLErrors(result.Errors),
-					}
-					subscription.SendData(&data)
+	events.Subscribe(handleEvent)
+}
+
+// Who a websocket connection belongs to, and the session it logged in with
+type connectionSession struct {
+	username string
+	sid      string
+}
+
+// Find who a connection belongs to, or "" if nobody is logged in
+func connectionUser(conn graphqlws.Connection) string {
+	session, _ := conn.User().(connectionSession)
+	return session.username
+}
+
+// Check that the session a connection logged in with wasn't revoked or expired, and that its user can still log in.
+// Connections that logged out lose their subscriptions, and are told why.
+func stillLoggedIn(conn graphqlws.Connection) bool {
+	session, _ := conn.User().(connectionSession)
+	if session.sid == "" {
+		return true
+	}
+
+	_, isAuth, err := auth.VerifySessionID(session.sid)
+	if err == nil && isAuth {
+		return true
+	}
+	subscriptionManager.RemoveSubscriptions(conn)
+	conn.SendError(errors.New("Unauthorized: session ended, log in and subscribe again"))
+	return false
+}
+
+// Update the subscriptions an event affects
+func handleEvent(event events.Event) {
+	switch event.Type {
+	case events.NotificationCreated:
+		pushToSubscriptions([]string{event.Owner}, "notificationAdded", map[string]interface{}{
+			"notification": event.Object,
+		})
+		return
+	case events.UserUpdated:
+		// Profiles aren't part of the feed
+	case events.DweetCreated, events.RedweetCreated:
+		// New feed items are sent on their own to feedItemAdded, and the whole feed to feed
+		audience := feedAudience(event.Owner)
+		pushToSubscriptions(audience, "feedItemAdded", map[string]interface{}{
+			"feedItem": event.Object,
+		})
+		pushToSubscriptions(audience, "feed", nil)
+	case events.UserFollowed, events.UserUnfollowed:
+		// Only the feed of the follower changes
+		pushToSubscriptions([]string{event.Actor}, "feed", nil)
+	default:
+		// Edits, deletes and likes change items already in feeds, so those feeds are run again
+		pushToSubscriptions(feedAudience(event.Owner), "feed", nil)
+	}
+
+	// Replies are sent to everyone watching the dweet they reply to, whose reply count changed too
+	if reply, ok := event.Object.(schema.DweetType); ok && event.Type == events.DweetCreated && reply.IsReply {
+		pushToWatchers("replyAdded", "dweetID", reply.OriginalReplyID, map[string]interface{}{
+			"reply": reply,
+		})
+		pushToWatchers("dweetUpdated", "id", reply.OriginalReplyID, nil)
+	}
+
+	switch event.Type {
+	case events.DweetEdited, events.DweetLiked, events.DweetUnliked, events.RedweetCreated, events.RedweetDeleted:
+		pushToWatchers("dweetUpdated", "id", event.DweetID, nil)
+	case events.DweetDeleted:
+		// Deleted dweets can't be run again, so watchers get a tombstone
+		pushToWatchers("dweetUpdated", "id", event.DweetID, map[string]interface{}{
+			"deletedDweet": event.DweetID,
+		})
+	}
+
+	// Both the user who did something and the user it was done to show it on their profile
+	pushToWatchers("userActivity", "username", event.Actor, nil)
+	if event.Owner != event.Actor {
+		pushToWatchers("userActivity", "username", event.Owner, nil)
+	}
+}
+
+// Find the users with a live feed or feedItemAdded subscription whose feed shows the dweets and redweets of a user
+func feedAudience(username string) []string {
+	live := []string{}
+	seen := map[string]bool{}
+	subscriptions := common.SubscriptionManager.Subscriptions()
+	for conn := range subscriptions {
+		subscriber := connectionUser(conn)
+		if subscriber == "" || seen[subscriber] {
+			continue
+		}
+		for _, subscription := range subscriptions[conn] {
+			if subscription.MatchesField("feed") || subscription.MatchesField("feedItemAdded") {
+				seen[subscriber] = true
+				live = append(live, subscriber)
+				break
+			}
+		}
+	}
+
+	audience, err := database.FeedAudience(username, live)
+	if err != nil {
+		fmt.Printf("Error finding feed subscribers: %v\n", err)
+	}
+	return audience
+}
+
+// Run the subscriptions to a field on the connections of some users, and send them the results
+func pushToSubscriptions(usernames []string, field string, root map[string]interface{}) {
+	if len(usernames) == 0 {
+		return
+	}
+	wanted := map[string]bool{}
+	for _, username := range usernames {
+		wanted[username] = true
+	}
+
+	push(field, root, func(subscriber string, subscription *graphqlws.Subscription) bool {
+		return wanted[subscriber]
+	})
+}
+
+// Run the subscriptions to a field that watch something, on every connection, and send them the results
+func pushToWatchers(field string, argument string, value string, root map[string]interface{}) {
+	if value == "" {
+		return
+	}
+
+	push(field, root, func(subscriber string, subscription *graphqlws.Subscription) bool {
+		watched, _ := subscriptionArgument(subscription, field, argument).(string)
+		return watched == value
+	})
+}
+
+// Read an argument of a field in a subscription, whether it is written in the query or passed as a variable
+func subscriptionArgument(subscription *graphqlws.Subscription, field string, argument string) interface{} {
+	for _, definition := range subscription.Document.Definitions {
+		operation, ok := definition.(*ast.OperationDefinition)
+		if !ok || operation.SelectionSet == nil {
+			continue
+		}
+		for _, selection := range operation.SelectionSet.Selections {
+			selected, ok := selection.(*ast.Field)
+			if !ok || selected.Name == nil || selected.Name.Value != field {
+				continue
+			}
+			for _, arg := range selected.Arguments {
+				if arg.Name == nil || arg.Name.Value != argument {
+					continue
+				}
+				if variable, ok := arg.Value.(*ast.Variable); ok {
+					return subscription.Variables[variable.Name.Value]
 				}
+				return arg.Value.GetValue()
 			}
 		}
-	}()
+	}
+	return nil
+}
+
+// Run the subscriptions to a field that match, and send them the results.
+// The root object is what changed, and resolvers also get the user the connection belongs to as "subscriber".
+// Connections that aren't logged in have "" as their user.
+// The session of a connection is checked again before anything is sent to it, so that logging out stops updates.
+func push(field string, root map[string]interface{}, matches func(subscriber string, subscription *graphqlws.Subscription) bool) {
+	subscriptions := common.SubscriptionManager.Subscriptions()
+	for conn := range subscriptions {
+		subscriber := connectionUser(conn)
+
+		matched := []*graphqlws.Subscription{}
+		for _, subscription := range subscriptions[conn] {
+			if subscription.MatchesField(field) && matches(subscriber, subscription) {
+				matched = append(matched, subscription)
+			}
+		}
+		if len(matched) == 0 || !stillLoggedIn(conn) {
+			continue
+		}
+
+		for _, subscription := range matched {
+			runSubscription(subscription, subscriber, root)
+		}
+	}
+}
+
+// Run a subscription for the user a connection belongs to, and send it the result
+func runSubscription(subscription *graphqlws.Subscription, subscriber string, root map[string]interface{}) {
+	rootObject := map[string]interface{}{
+		"subscriber": subscriber,
+	}
+	for key, value := range root {
+		rootObject[key] = value
+	}
+
+	params := graphql.Params{
+		Schema:         Schema,
+		RequestString:  subscription.Query,
+		VariableValues: subscription.Variables,
+		OperationName:  subscription.OperationName,
+		Context:        common.BaseCtx,
+		RootObject:     rootObject,
+	}
+	result := graphql.Do(params)
+
+	data := graphqlws.DataMessagePayload{
+		Data:   result.Data,
+		Errors: graphqlws.ErrorsFromGraphQLErrors(result.Errors),
+	}
+	subscription.SendData(&data)
+}
+
+// Find who a subscription is run for, or "" if nobody is logged in.
+// Pushed updates say who the connection belongs to, otherwise the request is authenticated like a query.
+func subscriptionViewer(rootValue interface{}) (string, error) {
+	root, _ := rootValue.(map[string]interface{})
+	if subscriber, ok := root["subscriber"].(string); ok {
+		return subscriber, nil
+	}
+
+	data, isAuth, err := auth.ResolveViewer(rootValue, auth.ScopeRead)
+	if err != nil {
+		return "", err
+	}
+	if isAuth {
+		return data.Username, nil
+	}
+	return "", nil
 }
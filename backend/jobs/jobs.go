@@ -0,0 +1,266 @@
+// Package jobs provides a Redis-backed job queue, with retries and a dead-letter list
+package jobs
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/soumitradev/Dwitter/backend/common"
+	"github.com/soumitradev/Dwitter/backend/util"
+)
+
+// A Job is a piece of work waiting to be done by a worker
+type Job struct {
+	ID             string          `json:"id"`
+	Type           string          `json:"type"`
+	Payload        json.RawMessage `json:"payload"`
+	IdempotencyKey string          `json:"idempotencyKey"`
+	Attempts       int             `json:"attempts"`
+	EnqueuedAt     time.Time       `json:"enqueuedAt"`
+	LastError      string          `json:"lastError"`
+}
+
+// A Handler does a type of job. Returning an error makes the job run again later.
+type Handler func(payload json.RawMessage) error
+
+// Keys the queue is stored in
+const (
+	readyKey = "jobs:ready"
+	// Jobs being run, moved here from the ready list in the same step that takes them off it
+	processingKey = "jobs:processing"
+	delayedKey    = "jobs:delayed"
+	// When each job being run is assumed to have been lost
+	inflightKey = "jobs:inflight"
+	deadKey     = "jobs:dead"
+)
+
+// Key that stops a job with the same idempotency key from being enqueued twice
+func idempotencyKey(key string) string {
+	return "jobs:key:" + key
+}
+
+// Key that marks a job as done, so that it doesn't run again if it gets requeued
+func doneKey(id string) string {
+	return "jobs:done:" + id
+}
+
+var handlers = map[string]Handler{}
+
+// How many times a job is tried before it goes to the dead-letter list
+var MaxAttempts = 8
+
+// How long the first retry waits, every retry after that waits twice as long
+var baseBackoff = time.Second * 30
+
+// Retries never wait longer than this
+var maxBackoff = time.Hour
+
+// A job that takes longer than this is assumed to have been lost, and is run again
+var jobTimeout = time.Minute * 5
+
+// How long idempotency keys and done markers are kept
+var jobMarkerTTL = time.Hour * 24
+
+// How many dead jobs are kept around to look at
+const maxDeadJobs = 1000
+
+// Push a job unless its idempotency key was used already, setting the key in the same step so that a failed push doesn't leave it behind
+var enqueueScript = redis.NewScript(`
+if redis.call("SET", KEYS[1], "1", "NX", "EX", ARGV[1]) then
+	redis.call("LPUSH", KEYS[2], ARGV[2])
+	return 1
+end
+return 0
+`)
+
+// Put a job that is being run back on the ready list, if it is still being run
+var requeueLostScript = redis.NewScript(`
+redis.call("ZREM", KEYS[2], ARGV[1])
+if redis.call("LREM", KEYS[1], 1, ARGV[1]) > 0 then
+	redis.call("LPUSH", KEYS[3], ARGV[1])
+end
+return 0
+`)
+
+// Put a retry that is due back on the ready list, if no other server did already
+var requeueDelayedScript = redis.NewScript(`
+if redis.call("ZREM", KEYS[1], ARGV[1]) > 0 then
+	redis.call("LPUSH", KEYS[2], ARGV[1])
+end
+return 0
+`)
+
+// Register the handler of a type of job
+func Register(jobType string, handler Handler) {
+	handlers[jobType] = handler
+}
+
+// Add a job to the queue. A job with the same idempotency key as one from the last day is dropped.
+func Enqueue(jobType string, key string, payload interface{}) error {
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	job := Job{
+		ID:             util.GenID(20),
+		Type:           jobType,
+		Payload:        encoded,
+		IdempotencyKey: key,
+		EnqueuedAt:     time.Now().UTC(),
+	}
+	raw, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	if key == "" {
+		return common.RedisDB.LPush(common.BaseCtx, readyKey, raw).Err()
+	}
+	return enqueueScript.Run(common.BaseCtx, common.RedisDB, []string{idempotencyKey(key), readyKey}, int(jobMarkerTTL.Seconds()), raw).Err()
+}
+
+// Start workers that run jobs, and the scheduler that moves retries back to the queue.
+// The number of workers is read from JOB_WORKERS, and defaults to 4.
+func StartWorkers() {
+	workers, err := strconv.Atoi(os.Getenv("JOB_WORKERS"))
+	if err != nil || workers <= 0 {
+		workers = 4
+	}
+
+	for i := 0; i < workers; i++ {
+		go work()
+	}
+	go schedule()
+}
+
+// Take jobs off the queue and run them, forever
+func work() {
+	for {
+		// The job is moved to the processing list in the same step, so it comes back if this server dies at any point
+		raw, err := common.RedisDB.BRPopLPush(common.BaseCtx, readyKey, processingKey, 0).Result()
+		if err != nil {
+			fmt.Printf("Error reading job queue: %v\n", err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		common.RedisDB.ZAdd(common.BaseCtx, inflightKey, &redis.Z{
+			Score:  float64(time.Now().Add(jobTimeout).Unix()),
+			Member: raw,
+		})
+		run(raw)
+		_, err = common.RedisDB.TxPipelined(common.BaseCtx, func(pipe redis.Pipeliner) error {
+			pipe.LRem(common.BaseCtx, processingKey, 1, raw)
+			pipe.ZRem(common.BaseCtx, inflightKey, raw)
+			return nil
+		})
+		if err != nil {
+			fmt.Printf("Error finishing job: %v\n", err)
+		}
+	}
+}
+
+// Run a job, and retry it later or give up on it if it fails
+func run(raw string) {
+	var job Job
+	err := json.Unmarshal([]byte(raw), &job)
+	if err != nil {
+		fmt.Printf("Dropping unreadable job: %v\n", err)
+		return
+	}
+
+	done, err := common.RedisDB.Exists(common.BaseCtx, doneKey(job.ID)).Result()
+	if err == nil && done > 0 {
+		return
+	}
+
+	handler, ok := handlers[job.Type]
+	if ok {
+		err = handler(job.Payload)
+	} else {
+		err = fmt.Errorf("no handler for job type %s", job.Type)
+	}
+	if err == nil {
+		common.RedisDB.Set(common.BaseCtx, doneKey(job.ID), "1", jobMarkerTTL)
+		return
+	}
+
+	job.Attempts++
+	job.LastError = err.Error()
+	retried, marshalErr := json.Marshal(job)
+	if marshalErr != nil {
+		fmt.Printf("Dropping job %s: %v\n", job.ID, marshalErr)
+		return
+	}
+
+	if job.Attempts >= MaxAttempts || !ok {
+		fmt.Printf("Job %s failed for good: %v\n", job.ID, err)
+		common.RedisDB.LPush(common.BaseCtx, deadKey, retried)
+		common.RedisDB.LTrim(common.BaseCtx, deadKey, 0, maxDeadJobs-1)
+		return
+	}
+
+	common.RedisDB.ZAdd(common.BaseCtx, delayedKey, &redis.Z{
+		Score:  float64(time.Now().Add(backoff(job.Attempts)).Unix()),
+		Member: retried,
+	})
+}
+
+// How long to wait before trying a job again, with some jitter so that failures don't retry in lockstep
+func backoff(attempts int) time.Duration {
+	wait := baseBackoff << uint(attempts-1)
+	if wait > maxBackoff || wait <= 0 {
+		wait = maxBackoff
+	}
+	return wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+}
+
+// Jobs that are due in a sorted set of jobs
+func dueJobs(key string) []string {
+	due, err := common.RedisDB.ZRangeByScore(common.BaseCtx, key, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(time.Now().Unix(), 10),
+	}).Result()
+	if err != nil {
+		fmt.Printf("Error reading job schedule: %v\n", err)
+	}
+	return due
+}
+
+// Move retries that are due, and jobs that were lost while running, back to the queue
+func schedule() {
+	for {
+		for _, raw := range dueJobs(delayedKey) {
+			err := requeueDelayedScript.Run(common.BaseCtx, common.RedisDB, []string{delayedKey, readyKey}, raw).Err()
+			if err != nil {
+				fmt.Printf("Error requeueing job: %v\n", err)
+			}
+		}
+
+		// A server can die after taking a job but before giving it a deadline, so jobs without one get one now
+		processing, err := common.RedisDB.LRange(common.BaseCtx, processingKey, 0, -1).Result()
+		if err != nil {
+			fmt.Printf("Error reading jobs being run: %v\n", err)
+		}
+		for _, raw := range processing {
+			common.RedisDB.ZAddNX(common.BaseCtx, inflightKey, &redis.Z{
+				Score:  float64(time.Now().Add(jobTimeout).Unix()),
+				Member: raw,
+			})
+		}
+
+		for _, raw := range dueJobs(inflightKey) {
+			err := requeueLostScript.Run(common.BaseCtx, common.RedisDB, []string{processingKey, inflightKey, readyKey}, raw).Err()
+			if err != nil {
+				fmt.Printf("Error requeueing job: %v\n", err)
+			}
+		}
+		time.Sleep(time.Second)
+	}
+}
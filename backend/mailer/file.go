@@ -0,0 +1,50 @@
+package mailer
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// A fileMailer writes emails into a maildir instead of sending them, so that they can be read in development
+type fileMailer struct {
+	dir string
+}
+
+func newFileMailer(dir string) *fileMailer {
+	return &fileMailer{dir: dir}
+}
+
+// Messages are written to tmp and then moved to new, so that mail readers never see half a message
+func (m *fileMailer) Send(message Message) error {
+	raw, err := buildMIME(message)
+	if err != nil {
+		return err
+	}
+
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		err = os.MkdirAll(filepath.Join(m.dir, sub), 0755)
+		if err != nil {
+			return err
+		}
+	}
+
+	random := make([]byte, 8)
+	_, err = rand.Read(random)
+	if err != nil {
+		return err
+	}
+	hostname, _ := os.Hostname()
+	name := fmt.Sprintf("%d.%s.%s", time.Now().UnixNano(), hex.EncodeToString(random), hostname)
+
+	tmpPath := filepath.Join(m.dir, "tmp", name)
+	err = ioutil.WriteFile(tmpPath, raw, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, filepath.Join(m.dir, "new", name))
+}
@@ -0,0 +1,206 @@
+// Package mailer sends emails through SendGrid, an SMTP server, or into a directory on disk
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A Message is an email with a plain text part, and optionally an HTML part
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+	// Extra headers, like List-Unsubscribe
+	Headers map[string]string
+}
+
+// A Mailer sends emails
+type Mailer interface {
+	Send(message Message) error
+}
+
+// The mailer used by Send
+var Default Mailer
+
+// Address and name emails are sent from
+var fromAddress mail.Address
+
+// Work out the backend from MAIL_BACKEND. Without it, SendGrid is used if SENDGRID_API_KEY is set,
+// since that was the only backend once. Anything else has to be picked, so that emails aren't quietly written to disk.
+func backendFromEnv() (string, error) {
+	backend := os.Getenv("MAIL_BACKEND")
+	if backend == "" && os.Getenv("SENDGRID_API_KEY") != "" {
+		backend = "sendgrid"
+	}
+
+	switch backend {
+	case "":
+		return "", errors.New("MAIL_BACKEND is not set, set it to sendgrid, smtp or file")
+	case "sendgrid":
+		if os.Getenv("SENDGRID_API_KEY") == "" {
+			return "", errors.New("MAIL_BACKEND is sendgrid, but SENDGRID_API_KEY is not set")
+		}
+	case "smtp", "file":
+	default:
+		return "", fmt.Errorf("unknown MAIL_BACKEND: %s", backend)
+	}
+	return backend, nil
+}
+
+// Pick a mailer from MAIL_BACKEND, which can be sendgrid, smtp or file
+func Init() {
+	fromAddress = mail.Address{Name: "Dwitter", Address: os.Getenv("MAIL_FROM")}
+	if fromAddress.Address == "" {
+		fromAddress.Address = os.Getenv("SENDGRID_SENDER_EMAIL_ADDR")
+	}
+
+	backend, err := backendFromEnv()
+	if err != nil {
+		panic(err)
+	}
+
+	switch backend {
+	case "sendgrid":
+		Default = newSendgridMailer(os.Getenv("SENDGRID_API_KEY"))
+	case "smtp":
+		addr := os.Getenv("SMTP_ADDR")
+		if addr == "" {
+			addr = "localhost:1025"
+		}
+		Default = newSMTPMailer(addr, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"))
+	case "file":
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			dir = "mail"
+		}
+		Default = newFileMailer(dir)
+	}
+}
+
+// Send an email with the default mailer
+func Send(message Message) error {
+	if Default == nil {
+		return fmt.Errorf("mailer not initialized")
+	}
+	err := message.validate()
+	if err != nil {
+		return err
+	}
+	return Default.Send(message)
+}
+
+// Check that the recipient and headers of a message can't start headers of their own.
+// Recipients are addresses users typed in, so a line break in one could add any header to the email.
+func (message Message) validate() error {
+	if strings.ContainsAny(message.To, "\r\n") {
+		return errors.New("invalid recipient: line breaks aren't allowed")
+	}
+	_, err := mail.ParseAddress(message.To)
+	if err != nil {
+		return fmt.Errorf("invalid recipient %q: %v", message.To, err)
+	}
+
+	for name, value := range message.Headers {
+		if name == "" || strings.ContainsAny(name, ": \t\r\n") {
+			return fmt.Errorf("invalid header name %q", name)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("invalid value for header %s: line breaks aren't allowed", name)
+		}
+	}
+	return nil
+}
+
+// Write a quoted-printable MIME part
+func writePart(writer *multipart.Writer, contentType string, body string) error {
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", contentType)
+	header.Set("Content-Transfer-Encoding", "quoted-printable")
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		return err
+	}
+
+	encoder := quotedprintable.NewWriter(part)
+	_, err = encoder.Write([]byte(body))
+	if err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// Turn a message into the raw email sent over SMTP or written to disk
+func buildMIME(message Message) ([]byte, error) {
+	err := message.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	var buffer bytes.Buffer
+	writer := multipart.NewWriter(&buffer)
+
+	idBytes := make([]byte, 16)
+	_, err = rand.Read(idBytes)
+	if err != nil {
+		return nil, err
+	}
+	domain := "localhost"
+	if at := strings.LastIndex(fromAddress.Address, "@"); at >= 0 {
+		domain = fromAddress.Address[at+1:]
+	}
+
+	headers := map[string]string{
+		"From":         fromAddress.String(),
+		"To":           message.To,
+		"Subject":      mime.QEncoding.Encode("utf-8", message.Subject),
+		"Date":         time.Now().Format(time.RFC1123Z),
+		"Message-ID":   "<" + hex.EncodeToString(idBytes) + "@" + domain + ">",
+		"MIME-Version": "1.0",
+		"Content-Type": "multipart/alternative; boundary=" + writer.Boundary(),
+	}
+	for name, value := range message.Headers {
+		headers[name] = value
+	}
+
+	// Keep the headers in the same order every time
+	names := []string{}
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&buffer, "%s: %s\r\n", name, headers[name])
+	}
+	buffer.WriteString("\r\n")
+
+	err = writePart(writer, "text/plain; charset=utf-8", message.Text)
+	if err != nil {
+		return nil, err
+	}
+	if message.HTML != "" {
+		err = writePart(writer, "text/html; charset=utf-8", message.HTML)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = writer.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
@@ -0,0 +1,183 @@
+package mailer
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"os"
+	"strings"
+	"testing"
+)
+
+func testMessage() Message {
+	return Message{
+		To:      "someone@example.com",
+		Subject: "Nuevo seguidor en Dwitter",
+		Text:    "Someone followed you.\nSee who at https://example.com/u/someone",
+		HTML:    "<p>Someone followed you.</p>",
+		Headers: map[string]string{
+			"List-Unsubscribe":      "<https://example.com/api/unsubscribe/token>",
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		},
+	}
+}
+
+func TestBuildMIME(t *testing.T) {
+	fromAddress = mail.Address{Name: "Dwitter", Address: "noreply@dwitter.example.com"}
+
+	raw, err := buildMIME(testMessage())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	headers := map[string]string{
+		"From":                  `"Dwitter" <noreply@dwitter.example.com>`,
+		"To":                    "someone@example.com",
+		"Subject":               "Nuevo seguidor en Dwitter",
+		"MIME-Version":          "1.0",
+		"List-Unsubscribe":      "<https://example.com/api/unsubscribe/token>",
+		"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+	}
+	for name, want := range headers {
+		if got := parsed.Header.Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	if messageID := parsed.Header.Get("Message-ID"); !strings.HasSuffix(messageID, "@dwitter.example.com>") {
+		t.Errorf("Message-ID = %q, want it on the domain of the sender", messageID)
+	}
+	if _, err := parsed.Header.Date(); err != nil {
+		t.Errorf("invalid Date: %v", err)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q, want multipart/alternative", parsed.Header.Get("Content-Type"))
+	}
+
+	reader := multipart.NewReader(parsed.Body, params["boundary"])
+	parts := map[string]string{}
+	for {
+		part, err := reader.NextRawPart()
+		if err != nil {
+			break
+		}
+		if part.Header.Get("Content-Transfer-Encoding") != "quoted-printable" {
+			t.Errorf("part %s isn't quoted-printable", part.Header.Get("Content-Type"))
+		}
+		body, err := ioutil.ReadAll(quotedprintable.NewReader(part))
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts[part.Header.Get("Content-Type")] = string(body)
+	}
+
+	// Line breaks in text are sent as CRLF
+	message := testMessage()
+	text := strings.ReplaceAll(message.Text, "\n", "\r\n")
+	if parts["text/plain; charset=utf-8"] != text {
+		t.Errorf("text part = %q, want %q", parts["text/plain; charset=utf-8"], text)
+	}
+	if parts["text/html; charset=utf-8"] != message.HTML {
+		t.Errorf("HTML part = %q, want %q", parts["text/html; charset=utf-8"], message.HTML)
+	}
+}
+
+func TestBuildMIMETextOnly(t *testing.T) {
+	message := testMessage()
+	message.HTML = ""
+
+	raw, err := buildMIME(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(raw, []byte("text/html")) {
+		t.Error("message without HTML has an HTML part")
+	}
+}
+
+func TestBuildMIMEEncodesSubject(t *testing.T) {
+	message := testMessage()
+	message.Subject = "Nueva respuesta de José\r\nBcc: everyone@example.com"
+
+	raw, err := buildMIME(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Header.Get("Bcc") != "" {
+		t.Error("subject added a Bcc header")
+	}
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if err != nil || subject != message.Subject {
+		t.Errorf("Subject = %q, want %q", subject, message.Subject)
+	}
+}
+
+func TestBuildMIMERejectsInjection(t *testing.T) {
+	tests := map[string]func(message *Message){
+		"recipient with CRLF": func(m *Message) { m.To = "someone@example.com\r\nBcc: everyone@example.com" },
+		"recipient with LF":   func(m *Message) { m.To = "someone@example.com\nBcc: everyone@example.com" },
+		"invalid recipient":   func(m *Message) { m.To = "not an address" },
+		"header value with CRLF": func(m *Message) {
+			m.Headers["List-Unsubscribe"] = "<https://example.com>\r\nBcc: everyone@example.com"
+		},
+		"header value with CR":   func(m *Message) { m.Headers["List-Unsubscribe"] = "<https://example.com>\rBcc: x" },
+		"header name with colon": func(m *Message) { m.Headers["Bcc: everyone@example.com\r\nX"] = "1" },
+		"header name with space": func(m *Message) { m.Headers["X Header"] = "1" },
+		"empty header name":      func(m *Message) { m.Headers[""] = "1" },
+	}
+
+	for name, edit := range tests {
+		t.Run(name, func(t *testing.T) {
+			message := testMessage()
+			edit(&message)
+
+			_, err := buildMIME(message)
+			if err == nil {
+				t.Error("buildMIME() accepted the message")
+			}
+		})
+	}
+}
+
+func TestBackendFromEnv(t *testing.T) {
+	tests := []struct {
+		backend string
+		apiKey  string
+		want    string
+		wantErr bool
+	}{
+		{backend: "", apiKey: "", wantErr: true},
+		{backend: "", apiKey: "key", want: "sendgrid"},
+		{backend: "sendgrid", apiKey: "", wantErr: true},
+		{backend: "sendgrid", apiKey: "key", want: "sendgrid"},
+		{backend: "smtp", apiKey: "key", want: "smtp"},
+		{backend: "file", apiKey: "", want: "file"},
+		{backend: "carrier-pigeon", apiKey: "", wantErr: true},
+	}
+
+	defer os.Setenv("MAIL_BACKEND", os.Getenv("MAIL_BACKEND"))
+	defer os.Setenv("SENDGRID_API_KEY", os.Getenv("SENDGRID_API_KEY"))
+	for _, test := range tests {
+		os.Setenv("MAIL_BACKEND", test.backend)
+		os.Setenv("SENDGRID_API_KEY", test.apiKey)
+
+		got, err := backendFromEnv()
+		if (err != nil) != test.wantErr || got != test.want {
+			t.Errorf("backendFromEnv() with MAIL_BACKEND=%q SENDGRID_API_KEY=%q = %q, %v, want %q, error %v", test.backend, test.apiKey, got, err, test.want, test.wantErr)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package mailer
+
+import (
+	"fmt"
+
+	"github.com/sendgrid/sendgrid-go"
+	"github.com/sendgrid/sendgrid-go/helpers/mail"
+)
+
+// A sendgridMailer sends emails through the SendGrid API
+type sendgridMailer struct {
+	client *sendgrid.Client
+}
+
+func newSendgridMailer(apiKey string) *sendgridMailer {
+	return &sendgridMailer{client: sendgrid.NewSendClient(apiKey)}
+}
+
+func (m *sendgridMailer) Send(message Message) error {
+	from := mail.NewEmail(fromAddress.Name, fromAddress.Address)
+	to := mail.NewEmail("Recipient", message.To)
+
+	var email *mail.SGMailV3
+	if message.HTML == "" {
+		email = mail.NewSingleEmailPlainText(from, message.Subject, to, message.Text)
+	} else {
+		email = mail.NewSingleEmail(from, message.Subject, to, message.Text, message.HTML)
+	}
+	for name, value := range message.Headers {
+		email.SetHeader(name, value)
+	}
+
+	response, err := m.client.Send(email)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("sendgrid returned %d: %s", response.StatusCode, response.Body)
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package mailer
+
+import (
+	"net"
+	"net/smtp"
+)
+
+// An smtpMailer sends emails through an SMTP server, like MailHog in development
+type smtpMailer struct {
+	addr string
+	auth smtp.Auth
+}
+
+// Log in to the server only if a username is given, local test servers usually don't need it
+func newSMTPMailer(addr string, username string, password string) *smtpMailer {
+	m := &smtpMailer{addr: addr}
+	if username != "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			host = addr
+		}
+		m.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return m
+}
+
+func (m *smtpMailer) Send(message Message) error {
+	raw, err := buildMIME(message)
+	if err != nil {
+		return err
+	}
+	return smtp.SendMail(m.addr, m.auth, fromAddress.Address, []string{message.To}, raw)
+}
@@ -0,0 +1,123 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Language emails fall back to when there is no translation
+const DefaultLanguage = "en"
+
+// Every email has a text template, which defines its subject and plain text body,
+// and an HTML template, which is rendered inside layout.html with the footer of its language
+//
+//go:embed templates
+var templateFiles embed.FS
+
+// TemplateData is what email templates are rendered with. Templates only use the fields they need.
+type TemplateData struct {
+	// Link to click, like a verification link
+	Link string
+	// Who did what the email is about, and a link to their profile
+	Author    string
+	AuthorURL string
+	// The dweet the email is about, and a link to it
+	DweetBody string
+	DweetURL  string
+	// Link that unsubscribes from these emails in one click
+	UnsubscribeURL string
+	// What happened since the last digest, by author
+	Digest []DigestGroup
+}
+
+// A DigestGroup is everything one author did since the last digest
+type DigestGroup struct {
+	Author    string
+	AuthorURL string
+	Items     []DigestItem
+}
+
+// A DigestItem is one new dweet, reply or redweet in a digest
+type DigestItem struct {
+	// The notification type, like newDweet, newRedweet or reply
+	Type      string
+	DweetBody string
+	DweetURL  string
+}
+
+type emailTemplate struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+// Templates by language, then by name
+var templates = map[string]map[string]emailTemplate{}
+
+func init() {
+	languages, err := fs.ReadDir(templateFiles, "templates")
+	if err != nil {
+		panic(err)
+	}
+
+	for _, language := range languages {
+		if !language.IsDir() {
+			continue
+		}
+		dir := path.Join("templates", language.Name())
+		files, err := fs.Glob(templateFiles, path.Join(dir, "*.txt"))
+		if err != nil {
+			panic(err)
+		}
+
+		templates[language.Name()] = map[string]emailTemplate{}
+		for _, file := range files {
+			name := strings.TrimSuffix(path.Base(file), ".txt")
+			text := texttemplate.Must(texttemplate.ParseFS(templateFiles, file))
+			html := htmltemplate.Must(htmltemplate.ParseFS(templateFiles, "templates/layout.html", path.Join(dir, "footer.html"), path.Join(dir, name+".html")))
+			templates[language.Name()][name] = emailTemplate{text: text, html: html}
+		}
+	}
+}
+
+// Check if emails can be sent in a language
+func IsSupportedLanguage(language string) bool {
+	_, ok := templates[language]
+	return ok
+}
+
+// Render an email from a template in a language, falling back to the default language
+func Render(name string, language string, data TemplateData) (Message, error) {
+	tmpl, ok := templates[language][name]
+	if !ok {
+		tmpl, ok = templates[DefaultLanguage][name]
+	}
+	if !ok {
+		return Message{}, fmt.Errorf("no email template named %s", name)
+	}
+
+	var subject, text, html bytes.Buffer
+	err := tmpl.text.ExecuteTemplate(&subject, "subject", data)
+	if err != nil {
+		return Message{}, err
+	}
+	err = tmpl.text.ExecuteTemplate(&text, "body", data)
+	if err != nil {
+		return Message{}, err
+	}
+	err = tmpl.html.ExecuteTemplate(&html, "layout", data)
+	if err != nil {
+		return Message{}, err
+	}
+
+	return Message{
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    strings.TrimSpace(text.String()) + "\n",
+		HTML:    html.String(),
+	}, nil
+}
@@ -2,17 +2,29 @@
 package middleware
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
+	"github.com/soumitradev/Dwitter/backend/auth"
 	"github.com/soumitradev/Dwitter/backend/common"
 
 	"github.com/gorilla/handlers"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/handler"
 )
 
+type contextKey string
+
+const responseWriterKey contextKey = "responseWriter"
+
 // Limit size of request
 func SizeAndTimeHandler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -38,7 +50,15 @@ func LoggingHandler(next http.Handler) http.Handler {
 
 // Limit content types
 func ContentTypeHandler(next http.Handler) http.Handler {
-	return handlers.ContentTypeHandler(next, "application/json", "application/graphql", "multipart/form-data")
+	checked := handlers.ContentTypeHandler(next, "application/json", "application/graphql", "multipart/form-data")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// One-click unsubscribes are form posts from mail clients
+		if strings.HasPrefix(r.URL.Path, "/api/unsubscribe/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		checked.ServeHTTP(w, r)
+	})
 }
 
 // Handle recoveries
@@ -46,18 +66,164 @@ func RecoveryHandler(next http.Handler) http.Handler {
 	return handlers.RecoveryHandler(handlers.PrintRecoveryStack(true))(next)
 }
 
+// Headers clients send cross-origin. Browsers don't treat * as a wildcard for requests with credentials, so they are listed.
+const corsAllowedHeaders = "Content-Type, Authorization, X-CSRF-Token"
+
+// Methods clients use cross-origin
+const corsAllowedMethods = "GET, POST, OPTIONS"
+
+// Only let the origins in ALLOWED_ORIGINS read responses, and answer their preflights
 func CORSHandler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Headers", "*")
+		origin := r.Header.Get("Origin")
+		allowed := auth.IsAllowedOrigin(origin)
+		if allowed {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+			w.Header().Set("Access-Control-Allow-Headers", corsAllowedHeaders)
+			w.Header().Set("Access-Control-Allow-Methods", corsAllowedMethods)
+		}
+		w.Header().Add("Vary", "Origin")
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			if allowed {
+				w.WriteHeader(http.StatusNoContent)
+			} else {
+				w.WriteHeader(http.StatusForbidden)
+			}
+			return
+		}
 		next.ServeHTTP(w, r)
 	})
 }
 
-func CORSTestingHandler(next http.Handler) http.Handler {
+// Only let the origins in ALLOWED_ORIGINS open websockets.
+// Browsers send the session cookie with websockets from any site and don't apply CORS to them, so the origin is checked here.
+// Clients that aren't browsers don't send an Origin, and can't be made to send someone else's cookie.
+func WebsocketOriginHandler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "http://localhost:8080")
-		w.Header().Set("Access-Control-Allow-Headers", "*")
+		origin := r.Header.Get("Origin")
+		if origin != "" && !auth.IsAllowedOrigin(origin) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(common.HTTPError{
+				Error: "origin not allowed",
+			})
+			return
+		}
 		next.ServeHTTP(w, r)
 	})
 }
+
+// Query fields that change state. They are kept as queries for old clients, and checked like mutations.
+var stateChangingQueryFields = map[string]bool{
+	"subscribeToDweet": true,
+	"subscribeToUser":  true,
+}
+
+// Check if a selection set has a field in stateChangingQueryFields at its top level, looking inside fragments
+func selectsStateChangingField(selectionSet *ast.SelectionSet, fragments map[string]*ast.FragmentDefinition, seen map[string]bool) bool {
+	if selectionSet == nil {
+		return false
+	}
+	for _, selection := range selectionSet.Selections {
+		switch selection := selection.(type) {
+		case *ast.Field:
+			if stateChangingQueryFields[selection.Name.Value] {
+				return true
+			}
+		case *ast.InlineFragment:
+			if selectsStateChangingField(selection.SelectionSet, fragments, seen) {
+				return true
+			}
+		case *ast.FragmentSpread:
+			name := selection.Name.Value
+			fragment, ok := fragments[name]
+			if !ok || seen[name] {
+				continue
+			}
+			seen[name] = true
+			if selectsStateChangingField(fragment.SelectionSet, fragments, seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Check if a GraphQL request has a mutation, or a query that changes state, in it.
+// It is parsed the same way the GraphQL handler does.
+func isGraphQLMutation(r *http.Request) bool {
+	// The body can only be read once, so give the GraphQL handler a copy
+	var body []byte
+	if r.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(r.Body)
+		if err != nil {
+			return true
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	parsed := r.Clone(r.Context())
+	parsed.Body = ioutil.NopCloser(bytes.NewReader(body))
+	opts := handler.NewRequestOptions(parsed)
+
+	// Requests that don't parse are never run
+	document, err := parser.Parse(parser.ParseParams{Source: opts.Query})
+	if err != nil {
+		return false
+	}
+	fragments := map[string]*ast.FragmentDefinition{}
+	for _, definition := range document.Definitions {
+		if fragment, ok := definition.(*ast.FragmentDefinition); ok {
+			fragments[fragment.Name.Value] = fragment
+		}
+	}
+	for _, definition := range document.Definitions {
+		operation, ok := definition.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		if operation.Operation == ast.OperationTypeMutation {
+			return true
+		}
+		if selectsStateChangingField(operation.SelectionSet, fragments, map[string]bool{}) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reject GraphQL mutations authenticated by the session cookie that don't have a valid CSRF token.
+// Queries that don't change state, and requests authenticated by an API token, go through as they are.
+func CSRFHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth.UsesSessionCookie(r) && isGraphQLMutation(r) {
+			err := auth.CheckCSRF(r)
+			if err != nil {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusForbidden)
+				json.NewEncoder(w).Encode(common.HTTPError{
+					Error: err.Error(),
+				})
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Store the response writer in the request context so that GraphQL resolvers can set cookies
+func ResponseWriterHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), responseWriterKey, w)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Get the response writer stored by ResponseWriterHandler
+func ResponseWriterFromContext(ctx context.Context) http.ResponseWriter {
+	w, _ := ctx.Value(responseWriterKey).(http.ResponseWriter)
+	return w
+}
@@ -0,0 +1,126 @@
+// Package schema provides useful custom types and functions to format database objects into these types
+package schema
+
+import (
+	"github.com/graphql-go/graphql"
+)
+
+// Where a page of a connection sits in the whole list
+type PageInfoType struct {
+	HasNextPage     bool   `json:"hasNextPage"`
+	HasPreviousPage bool   `json:"hasPreviousPage"`
+	StartCursor     string `json:"startCursor"`
+	EndCursor       string `json:"endCursor"`
+}
+
+// A Dweet in a connection, with the cursor that points at it
+type DweetEdgeType struct {
+	Cursor string    `json:"cursor"`
+	Node   DweetType `json:"node"`
+}
+
+// A page of Dweets
+type DweetConnectionType struct {
+	Edges    []DweetEdgeType `json:"edges"`
+	PageInfo PageInfoType    `json:"pageInfo"`
+}
+
+// A User in a connection, with the cursor that points at it
+type UserEdgeType struct {
+	Cursor string   `json:"cursor"`
+	Node   UserType `json:"node"`
+}
+
+// A page of Users
+type UserConnectionType struct {
+	Edges    []UserEdgeType `json:"edges"`
+	PageInfo PageInfoType   `json:"pageInfo"`
+}
+
+// A Redweet in a connection, with the cursor that points at it
+type RedweetEdgeType struct {
+	Cursor string      `json:"cursor"`
+	Node   RedweetType `json:"node"`
+}
+
+// A page of Redweets
+type RedweetConnectionType struct {
+	Edges    []RedweetEdgeType `json:"edges"`
+	PageInfo PageInfoType      `json:"pageInfo"`
+}
+
+// A Dweet or Redweet in a connection, with the cursor that points at it
+type FeedObjectEdgeType struct {
+	Cursor string      `json:"cursor"`
+	Node   interface{} `json:"node"`
+}
+
+// A page of Dweets and Redweets
+type FeedObjectConnectionType struct {
+	Edges    []FeedObjectEdgeType `json:"edges"`
+	PageInfo PageInfoType         `json:"pageInfo"`
+}
+
+// GraphQL schema for page info
+var PageInfoSchema = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name: "PageInfo",
+		Fields: graphql.Fields{
+			"hasNextPage": &graphql.Field{
+				Type: graphql.Boolean,
+			},
+			"hasPreviousPage": &graphql.Field{
+				Type: graphql.Boolean,
+			},
+			"startCursor": &graphql.Field{
+				Type: graphql.String,
+			},
+			"endCursor": &graphql.Field{
+				Type: graphql.String,
+			},
+		},
+	},
+)
+
+// Create the GraphQL schemas for an edge and a connection of a type
+func newConnectionSchema(name string, nodeType graphql.Output) *graphql.Object {
+	edge := graphql.NewObject(
+		graphql.ObjectConfig{
+			Name: name + "Edge",
+			Fields: graphql.Fields{
+				"cursor": &graphql.Field{
+					Type: graphql.String,
+				},
+				"node": &graphql.Field{
+					Type: nodeType,
+				},
+			},
+		},
+	)
+
+	return graphql.NewObject(
+		graphql.ObjectConfig{
+			Name: name + "Connection",
+			Fields: graphql.Fields{
+				"edges": &graphql.Field{
+					Type: graphql.NewList(edge),
+				},
+				"pageInfo": &graphql.Field{
+					Type: PageInfoSchema,
+				},
+			},
+		},
+	)
+}
+
+// GraphQL schema for a page of dweets
+var DweetConnectionSchema = newConnectionSchema("Dweet", DweetSchema)
+
+// GraphQL schema for a page of users
+var UserConnectionSchema = newConnectionSchema("User", UserSchema)
+
+// GraphQL schema for a page of redweets
+var RedweetConnectionSchema = newConnectionSchema("Redweet", RedweetSchema)
+
+// GraphQL schema for a page of dweets and redweets
+var FeedObjectConnectionSchema = newConnectionSchema("FeedObject", FeedObjectSchema)
@@ -85,6 +85,96 @@ type RedweetType struct {
 	RedweetTime       time.Time      `json:"redweetTime"`
 }
 
+// A Session object describing a logged in device
+type SessionInfoType struct {
+	ID        string    `json:"id"`
+	Device    string    `json:"device"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"userAgent"`
+	CreatedAt time.Time `json:"createdAt"`
+	Expires   time.Time `json:"expires"`
+	Current   bool      `json:"current"`
+}
+
+// A TwoFactorSetup object with the secret to add to an authenticator app
+type TwoFactorSetupType struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioningURI"`
+}
+
+// An Identity object describing an external account linked to a user
+type IdentityType struct {
+	Provider  string    `json:"provider"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// An APIToken object describing a personal access token
+type APITokenType struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	Token      string     `json:"token"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+}
+
+// A Report object describing a dweet or user someone reported
+type ReportType struct {
+	ID         string     `json:"id"`
+	Reporter   string     `json:"reporter"`
+	TargetType string     `json:"targetType"`
+	TargetID   string     `json:"targetID"`
+	Reason     string     `json:"reason"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	Resolved   bool       `json:"resolved"`
+	ResolvedBy string     `json:"resolvedBy"`
+	ResolvedAt *time.Time `json:"resolvedAt"`
+}
+
+// An AuditLogEntry object describing a privileged action
+type AuditLogEntryType struct {
+	Actor      string    `json:"actor"`
+	Action     string    `json:"action"`
+	TargetType string    `json:"targetType"`
+	TargetID   string    `json:"targetID"`
+	Details    string    `json:"details"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// An Instance object describing a running API server and its websocket clients
+type InstanceType struct {
+	ID            string    `json:"id"`
+	Connections   int       `json:"connections"`
+	Subscriptions int       `json:"subscriptions"`
+	HeartbeatAt   time.Time `json:"heartbeatAt"`
+}
+
+// A Notification object telling a user that someone did something
+type NotificationType struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	Actor     string    `json:"actor"`
+	DweetID   string    `json:"dweetID"`
+	Read      bool      `json:"read"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// A NotificationPreference object describing how a user wants to be notified about an event
+type NotificationPreferenceType struct {
+	Event string `json:"event"`
+	Email bool   `json:"email"`
+	InApp bool   `json:"inApp"`
+}
+
+// A DweetUpdate object carrying the latest version of a dweet, or telling that it was deleted
+type DweetUpdateType struct {
+	ID      string     `json:"id"`
+	Deleted bool       `json:"deleted"`
+	Dweet   *DweetType `json:"dweet"`
+}
+
 // GraphQL schema for basic user
 var BasicUserSchema = graphql.NewObject(
 	graphql.ObjectConfig{
@@ -139,19 +229,24 @@ var UserSchema = graphql.NewObject(
 				Type: graphql.String,
 			},
 			"dweets": &graphql.Field{
-				Type: graphql.NewList(BasicDweetSchema),
+				Type:              graphql.NewList(BasicDweetSchema),
+				DeprecationReason: "Use dweetsConnection",
 			},
 			"redweets": &graphql.Field{
-				Type: graphql.NewList(RedweetSchema),
+				Type:              graphql.NewList(RedweetSchema),
+				DeprecationReason: "Use redweetsConnection",
 			},
 			"redweetedDweets": &graphql.Field{
-				Type: graphql.NewList(BasicDweetSchema),
+				Type:              graphql.NewList(BasicDweetSchema),
+				DeprecationReason: "Use redweetedDweetsConnection",
 			},
 			"feedObjects": &graphql.Field{
-				Type: graphql.NewList(BasicFeedObjectSchema),
+				Type:              graphql.NewList(BasicFeedObjectSchema),
+				DeprecationReason: "Use feedObjectsConnection",
 			},
 			"likedDweets": &graphql.Field{
-				Type: graphql.NewList(BasicDweetSchema),
+				Type:              graphql.NewList(BasicDweetSchema),
+				DeprecationReason: "Use likedDweetsConnection",
 			},
 			"followerCount": &graphql.Field{
 				Type: graphql.Int,
@@ -259,7 +354,8 @@ var DweetSchema = graphql.NewObject(
 				Type: graphql.Int,
 			},
 			"replyDweets": &graphql.Field{
-				Type: graphql.NewList(BasicDweetSchema),
+				Type:              graphql.NewList(BasicDweetSchema),
+				DeprecationReason: "Use replyDweetsConnection",
 			},
 			"redweetCount": &graphql.Field{
 				Type: graphql.Int,
@@ -298,6 +394,254 @@ var RedweetSchema = graphql.NewObject(
 	},
 )
 
+// GraphQL schema for session
+var SessionInfoSchema = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name: "Session",
+		Fields: graphql.Fields{
+			"id": &graphql.Field{
+				Type: graphql.String,
+			},
+			"device": &graphql.Field{
+				Type: graphql.String,
+			},
+			"ip": &graphql.Field{
+				Type: graphql.String,
+			},
+			"userAgent": &graphql.Field{
+				Type: graphql.String,
+			},
+			"createdAt": &graphql.Field{
+				Type: graphql.DateTime,
+			},
+			"expires": &graphql.Field{
+				Type: graphql.DateTime,
+			},
+			"current": &graphql.Field{
+				Type: graphql.Boolean,
+			},
+		},
+	},
+)
+
+// GraphQL schema for two-factor setup
+var TwoFactorSetupSchema = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name: "TwoFactorSetup",
+		Fields: graphql.Fields{
+			"secret": &graphql.Field{
+				Type: graphql.String,
+			},
+			"provisioningURI": &graphql.Field{
+				Type: graphql.String,
+			},
+		},
+	},
+)
+
+// GraphQL schema for personal access token
+var APITokenSchema = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name: "APIToken",
+		Fields: graphql.Fields{
+			"id": &graphql.Field{
+				Type: graphql.String,
+			},
+			"name": &graphql.Field{
+				Type: graphql.String,
+			},
+			"scopes": &graphql.Field{
+				Type: graphql.NewList(graphql.String),
+			},
+			"token": &graphql.Field{
+				Type:        graphql.String,
+				Description: "The token itself, only sent back when it is created",
+			},
+			"createdAt": &graphql.Field{
+				Type: graphql.DateTime,
+			},
+			"lastUsedAt": &graphql.Field{
+				Type: graphql.DateTime,
+			},
+			"expiresAt": &graphql.Field{
+				Type: graphql.DateTime,
+			},
+		},
+	},
+)
+
+// GraphQL schema for report
+var ReportSchema = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name: "Report",
+		Fields: graphql.Fields{
+			"id": &graphql.Field{
+				Type: graphql.String,
+			},
+			"reporter": &graphql.Field{
+				Type: graphql.String,
+			},
+			"targetType": &graphql.Field{
+				Type:        graphql.String,
+				Description: "Either dweet or user",
+			},
+			"targetID": &graphql.Field{
+				Type: graphql.String,
+			},
+			"reason": &graphql.Field{
+				Type: graphql.String,
+			},
+			"createdAt": &graphql.Field{
+				Type: graphql.DateTime,
+			},
+			"resolved": &graphql.Field{
+				Type: graphql.Boolean,
+			},
+			"resolvedBy": &graphql.Field{
+				Type: graphql.String,
+			},
+			"resolvedAt": &graphql.Field{
+				Type: graphql.DateTime,
+			},
+		},
+	},
+)
+
+// GraphQL schema for audit log entry
+var AuditLogEntrySchema = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name: "AuditLogEntry",
+		Fields: graphql.Fields{
+			"actor": &graphql.Field{
+				Type: graphql.String,
+			},
+			"action": &graphql.Field{
+				Type: graphql.String,
+			},
+			"targetType": &graphql.Field{
+				Type: graphql.String,
+			},
+			"targetID": &graphql.Field{
+				Type: graphql.String,
+			},
+			"details": &graphql.Field{
+				Type: graphql.String,
+			},
+			"createdAt": &graphql.Field{
+				Type: graphql.DateTime,
+			},
+		},
+	},
+)
+
+// GraphQL schema for instance
+var InstanceSchema = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name: "Instance",
+		Fields: graphql.Fields{
+			"id": &graphql.Field{
+				Type: graphql.String,
+			},
+			"connections": &graphql.Field{
+				Type:        graphql.Int,
+				Description: "Websocket connections with live subscriptions",
+			},
+			"subscriptions": &graphql.Field{
+				Type: graphql.Int,
+			},
+			"heartbeatAt": &graphql.Field{
+				Type: graphql.DateTime,
+			},
+		},
+	},
+)
+
+// GraphQL schema for notification
+var NotificationSchema = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name: "Notification",
+		Fields: graphql.Fields{
+			"id": &graphql.Field{
+				Type: graphql.String,
+			},
+			"type": &graphql.Field{
+				Type:        graphql.String,
+				Description: "One of like, reply, redweet, follow, mention, newDweet or newRedweet",
+			},
+			"actor": &graphql.Field{
+				Type:        graphql.String,
+				Description: "Username of who did what the notification is about",
+			},
+			"dweetID": &graphql.Field{
+				Type:        graphql.String,
+				Description: "The dweet the notification is about, empty for follows",
+			},
+			"read": &graphql.Field{
+				Type: graphql.Boolean,
+			},
+			"createdAt": &graphql.Field{
+				Type: graphql.DateTime,
+			},
+		},
+	},
+)
+
+// GraphQL schema for notification preference
+var NotificationPreferenceSchema = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name: "NotificationPreference",
+		Fields: graphql.Fields{
+			"event": &graphql.Field{
+				Type:        graphql.String,
+				Description: "One of reply, like, redweet, follow, mention or subscribedPost",
+			},
+			"email": &graphql.Field{
+				Type: graphql.Boolean,
+			},
+			"inApp": &graphql.Field{
+				Type: graphql.Boolean,
+			},
+		},
+	},
+)
+
+// GraphQL schema for dweet update
+var DweetUpdateSchema = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name: "DweetUpdate",
+		Fields: graphql.Fields{
+			"id": &graphql.Field{
+				Type: graphql.String,
+			},
+			"deleted": &graphql.Field{
+				Type: graphql.Boolean,
+			},
+			"dweet": &graphql.Field{
+				Type:        DweetSchema,
+				Description: "The dweet as it is now, or null if it was deleted",
+			},
+		},
+	},
+)
+
+// GraphQL schema for linked identity
+var IdentitySchema = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name: "Identity",
+		Fields: graphql.Fields{
+			"provider": &graphql.Field{
+				Type: graphql.String,
+			},
+			"email": &graphql.Field{
+				Type: graphql.String,
+			},
+			"createdAt": &graphql.Field{
+				Type: graphql.DateTime,
+			},
+		},
+	},
+)
+
 // A GraphQL union type for objects that may appear on a feed. i.e. Dweets and Redweets
 var FeedObjectSchema = graphql.NewUnion(graphql.UnionConfig{
 	Name:        "FeedObject",
@@ -0,0 +1,231 @@
+package subscriptions
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/soumitradev/Dwitter/backend/common"
+	"github.com/soumitradev/Dwitter/backend/jobs"
+	"github.com/soumitradev/Dwitter/backend/mailer"
+	"github.com/soumitradev/Dwitter/backend/prisma/db"
+)
+
+// How often a user can get notification emails
+const (
+	DigestOff    = "off"
+	DigestHourly = "hourly"
+	DigestDaily  = "daily"
+	// Events that would go in a digest aren't emailed at all, what the unsubscribe link in a digest picks
+	DigestNone = "none"
+)
+
+// A digestItem is an event waiting to be sent in a digest
+type digestItem struct {
+	Type      string    `json:"type"`
+	Author    string    `json:"author"`
+	DweetID   string    `json:"dweetID"`
+	DweetBody string    `json:"dweetBody"`
+	At        time.Time `json:"at"`
+}
+
+// Sorted set of users with a digest waiting, scored by when it should be sent
+const digestScheduleKey = "digest:schedule"
+
+// Key that stores the events waiting in the digest of a user
+func digestItemsKey(username string) string {
+	return "digest:items:" + username
+}
+
+// Key that stores the events of a digest being sent. They are only deleted once the email is queued,
+// so a digest that fails to send is sent with the next one instead of being lost.
+func digestSendingKey(username string) string {
+	return "digest:sending:" + username
+}
+
+// Move the waiting events of a digest after the ones still being sent, and return all of them
+var claimDigestScript = redis.NewScript(`
+local items = redis.call("LRANGE", KEYS[1], 0, -1)
+if #items > 0 then
+	redis.call("RPUSH", KEYS[2], unpack(items))
+	redis.call("DEL", KEYS[1])
+end
+redis.call("LTRIM", KEYS[2], -tonumber(ARGV[1]), -1)
+return redis.call("LRANGE", KEYS[2], 0, -1)
+`)
+
+// Only the newest events are kept, a digest longer than this wouldn't be read anyway
+const maxDigestItems = 200
+
+// How often to look for digests that are due
+var digestSweepInterval = time.Minute
+
+// How long to wait before sending a digest that failed again
+var digestRetryDelay = time.Minute * 10
+
+// Check if a digest frequency is one users can pick
+func IsDigestFrequency(frequency string) bool {
+	return frequency == DigestOff || frequency == DigestHourly || frequency == DigestDaily || frequency == DigestNone
+}
+
+// When a digest started now should be sent. Hourly digests go out on the hour, daily ones at midnight UTC.
+func nextDigestTime(frequency string, now time.Time) time.Time {
+	if frequency == DigestDaily {
+		return now.UTC().Truncate(time.Hour * 24).Add(time.Hour * 24)
+	}
+	return now.UTC().Truncate(time.Hour).Add(time.Hour)
+}
+
+// Move a digest that is waiting to be sent to when it's due with a new frequency.
+// If digests were turned off or emails stopped, it's sent or dropped right away.
+func RescheduleDigest(username string, frequency string) error {
+	at := time.Now().UTC()
+	if frequency == DigestHourly || frequency == DigestDaily {
+		at = nextDigestTime(frequency, at)
+	}
+	// Users without a digest waiting aren't added to the schedule
+	return common.RedisDB.ZAddXX(common.BaseCtx, digestScheduleKey, &redis.Z{
+		Score:  float64(at.Unix()),
+		Member: username,
+	}).Err()
+}
+
+// Collect an event into the digest of a user instead of emailing it right away
+func AddToDigest(recipient db.UserModel, notificationType string, actor string, dweet *db.DweetModel) error {
+	if recipient.EmailDigest == DigestNone {
+		return nil
+	}
+
+	item := digestItem{
+		Type:   notificationType,
+		Author: actor,
+		At:     time.Now().UTC(),
+	}
+	if dweet != nil {
+		item.DweetID = dweet.ID
+		item.DweetBody = dweet.DweetBody
+	}
+	raw, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+
+	key := digestItemsKey(recipient.Username)
+	_, err = common.RedisDB.TxPipelined(common.BaseCtx, func(pipe redis.Pipeliner) error {
+		pipe.RPush(common.BaseCtx, key, raw)
+		pipe.LTrim(common.BaseCtx, key, -maxDigestItems, -1)
+		// Only the first event of a digest schedules it
+		pipe.ZAddNX(common.BaseCtx, digestScheduleKey, &redis.Z{
+			Score:  float64(nextDigestTime(recipient.EmailDigest, item.At).Unix()),
+			Member: recipient.Username,
+		})
+		return nil
+	})
+	return err
+}
+
+// Send the digests that are due, every minute
+func SendDigests() {
+	for {
+		due, err := common.RedisDB.ZRangeByScore(common.BaseCtx, digestScheduleKey, &redis.ZRangeBy{
+			Min: "-inf",
+			Max: strconv.FormatInt(time.Now().Unix(), 10),
+		}).Result()
+		if err != nil {
+			fmt.Printf("Error reading digest schedule: %v\n", err)
+		}
+
+		for _, username := range due {
+			// Only the server that manages to remove the user from the schedule sends their digest
+			removed, err := common.RedisDB.ZRem(common.BaseCtx, digestScheduleKey, username).Result()
+			if err != nil || removed == 0 {
+				continue
+			}
+
+			err = sendDigest(username)
+			if err != nil {
+				fmt.Printf("Error sending digest: %v\n", err)
+				// The events are kept, so try again later
+				err = common.RedisDB.ZAddNX(common.BaseCtx, digestScheduleKey, &redis.Z{
+					Score:  float64(time.Now().Add(digestRetryDelay).Unix()),
+					Member: username,
+				}).Err()
+				if err != nil {
+					fmt.Printf("Error rescheduling digest: %v\n", err)
+				}
+			}
+		}
+		time.Sleep(digestSweepInterval)
+	}
+}
+
+// Render the events waiting for a user into one email, grouped by author, and queue it.
+// The events are only deleted once the email is queued.
+func sendDigest(username string) error {
+	sendingKey := digestSendingKey(username)
+	items, err := claimDigestScript.Run(common.BaseCtx, common.RedisDB, []string{digestItemsKey(username), sendingKey}, maxDigestItems).StringSlice()
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		return nil
+	}
+
+	user, err := common.Client.User.FindUnique(
+		db.User.Username.Equals(username),
+	).Exec(common.BaseCtx)
+	if err == db.ErrNotFound || (err == nil && user.EmailDigest == DigestNone) {
+		// The account is gone or unsubscribed from digests, and so is its digest
+		return common.RedisDB.Del(common.BaseCtx, sendingKey).Err()
+	}
+	if err != nil {
+		return err
+	}
+
+	groups := []mailer.DigestGroup{}
+	groupIndex := map[string]int{}
+	for _, raw := range items {
+		var item digestItem
+		err = json.Unmarshal([]byte(raw), &item)
+		if err != nil {
+			continue
+		}
+
+		index, ok := groupIndex[item.Author]
+		if !ok {
+			index = len(groups)
+			groupIndex[item.Author] = index
+			groups = append(groups, mailer.DigestGroup{
+				Author:    item.Author,
+				AuthorURL: appURL + "/user/" + item.Author,
+			})
+		}
+		groups[index].Items = append(groups[index].Items, mailer.DigestItem{
+			Type:      item.Type,
+			DweetBody: item.DweetBody,
+			DweetURL:  appURL + "/dweet/" + item.DweetID,
+		})
+	}
+
+	data := mailer.TemplateData{
+		Digest:         groups,
+		UnsubscribeURL: UnsubscribeURL(user.Username, TargetDigest, ""),
+	}
+	message, err := mailer.Render("digest", user.Language, data)
+	if err != nil {
+		return err
+	}
+	message.To = user.Email
+	message.Headers = map[string]string{
+		"List-Unsubscribe":      "<" + data.UnsubscribeURL + ">",
+		"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+	}
+
+	err = jobs.Enqueue("email", "", message)
+	if err != nil {
+		return err
+	}
+	return common.RedisDB.Del(common.BaseCtx, sendingKey).Err()
+}
@@ -0,0 +1,141 @@
+package subscriptions
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/soumitradev/Dwitter/backend/common"
+	"github.com/soumitradev/Dwitter/backend/prisma/db"
+	"github.com/soumitradev/Dwitter/backend/schema"
+)
+
+// Events users can pick how to be notified about
+const (
+	EventReply          = "reply"
+	EventLike           = "like"
+	EventRedweet        = "redweet"
+	EventFollow         = "follow"
+	EventMention        = "mention"
+	EventSubscribedPost = "subscribedPost"
+)
+
+// Every event, in the order preferences are listed in
+var Events = []string{EventReply, EventLike, EventRedweet, EventFollow, EventMention, EventSubscribedPost}
+
+// A Preference is how a user wants to be notified about an event. Turning both channels off mutes the event.
+type Preference struct {
+	Email bool
+	InApp bool
+}
+
+// What users get before they change anything. Only events that used to send emails still do.
+var defaultPreferences = map[string]Preference{
+	EventReply:          {Email: true, InApp: true},
+	EventLike:           {Email: false, InApp: true},
+	EventRedweet:        {Email: false, InApp: true},
+	EventFollow:         {Email: false, InApp: true},
+	EventMention:        {Email: false, InApp: true},
+	EventSubscribedPost: {Email: true, InApp: true},
+}
+
+// Check if an event is one users can pick preferences for
+func IsEvent(event string) bool {
+	_, ok := defaultPreferences[event]
+	return ok
+}
+
+// Get how some users want to be notified about an event
+func PreferencesFor(usernames []string, event string) (map[string]Preference, error) {
+	preferences := map[string]Preference{}
+	for _, username := range usernames {
+		preferences[username] = defaultPreferences[event]
+	}
+	if len(usernames) == 0 {
+		return preferences, nil
+	}
+
+	stored, err := common.Client.NotificationPreference.FindMany(
+		db.NotificationPreference.UserID.In(usernames),
+		db.NotificationPreference.Event.Equals(event),
+	).Exec(common.BaseCtx)
+	if err != nil {
+		return nil, err
+	}
+	for _, preference := range stored {
+		preferences[preference.UserID] = Preference{Email: preference.Email, InApp: preference.InApp}
+	}
+	return preferences, nil
+}
+
+// Get how a user wants to be notified about every event
+func GetPreferences(username string) ([]schema.NotificationPreferenceType, error) {
+	stored, err := common.Client.NotificationPreference.FindMany(
+		db.NotificationPreference.UserID.Equals(username),
+	).Exec(common.BaseCtx)
+	if err != nil {
+		return nil, fmt.Errorf("internal server error: %v", err)
+	}
+
+	preferences := map[string]Preference{}
+	for _, preference := range stored {
+		preferences[preference.Event] = Preference{Email: preference.Email, InApp: preference.InApp}
+	}
+
+	formatted := []schema.NotificationPreferenceType{}
+	for _, event := range Events {
+		preference, ok := preferences[event]
+		if !ok {
+			preference = defaultPreferences[event]
+		}
+		formatted = append(formatted, schema.NotificationPreferenceType{
+			Event: event,
+			Email: preference.Email,
+			InApp: preference.InApp,
+		})
+	}
+	return formatted, nil
+}
+
+// Set how a user wants to be notified about an event
+func SetPreference(username string, event string, email bool, inApp bool) (schema.NotificationPreferenceType, error) {
+	if !IsEvent(event) {
+		return schema.NotificationPreferenceType{}, errors.New("invalid request: unknown event")
+	}
+
+	// Upsert in one query, so that setting a preference twice at once doesn't try to create it twice
+	_, err := common.Client.NotificationPreference.UpsertOne(
+		db.NotificationPreference.UserIDEvent(
+			db.NotificationPreference.UserID.Equals(username),
+			db.NotificationPreference.Event.Equals(event),
+		),
+	).Create(
+		db.NotificationPreference.User.Link(
+			db.User.Username.Equals(username),
+		),
+		db.NotificationPreference.Event.Set(event),
+		db.NotificationPreference.Email.Set(email),
+		db.NotificationPreference.InApp.Set(inApp),
+	).Update(
+		db.NotificationPreference.Email.Set(email),
+		db.NotificationPreference.InApp.Set(inApp),
+	).Exec(common.BaseCtx)
+	if err != nil {
+		return schema.NotificationPreferenceType{}, fmt.Errorf("internal server error: %v", err)
+	}
+
+	return schema.NotificationPreferenceType{
+		Event: event,
+		Email: email,
+		InApp: inApp,
+	}, nil
+}
+
+// Stop emails about an event, keeping in-app notifications as they were
+func muteEmails(username string, event string) error {
+	preferences, err := PreferencesFor([]string{username}, event)
+	if err != nil {
+		return err
+	}
+	_, err = SetPreference(username, event, false, preferences[username].InApp)
+	return err
+}
@@ -1,49 +1,59 @@
 package subscriptions
 
 import (
-	"fmt"
-	"os"
+	"encoding/json"
 
-	"github.com/sendgrid/sendgrid-go/helpers/mail"
-	"github.com/soumitradev/Dwitter/backend/common"
+	"github.com/soumitradev/Dwitter/backend/jobs"
+	"github.com/soumitradev/Dwitter/backend/mailer"
 	"github.com/soumitradev/Dwitter/backend/prisma/db"
 )
 
-// TODO: Make the email look better
+func init() {
+	jobs.Register("email", sendEmailJob)
+}
+
+// Send a plain text email
 func SendEmail(title string, body string, recipient string) error {
-	from := mail.NewEmail("Dwitter", os.Getenv("SENDGRID_SENDER_EMAIL_ADDR"))
-	to := mail.NewEmail("Recipient", recipient)
-	message := mail.NewSingleEmail(from, title, to, body, body)
-	_, err := common.SendgridClient.Send(message)
-	return err
+	return mailer.Send(mailer.Message{
+		To:      recipient,
+		Subject: title,
+		Text:    body,
+	})
 }
 
-func NotifyDweetSubscribers(event string, dweet db.DweetModel, subscribers []string) error {
-	for _, subscriber := range subscribers {
-		err := SendEmail("New reply to dweet on dwitter", fmt.Sprintf("The dweet with ID %s that you subscribed to has a new reply!", dweet.ID), subscriber)
-		if err != nil {
-			return err
-		}
+// Email jobs carry the rendered message, so that retries send the same email
+func sendEmailJob(payload json.RawMessage) error {
+	var message mailer.Message
+	err := json.Unmarshal(payload, &message)
+	if err != nil {
+		return err
 	}
-	return nil
+	return mailer.Send(message)
 }
 
-func NotifyUserSubscribersDweet(event string, dweet db.DweetModel, subscribers []string) error {
-	for _, subscriber := range subscribers {
-		err := SendEmail("New dweet by user on dwitter", fmt.Sprintf("The user %s that you subscribed to has a new dweet!", dweet.AuthorID), subscriber)
-		if err != nil {
-			return err
-		}
+// Queue a notification email to a user, rendered in their language.
+// The unsubscribe link stops emails about the target, which is a dweet, a user or an event.
+// The key makes sure the user only gets one email about the same thing.
+func EmailNotification(key string, template string, recipient db.UserModel, actor string, dweet *db.DweetModel, targetType string, targetID string) error {
+	data := mailer.TemplateData{
+		Author:         actor,
+		AuthorURL:      appURL + "/user/" + actor,
+		UnsubscribeURL: UnsubscribeURL(recipient.Username, targetType, targetID),
+	}
+	if dweet != nil {
+		data.DweetBody = dweet.DweetBody
+		data.DweetURL = appURL + "/dweet/" + dweet.ID
 	}
-	return nil
-}
 
-func NotifyUserSubscribersRedweet(event string, redweet db.RedweetModel, subscribers []string) error {
-	for _, subscriber := range subscribers {
-		err := SendEmail("New redweet by user on dwitter", fmt.Sprintf("The user %s that you subscribed to has a new redweet!", redweet.AuthorID), subscriber)
-		if err != nil {
-			return err
-		}
+	message, err := mailer.Render(template, recipient.Language, data)
+	if err != nil {
+		return err
+	}
+	message.To = recipient.Email
+	message.Headers = map[string]string{
+		"List-Unsubscribe":      "<" + data.UnsubscribeURL + ">",
+		"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
 	}
-	return nil
+
+	return jobs.Enqueue("email", key+":"+recipient.Username, message)
 }
@@ -0,0 +1,173 @@
+package subscriptions
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/soumitradev/Dwitter/backend/common"
+	"github.com/soumitradev/Dwitter/backend/prisma/db"
+)
+
+// What an unsubscribe link can unsubscribe from
+const (
+	TargetDweet = "dweet"
+	TargetUser  = "user"
+	TargetEvent = "event"
+	// Digest emails, without changing how each event is notified
+	TargetDigest = "digest"
+)
+
+// Secret that unsubscribe links are signed with
+var unsubscribeSecret []byte
+
+// Address of the site, which links in emails point to
+var appURL string
+
+// How long an unsubscribe link works after the email with it is sent
+var unsubscribeLinkTTL = time.Hour * 24 * 90
+
+// Read UNSUBSCRIBE_SECRET and APP_URL.
+// Links are signed with the secret, so the server doesn't start without one.
+func Init() {
+	secret := os.Getenv("UNSUBSCRIBE_SECRET")
+	if secret == "" {
+		panic(errors.New("UNSUBSCRIBE_SECRET is not set"))
+	}
+	unsubscribeSecret = []byte(secret)
+
+	appURL = strings.TrimSuffix(os.Getenv("APP_URL"), "/")
+	if appURL == "" {
+		appURL = "http://localhost:5000"
+	}
+}
+
+// Address of the site, which links in emails point to
+func AppURL() string {
+	return appURL
+}
+
+func sign(payload string) []byte {
+	mac := hmac.New(sha256.New, unsubscribeSecret)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// Sign who is unsubscribing from what, and when the link was made
+func unsubscribeToken(username string, targetType string, targetID string, issuedAt time.Time) string {
+	payload := username + "\x00" + targetType + "\x00" + targetID + "\x00" + strconv.FormatInt(issuedAt.Unix(), 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." + base64.RawURLEncoding.EncodeToString(sign(payload))
+}
+
+// Link that stops the emails a user gets about a dweet, a user or an event, without logging in.
+// It names the user instead of their email, so it stays theirs if the email changes.
+func UnsubscribeURL(username string, targetType string, targetID string) string {
+	return appURL + "/api/unsubscribe/" + unsubscribeToken(username, targetType, targetID, time.Now().UTC())
+}
+
+// Check the signature and age of an unsubscribe token, and read who is unsubscribing from what
+func parseUnsubscribeToken(token string) (username string, targetType string, targetID string, ok bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return "", "", "", false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", "", "", false
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(signature, sign(string(payload))) {
+		return "", "", "", false
+	}
+
+	fields := strings.Split(string(payload), "\x00")
+	if len(fields) != 4 {
+		return "", "", "", false
+	}
+	issuedAt, err := strconv.ParseInt(fields[3], 10, 64)
+	if err != nil {
+		return "", "", "", false
+	}
+	age := time.Since(time.Unix(issuedAt, 0))
+	if age < 0 || age > unsubscribeLinkTTL {
+		return "", "", "", false
+	}
+	return fields[0], fields[1], fields[2], true
+}
+
+// Stop a user's emails about a dweet, a user or a type of event.
+// Unsubscribing from a dweet or a user also stops in-app notifications about it, since the subscription is gone.
+func Unsubscribe(username string, targetType string, targetID string) error {
+	var err error
+	switch targetType {
+	case TargetDweet:
+		_, err = common.Client.Dweet.FindUnique(
+			db.Dweet.ID.Equals(targetID),
+		).Update(
+			db.Dweet.Subscribers.Unlink(
+				db.User.Username.Equals(username),
+			),
+		).Exec(common.BaseCtx)
+	case TargetUser:
+		_, err = common.Client.User.FindUnique(
+			db.User.Username.Equals(targetID),
+		).Update(
+			db.User.Subscribers.Unlink(
+				db.User.Username.Equals(username),
+			),
+		).Exec(common.BaseCtx)
+	case TargetEvent:
+		if !IsEvent(targetID) {
+			return fmt.Errorf("cannot unsubscribe from %s", targetID)
+		}
+		err = muteEmails(username, targetID)
+	case TargetDigest:
+		// Only stop the digest, so that the preferences for each event stay as they were
+		_, err = common.Client.User.FindUnique(
+			db.User.Username.Equals(username),
+		).Update(
+			db.User.EmailDigest.Set(DigestNone),
+		).Exec(common.BaseCtx)
+	default:
+		err = fmt.Errorf("cannot unsubscribe from %s", targetType)
+	}
+	return err
+}
+
+// Unsubscribe a user from an unsubscribe link. Tests replace it, so that they don't need a database.
+var unsubscribeUser = Unsubscribe
+
+// Show a page that asks to confirm unsubscribing on GET, and unsubscribe on POST.
+// Mail clients that support one-click unsubscribe POST to the link directly.
+func UnsubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	username, targetType, targetID, ok := parseUnsubscribeToken(mux.Vars(r)["token"])
+	if !ok {
+		common.WriteLinkResponse(w, http.StatusNotFound, "This unsubscribe link is invalid or has expired")
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		common.WriteConfirmPage(w, "Stop getting these emails?", "Unsubscribe")
+		return
+	}
+
+	err := unsubscribeUser(username, targetType, targetID)
+	if err == db.ErrNotFound {
+		// The account, or the dweet or user it was subscribed to, was deleted
+		common.WriteLinkResponse(w, http.StatusNotFound, "There is nothing to unsubscribe from anymore.")
+		return
+	}
+	if err != nil {
+		common.WriteLinkResponse(w, http.StatusInternalServerError, fmt.Sprintf("internal server error: %v", err))
+		return
+	}
+	common.WriteLinkResponse(w, http.StatusOK, "You have been unsubscribed.")
+}
@@ -0,0 +1,180 @@
+package subscriptions
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/soumitradev/Dwitter/backend/prisma/db"
+)
+
+func setupUnsubscribe(t *testing.T) {
+	oldSecret, oldURL, oldUnsubscribe := unsubscribeSecret, appURL, unsubscribeUser
+	unsubscribeSecret = []byte("test secret")
+	appURL = "https://dwitter.example.com"
+	t.Cleanup(func() {
+		unsubscribeSecret, appURL, unsubscribeUser = oldSecret, oldURL, oldUnsubscribe
+	})
+}
+
+// Get the token out of an unsubscribe link
+func tokenFromURL(t *testing.T, link string) string {
+	prefix := "https://dwitter.example.com/api/unsubscribe/"
+	if !strings.HasPrefix(link, prefix) {
+		t.Fatalf("unsubscribe link %s doesn't start with %s", link, prefix)
+	}
+	return strings.TrimPrefix(link, prefix)
+}
+
+func TestUnsubscribeToken(t *testing.T) {
+	setupUnsubscribe(t)
+
+	tests := []struct {
+		username   string
+		targetType string
+		targetID   string
+	}{
+		{"someone", TargetDweet, "abcdefghij"},
+		{"someone", TargetUser, "other"},
+		{"someone", TargetEvent, EventReply},
+		{"someone", TargetDigest, ""},
+	}
+
+	for _, test := range tests {
+		token := tokenFromURL(t, UnsubscribeURL(test.username, test.targetType, test.targetID))
+		username, targetType, targetID, ok := parseUnsubscribeToken(token)
+		if !ok || username != test.username || targetType != test.targetType || targetID != test.targetID {
+			t.Errorf("parseUnsubscribeToken(UnsubscribeURL(%q, %q, %q)) = %q, %q, %q, %v", test.username, test.targetType, test.targetID, username, targetType, targetID, ok)
+		}
+	}
+}
+
+func TestUnsubscribeTokenAge(t *testing.T) {
+	setupUnsubscribe(t)
+
+	tests := []struct {
+		name     string
+		issuedAt time.Time
+		want     bool
+	}{
+		{"new", time.Now(), true},
+		{"almost expired", time.Now().Add(-unsubscribeLinkTTL + time.Hour), true},
+		{"expired", time.Now().Add(-unsubscribeLinkTTL - time.Hour), false},
+		{"issued in the future", time.Now().Add(time.Hour), false},
+	}
+	for _, test := range tests {
+		token := unsubscribeToken("someone", TargetDweet, "abcdefghij", test.issuedAt)
+		if _, _, _, ok := parseUnsubscribeToken(token); ok != test.want {
+			t.Errorf("%s: parseUnsubscribeToken() accepted = %v, want %v", test.name, ok, test.want)
+		}
+	}
+}
+
+func TestUnsubscribeTokenTampered(t *testing.T) {
+	setupUnsubscribe(t)
+
+	token := tokenFromURL(t, UnsubscribeURL("someone", TargetUser, "other"))
+	parts := strings.Split(token, ".")
+	other := tokenFromURL(t, UnsubscribeURL("another", TargetUser, "other"))
+	otherParts := strings.Split(other, ".")
+
+	tests := map[string]string{
+		"empty":                     "",
+		"no signature":              parts[0],
+		"empty signature":           parts[0] + ".",
+		"signature of another link": parts[0] + "." + otherParts[1],
+		"extra part":                token + ".x",
+		"not base64":                "!!!." + parts[1],
+	}
+	for name, tampered := range tests {
+		if _, _, _, ok := parseUnsubscribeToken(tampered); ok {
+			t.Errorf("%s: parseUnsubscribeToken(%q) accepted the token", name, tampered)
+		}
+	}
+
+	// Links signed with another secret don't work
+	unsubscribeSecret = []byte("another secret")
+	if _, _, _, ok := parseUnsubscribeToken(token); ok {
+		t.Error("parseUnsubscribeToken() accepted a token signed with another secret")
+	}
+}
+
+// Send a request to the unsubscribe handler the way the router does
+func serveUnsubscribe(method string, token string) *httptest.ResponseRecorder {
+	router := mux.NewRouter()
+	router.HandleFunc("/api/unsubscribe/{token}", UnsubscribeHandler).Methods("GET", "POST")
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(method, "/api/unsubscribe/"+token, nil))
+	return recorder
+}
+
+func TestUnsubscribeHandlerConfirmsOnGet(t *testing.T) {
+	setupUnsubscribe(t)
+	calls := 0
+	unsubscribeUser = func(username string, targetType string, targetID string) error {
+		calls++
+		return nil
+	}
+
+	token := tokenFromURL(t, UnsubscribeURL("someone", TargetDweet, "abcdefghij"))
+	response := serveUnsubscribe("GET", token)
+
+	if response.Code != http.StatusOK {
+		t.Errorf("GET status = %d, want %d", response.Code, http.StatusOK)
+	}
+	if !strings.Contains(response.Body.String(), `<form method="POST">`) {
+		t.Errorf("GET didn't send back a confirmation form: %s", response.Body.String())
+	}
+	if calls != 0 {
+		t.Error("GET unsubscribed without confirming")
+	}
+}
+
+func TestUnsubscribeHandlerUnsubscribesOnPost(t *testing.T) {
+	setupUnsubscribe(t)
+	var got []string
+	unsubscribeUser = func(username string, targetType string, targetID string) error {
+		got = []string{username, targetType, targetID}
+		return nil
+	}
+
+	token := tokenFromURL(t, UnsubscribeURL("someone", TargetDweet, "abcdefghij"))
+	response := serveUnsubscribe("POST", token)
+
+	if response.Code != http.StatusOK {
+		t.Errorf("POST status = %d, want %d", response.Code, http.StatusOK)
+	}
+	if strings.Join(got, " ") != "someone dweet abcdefghij" {
+		t.Errorf("POST unsubscribed %q, want someone from dweet abcdefghij", got)
+	}
+}
+
+func TestUnsubscribeHandlerErrors(t *testing.T) {
+	setupUnsubscribe(t)
+	unsubscribeUser = func(username string, targetType string, targetID string) error {
+		return errors.New("database is down")
+	}
+
+	token := tokenFromURL(t, UnsubscribeURL("someone", TargetDweet, "abcdefghij"))
+	if response := serveUnsubscribe("POST", token); response.Code != http.StatusInternalServerError {
+		t.Errorf("POST with a failing database status = %d, want %d", response.Code, http.StatusInternalServerError)
+	}
+
+	unsubscribeUser = func(username string, targetType string, targetID string) error {
+		return db.ErrNotFound
+	}
+	if response := serveUnsubscribe("POST", token); response.Code != http.StatusNotFound {
+		t.Errorf("POST for a deleted dweet status = %d, want %d", response.Code, http.StatusNotFound)
+	}
+
+	for _, method := range []string{"GET", "POST"} {
+		if response := serveUnsubscribe(method, "not-a-token"); response.Code != http.StatusNotFound {
+			t.Errorf("%s with an invalid token status = %d, want %d", method, response.Code, http.StatusNotFound)
+		}
+	}
+}
@@ -5,6 +5,7 @@ package util
 import (
 	crypto_rand "crypto/rand"
 	"encoding/binary"
+	"math/big"
 	math_rand "math/rand"
 	"reflect"
 
@@ -35,6 +36,20 @@ func GenID(n int) string {
 	return string(b)
 }
 
+// Make a random string of length n using a cryptographically secure source, for secrets like tokens
+func GenSecureID(n int) string {
+	b := make([]byte, n)
+	limit := big.NewInt(int64(len(AlphanumBytes)))
+	for i := range b {
+		index, err := crypto_rand.Int(crypto_rand.Reader, limit)
+		if err != nil {
+			panic("cannot read from cryptographically secure random number generator")
+		}
+		b[i] = AlphanumBytes[index.Int64()]
+	}
+	return string(b)
+}
+
 // Make a random string of length 5n - 1 with hyphens every 4 letters
 // e.g. GenToken(5) will return a string of format aaaa-bbbb-cccc-dddd-eeee
 func GenToken(n int) string {
@@ -20,10 +20,12 @@ const cache = new InMemoryCache()
 // Use auth
 const authLink = setContext((_, { headers }) => {
   const token = localStorage.getItem('token');
+  const csrfToken = document.cookie.split('; ').find(c => c.startsWith('csrf_token='));
   return {
     headers: {
       ...headers,
       authorization: token ? `Bearer ${token}` : "",
+      'X-CSRF-Token': csrfToken ? csrfToken.split('=')[1] : "",
     }
   }
 });
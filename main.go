@@ -20,8 +20,12 @@ import (
 	"github.com/soumitradev/Dwitter/backend/cdn"
 	"github.com/soumitradev/Dwitter/backend/common"
 	"github.com/soumitradev/Dwitter/backend/database"
+	"github.com/soumitradev/Dwitter/backend/events"
 	"github.com/soumitradev/Dwitter/backend/gql"
+	"github.com/soumitradev/Dwitter/backend/jobs"
+	"github.com/soumitradev/Dwitter/backend/mailer"
 	"github.com/soumitradev/Dwitter/backend/middleware"
+	"github.com/soumitradev/Dwitter/backend/subscriptions"
 	"github.com/soumitradev/Dwitter/frontend"
 	"github.com/unrolled/secure"
 )
@@ -36,12 +40,35 @@ func main() {
 		log.Fatal("Error loading .env file: ", err)
 	}
 
-	// Initialize sendgrid
-	common.InitSendgrid()
+	// Connect to the Redis that sessions, jobs, events and digests are kept in
+	common.InitRedis()
+
+	// Pick how emails are sent
+	mailer.Init()
+
+	// Read settings for links in notification emails
+	subscriptions.Init()
+
+	// Start working on the job queue
+	jobs.StartWorkers()
+	go subscriptions.SendDigests()
+
+	// Share events with the other servers, and push changes to live subscriptions as they are written
+	events.Init()
+	go events.Dispatch()
+	go events.Heartbeat(gql.SubscriptionCounts)
+
+	// Initialize password hashing settings
+	common.InitPasswordHashing()
 
 	// Initialize redis dbs
 	auth.InitAuth()
+	auth.InitCSRF()
+	auth.InitOAuth()
+	go auth.SweepUnverifiedAccounts()
 	cache.InitCache()
+	go database.SweepDeletedAccounts()
+	go cdn.SweepUnusedMedia()
 
 	// Check for an error in schema at runtime
 	if gql.SchemaError != nil {
@@ -79,21 +106,34 @@ func main() {
 			}
 
 			return map[string]interface{}{
-				"sid": sid,
+				"sid":            sid,
+				"apiToken":       auth.BearerToken(r),
+				"ip":             auth.ClientIP(r),
+				"responseWriter": middleware.ResponseWriterFromContext(r.Context()),
 			}
 		},
 	})
 
 	// Map /graphql to the graphql handler, and attach a middleware to it
-	router.Handle("/api/graphql", h)
+	router.Handle("/api/graphql", middleware.ResponseWriterHandler(middleware.CSRFHandler(h)))
 
 	// Handle some API endpoints using a non-GraphQL solution
 	router.HandleFunc("/api/login", auth.LoginHandler).Methods("POST")
+	router.HandleFunc("/api/login/2fa", auth.TwoFactorLoginHandler).Methods("POST")
+	router.HandleFunc("/api/logout", auth.LogoutHandler).Methods("POST")
+	router.HandleFunc("/api/password_reset", auth.PasswordResetRequestHandler).Methods("POST")
+	router.HandleFunc("/api/password_reset/confirm", auth.PasswordResetHandler).Methods("POST")
+	router.HandleFunc("/api/verify/resend", auth.ResendVerificationHandler).Methods("POST")
 	router.HandleFunc("/api/verify/{token}", auth.VerifyHandler).Methods("GET")
+	router.HandleFunc("/api/email_change/undo/{token}", auth.EmailChangeUndoHandler).Methods("GET", "POST")
+	router.HandleFunc("/api/email_change/{token}", auth.EmailChangeHandler).Methods("GET", "POST")
+	router.HandleFunc("/api/unsubscribe/{token}", subscriptions.UnsubscribeHandler).Methods("GET", "POST")
 	router.HandleFunc("/api/media_upload", cdn.UploadMediaHandler).Methods("POST")
 	router.HandleFunc("/api/pfp_upload", cdn.UploadPFPHandler).Methods("POST")
-	router.HandleFunc("/api/callback", auth.OAuth2callbackHandler)
-	router.Handle("/api/subscriptions", common.GraphqlwsHandler)
+	router.HandleFunc("/api/oauth/providers", auth.OAuth2ProvidersHandler).Methods("GET")
+	router.HandleFunc("/api/oauth/{provider}/login", auth.OAuth2LoginHandler).Methods("GET")
+	router.HandleFunc("/api/oauth/{provider}/callback", auth.OAuth2CallbackHandler).Methods("GET")
+	router.Handle("/api/subscriptions", middleware.WebsocketOriginHandler(common.GraphqlwsHandler))
 
 	// Handle frontend
 	frontend := frontend.FrontendHandler{StaticPath: "frontend/dist", IndexPath: "index.html"}
@@ -110,12 +150,11 @@ func main() {
 	router.Use(middleware.RecoveryHandler)
 	router.Use(middleware.SizeAndTimeHandler)
 	router.Use(secureMiddleware.Handler)
-	// CORS Handler. TODO: Make sure to turn on/off in production!
-	router.Use(middleware.CORSTestingHandler)
 
 	// Create an HTTP server
 	srv := &http.Server{
-		Handler: router,
+		// CORS is handled before routing, so that preflights to POST-only routes are answered instead of getting a 405
+		Handler: middleware.CORSHandler(router),
 		Addr:    "127.0.0.1:5000",
 		// Good practice: enforce timeouts for servers you create!
 		WriteTimeout: 15 * time.Second,
@@ -0,0 +1,10 @@
+-- Accounts made with Discord before passwordSet existed were given a random password nobody knows.
+-- Mark them as having no password so that unlinking Discord can't lock them out,
+-- and store provider names in lowercase like the names providers are configured with.
+DO $$
+BEGIN
+	IF EXISTS (SELECT 1 FROM information_schema.tables WHERE table_schema = 'public' AND table_name = 'User') THEN
+		ALTER TABLE "User" ADD COLUMN IF NOT EXISTS "passwordSet" BOOLEAN NOT NULL DEFAULT true;
+		UPDATE "User" SET "passwordSet" = false, "oauthProvider" = lower("oauthProvider") WHERE "oauthProvider" <> 'None';
+	END IF;
+END $$;
@@ -0,0 +1,9 @@
+-- API tokens are revoked when the token version of their owner changes.
+-- Tokens made before they stored one get their owner's current version, so that they keep working.
+DO $$
+BEGIN
+	IF EXISTS (SELECT 1 FROM information_schema.tables WHERE table_schema = 'public' AND table_name = 'APIToken') THEN
+		ALTER TABLE "APIToken" ADD COLUMN IF NOT EXISTS "tokenVersion" INTEGER NOT NULL DEFAULT 0;
+		UPDATE "APIToken" SET "tokenVersion" = "User"."tokenVersion" FROM "User" WHERE "User".username = "APIToken"."ownerID";
+	END IF;
+END $$;
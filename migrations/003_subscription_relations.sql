@@ -0,0 +1,43 @@
+-- Subscriptions used to be lists of subscriber emails on "Dweet" and "User", and are now relations between users.
+-- Move every email that belongs to a user into the tables prisma keeps the relations in, then drop the old lists.
+-- In "_DweetSubscriptions", "A" is the dweet and "B" the subscriber.
+-- In "_Subscriptions", "A" is the subscriber and "B" the user they subscribed to.
+-- Emails of deleted accounts have nobody to move to, and are dropped with the lists.
+DO $$
+BEGIN
+	IF EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema = 'public' AND table_name = 'Dweet' AND column_name = 'subscribers' AND data_type = 'ARRAY') THEN
+		CREATE TABLE IF NOT EXISTS "_DweetSubscriptions" (
+			"A" TEXT NOT NULL REFERENCES "Dweet"("dbID") ON DELETE CASCADE ON UPDATE CASCADE,
+			"B" TEXT NOT NULL REFERENCES "User"("dbID") ON DELETE CASCADE ON UPDATE CASCADE
+		);
+		CREATE UNIQUE INDEX IF NOT EXISTS "_DweetSubscriptions_AB_unique" ON "_DweetSubscriptions"("A", "B");
+		CREATE INDEX IF NOT EXISTS "_DweetSubscriptions_B_index" ON "_DweetSubscriptions"("B");
+
+		INSERT INTO "_DweetSubscriptions" ("A", "B")
+		SELECT DISTINCT "Dweet"."dbID", "User"."dbID"
+		FROM "Dweet"
+		CROSS JOIN LATERAL unnest("Dweet".subscribers) AS subscriber(email)
+		JOIN "User" ON "User".email = subscriber.email
+		ON CONFLICT DO NOTHING;
+
+		ALTER TABLE "Dweet" DROP COLUMN subscribers;
+	END IF;
+
+	IF EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema = 'public' AND table_name = 'User' AND column_name = 'subscribers' AND data_type = 'ARRAY') THEN
+		CREATE TABLE IF NOT EXISTS "_Subscriptions" (
+			"A" TEXT NOT NULL REFERENCES "User"("dbID") ON DELETE CASCADE ON UPDATE CASCADE,
+			"B" TEXT NOT NULL REFERENCES "User"("dbID") ON DELETE CASCADE ON UPDATE CASCADE
+		);
+		CREATE UNIQUE INDEX IF NOT EXISTS "_Subscriptions_AB_unique" ON "_Subscriptions"("A", "B");
+		CREATE INDEX IF NOT EXISTS "_Subscriptions_B_index" ON "_Subscriptions"("B");
+
+		INSERT INTO "_Subscriptions" ("A", "B")
+		SELECT DISTINCT subscriberUser."dbID", "User"."dbID"
+		FROM "User"
+		CROSS JOIN LATERAL unnest("User".subscribers) AS subscriber(email)
+		JOIN "User" AS subscriberUser ON subscriberUser.email = subscriber.email
+		ON CONFLICT DO NOTHING;
+
+		ALTER TABLE "User" DROP COLUMN subscribers;
+	END IF;
+END $$;